@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"os"
 
 	"github.com/codex-k8s/codexctl/internal/cli"
@@ -11,6 +12,13 @@ import (
 func main() {
 	logger := logging.NewLogger(os.Stderr, logging.LevelInfo)
 	if err := cli.Execute(os.Args[1:], logger); err != nil {
+		var exitErr *cli.ExitError
+		if errors.As(err, &exitErr) {
+			if exitErr.Err != nil {
+				logger.Error("command failed", "error", exitErr.Err)
+			}
+			os.Exit(exitErr.Code)
+		}
 		logger.Error("command failed", "error", err)
 		os.Exit(1)
 	}
@@ -2,6 +2,9 @@ package cli
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"strings"
 	"time"
@@ -12,15 +15,20 @@ import (
 	"github.com/codex-k8s/codexctl/internal/engine"
 	"github.com/codex-k8s/codexctl/internal/hooks"
 	"github.com/codex-k8s/codexctl/internal/kube"
+	"github.com/codex-k8s/codexctl/internal/state"
 )
 
 // newApplyCommand creates the "apply" subcommand that renders and applies manifests to a cluster.
 func newApplyCommand(opts *Options) *cobra.Command {
 	var (
-		onlyServices string
-		skipServices string
-		onlyInfra    string
-		skipInfra    string
+		onlyServices   string
+		skipServices   string
+		onlyInfra      string
+		skipInfra      string
+		withDeps       bool
+		prune          bool
+		pruneDryRun    bool
+		forceConflicts bool
 	)
 	cmd := &cobra.Command{
 		Use:   "apply",
@@ -52,8 +60,38 @@ func newApplyCommand(opts *Options) *cobra.Command {
 				SkipInfra:    parseNameSet(skipInfra),
 				OnlyServices: parseNameSet(onlyServices),
 				SkipServices: parseNameSet(skipServices),
+				WithDeps:     withDeps,
 			}
-			return applyStack(ctx, logger, stackCfg, ctxData, opts.Env, envCfg, preflight, wait, false, renderOpts)
+			kubeClient, err := envKubeClient(opts, envCfg, ctxData, false)
+			if err != nil {
+				return err
+			}
+			if err := applyStack(ctx, logger, applyStackParams{
+				kubeClient:     kubeClient,
+				stackCfg:       stackCfg,
+				ctxData:        ctxData,
+				envName:        opts.Env,
+				envCfg:         envCfg,
+				preflight:      preflight,
+				wait:           wait,
+				renderOpts:     renderOpts,
+				prune:          prune,
+				pruneDryRun:    pruneDryRun,
+				forceConflicts: forceConflicts,
+				out:            cmd.OutOrStdout(),
+			}); err != nil {
+				return err
+			}
+
+			// Applying to a slot counts as activity for "manage-env gc --idle".
+			if slot > 0 {
+				if store, err := newStateStore(opts, stackCfg, ctxData, kubeClient, logger, false); err != nil {
+					logger.Debug("state store unavailable; slot activity not recorded", "slot", slot, "error", err)
+				} else {
+					touchSlotActivity(ctx, logger, store, slot, state.PhaseReady)
+				}
+			}
+			return nil
 		},
 	}
 
@@ -62,6 +100,9 @@ func newApplyCommand(opts *Options) *cobra.Command {
 	cmd.Flags().Bool("wait", false, "Wait for core deployments to become ready")
 	cmd.Flags().Bool("preflight", false, "Run preflight checks before applying manifests")
 	addRenderFilterFlags(cmd, &onlyServices, &skipServices, &onlyInfra, &skipInfra, "Apply", "Skip")
+	addWithDepsFlag(cmd, &withDeps)
+	addPruneFlags(cmd, &prune, &pruneDryRun)
+	addForceConflictsFlag(cmd, &forceConflicts)
 	addVarsFlags(cmd)
 	cmd.Flags().Int("slot", 0, "Slot number for slot-based environments (e.g. ai)")
 	_ = cmd.MarkFlagRequired("env")
@@ -69,35 +110,78 @@ func newApplyCommand(opts *Options) *cobra.Command {
 	return cmd
 }
 
+// applyStackParams describes a single stack apply.
+type applyStackParams struct {
+	// kubeClient is the Kubernetes orchestrator used for apply, hooks, prune and wait.
+	kubeClient kube.Orchestrator
+	// stackCfg is the loaded stack configuration.
+	stackCfg *config.StackConfig
+	// ctxData is the template context used for rendering.
+	ctxData config.TemplateContext
+	// envName is the target environment name.
+	envName string
+	// envCfg is the resolved environment configuration.
+	envCfg config.Environment
+	// preflight runs preflight checks before apply.
+	preflight bool
+	// wait waits for deployments to become Available after apply.
+	wait bool
+	// renderOpts filters infra blocks and services.
+	renderOpts engine.RenderOptions
+	// prune deletes labelled objects of the selected components that are no longer rendered.
+	prune bool
+	// pruneDryRun lists objects prune would delete without deleting them.
+	pruneDryRun bool
+	// forceConflicts takes over fields owned by other managers when envCfg enables server-side apply.
+	forceConflicts bool
+	// out receives the prune dry-run listing.
+	out io.Writer
+}
+
 // applyStack runs the core apply logic shared between the "apply" command and
 // higher-level helpers such as "ci ensure-ready".
-func applyStack(
-	ctx context.Context,
-	logger *slog.Logger,
-	stackCfg *config.StackConfig,
-	ctxData config.TemplateContext,
-	envName string,
-	envCfg config.Environment,
-	preflight bool,
-	wait bool,
-	machineOutput bool,
-	renderOpts engine.RenderOptions,
-) error {
-	kubeClient := kube.NewClient()
-	kubeClient.StdoutToStderr = machineOutput
+func applyStack(ctx context.Context, logger *slog.Logger, params applyStackParams) error {
+	stackCfg := params.stackCfg
+	ctxData := params.ctxData
+	envName := params.envName
+	renderOpts := params.renderOpts
+
+	kubeClient := params.kubeClient
+	applyOpts := kube.ApplyOptions{
+		ServerSide:     params.envCfg.UsesServerSideApply(),
+		ForceConflicts: params.forceConflicts,
+	}
+	if params.forceConflicts && !applyOpts.ServerSide {
+		logger.Warn("--force-conflicts has no effect without serverSideApply in the environment", "env", envName)
+	}
 
 	// Ensure target namespace exists before running hooks or applying manifests.
 	if ns := strings.TrimSpace(ctxData.Namespace); ns != "" {
 		nsCtx, cancelNS := context.WithTimeout(ctx, 2*time.Minute)
 		defer cancelNS()
-		if err := kubeClient.RunRaw(nsCtx, nil, "get", "ns", ns); err != nil {
-			logger.Info("creating namespace before apply", "env", envName, "namespace", ns)
-			_ = kubeClient.RunRaw(nsCtx, nil, "create", "ns", ns)
+		created, err := kubeClient.EnsureNamespace(nsCtx, ns)
+		if err != nil {
+			return err
+		}
+		if created {
+			logger.Info("created namespace before apply", "env", envName, "namespace", ns)
 		}
 	}
 
 	eng := engine.NewEngine()
-	manifests, err := eng.RenderStackWithOptions(stackCfg, ctxData, renderOpts)
+	graph, err := config.BuildDependencyGraph(stackCfg)
+	if err != nil {
+		return err
+	}
+	var (
+		manifests []byte
+		plan      *engine.Plan
+	)
+	if graph.HasEdges() {
+		plan, err = eng.RenderPlan(stackCfg, ctxData, renderOpts)
+	} else {
+		manifests, err = eng.RenderStackWithOptions(stackCfg, ctxData, renderOpts)
+	}
 	if err != nil {
 		return err
 	}
@@ -110,80 +194,84 @@ func applyStack(
 		KubeClient: kubeClient,
 	}
 
-	if preflight {
+	if params.preflight {
 		logger.Info("running preflight checks before apply", "env", envName)
-		if err := hookExec.RunPreflightBasic(ctx); err != nil {
+		if err := hookExec.RunPreflightBasic(ctx, hookCtx); err != nil {
 			return err
 		}
-		if err := runDoctorChecks(ctx, logger, doctorParams{stackCfg: stackCfg, envName: envName}); err != nil {
+		if err := runDoctorChecks(ctx, logger, doctorParams{stackCfg: stackCfg, envName: envName, kubeClient: kubeClient}); err != nil {
 			return err
 		}
 	}
 
-	// Stack-level and infrastructure/service hooks before apply.
+	// Stack-level hooks before apply.
 	if err := hookExec.RunSteps(ctx, stackCfg.Hooks.BeforeAll, hookCtx); err != nil {
 		return err
 	}
-	stageCtx := hookStageContext{stackCfg: stackCfg, ctxData: ctxData, hookCtx: hookCtx}
-	beforeStage := hookStage{infra: infraBeforeApply, services: serviceBeforeApply}
-	if err := runHookStage(ctx, hookExec, stageCtx, beforeStage); err != nil {
-		return err
-	}
 
-	logger.Info("applying manifests", "env", envName, "namespace", ctxData.Namespace)
+	if plan != nil {
+		waveParams := waveApplyParams{
+			kubeClient:  kubeClient,
+			applyOpts:   applyOpts,
+			hookExec:    hookExec,
+			hookCtx:     hookCtx,
+			namespace:   ctxData.Namespace,
+			waitTimeout: resolveDeployWaitTimeout(stackCfg, "", false),
+		}
+		logger.Info("applying manifests in dependency waves", "env", envName, "namespace", ctxData.Namespace, "waves", len(plan.Waves))
+		if err := applyPlanWaves(ctx, logger, plan, waveParams); err != nil {
+			return err
+		}
+	} else {
+		// Infrastructure/service hooks before apply.
+		stageCtx := hookStageContext{stackCfg: stackCfg, ctxData: ctxData, hookCtx: hookCtx}
+		beforeStage := hookStage{infra: infraBeforeApply, services: serviceBeforeApply}
+		if err := runHookStage(ctx, hookExec, stageCtx, beforeStage); err != nil {
+			return err
+		}
 
-	applyOnce := func(ctx context.Context) error {
-		return kubeClient.Apply(ctx, manifests)
-	}
+		logger.Info("applying manifests", "env", envName, "namespace", ctxData.Namespace)
+		if err := applyWithAdmissionRetry(ctx, logger, kubeClient, manifests, applyOpts); err != nil {
+			return err
+		}
 
-	err = applyOnce(ctx)
-	if err != nil {
-		msg := err.Error()
-		// Ingress-nginx admission webhook might not be ready yet; do a bounded retry loop.
-		if strings.Contains(msg, "validate.nginx.ingress.kubernetes.io") ||
-			strings.Contains(msg, "ingress-nginx-controller-admission") {
-			const maxRetries = 18
-			for attempt := 1; attempt <= maxRetries; attempt++ {
-				logger.Warn("apply failed due to ingress-nginx admission webhook; retrying", "attempt", attempt, "max", maxRetries, "error", err)
-				select {
-				case <-ctx.Done():
-					return err
-				case <-time.After(10 * time.Second):
-				}
-				err = applyOnce(ctx)
-				if err == nil {
-					break
-				}
-				msg = err.Error()
-				if !strings.Contains(msg, "validate.nginx.ingress.kubernetes.io") &&
-					!strings.Contains(msg, "ingress-nginx-controller-admission") {
-					return err
-				}
-			}
-			if err != nil {
-				return err
-			}
-		} else {
+		// Infrastructure/service hooks after apply.
+		afterStage := hookStage{infra: infraAfterApply, services: serviceAfterApply}
+		if err := runHookStage(ctx, hookExec, stageCtx, afterStage); err != nil {
 			return err
 		}
 	}
 
-	// Infrastructure/service hooks and stack-level hooks after apply.
-	afterStage := hookStage{infra: infraAfterApply, services: serviceAfterApply}
-	if err := runHookStage(ctx, hookExec, stageCtx, afterStage); err != nil {
-		return err
-	}
+	// Stack-level hooks after apply.
 	if err := hookExec.RunSteps(ctx, stackCfg.Hooks.AfterAll, hookCtx); err != nil {
 		return err
 	}
 
-	if wait {
+	if params.prune || params.pruneDryRun {
+		rendered := manifests
+		if plan != nil {
+			rendered = plan.Manifests()
+		}
+		pruneOpts := pruneParams{
+			kubeClient: kubeClient,
+			stackCfg:   stackCfg,
+			ctxData:    ctxData,
+			renderOpts: renderOpts,
+			rendered:   rendered,
+			dryRun:     params.pruneDryRun,
+			out:        params.out,
+		}
+		if err := pruneStack(ctx, logger, pruneOpts); err != nil {
+			return err
+		}
+	}
+
+	if params.wait {
 		if ctxData.Namespace == "" {
 			logger.Info("skip wait: namespace is empty, resources may be cluster-scoped or namespaced explicitly in manifests")
 		} else {
 			waitTimeout := resolveDeployWaitTimeout(stackCfg, "", false)
-			logger.Info("waiting for deployments to become Available", "namespace", ctxData.Namespace, "timeout", waitTimeout)
-			if err := kubeClient.WaitForDeployments(ctx, ctxData.Namespace, waitTimeout); err != nil {
+			if _, err := waitForRollout(ctx, logger, kubeClient, ctxData.Namespace, waitTimeout); err != nil {
 				return err
 			}
 		}
@@ -191,3 +279,42 @@ func applyStack(
 
 	return nil
 }
+
+// applyWithAdmissionRetry applies manifests and retries for a bounded time while an admission
+// webhook (typically ingress-nginx) is not ready yet. Server-side apply conflicts are not retried.
+func applyWithAdmissionRetry(ctx context.Context, logger *slog.Logger, kubeClient kube.Applier, manifests []byte, applyOpts kube.ApplyOptions) error {
+	applyOnce := func(ctx context.Context) error {
+		err := kubeClient.Apply(ctx, manifests, applyOpts)
+		var conflict *kube.ConflictError
+		if errors.As(err, &conflict) {
+			for _, c := range conflict.Conflicts {
+				logger.Error("field is owned by another manager", "object", conflict.Object, "field", c.Field, "manager", c.Manager)
+			}
+			return fmt.Errorf("%w (re-run with --force-conflicts to take ownership)", err)
+		}
+		return err
+	}
+
+	err := applyOnce(ctx)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, kube.ErrWebhookUnavailable) {
+		return err
+	}
+
+	const maxRetries = 18
+	for attempt := 1; attempt <= maxRetries; attempt++ {
+		logger.Warn("apply failed because an admission webhook is unavailable; retrying", "attempt", attempt, "max", maxRetries, "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(10 * time.Second):
+		}
+		err = applyOnce(ctx)
+		if err == nil || !errors.Is(err, kube.ErrWebhookUnavailable) {
+			return err
+		}
+	}
+	return err
+}
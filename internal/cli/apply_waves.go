@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/codex-k8s/codexctl/internal/engine"
+	"github.com/codex-k8s/codexctl/internal/hooks"
+	"github.com/codex-k8s/codexctl/internal/kube"
+)
+
+// waveApplyParams groups dependencies used when applying a plan wave by wave.
+type waveApplyParams struct {
+	// kubeClient applies manifests and waits for workloads.
+	kubeClient kube.Orchestrator
+	// applyOpts selects client-side or server-side apply.
+	applyOpts kube.ApplyOptions
+	// hookExec runs per-node hooks.
+	hookExec *hooks.Executor
+	// hookCtx is the runtime hook execution context.
+	hookCtx hooks.StepContext
+	// namespace is used for workloads without an explicit namespace.
+	namespace string
+	// waitTimeout is the readiness timeout for every workload.
+	waitTimeout string
+}
+
+// applyPlanWaves applies plan waves in order. Nodes inside a wave run in parallel; the next wave
+// starts only after every node of the current one is applied and its workloads are ready.
+func applyPlanWaves(ctx context.Context, logger *slog.Logger, plan *engine.Plan, params waveApplyParams) error {
+	for i, wave := range plan.Waves {
+		names := make([]string, 0, len(wave))
+		for _, node := range wave {
+			names = append(names, node.Key.String())
+		}
+		logger.Info("applying dependency wave", "wave", i+1, "total", len(plan.Waves), "nodes", strings.Join(names, ","))
+
+		waveCtx, cancel := context.WithCancel(ctx)
+		errs := make([]error, len(wave))
+		var wg sync.WaitGroup
+		for j, node := range wave {
+			wg.Add(1)
+			go func(j int, node engine.PlanNode) {
+				defer wg.Done()
+				if err := applyPlanNode(waveCtx, logger, node, params); err != nil {
+					errs[j] = fmt.Errorf("%s: %w", node.Key, err)
+					cancel()
+				}
+			}(j, node)
+		}
+		wg.Wait()
+		cancel()
+
+		if err := errors.Join(errs...); err != nil {
+			return fmt.Errorf("apply wave %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// applyPlanNode runs before-apply hooks, applies node manifests, waits for its workloads
+// and runs after-apply hooks.
+func applyPlanNode(ctx context.Context, logger *slog.Logger, node engine.PlanNode, params waveApplyParams) error {
+	if err := params.hookExec.RunSteps(ctx, node.Hooks.BeforeApply, params.hookCtx); err != nil {
+		return err
+	}
+
+	if len(node.Manifests) > 0 {
+		logger.Info("applying manifests", "node", node.Key.String())
+		if err := applyWithAdmissionRetry(ctx, logger, params.kubeClient, node.Manifests, params.applyOpts); err != nil {
+			return err
+		}
+	}
+
+	for _, w := range node.Workloads {
+		ns := w.Namespace
+		if ns == "" {
+			ns = params.namespace
+		}
+		logger.Info("waiting for workload", "node", node.Key.String(), "kind", w.Kind, "name", w.Name, "namespace", ns, "timeout", params.waitTimeout)
+		if err := params.kubeClient.WaitForWorkload(ctx, w.Kind, w.Name, ns, params.waitTimeout); err != nil {
+			return err
+		}
+	}
+
+	return params.hookExec.RunSteps(ctx, node.Hooks.AfterApply, params.hookCtx)
+}
@@ -14,7 +14,6 @@ import (
 	"github.com/codex-k8s/codexctl/internal/config"
 	"github.com/codex-k8s/codexctl/internal/engine"
 	"github.com/codex-k8s/codexctl/internal/ghoutput"
-	"github.com/codex-k8s/codexctl/internal/kube"
 	"github.com/codex-k8s/codexctl/internal/state"
 )
 
@@ -81,7 +80,8 @@ func newCISyncSourcesCommand(opts *Options) *cobra.Command {
 				return fmt.Errorf("sync-sources requires a resolved namespace")
 			}
 
-			if _, err := config.ResolveEnvironment(stackCfg, envName); err != nil {
+			stackEnv, err := config.ResolveEnvironment(stackCfg, envName)
+			if err != nil {
 				return err
 			}
 
@@ -100,7 +100,10 @@ func newCISyncSourcesCommand(opts *Options) *cobra.Command {
 			}
 			targetPath := filepath.Join(workspaceMount, targetRel)
 
-			kubeClient := kube.NewClient()
+			kubeClient, err := envKubeClient(opts, stackEnv, ctxData, false)
+			if err != nil {
+				return err
+			}
 			if err := syncSources(cmd.Context(), logger, source, syncTarget{
 				Namespace:  ctxData.Namespace,
 				PVCName:    workspacePVC,
@@ -189,6 +192,10 @@ func newCIApplyCommand(opts *Options) *cobra.Command {
 		skipServices   string
 		onlyInfra      string
 		skipInfra      string
+		withDeps       bool
+		prune          bool
+		pruneDryRun    bool
+		forceConflicts bool
 	)
 
 	cmd := &cobra.Command{
@@ -251,6 +258,18 @@ func newCIApplyCommand(opts *Options) *cobra.Command {
 			if !cmd.Flags().Changed("skip-infra") && envPresent("CODEXCTL_SKIP_INFRA") {
 				skipInfra = envVars.SkipInfra
 			}
+			if !cmd.Flags().Changed("with-deps") && envPresent("CODEXCTL_WITH_DEPS") {
+				withDeps = envVars.WithDeps
+			}
+			if !cmd.Flags().Changed("prune") && envPresent("CODEXCTL_PRUNE") {
+				prune = envVars.Prune
+			}
+			if !cmd.Flags().Changed("prune-dry-run") && envPresent("CODEXCTL_PRUNE_DRY_RUN") {
+				pruneDryRun = envVars.PruneDryRun
+			}
+			if !cmd.Flags().Changed("force-conflicts") && envPresent("CODEXCTL_FORCE_CONFLICTS") {
+				forceConflicts = envVars.ForceConflicts
+			}
 
 			stackCfg, ctxData, _, _, err := loadStackConfigFromCmd(opts, cmd, slot)
 			if err != nil {
@@ -276,12 +295,34 @@ func newCIApplyCommand(opts *Options) *cobra.Command {
 				SkipInfra:    parseNameSet(skipInfra),
 				OnlyServices: parseNameSet(onlyServices),
 				SkipServices: parseNameSet(skipServices),
+				WithDeps:     withDeps,
+			}
+
+			kubeClient, err := newKubeClient(opts, kubeClientParams{
+				cluster:        envCfg.Cluster,
+				projectRoot:    ctxData.ProjectRoot,
+				requestTimeout: requestTimeout,
+			})
+			if err != nil {
+				return err
 			}
 
 			var applyErr error
 			for attempt := 1; attempt <= attempts; attempt++ {
 				ctxApply, cancel := context.WithTimeout(cmd.Context(), 10*time.Minute)
-				applyErr = applyStack(ctxApply, logger, stackCfg, ctxData, opts.Env, envCfg, preflight, false, false, renderOpts)
+				applyErr = applyStack(ctxApply, logger, applyStackParams{
+					stackCfg:       stackCfg,
+					ctxData:        ctxData,
+					envName:        opts.Env,
+					envCfg:         envCfg,
+					kubeClient:     kubeClient,
+					preflight:      preflight,
+					renderOpts:     renderOpts,
+					prune:          prune,
+					pruneDryRun:    pruneDryRun,
+					forceConflicts: forceConflicts,
+					out:            cmd.OutOrStdout(),
+				})
 				cancel()
 				if applyErr == nil {
 					break
@@ -313,14 +354,13 @@ func newCIApplyCommand(opts *Options) *cobra.Command {
 				waitDelay = 5 * time.Second
 			}
 
-			client := kube.NewClient()
 			waitTimeoutResolved := resolveDeployWaitTimeout(stackCfg, waitTimeout, cmd.Flags().Changed("wait-timeout") || envPresent("CODEXCTL_WAIT_TIMEOUT"))
 			for attempt := 1; attempt <= waitAttempts; attempt++ {
-				if err := waitForDeployments(cmd.Context(), client, ctxData.Namespace, requestTimeout, waitTimeoutResolved); err != nil {
+				if _, err := waitForRollout(cmd.Context(), logger, kubeClient, ctxData.Namespace, waitTimeoutResolved); err != nil {
 					if attempt == waitAttempts {
 						return err
 					}
-					logger.Warn("kubectl wait failed, retrying", "attempt", attempt, "max", waitAttempts, "delay", waitDelay.String(), "error", err)
+					logger.Warn("wait for rollout failed, retrying", "attempt", attempt, "max", waitAttempts, "delay", waitDelay.String(), "error", err)
 					time.Sleep(waitDelay)
 					waitDelay *= 2
 					continue
@@ -333,14 +373,17 @@ func newCIApplyCommand(opts *Options) *cobra.Command {
 
 	cmd.Flags().IntVar(&slot, "slot", 0, "Slot number for slot-based environments (e.g. ai)")
 	cmd.Flags().BoolVar(&preflight, "preflight", false, "Run preflight checks before apply")
-	cmd.Flags().BoolVar(&wait, "wait", false, "Wait for deployments to become Available")
+	cmd.Flags().BoolVar(&wait, "wait", false, "Wait for Deployments, StatefulSets, DaemonSets and Jobs to become ready")
 	cmd.Flags().IntVar(&applyRetries, "apply-retries", 3, "Number of apply retries")
 	cmd.Flags().IntVar(&waitRetries, "wait-retries", 3, "Number of wait retries")
 	cmd.Flags().DurationVar(&applyBackoff, "apply-backoff", 5*time.Second, "Initial backoff for apply retries")
 	cmd.Flags().DurationVar(&waitBackoff, "wait-backoff", 5*time.Second, "Initial backoff for wait retries")
 	cmd.Flags().StringVar(&waitTimeout, "wait-timeout", defaultDeployWaitTimeout, "kubectl wait timeout")
-	cmd.Flags().DurationVar(&requestTimeout, "request-timeout", 600*time.Second, "kubectl request-timeout")
+	cmd.Flags().DurationVar(&requestTimeout, "request-timeout", 600*time.Second, "Timeout for a single Kubernetes API request")
 	addRenderFilterFlags(cmd, &onlyServices, &skipServices, &onlyInfra, &skipInfra, "Apply", "Skip")
+	addWithDepsFlag(cmd, &withDeps)
+	addPruneFlags(cmd, &prune, &pruneDryRun)
+	addForceConflictsFlag(cmd, &forceConflicts)
 	addVarsFlags(cmd)
 
 	return cmd
@@ -391,9 +434,11 @@ func newCIEnsureSlotCommand(opts *Options) *cobra.Command {
 				return err
 			}
 			writeErr := ghoutput.Write(map[string]string{
-				"slot":      strconv.Itoa(res.record.Slot),
-				"namespace": res.record.Namespace,
-				"env":       res.record.Env,
+				"slot":               strconv.Itoa(res.record.Slot),
+				"namespace":          res.record.Namespace,
+				"env":                res.record.Env,
+				"queue_position":     strconv.Itoa(res.queuePosition),
+				"queue_wait_seconds": strconv.Itoa(int(res.queueWait / time.Second)),
 			})
 			if writeErr != nil {
 				return writeErr
@@ -416,17 +461,18 @@ func newCIEnsureSlotCommand(opts *Options) *cobra.Command {
 // newCIEnsureReadyCommand creates "ci ensure-ready" for provisioning envs in CI.
 func newCIEnsureReadyCommand(opts *Options) *cobra.Command {
 	var (
-		issue         int
-		pr            int
-		slot          int
-		maxSlots      int
-		codeRootBase  string
-		source        string
-		prepareImages bool
-		doApply       bool
-		forceApply    bool
-		waitTimeout   string
-		waitSoftFail  bool
+		issue          int
+		pr             int
+		slot           int
+		maxSlots       int
+		codeRootBase   string
+		source         string
+		prepareImages  bool
+		doApply        bool
+		forceApply     bool
+		forceConflicts bool
+		waitTimeout    string
+		waitSoftFail   bool
 	)
 
 	cmd := &cobra.Command{
@@ -465,6 +511,9 @@ func newCIEnsureReadyCommand(opts *Options) *cobra.Command {
 			if !cmd.Flags().Changed("force-apply") && envPresent("CODEXCTL_FORCE_APPLY") {
 				forceApply = envCfg.ForceApply
 			}
+			if !cmd.Flags().Changed("force-conflicts") && envPresent("CODEXCTL_FORCE_CONFLICTS") {
+				forceConflicts = envCfg.ForceConflicts
+			}
 			if !cmd.Flags().Changed("wait-timeout") && envPresent("CODEXCTL_WAIT_TIMEOUT") {
 				waitTimeout = envCfg.WaitTimeout
 			}
@@ -488,6 +537,7 @@ func newCIEnsureReadyCommand(opts *Options) *cobra.Command {
 				prepareImages:  prepareImages,
 				doApply:        doApply,
 				forceApply:     forceApply,
+				forceConflicts: forceConflicts,
 				waitTimeout:    waitTimeout,
 				waitTimeoutSet: cmd.Flags().Changed("wait-timeout") || envPresent("CODEXCTL_WAIT_TIMEOUT"),
 				waitSoftFail:   waitSoftFail,
@@ -495,33 +545,52 @@ func newCIEnsureReadyCommand(opts *Options) *cobra.Command {
 				inlineVars:     inlineVars,
 				varFiles:       varFiles,
 			})
+			rolloutOut, outErr := rolloutOutputs(res.rollout)
+			if outErr != nil {
+				return outErr
+			}
 			if err != nil {
+				// Expose the diagnostics of a failed rollout to later workflow steps.
+				if res.rollout != nil {
+					if writeErr := ghoutput.Write(rolloutOut); writeErr != nil {
+						logger.Warn("failed to write rollout report to GitHub outputs", "error", writeErr)
+					}
+				}
 				return err
 			}
-			newEnv := res.created || res.recreated
+			newEnv := res.created || res.recreated || res.warm
 			infraUnhealthy := strconv.FormatBool(!res.infraReady)
-			writeErr := ghoutput.Write(map[string]string{
+			outputs := map[string]string{
 				"slot":               strconv.Itoa(res.record.Slot),
 				"namespace":          res.record.Namespace,
 				"env":                res.record.Env,
 				"created":            strconv.FormatBool(res.created),
 				"recreated":          strconv.FormatBool(res.recreated),
+				"warm":               strconv.FormatBool(res.warm),
+				"woken":              strconv.FormatBool(res.woken),
 				"infra_ready":        strconv.FormatBool(res.infraReady),
+				"queue_position":     strconv.Itoa(res.queuePosition),
+				"queue_wait_seconds": strconv.Itoa(int(res.queueWait / time.Second)),
 				"codexctl_env_ready": strconv.FormatBool(res.envReady),
 				"infra_unhealthy":    infraUnhealthy,
 				"codexctl_new_env":   strconv.FormatBool(newEnv),
 				"codexctl_run_args":  buildCodexctlRunArgs(res.record, issue, pr, opts.Env),
-			})
-			if writeErr != nil {
+			}
+			for k, v := range rolloutOut {
+				outputs[k] = v
+			}
+			if writeErr := ghoutput.Write(outputs); writeErr != nil {
 				return writeErr
 			}
 			fmt.Printf(
-				"slot: %d\nnamespace: %s\nenv: %s\ncreated: %t\nrecreated: %t\ninfra_ready: %t\ncodexctl_env_ready: %t\ninfra_unhealthy: %s\ncodexctl_new_env: %t\n",
+				"slot: %d\nnamespace: %s\nenv: %s\ncreated: %t\nrecreated: %t\nwarm: %t\nwoken: %t\ninfra_ready: %t\ncodexctl_env_ready: %t\ninfra_unhealthy: %s\ncodexctl_new_env: %t\n",
 				res.record.Slot,
 				res.record.Namespace,
 				res.record.Env,
 				res.created,
 				res.recreated,
+				res.warm,
+				res.woken,
 				res.infraReady,
 				res.envReady,
 				infraUnhealthy,
@@ -540,6 +609,7 @@ func newCIEnsureReadyCommand(opts *Options) *cobra.Command {
 	cmd.Flags().BoolVar(&prepareImages, "prepare-images", false, "Mirror external and build local images before apply")
 	cmd.Flags().BoolVar(&doApply, "apply", false, "Apply manifests for the ensured environment")
 	cmd.Flags().BoolVar(&forceApply, "force-apply", false, "Apply manifests even for existing environments")
+	addForceConflictsFlag(cmd, &forceConflicts)
 	cmd.Flags().StringVar(&waitTimeout, "wait-timeout", defaultDeployWaitTimeout, "kubectl wait timeout for deployments")
 	cmd.Flags().BoolVar(&waitSoftFail, "wait-soft-fail", false, "Do not fail when deployment wait times out")
 	cmd.Flags().String("vars", "", "Additional variables in k=v,k2=v2 format")
@@ -568,26 +638,3 @@ func buildCodexctlRunArgs(rec state.EnvRecord, issue, pr int, envName string) st
 	}
 	return strings.Join(args, " ")
 }
-
-// waitForDeployments runs kubectl wait with a request timeout wrapper.
-func waitForDeployments(ctx context.Context, client *kube.Client, namespace string, requestTimeout time.Duration, waitTimeout string) error {
-	if client == nil {
-		return fmt.Errorf("kubernetes client is nil")
-	}
-	args := []string{"wait", "--for=condition=Available", "deployment", "--all", fmt.Sprintf("--timeout=%s", waitTimeout)}
-	if namespace != "" {
-		args = append(args, "-n", namespace)
-	}
-	if requestTimeout > 0 {
-		args = append(args, fmt.Sprintf("--request-timeout=%s", requestTimeout.String()))
-	}
-	ctxWait := ctx
-	if waitTimeout != "" {
-		if d, err := time.ParseDuration(waitTimeout); err == nil {
-			var cancel context.CancelFunc
-			ctxWait, cancel = context.WithTimeout(ctx, d+time.Minute)
-			defer cancel()
-		}
-	}
-	return client.RunRaw(ctxWait, nil, args...)
-}
@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/codex-k8s/codexctl/internal/config"
+)
+
+// defaultValidateSlot is the sample slot used to render slot-based environments during validation.
+const defaultValidateSlot = 1
+
+// newConfigCommand creates the "config" group command for services.yaml tooling.
+func newConfigCommand(opts *Options) *cobra.Command {
+	return newGroupCommand(
+		"config",
+		"Validate services.yaml and publish its JSON Schema",
+		newConfigValidateCommand(opts),
+		newConfigSchemaCommand(opts),
+	)
+}
+
+// newConfigValidateCommand creates "config validate" that renders every declared environment
+// and checks the result strictly against the services.yaml model.
+func newConfigValidateCommand(opts *Options) *cobra.Command {
+	var (
+		onlyEnv string
+		slot    int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Render services.yaml for every environment and reject unknown or malformed fields",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			logger := LoggerFromContext(cmd.Context())
+
+			inlineVars, varFiles, err := parseInlineVarsAndFiles(cmd)
+			if err != nil {
+				return err
+			}
+
+			envNames := []string{onlyEnv}
+			if onlyEnv == "" {
+				envNames, err = config.DeclaredEnvironments(opts.ConfigPath, config.LoadOptions{
+					Namespace: opts.Namespace,
+					UserVars:  inlineVars,
+					VarFiles:  varFiles,
+				})
+				if err != nil {
+					return err
+				}
+				if len(envNames) == 0 {
+					envNames = []string{""}
+				}
+			}
+
+			total := 0
+			for _, envName := range envNames {
+				loadOpts := config.LoadOptions{
+					Env:       envName,
+					Namespace: opts.Namespace,
+					UserVars:  inlineVars,
+					VarFiles:  varFiles,
+				}
+				if envName == "ai" {
+					loadOpts.Slot = slot
+				}
+
+				issues, err := config.ValidateStack(opts.ConfigPath, loadOpts)
+				if err != nil {
+					return fmt.Errorf("render services.yaml for env %q: %w", envName, err)
+				}
+				for _, issue := range issues {
+					fmt.Fprintf(os.Stderr, "env=%s: %s\n", envName, issue.Error())
+				}
+				total += len(issues)
+				logger.Debug("validated environment", "env", envName, "issues", len(issues))
+			}
+
+			if total > 0 {
+				return fmt.Errorf("services.yaml validation failed: %d issue(s)", total)
+			}
+			logger.Info("services.yaml is valid", "config", opts.ConfigPath, "environments", envNames)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&onlyEnv, "env", "", "Validate only this environment (default: every declared environment)")
+	cmd.Flags().IntVar(&slot, "slot", defaultValidateSlot, "Sample slot used to render the ai environment")
+	addVarsFlags(cmd)
+
+	return cmd
+}
+
+// newConfigSchemaCommand creates "config schema" that prints the services.yaml JSON Schema.
+func newConfigSchemaCommand(_ *Options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "schema",
+		Short: "Print the services.yaml JSON Schema to stdout",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			data, err := json.MarshalIndent(config.JSONSchema(), "", "  ")
+			if err != nil {
+				return fmt.Errorf("encode schema: %w", err)
+			}
+			if _, err := os.Stdout.Write(append(data, '\n')); err != nil {
+				return fmt.Errorf("write schema: %w", err)
+			}
+			return nil
+		},
+	}
+}
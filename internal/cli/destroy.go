@@ -20,6 +20,7 @@ import (
 func destroyStack(
 	ctx context.Context,
 	logger *slog.Logger,
+	kubeClient kube.Orchestrator,
 	stackCfg *config.StackConfig,
 	ctxData config.TemplateContext,
 	envCfg config.Environment,
@@ -37,8 +38,6 @@ func destroyStack(
 		}
 	}
 
-	kubeClient := kube.NewClient()
-
 	hookExec := hooks.NewExecutor(logger)
 	hookCtx := hooks.StepContext{
 		Stack:      stackCfg,
@@ -0,0 +1,355 @@
+package cli
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/codex-k8s/codexctl/internal/config"
+	"github.com/codex-k8s/codexctl/internal/engine"
+	"github.com/codex-k8s/codexctl/internal/kube"
+	"github.com/codex-k8s/codexctl/internal/textdiff"
+)
+
+const (
+	// diffContextLines is the number of unchanged lines shown around each change.
+	diffContextLines = 3
+	// diffExitDifferences is the exit code of diff when the cluster differs from the rendered manifests.
+	diffExitDifferences = 1
+	// diffExitError is the exit code of diff when it fails, so that CI can tell drift from a broken run
+	// (kubectl diff uses the same convention).
+	diffExitError = 2
+)
+
+// normalizedMetadataFields lists server-populated metadata fields ignored by diff.
+var normalizedMetadataFields = []string{
+	"managedFields",
+	"resourceVersion",
+	"uid",
+	"generation",
+	"creationTimestamp",
+	"selfLink",
+}
+
+// normalizedAnnotations lists annotations maintained by kubectl or controllers and ignored by diff.
+var normalizedAnnotations = []string{
+	"kubectl.kubernetes.io/last-applied-configuration",
+	"deployment.kubernetes.io/revision",
+}
+
+// diffReport is the machine-readable result of "codexctl diff".
+type diffReport struct {
+	// Created lists rendered objects missing from the cluster.
+	Created []kube.ObjectRef `json:"created"`
+	// Changed lists objects whose live state differs from the rendered one.
+	Changed []kube.ObjectRef `json:"changed"`
+	// Deleted lists labelled live objects that apply --prune would delete.
+	Deleted []kube.ObjectRef `json:"deleted"`
+}
+
+// total returns the number of differing objects.
+func (r diffReport) total() int {
+	return len(r.Created) + len(r.Changed) + len(r.Deleted)
+}
+
+// newDiffCommand creates the "diff" subcommand that compares rendered manifests with the live cluster.
+func newDiffCommand(opts *Options) *cobra.Command {
+	var (
+		slot         int
+		onlyServices string
+		skipServices string
+		onlyInfra    string
+		skipInfra    string
+		withDeps     bool
+		output       string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Show what apply would change in the cluster; exits 1 when there are changes and 2 on errors",
+		Annotations: map[string]string{
+			errorExitCodeAnnotation: strconv.Itoa(diffExitError),
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			logger := LoggerFromContext(cmd.Context())
+
+			if output != "text" && output != "json" {
+				return fmt.Errorf("unsupported output %q (use text or json)", output)
+			}
+
+			stackCfg, ctxData, _, _, err := loadStackConfigFromCmd(opts, cmd, slot)
+			if err != nil {
+				return err
+			}
+
+			renderOpts := engine.RenderOptions{
+				OnlyInfra:    parseNameSet(onlyInfra),
+				SkipInfra:    parseNameSet(skipInfra),
+				OnlyServices: parseNameSet(onlyServices),
+				SkipServices: parseNameSet(skipServices),
+				WithDeps:     withDeps,
+			}
+			manifests, err := engine.NewEngine().RenderStackWithOptions(stackCfg, ctxData, renderOpts)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), 5*time.Minute)
+			defer cancel()
+
+			envCfg, err := config.ResolveEnvironment(stackCfg, opts.Env)
+			if err != nil {
+				return err
+			}
+			kubeClient, err := envKubeClient(opts, envCfg, ctxData, true)
+			if err != nil {
+				return err
+			}
+
+			applyOpts := kube.ApplyOptions{ServerSide: envCfg.UsesServerSideApply()}
+			report, diffs, err := diffStack(ctx, kubeClient, applyOpts, pruneParams{
+				kubeClient: kubeClient,
+				stackCfg:   stackCfg,
+				ctxData:    ctxData,
+				renderOpts: renderOpts,
+				rendered:   manifests,
+			})
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			if output == "json" {
+				enc := json.NewEncoder(out)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(report); err != nil {
+					return fmt.Errorf("encode diff report: %w", err)
+				}
+			} else {
+				for _, d := range diffs {
+					if _, err := io.WriteString(out, d); err != nil {
+						return fmt.Errorf("write diff: %w", err)
+					}
+				}
+			}
+
+			if n := report.total(); n > 0 {
+				// Differences are an expected outcome reported by the exit code, not an error.
+				cmd.SilenceUsage = true
+				cmd.SilenceErrors = true
+				logger.Info("resources differ from the live cluster", "total", n, "created", len(report.Created), "changed", len(report.Changed), "deleted", len(report.Deleted))
+				return &ExitError{Code: diffExitDifferences}
+			}
+			logger.Info("no differences with the live cluster", "namespace", ctxData.Namespace)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Env, "env", "", "Environment to diff (dev, ai-staging, ai)")
+	cmd.Flags().StringVar(&opts.Namespace, "namespace", "", "Namespace override for resources")
+	cmd.Flags().IntVar(&slot, "slot", 0, "Slot number for slot-based environments (e.g. ai)")
+	cmd.Flags().StringVarP(&output, "output", "o", "text", "Output format: text (unified diff) or json (created/changed/deleted)")
+	addRenderFilterFlags(cmd, &onlyServices, &skipServices, &onlyInfra, &skipInfra, "Diff", "Skip")
+	addWithDepsFlag(cmd, &withDeps)
+	addVarsFlags(cmd)
+	_ = cmd.MarkFlagRequired("env")
+
+	return cmd
+}
+
+// diffStack compares every rendered object with its live counterpart and lists labelled live
+// objects that are no longer rendered. Desired state comes from a dry-run apply with applyOpts; objects
+// whose dry run fails because their namespace does not exist yet (e.g. a new slot) are reported as created
+// from their rendered form. It returns the report and unified diffs in render order.
+func diffStack(ctx context.Context, kubeClient kube.Orchestrator, applyOpts kube.ApplyOptions, params pruneParams) (diffReport, []string, error) {
+	report := diffReport{
+		Created: []kube.ObjectRef{},
+		Changed: []kube.ObjectRef{},
+		Deleted: []kube.ObjectRef{},
+	}
+	var diffs []string
+
+	docs, err := kube.DecodeDocuments(params.rendered)
+	if err != nil {
+		return report, nil, err
+	}
+
+	// missingNamespaces caches which target namespaces do not exist.
+	missingNamespaces := map[string]bool{}
+	namespaceMissing := func(ns string) (bool, error) {
+		if missing, ok := missingNamespaces[ns]; ok {
+			return missing, nil
+		}
+		obj, err := kubeClient.GetObject(ctx, kube.ObjectRef{APIVersion: "v1", Kind: "Namespace", Name: ns})
+		if err != nil {
+			return false, fmt.Errorf("get namespace %s: %w", ns, err)
+		}
+		missingNamespaces[ns] = obj == nil
+		return obj == nil, nil
+	}
+
+	for _, doc := range docs {
+		ref := kube.ObjectRefOf(doc)
+		single, err := yaml.Marshal(doc)
+		if err != nil {
+			return report, nil, fmt.Errorf("encode %s: %w", ref, err)
+		}
+
+		var live map[string]any
+		desired, err := kubeClient.DryRunApply(ctx, single, applyOpts)
+		if err != nil {
+			target := ref.Namespace
+			if target == "" {
+				target = strings.TrimSpace(params.ctxData.Namespace)
+			}
+			missing := false
+			if target != "" {
+				var nsErr error
+				if missing, nsErr = namespaceMissing(target); nsErr != nil {
+					return report, nil, nsErr
+				}
+			}
+			if !missing {
+				return report, nil, fmt.Errorf("server dry-run for %s: %w", ref, err)
+			}
+			// Nothing of a namespace that does not exist yet is live; the rendered object is the desired state.
+			desired = doc
+			ref.Namespace = target
+		} else {
+			if ref.Namespace == "" {
+				ref.Namespace = kube.ObjectRefOf(desired).Namespace
+			}
+			live, err = kubeClient.GetObject(ctx, ref)
+			if err != nil {
+				return report, nil, fmt.Errorf("get live %s: %w", ref, err)
+			}
+		}
+
+		desiredText, err := normalizedYAML(desired)
+		if err != nil {
+			return report, nil, err
+		}
+		liveText := ""
+		if live != nil {
+			if liveText, err = normalizedYAML(live); err != nil {
+				return report, nil, err
+			}
+		}
+
+		d := textdiff.Unified("live/"+diffName(ref), "rendered/"+diffName(ref), liveText, desiredText, diffContextLines)
+		if d == "" {
+			continue
+		}
+		if live == nil {
+			report.Created = append(report.Created, ref)
+		} else {
+			report.Changed = append(report.Changed, ref)
+		}
+		diffs = append(diffs, d)
+	}
+
+	stale, err := findStaleObjects(ctx, params)
+	if err != nil {
+		return report, nil, err
+	}
+	for _, ref := range stale {
+		live, err := kubeClient.GetObject(ctx, ref)
+		if err != nil {
+			return report, nil, fmt.Errorf("get live %s: %w", ref, err)
+		}
+		if live == nil {
+			continue
+		}
+		liveText, err := normalizedYAML(live)
+		if err != nil {
+			return report, nil, err
+		}
+		report.Deleted = append(report.Deleted, ref)
+		diffs = append(diffs, textdiff.Unified("live/"+diffName(ref), "rendered/"+diffName(ref), liveText, "", diffContextLines))
+	}
+
+	return report, diffs, nil
+}
+
+// normalizedYAML strips server-populated fields from obj, masks Secret values and encodes it as YAML.
+func normalizedYAML(obj map[string]any) (string, error) {
+	delete(obj, "status")
+	maskSecretValues(obj)
+	if meta, ok := obj["metadata"].(map[string]any); ok {
+		for _, field := range normalizedMetadataFields {
+			delete(meta, field)
+		}
+		if annotations, ok := meta["annotations"].(map[string]any); ok {
+			for _, key := range normalizedAnnotations {
+				delete(annotations, key)
+			}
+			if len(annotations) == 0 {
+				delete(meta, "annotations")
+			}
+		}
+	}
+	var buf strings.Builder
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(obj); err != nil {
+		return "", fmt.Errorf("encode object: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return "", fmt.Errorf("encode object: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// secretMaskKey keys the digests that stand in for Secret values in diffs. It is random per process, so equal
+// values still compare equal within one diff while the printed digests reveal nothing across runs.
+var secretMaskKey = func() []byte {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	return key
+}()
+
+// maskSecretValues replaces the values of Secret data and stringData with keyed digests, so that diffs show
+// which keys changed without printing the values into CI logs. stringData values are digested in their
+// base64 form to match the data values the API server stores them as.
+func maskSecretValues(obj map[string]any) {
+	if kind, _ := obj["kind"].(string); kind != "Secret" {
+		return
+	}
+	for _, field := range []string{"data", "stringData"} {
+		values, ok := obj[field].(map[string]any)
+		if !ok {
+			continue
+		}
+		for key, v := range values {
+			s := fmt.Sprint(v)
+			if field == "stringData" {
+				s = base64.StdEncoding.EncodeToString([]byte(s))
+			}
+			mac := hmac.New(sha256.New, secretMaskKey)
+			mac.Write([]byte(s))
+			values[key] = "*** (digest " + hex.EncodeToString(mac.Sum(nil))[:12] + ")"
+		}
+	}
+}
+
+// diffName returns the path-like object name used in diff headers.
+func diffName(ref kube.ObjectRef) string {
+	parts := []string{}
+	if ref.Namespace != "" {
+		parts = append(parts, ref.Namespace)
+	}
+	parts = append(parts, strings.ToLower(ref.Kind), ref.Name)
+	return strings.Join(parts, "/")
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/codex-k8s/codexctl/internal/config"
+	"github.com/codex-k8s/codexctl/internal/kube"
 )
 
 type doctorParams struct {
@@ -15,6 +16,8 @@ type doctorParams struct {
 	stackCfg *config.StackConfig
 	// envName is the environment name for log context.
 	envName string
+	// kubeClient is the orchestrator in use; kubectl is required only for the kubectl backend.
+	kubeClient kube.Orchestrator
 }
 
 // runDoctorChecks verifies required/optional tooling is available in PATH.
@@ -24,7 +27,10 @@ func runDoctorChecks(_ context.Context, logger *slog.Logger, params doctorParams
 	}
 
 	var required []string
-	required = append(required, "kubectl", "bash")
+	if params.kubeClient == nil || usesKubectl(params.kubeClient) {
+		required = append(required, "kubectl")
+	}
+	required = append(required, "bash")
 	if params.stackCfg != nil && len(params.stackCfg.Images) > 0 {
 		kanikoCfg, err := resolveKanikoConfig()
 		if err != nil {
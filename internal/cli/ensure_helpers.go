@@ -42,6 +42,12 @@ type ensureSlotResult struct {
 	created bool
 	// store holds the resolved store context.
 	store *envSlotStore
+	// queuePosition is the slot queue position the allocation started from (0 when it did not wait).
+	queuePosition int
+	// queueWait is the time spent in the slot queue.
+	queueWait time.Duration
+	// warm indicates the slot was claimed from the warm pool (already provisioned, new to the issue/PR).
+	warm bool
 }
 
 type ensureReadyRequest struct {
@@ -65,6 +71,8 @@ type ensureReadyRequest struct {
 	doApply bool
 	// forceApply forces apply even for existing envs.
 	forceApply bool
+	// forceConflicts takes over server-side apply field conflicts.
+	forceConflicts bool
 	// waitTimeout overrides deployment wait timeout.
 	waitTimeout string
 	// waitTimeoutSet indicates explicit wait-timeout flag usage.
@@ -90,6 +98,16 @@ type ensureReadyResult struct {
 	infraReady bool
 	// envReady indicates whether the existing environment looks ready to run Codex.
 	envReady bool
+	// rollout is the rollout report of the post-apply wait (nil when no wait ran).
+	rollout *kube.RolloutReport
+	// queuePosition is the slot queue position the allocation started from (0 when it did not wait).
+	queuePosition int
+	// queueWait is the time spent in the slot queue.
+	queueWait time.Duration
+	// warm indicates the slot was claimed from the warm pool (already provisioned, new to the issue/PR).
+	warm bool
+	// woken indicates the slot was hibernated and its workloads were scaled back up.
+	woken bool
 }
 
 // ensureSlot allocates or resolves an environment slot based on selectors.
@@ -110,13 +128,10 @@ func ensureSlot(ctx context.Context, logger *slog.Logger, opts *Options, req ens
 		VarFiles: req.varFiles,
 	}
 
-	envStore, err := loadEnvSlotStore(opts.ConfigPath, envName, loadOpts, logger)
+	envStore, err := loadEnvSlotStore(opts, envName, loadOpts, logger, req.machineOutput)
 	if err != nil {
 		return res, err
 	}
-	if envStore.kubeClient != nil {
-		envStore.kubeClient.StdoutToStderr = req.machineOutput
-	}
 
 	ctxList, cancelList := context.WithTimeout(ctx, 30*time.Second)
 	defer cancelList()
@@ -135,7 +150,7 @@ func ensureSlot(ctx context.Context, logger *slog.Logger, opts *Options, req ens
 		expectedNS, err := config.ResolveNamespace(envStore.stackCfg, ctxSlot, envName)
 		if err == nil && strings.TrimSpace(expectedNS) != "" && strings.TrimSpace(expectedNS) != strings.TrimSpace(found.Namespace) {
 			ctxFix, cancelFix := context.WithTimeout(ctx, 15*time.Second)
-			if err := envStore.store.UpdateNamespace(ctxFix, found.Slot, expectedNS); err != nil {
+			if err := envStore.store.Update(ctxFix, found.Slot, state.RecordUpdate{ResourceVersion: found.ResourceVersion, Namespace: expectedNS}); err != nil {
 				logger.Warn("failed to patch namespace for existing environment record", "slot", found.Slot, "env", envName, "expected", expectedNS, "actual", found.Namespace, "error", err)
 			} else {
 				found.Namespace = expectedNS
@@ -152,14 +167,47 @@ func ensureSlot(ctx context.Context, logger *slog.Logger, opts *Options, req ens
 	ctxAlloc, cancelAlloc := context.WithTimeout(ctx, 6*time.Hour)
 	defer cancelAlloc()
 
-	rec, err := allocateSlotWithRetry(ctxAlloc, envStore.store, envStore.stackCfg, envStore.templateCtx, envName, req.maxSlots, prefer, req.issue, req.pr, logger)
+	alloc, err := allocateSlotWithRetry(ctxAlloc, envStore.store, state.AllocateRequest{
+		StackConfig: envStore.stackCfg,
+		BaseContext: envStore.templateCtx,
+		Env:         envName,
+		MaxSlots:    req.maxSlots,
+		Prefer:      prefer,
+		Issue:       req.issue,
+		PR:          req.pr,
+	}, slotQueueRequest{
+		holder: slotLeaseHolder(envStore.templateCtx.EnvMap),
+		priority: func(ctx context.Context) int {
+			return slotQueuePriority(ctx, logger, req.issue, req.pr)
+		},
+	}, logger)
+	if err != nil {
+		return res, err
+	}
+	rec := alloc.record
+	res.queuePosition = alloc.queuePosition
+	res.queueWait = alloc.queueWait
+	settled, released, err := settleDuplicateAllocation(ctxAlloc, logger, envStore.store, rec, alloc.warm, req.issue, req.pr)
 	if err != nil {
 		return res, err
 	}
+	if released {
+		res.record = settled
+		res.store = envStore
+		return res, nil
+	}
 
 	res.record = rec
-	res.created = true
 	res.store = envStore
+	if alloc.warm {
+		// The warm slot already runs the bootstrap infra and the full stack.
+		res.warm = true
+		return res, nil
+	}
+	res.created = true
+	if err := seedSlotData(ctx, logger, envStore, envName, rec); err != nil {
+		return res, err
+	}
 	if err := applySlotBootstrapInfra(ctx, logger, opts, envStore, rec, req); err != nil {
 		return res, err
 	}
@@ -190,21 +238,20 @@ func ensureReady(ctx context.Context, logger *slog.Logger, opts *Options, req en
 
 	rec := slotRes.record
 	created := slotRes.created
+	res.queuePosition = slotRes.queuePosition
+	res.queueWait = slotRes.queueWait
+	res.warm = slotRes.warm
 	envName := req.envName
 	if envName == "" {
 		envName = "ai"
 	}
 
-	if slotRes.store != nil && slotRes.store.kubeClient != nil {
-		slotRes.store.kubeClient.StdoutToStderr = req.machineOutput
-	}
-
 	recreated := false
 	if !created && strings.TrimSpace(rec.Namespace) != "" {
 		ctxNs, cancelNs := context.WithTimeout(ctx, 15*time.Second)
 		defer cancelNs()
-		nsArgs := []string{"get", "ns", rec.Namespace}
-		if _, err := slotRes.store.kubeClient.RunAndCapture(ctxNs, nil, nsArgs...); err != nil {
+		nsRef := kube.ObjectRef{APIVersion: "v1", Kind: "Namespace", Name: rec.Namespace}
+		if ns, err := slotRes.store.kubeClient.GetObject(ctxNs, nsRef); err != nil || ns == nil {
 			logger.Warn("namespace missing for existing environment; resources will be recreated",
 				"namespace", rec.Namespace,
 				"slot", rec.Slot,
@@ -215,6 +262,26 @@ func ensureReady(ctx context.Context, logger *slog.Logger, opts *Options, req en
 		}
 	}
 
+	if rec.Phase == state.PhaseHibernated {
+		if !recreated {
+			waitTimeout := resolveDeployWaitTimeout(slotRes.store.stackCfg, req.waitTimeout, req.waitTimeoutSet)
+			report, err := wakeSlot(ctx, logger, slotRes.store.kubeClient, rec.Namespace, waitTimeout)
+			res.rollout = report
+			switch {
+			// A report means the workloads were scaled up and only the rollout wait failed.
+			case err != nil && report != nil && req.waitSoftFail:
+				res.infraReady = false
+				logger.Warn("wait for woken slot failed, continuing", "namespace", rec.Namespace, "error", err)
+			case err != nil:
+				return res, fmt.Errorf("wake hibernated slot %d: %w", rec.Slot, err)
+			}
+			res.woken = true
+		}
+		// The activity is recorded with the phase change so that hibernate does not find a ready slot that still
+		// looks idle and scale it back down.
+		updateSlotRecord(ctx, logger, slotRes.store.store, rec.Slot, state.RecordUpdate{Phase: state.PhaseReady, LastActivityAt: time.Now()})
+	}
+
 	if req.codeRootBase != "" && req.source != "" {
 		workspaceMount := strings.TrimSpace(os.Getenv("CODEXCTL_WORKSPACE_MOUNT"))
 		if workspaceMount == "" {
@@ -288,7 +355,16 @@ func ensureReady(ctx context.Context, logger *slog.Logger, opts *Options, req en
 			ctxApply, cancelApply := context.WithTimeout(ctx, 10*time.Minute)
 			defer cancelApply()
 
-			if err := applyStack(ctxApply, logger, stackCfg, ctxData, envName, slotRes.store.envCfg, true, false, req.machineOutput, engine.RenderOptions{}); err != nil {
+			applyParams := applyStackParams{
+				kubeClient:     slotRes.store.kubeClient,
+				stackCfg:       stackCfg,
+				ctxData:        ctxData,
+				envName:        envName,
+				envCfg:         slotRes.store.envCfg,
+				preflight:      true,
+				forceConflicts: req.forceConflicts,
+			}
+			if err := applyStack(ctxApply, logger, applyParams); err != nil {
 				return res, err
 			}
 
@@ -296,11 +372,12 @@ func ensureReady(ctx context.Context, logger *slog.Logger, opts *Options, req en
 				logger.Info("skip wait: namespace is empty, resources may be cluster-scoped or namespaced explicitly in manifests")
 			} else {
 				waitTimeout := resolveDeployWaitTimeout(stackCfg, req.waitTimeout, req.waitTimeoutSet)
-				logger.Info("waiting for deployments to become Available", "namespace", rec.Namespace, "timeout", waitTimeout)
-				if err := slotRes.store.kubeClient.WaitForDeployments(ctx, rec.Namespace, waitTimeout); err != nil {
+				report, err := waitForRollout(ctx, logger, slotRes.store.kubeClient, rec.Namespace, waitTimeout)
+				res.rollout = report
+				if err != nil {
 					if req.waitSoftFail {
 						res.infraReady = false
-						logger.Warn("wait for deployments failed, continuing", "namespace", rec.Namespace, "error", err)
+						logger.Warn("wait for rollout failed, continuing", "namespace", rec.Namespace, "error", err)
 					} else {
 						return res, err
 					}
@@ -326,6 +403,12 @@ func ensureReady(ctx context.Context, logger *slog.Logger, opts *Options, req en
 		res.envReady = ready
 	}
 
+	phase := ""
+	if res.envReady || (req.doApply && res.infraReady) {
+		phase = state.PhaseReady
+	}
+	touchSlotActivity(ctx, logger, slotRes.store.store, rec.Slot, phase)
+
 	res.record = rec
 	res.created = created
 	res.recreated = recreated
@@ -376,7 +459,14 @@ func applySlotBootstrapInfra(
 	renderOpts := engine.RenderOptions{
 		OnlyInfra: onlyInfra,
 	}
-	return applyStack(applyCtx, logger, stackCfg, ctxData, envName, envStore.envCfg, false, false, req.machineOutput, renderOpts)
+	return applyStack(applyCtx, logger, applyStackParams{
+		kubeClient: envStore.kubeClient,
+		stackCfg:   stackCfg,
+		ctxData:    ctxData,
+		envName:    envName,
+		envCfg:     envStore.envCfg,
+		renderOpts: renderOpts,
+	})
 }
 
 func nameSetFromSlice(values []string) map[string]struct{} {
@@ -394,7 +484,7 @@ func nameSetFromSlice(values []string) map[string]struct{} {
 	return set
 }
 
-func checkEnvReady(ctx context.Context, client *kube.Client, namespace, deployment string) (bool, error) {
+func checkEnvReady(ctx context.Context, client kube.ObjectClient, namespace, deployment string) (bool, error) {
 	if client == nil {
 		return false, fmt.Errorf("kubernetes client is nil")
 	}
@@ -404,10 +494,12 @@ func checkEnvReady(ctx context.Context, client *kube.Client, namespace, deployme
 	if strings.TrimSpace(deployment) == "" {
 		return false, fmt.Errorf("deployment name is empty")
 	}
-	if _, err := client.RunAndCapture(ctx, nil, "get", "ns", namespace); err != nil {
+	ns, err := client.GetObject(ctx, kube.ObjectRef{APIVersion: "v1", Kind: "Namespace", Name: namespace})
+	if err != nil || ns == nil {
 		return false, err
 	}
-	if _, err := client.RunAndCapture(ctx, nil, "-n", namespace, "get", "deploy", deployment); err != nil {
+	deploy, err := client.GetObject(ctx, kube.ObjectRef{APIVersion: "apps/v1", Kind: "Deployment", Namespace: namespace, Name: deployment})
+	if err != nil || deploy == nil {
 		return false, err
 	}
 	return true, nil
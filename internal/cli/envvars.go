@@ -18,6 +18,8 @@ type baseEnv struct {
 	Namespace string `env:"CODEXCTL_NAMESPACE"`
 	// LogLevel is the logging level from CODEXCTL_LOG_LEVEL.
 	LogLevel string `env:"CODEXCTL_LOG_LEVEL"`
+	// KubeBackend is the Kubernetes backend from CODEXCTL_KUBE_BACKEND.
+	KubeBackend string `env:"CODEXCTL_KUBE_BACKEND"`
 }
 
 // varsEnv describes inline vars and var files passed via env.
@@ -80,6 +82,14 @@ type ciEnv struct {
 	OnlyInfra string `env:"CODEXCTL_ONLY_INFRA"`
 	// SkipInfra filters infra from CODEXCTL_SKIP_INFRA.
 	SkipInfra string `env:"CODEXCTL_SKIP_INFRA"`
+	// WithDeps toggles dependency expansion of filters from CODEXCTL_WITH_DEPS.
+	WithDeps bool `env:"CODEXCTL_WITH_DEPS"`
+	// Prune toggles pruning of stale objects from CODEXCTL_PRUNE.
+	Prune bool `env:"CODEXCTL_PRUNE"`
+	// PruneDryRun toggles prune listing from CODEXCTL_PRUNE_DRY_RUN.
+	PruneDryRun bool `env:"CODEXCTL_PRUNE_DRY_RUN"`
+	// ForceConflicts takes over server-side apply conflicts from CODEXCTL_FORCE_CONFLICTS.
+	ForceConflicts bool `env:"CODEXCTL_FORCE_CONFLICTS"`
 	// MirrorImages toggles mirroring from CODEXCTL_MIRROR_IMAGES.
 	MirrorImages bool `env:"CODEXCTL_MIRROR_IMAGES"`
 	// BuildImages toggles builds from CODEXCTL_BUILD_IMAGES.
@@ -142,6 +152,62 @@ type manageEnvEnv struct {
 	WithConfigMap bool `env:"CODEXCTL_WITH_CONFIGMAP"`
 	// Lang is the comment language from CODEXCTL_LANG.
 	Lang string `env:"CODEXCTL_LANG"`
+	// Branch is the working branch from CODEXCTL_BRANCH.
+	Branch string `env:"CODEXCTL_BRANCH"`
+	// HeadSHA is the branch head commit from CODEXCTL_HEAD_SHA.
+	HeadSHA string `env:"CODEXCTL_HEAD_SHA"`
+}
+
+// gcEnv captures env inputs for "manage-env gc".
+type gcEnv struct {
+	// TTL is the maximum slot age from CODEXCTL_GC_TTL.
+	TTL string `env:"CODEXCTL_GC_TTL"`
+	// Idle is the maximum idle time from CODEXCTL_GC_IDLE.
+	Idle string `env:"CODEXCTL_GC_IDLE"`
+	// DryRun toggles listing without destroying from CODEXCTL_DRY_RUN.
+	DryRun bool `env:"CODEXCTL_DRY_RUN"`
+	// SkipOpen keeps slots with an open issue/PR from CODEXCTL_SKIP_OPEN.
+	SkipOpen bool `env:"CODEXCTL_SKIP_OPEN"`
+	// Repo is the repository slug from CODEXCTL_REPO.
+	Repo string `env:"CODEXCTL_REPO"`
+}
+
+// warmEnv captures env inputs for "manage-env warm".
+type warmEnv struct {
+	// Size overrides warmPool.size from CODEXCTL_WARM_POOL_SIZE.
+	Size int `env:"CODEXCTL_WARM_POOL_SIZE"`
+	// MaxSlots caps slots from CODEXCTL_DEV_SLOTS_MAX.
+	MaxSlots int `env:"CODEXCTL_DEV_SLOTS_MAX"`
+	// PrepareImages toggles image prep from CODEXCTL_PREPARE_IMAGES.
+	PrepareImages bool `env:"CODEXCTL_PREPARE_IMAGES"`
+	// WaitTimeout is the rollout wait timeout from CODEXCTL_WAIT_TIMEOUT.
+	WaitTimeout string `env:"CODEXCTL_WAIT_TIMEOUT"`
+}
+
+// hibernateEnv captures env inputs for "manage-env hibernate".
+type hibernateEnv struct {
+	// Idle is the idle time before hibernation from CODEXCTL_HIBERNATE_IDLE.
+	Idle string `env:"CODEXCTL_HIBERNATE_IDLE"`
+	// DryRun toggles listing without scaling from CODEXCTL_DRY_RUN.
+	DryRun bool `env:"CODEXCTL_DRY_RUN"`
+}
+
+// reconcileEnv captures env inputs for "manage-env reconcile".
+type reconcileEnv struct {
+	// Repo is the repository slug from CODEXCTL_REPO.
+	Repo string `env:"CODEXCTL_REPO"`
+	// DryRun toggles reporting without acting from CODEXCTL_DRY_RUN.
+	DryRun bool `env:"CODEXCTL_DRY_RUN"`
+}
+
+// snapshotEnv captures env inputs for "manage-env snapshot".
+type snapshotEnv struct {
+	// Name is the snapshot name from CODEXCTL_SNAPSHOT_NAME.
+	Name string `env:"CODEXCTL_SNAPSHOT_NAME"`
+	// Class is the VolumeSnapshotClass from CODEXCTL_SNAPSHOT_CLASS.
+	Class string `env:"CODEXCTL_SNAPSHOT_CLASS"`
+	// WaitTimeout is the snapshot wait timeout from CODEXCTL_WAIT_TIMEOUT.
+	WaitTimeout string `env:"CODEXCTL_WAIT_TIMEOUT"`
 }
 
 // prEnv captures inputs for PR workflows.
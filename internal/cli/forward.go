@@ -0,0 +1,319 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/codex-k8s/codexctl/internal/config"
+	"github.com/codex-k8s/codexctl/internal/engine"
+	"github.com/codex-k8s/codexctl/internal/kube"
+)
+
+// maxForwardBackoff caps the delay between port-forward reconnect attempts.
+const maxForwardBackoff = 30 * time.Second
+
+// serviceForward is a Kubernetes Service of a codexctl service forwarded to local ports.
+type serviceForward struct {
+	// component is the service name from services.yaml.
+	component string
+	// service is the Kubernetes Service name.
+	service string
+	// ports are the forwarded Service ports.
+	ports []forwardPort
+}
+
+// forwardPort maps a Service port to a local port.
+type forwardPort struct {
+	// name is the Service port name.
+	name string
+	// remote is the Service port.
+	remote int32
+	// local is the allocated local port.
+	local int32
+}
+
+// newForwardCommand creates the "forward" subcommand that port-forwards the Services of an environment.
+func newForwardCommand(opts *Options) *cobra.Command {
+	var sel slotSelector
+
+	cmd := &cobra.Command{
+		Use:   "forward [service...]",
+		Short: "Port-forward the Services of an environment to free local ports until interrupted",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			logger := LoggerFromContext(cmd.Context())
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			target, err := resolveSlotTarget(ctx, logger, opts, cmd, sel)
+			if err != nil {
+				return err
+			}
+			services, err := selectServices(target, parseNameSet(strings.Join(args, ",")))
+			if err != nil {
+				return err
+			}
+			kubeClient, err := envKubeClient(opts, target.envCfg, target.ctxData, true)
+			if err != nil {
+				return err
+			}
+			ns := target.ctxData.Namespace
+
+			listCtx, cancel := context.WithTimeout(ctx, time.Minute)
+			k8sServices, err := kube.ListServices(listCtx, kubeClient, ns)
+			if err != nil {
+				cancel()
+				return err
+			}
+			ingresses, err := kube.ListIngresses(listCtx, kubeClient, ns)
+			cancel()
+			if err != nil {
+				logger.Warn("failed to list ingresses; links are not mapped", "namespace", ns, "error", err)
+			}
+
+			forwards := planForwards(services, k8sServices)
+			if len(forwards) == 0 {
+				return fmt.Errorf("no Services with TCP ports found for services %s in namespace %s", strings.Join(services, ", "), ns)
+			}
+			if err := allocateLocalPorts(forwards); err != nil {
+				return err
+			}
+			siteHost := envSiteHost(target.ctxData, target.ctxData.Env, target.ctxData.Slot)
+			if err := printForwards(os.Stdout, forwards, forwardLinks(target.ctxData.Codex.Links, siteHost, ingresses, forwards)); err != nil {
+				return err
+			}
+			logger.Info("forwarding ports; press Ctrl-C to stop", "namespace", ns)
+
+			var wg sync.WaitGroup
+			for _, fw := range forwards {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					runServiceForward(ctx, logger, kubeClient, ns, fw)
+				}()
+			}
+			wg.Wait()
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Env, "env", "", "Environment to forward (dev, ai-staging, ai)")
+	cmd.Flags().StringVar(&opts.Namespace, "namespace", "", "Namespace override")
+	addSlotSelectorFlags(cmd, &sel)
+	addVarsFlags(cmd)
+	_ = cmd.MarkFlagRequired("env")
+
+	return cmd
+}
+
+// planForwards selects the Services labelled with the given services, in the order of services.
+func planForwards(services []string, k8sServices []kube.ServiceState) []*serviceForward {
+	var out []*serviceForward
+	for _, name := range services {
+		for _, svc := range k8sServices {
+			if svc.Labels[engine.LabelComponentType] != string(config.NodeService) || svc.Labels[engine.LabelComponent] != name {
+				continue
+			}
+			fw := &serviceForward{component: name, service: svc.Name}
+			for _, p := range svc.Ports {
+				fw.ports = append(fw.ports, forwardPort{name: p.Name, remote: p.Port})
+			}
+			if len(fw.ports) > 0 {
+				out = append(out, fw)
+			}
+		}
+	}
+	return out
+}
+
+// allocateLocalPorts assigns a free local port to every forwarded port, preferring the Service port itself
+// when it is unprivileged and free.
+func allocateLocalPorts(forwards []*serviceForward) error {
+	used := map[int32]bool{}
+	for _, fw := range forwards {
+		for i := range fw.ports {
+			p := &fw.ports[i]
+			if p.remote >= 1024 && !used[p.remote] && localPortFree(p.remote) {
+				p.local = p.remote
+			} else {
+				for {
+					port, err := ephemeralLocalPort()
+					if err != nil {
+						return err
+					}
+					if !used[port] {
+						p.local = port
+						break
+					}
+				}
+			}
+			used[p.local] = true
+		}
+	}
+	return nil
+}
+
+// localPortFree reports whether port can be bound on 127.0.0.1.
+func localPortFree(port int32) bool {
+	l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(int(port))))
+	if err != nil {
+		return false
+	}
+	_ = l.Close()
+	return true
+}
+
+// ephemeralLocalPort asks the OS for a free port on 127.0.0.1.
+func ephemeralLocalPort() (int32, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("allocate local port: %w", err)
+	}
+	defer l.Close()
+	return int32(l.Addr().(*net.TCPAddr).Port), nil
+}
+
+// forwardLink is a codex.links entry served through a forwarded port.
+type forwardLink struct {
+	// title is the link title.
+	title string
+	// url is the local URL of the link.
+	url string
+}
+
+// forwardLinks maps codex.links to local URLs: a link matches the ingress route of siteHost with the longest
+// path prefix, and is listed when the route's backend Service port is forwarded.
+func forwardLinks(links []config.Link, siteHost string, ingresses []kube.IngressState, forwards []*serviceForward) []forwardLink {
+	var out []forwardLink
+	for _, link := range links {
+		title, path := strings.TrimSpace(link.Title), strings.TrimSpace(link.Path)
+		if title == "" || path == "" {
+			continue
+		}
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		var best *kube.IngressRoute
+		for i := range ingresses {
+			for j := range ingresses[i].Routes {
+				r := &ingresses[i].Routes[j]
+				if r.Host != "" && siteHost != "" && r.Host != siteHost {
+					continue
+				}
+				if !strings.HasPrefix(path, r.Path) || (best != nil && len(r.Path) <= len(best.Path)) {
+					continue
+				}
+				best = r
+			}
+		}
+		if best == nil {
+			continue
+		}
+		for _, fw := range forwards {
+			if fw.service != best.Service {
+				continue
+			}
+			for _, p := range fw.ports {
+				if (best.PortName != "" && p.name == best.PortName) || (best.PortName == "" && p.remote == best.Port) {
+					out = append(out, forwardLink{title: title, url: fmt.Sprintf("http://localhost:%d%s", p.local, path)})
+				}
+			}
+		}
+	}
+	return out
+}
+
+// printForwards writes the forwarded ports and the mapped links as tables.
+func printForwards(w io.Writer, forwards []*serviceForward, links []forwardLink) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVICE\tK8S SERVICE\tPORT\tLOCAL")
+	for _, fw := range forwards {
+		for _, p := range fw.ports {
+			port := strconv.Itoa(int(p.remote))
+			if p.name != "" {
+				port = p.name + "/" + port
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\tlocalhost:%d\n", fw.component, fw.service, port, p.local)
+		}
+	}
+	if len(links) > 0 {
+		fmt.Fprintln(tw, "\nLINK\tURL")
+		for _, l := range links {
+			fmt.Fprintf(tw, "%s\t%s\n", l.title, l.url)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("write forwards: %w", err)
+	}
+	return nil
+}
+
+// runServiceForward keeps the ports of fw forwarded to a ready pod of the Service until ctx is done,
+// reconnecting with exponential backoff when the pod goes away or the connection drops.
+func runServiceForward(ctx context.Context, logger *slog.Logger, client kube.Orchestrator, namespace string, fw *serviceForward) {
+	backoff := time.Second
+	for {
+		err := forwardOnce(ctx, logger, client, namespace, fw, &backoff)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Warn("port-forward interrupted; reconnecting", "service", fw.service, "retry_in", backoff.String(), "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxForwardBackoff)
+	}
+}
+
+// forwardOnce resolves a pod of the Service and forwards to it until the connection ends. The backoff is
+// reset once the forward is established.
+func forwardOnce(ctx context.Context, logger *slog.Logger, client kube.Orchestrator, namespace string, fw *serviceForward, backoff *time.Duration) error {
+	resolveCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	pod, targets, err := kube.ServicePod(resolveCtx, client, namespace, fw.service)
+	cancel()
+	if err != nil {
+		return err
+	}
+	ports := make([]string, 0, len(fw.ports))
+	for _, p := range fw.ports {
+		remote, ok := targets[p.remote]
+		if !ok {
+			remote = p.remote
+		}
+		ports = append(ports, fmt.Sprintf("%d:%d", p.local, remote))
+	}
+
+	ready := make(chan struct{})
+	go func() {
+		select {
+		case <-ready:
+			logger.Debug("port-forward established", "service", fw.service, "pod", pod, "ports", strings.Join(ports, ","))
+		case <-ctx.Done():
+		}
+	}()
+	err = client.PortForward(ctx, kube.PortForwardRequest{Namespace: namespace, Pod: pod, Ports: ports, Ready: ready})
+	select {
+	case <-ready:
+		*backoff = time.Second
+	default:
+	}
+	if err == nil && ctx.Err() == nil {
+		err = errors.New("port-forward ended")
+	}
+	return err
+}
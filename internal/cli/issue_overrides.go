@@ -184,3 +184,27 @@ func resolveReasoningEffort(labels []ghIssueLabel) (string, bool) {
 	}
 	return "", false
 }
+
+// resolveQueuePriority maps [ai-priority-*] label names to slot queue priorities; the highest one wins.
+func resolveQueuePriority(labels []ghIssueLabel) int {
+	priorities := map[string]int{
+		"ai-priority-critical": 2,
+		"ai-priority-urgent":   2,
+		"ai-priority-high":     1,
+		"ai-priority-low":      -1,
+	}
+
+	best, found := 0, false
+	for _, label := range labels {
+		name := strings.ToLower(strings.TrimSpace(label.Name))
+		name = strings.Trim(name, "[]")
+		p, ok := priorities[name]
+		if !ok {
+			continue
+		}
+		if !found || p > best {
+			best, found = p, true
+		}
+	}
+	return best
+}
@@ -1,19 +1,131 @@
 package cli
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/codex-k8s/codexctl/internal/config"
 	"github.com/codex-k8s/codexctl/internal/kube"
 )
 
+// kubeClientParams selects the cluster and output of a Kubernetes orchestrator.
+type kubeClientParams struct {
+	// cluster is the target cluster (nil uses the current kubeconfig context).
+	cluster *config.ClusterSpec
+	// projectRoot resolves relative kubeconfig paths.
+	projectRoot string
+	// machineOutput sends progress output to stderr so stdout stays machine-readable.
+	machineOutput bool
+	// requestTimeout bounds every single API request (zero means no limit).
+	requestTimeout time.Duration
+}
+
+// newKubeClient constructs the Kubernetes orchestrator selected by --kube-backend for the cluster in params.
+func newKubeClient(opts *Options, params kubeClientParams) (kube.Orchestrator, error) {
+	cfg := kube.Config{Backend: opts.KubeBackend, RequestTimeout: params.requestTimeout}
+	if params.machineOutput {
+		cfg.Stdout = os.Stderr
+	}
+	if c := params.cluster; c != nil {
+		cfg.Kubeconfig = resolveKubeconfigPaths(c.Kubeconfig, params.projectRoot)
+		cfg.Context = strings.TrimSpace(c.Context)
+		cfg.InCluster = c.InCluster
+	}
+	client, err := kube.New(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("connect to cluster%s: %w", describeCluster(params.cluster), err)
+	}
+	return client, nil
+}
+
+// envKubeClient constructs the orchestrator for the cluster of envCfg.
+func envKubeClient(opts *Options, envCfg config.Environment, ctxData config.TemplateContext, machineOutput bool) (kube.Orchestrator, error) {
+	return newKubeClient(opts, kubeClientParams{
+		cluster:       envCfg.Cluster,
+		projectRoot:   ctxData.ProjectRoot,
+		machineOutput: machineOutput,
+	})
+}
+
+// resolveKubeconfigPaths expands "~" and resolves relative entries of a path list against projectRoot.
+func resolveKubeconfigPaths(paths, projectRoot string) string {
+	var out []string
+	for _, p := range filepath.SplitList(strings.TrimSpace(paths)) {
+		p = strings.TrimSpace(p)
+		switch {
+		case p == "":
+			continue
+		case p == "~" || strings.HasPrefix(p, "~/"):
+			if home, err := os.UserHomeDir(); err == nil {
+				p = filepath.Join(home, strings.TrimPrefix(p, "~"))
+			}
+		case !filepath.IsAbs(p) && projectRoot != "":
+			p = filepath.Join(projectRoot, p)
+		}
+		out = append(out, p)
+	}
+	return strings.Join(out, string(filepath.ListSeparator))
+}
+
+// describeCluster formats cluster for error messages (empty for the default cluster).
+func describeCluster(cluster *config.ClusterSpec) string {
+	switch {
+	case cluster == nil:
+		return ""
+	case cluster.InCluster:
+		return " (in-cluster)"
+	case cluster.Context != "" && cluster.Kubeconfig != "":
+		return fmt.Sprintf(" (context %q in %s)", cluster.Context, cluster.Kubeconfig)
+	case cluster.Context != "":
+		return fmt.Sprintf(" (context %q)", cluster.Context)
+	case cluster.Kubeconfig != "":
+		return " (" + cluster.Kubeconfig + ")"
+	}
+	return ""
+}
+
+// usesKubectl reports whether client runs kubectl subprocesses.
+func usesKubectl(client kube.Orchestrator) bool {
+	_, ok := client.(*kube.KubectlClient)
+	return ok
+}
+
 // runCodexPodShell executes a shell command inside the codex deployment pod.
-func runCodexPodShell(ctx context.Context, client *kube.Client, namespace, command string) error {
-	return client.RunRaw(
-		ctx,
-		nil,
-		"-n", namespace,
-		"exec", "deploy/codex",
-		"--", "sh", "-lc",
-		command,
-	)
+func runCodexPodShell(ctx context.Context, client kube.PodRunner, namespace, command string) error {
+	return client.Exec(ctx, kube.ExecRequest{
+		Namespace: namespace,
+		Target:    "deploy/codex",
+		Command:   []string{"sh", "-lc", command},
+	})
+}
+
+// codexWorkspaceHead returns the checked-out branch and head commit of /workspace in the Codex pod. The
+// branch is empty for a detached HEAD.
+func codexWorkspaceHead(ctx context.Context, client kube.PodRunner, namespace string) (string, string, error) {
+	var out bytes.Buffer
+	err := client.Exec(ctx, kube.ExecRequest{
+		Namespace: namespace,
+		Target:    "deploy/codex",
+		Command:   []string{"sh", "-lc", "git -C /workspace rev-parse --abbrev-ref HEAD && git -C /workspace rev-parse HEAD"},
+		Stdout:    &out,
+		Stderr:    io.Discard,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	lines := strings.Fields(out.String())
+	if len(lines) != 2 {
+		return "", "", fmt.Errorf("unexpected git rev-parse output %q", out.String())
+	}
+	branch, sha := lines[0], lines[1]
+	if branch == "HEAD" {
+		branch = ""
+	}
+	return branch, sha, nil
 }
@@ -73,3 +73,19 @@ func addRenderFilterFlags(cmd *cobra.Command, onlyServices, skipServices, onlyIn
 	cmd.Flags().StringVar(onlyInfra, "only-infra", "", fmt.Sprintf("%s only selected infra blocks (comma-separated names)", actionOnly))
 	cmd.Flags().StringVar(skipInfra, "skip-infra", "", fmt.Sprintf("%s selected infra blocks (comma-separated names)", actionSkip))
 }
+
+// addPruneFlags registers flags that delete or list labelled objects no longer rendered.
+func addPruneFlags(cmd *cobra.Command, prune, pruneDryRun *bool) {
+	cmd.Flags().BoolVar(prune, "prune", false, "Delete codexctl-labelled objects of the selected components that are no longer rendered")
+	cmd.Flags().BoolVar(pruneDryRun, "prune-dry-run", false, "List objects --prune would delete without deleting them")
+}
+
+// addForceConflictsFlag registers the flag that lets server-side apply take over fields owned by other managers.
+func addForceConflictsFlag(cmd *cobra.Command, forceConflicts *bool) {
+	cmd.Flags().BoolVar(forceConflicts, "force-conflicts", false, "With serverSideApply, take ownership of fields managed by other field managers")
+}
+
+// addWithDepsFlag registers the flag that extends --only-services/--only-infra with dependencies.
+func addWithDepsFlag(cmd *cobra.Command, withDeps *bool) {
+	cmd.Flags().BoolVar(withDeps, "with-deps", false, "Include transitive dependsOn dependencies of --only-services/--only-infra")
+}
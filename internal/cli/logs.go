@@ -0,0 +1,346 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/codex-k8s/codexctl/internal/config"
+	"github.com/codex-k8s/codexctl/internal/engine"
+	"github.com/codex-k8s/codexctl/internal/kube"
+)
+
+// logsRediscoverInterval is how often "logs --follow" looks for new pods of the selected services.
+const logsRediscoverInterval = 5 * time.Second
+
+// logPrefixColors are the ANSI colours cycled through for service prefixes.
+var logPrefixColors = []string{"36", "33", "35", "32", "34", "91", "96", "93"}
+
+// newLogsCommand creates the "logs" subcommand that streams the logs of services' pods with a prefix.
+func newLogsCommand(opts *Options) *cobra.Command {
+	var (
+		sel          slotSelector
+		onlyServices string
+		since        time.Duration
+		grep         string
+		previous     bool
+		follow       bool
+		tail         int64
+		container    string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "logs",
+		Short: "Stream logs of the pods of one or more services with a [service/pod] prefix",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			logger := LoggerFromContext(cmd.Context())
+			var grepRe *regexp.Regexp
+			if grep != "" {
+				re, err := regexp.Compile(grep)
+				if err != nil {
+					return fmt.Errorf("invalid --grep expression: %w", err)
+				}
+				grepRe = re
+			}
+
+			target, err := resolveSlotTarget(cmd.Context(), logger, opts, cmd, sel)
+			if err != nil {
+				return err
+			}
+			services, err := selectServices(target, parseNameSet(onlyServices))
+			if err != nil {
+				return err
+			}
+			kubeClient, err := envKubeClient(opts, target.envCfg, target.ctxData, true)
+			if err != nil {
+				return err
+			}
+
+			tailer := &logTailer{
+				logger:    logger,
+				client:    kubeClient,
+				namespace: target.ctxData.Namespace,
+				services:  services,
+				out:       &lockedWriter{w: os.Stdout},
+				color:     colorEnabled(os.Stdout),
+				grep:      grepRe,
+				request: kube.LogsRequest{
+					Namespace: target.ctxData.Namespace,
+					Container: container,
+					Follow:    follow && !previous,
+					TailLines: tail,
+					Since:     since,
+					Previous:  previous,
+				},
+				streams: map[string]*podStream{},
+			}
+			return tailer.run(cmd.Context())
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Env, "env", "", "Environment whose logs are streamed (dev, ai-staging, ai)")
+	cmd.Flags().StringVar(&opts.Namespace, "namespace", "", "Namespace override")
+	addSlotSelectorFlags(cmd, &sel)
+	cmd.Flags().StringVar(&onlyServices, "only-services", "", "Stream logs of selected services only (comma-separated names)")
+	cmd.Flags().DurationVar(&since, "since", 0, "Only show lines newer than this duration (e.g. 10m)")
+	cmd.Flags().StringVar(&grep, "grep", "", "Only show lines matching this regular expression")
+	cmd.Flags().BoolVarP(&previous, "previous", "p", false, "Show logs of the previous container instances (implies --follow=false)")
+	cmd.Flags().BoolVarP(&follow, "follow", "f", true, "Keep streaming and pick up pods started later")
+	cmd.Flags().Int64Var(&tail, "tail", 50, "Lines of recent logs to show per pod (0 shows all)")
+	cmd.Flags().StringVar(&container, "container", "", "Container to read (defaults to the pod's default container)")
+	addVarsFlags(cmd)
+	_ = cmd.MarkFlagRequired("env")
+
+	return cmd
+}
+
+// selectServices returns the enabled services of target, restricted to only when it is not empty.
+func selectServices(target slotTarget, only map[string]struct{}) ([]string, error) {
+	declared := map[string]bool{}
+	var out []string
+	for _, svc := range target.stackCfg.Services {
+		declared[svc.Name] = true
+		if len(only) > 0 {
+			if _, ok := only[svc.Name]; !ok {
+				continue
+			}
+		}
+		ok, err := engine.ComponentEnabled(config.NodeService, svc.When, target.ctxData)
+		if err != nil {
+			return nil, fmt.Errorf("evaluate when for service %q: %w", svc.Name, err)
+		}
+		if ok {
+			out = append(out, svc.Name)
+		}
+	}
+	for name := range only {
+		if !declared[name] {
+			return nil, fmt.Errorf("unknown service %q", name)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no enabled services selected in env %s", target.ctxData.Env)
+	}
+	return out, nil
+}
+
+// podStream tracks the log stream of a single pod.
+type podStream struct {
+	// active reports a running stream.
+	active bool
+	// endedAt is when the last stream ended.
+	endedAt time.Time
+}
+
+// logTailer streams the logs of the pods of services and follows pods started later.
+type logTailer struct {
+	// logger reports stream failures.
+	logger *slog.Logger
+	// client lists pods and streams their logs.
+	client kube.Orchestrator
+	// namespace is the environment namespace.
+	namespace string
+	// services are the selected service names; their index picks the prefix colour.
+	services []string
+	// out is the shared output of all streams.
+	out *lockedWriter
+	// color enables coloured prefixes.
+	color bool
+	// grep filters lines when set.
+	grep *regexp.Regexp
+	// request is the template of every log request.
+	request kube.LogsRequest
+
+	// mu guards streams.
+	mu sync.Mutex
+	// wg tracks running streams.
+	wg sync.WaitGroup
+	// streams maps pod names to their stream state.
+	streams map[string]*podStream
+}
+
+// run starts a stream per pod. Without Follow it returns once every stream ended; with Follow it rediscovers
+// pods until ctx is cancelled and resumes streams of running pods whose stream ended (e.g. after a restart).
+func (t *logTailer) run(ctx context.Context) error {
+	started, err := t.discover(ctx)
+	if err != nil {
+		return err
+	}
+	if !t.request.Follow {
+		t.wg.Wait()
+		if started == 0 {
+			return fmt.Errorf("no pods found for services %s in namespace %s", strings.Join(t.services, ", "), t.namespace)
+		}
+		return nil
+	}
+	if started == 0 {
+		t.logger.Info("waiting for pods", "services", strings.Join(t.services, ","), "namespace", t.namespace)
+	}
+
+	ticker := time.NewTicker(logsRediscoverInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			t.wg.Wait()
+			return nil
+		case <-ticker.C:
+		}
+		if _, err := t.discover(ctx); err != nil && ctx.Err() == nil {
+			t.logger.Warn("failed to list pods", "namespace", t.namespace, "error", err)
+		}
+	}
+}
+
+// discover lists the pods of the services and starts streams for pods without an active one. It returns
+// the number of started streams.
+func (t *logTailer) discover(ctx context.Context) (int, error) {
+	listCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	ns, err := kube.GetNamespaceStatus(listCtx, t.client, t.namespace)
+	if err != nil {
+		return 0, err
+	}
+	if !ns.Exists {
+		return 0, fmt.Errorf("namespace %s does not exist", t.namespace)
+	}
+
+	started := 0
+	for i, svc := range t.services {
+		for _, w := range ns.Workloads {
+			if w.Labels[engine.LabelComponentType] != string(config.NodeService) || w.Labels[engine.LabelComponent] != svc {
+				continue
+			}
+			for _, pod := range w.Pods {
+				if t.start(ctx, svc, i, pod) {
+					started++
+				}
+			}
+		}
+	}
+	return started, nil
+}
+
+// start begins streaming the logs of pod unless a stream is active or the pod cannot have (new) logs.
+func (t *logTailer) start(ctx context.Context, service string, index int, pod kube.PodState) bool {
+	if pod.Phase == "Pending" || pod.Phase == "Unknown" {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	req := t.request
+	state, seen := t.streams[pod.Name]
+	switch {
+	case !seen:
+		state = &podStream{}
+		t.streams[pod.Name] = state
+	case state.active || !t.request.Follow || pod.Phase != "Running":
+		return false
+	default:
+		// Resume after the stream ended without repeating the lines already printed.
+		req.TailLines = 0
+		req.Since = (time.Since(state.endedAt) + time.Second).Truncate(time.Second)
+	}
+	state.active = true
+	req.Target = pod.Name
+
+	prefix := "[" + service + "/" + pod.Name + "] "
+	if t.color {
+		prefix = "\x1b[" + logPrefixColors[index%len(logPrefixColors)] + "m" + prefix + "\x1b[0m"
+	}
+	lw := &prefixedLineWriter{out: t.out, prefix: prefix, grep: t.grep}
+	req.Out = lw
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		err := t.client.Logs(ctx, req)
+		lw.flush()
+		if err != nil && ctx.Err() == nil {
+			t.logger.Warn("log stream failed", "service", service, "pod", pod.Name, "error", err)
+		}
+		t.mu.Lock()
+		state.active, state.endedAt = false, time.Now()
+		t.mu.Unlock()
+	}()
+	return true
+}
+
+// lockedWriter serialises writes of concurrent log streams.
+type lockedWriter struct {
+	// mu serialises writes.
+	mu sync.Mutex
+	// w is the underlying writer.
+	w io.Writer
+}
+
+// Write implements io.Writer.
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// prefixedLineWriter splits a stream into lines and writes those matching grep with a prefix.
+type prefixedLineWriter struct {
+	// out receives the prefixed lines.
+	out io.Writer
+	// prefix is prepended to every line.
+	prefix string
+	// grep filters lines when set.
+	grep *regexp.Regexp
+	// buf holds an incomplete trailing line.
+	buf []byte
+}
+
+// Write implements io.Writer; incomplete trailing lines are buffered until the next write or flush.
+func (p *prefixedLineWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := p.emit(p.buf[:i]); err != nil {
+			return 0, err
+		}
+		p.buf = p.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+// flush writes a buffered incomplete line.
+func (p *prefixedLineWriter) flush() {
+	if len(p.buf) > 0 {
+		_ = p.emit(p.buf)
+		p.buf = nil
+	}
+}
+
+// emit writes a single line when it matches grep.
+func (p *prefixedLineWriter) emit(line []byte) error {
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	if p.grep != nil && !p.grep.Match(line) {
+		return nil
+	}
+	_, err := p.out.Write([]byte(p.prefix + string(line) + "\n"))
+	return err
+}
+
+// colorEnabled reports whether ANSI colours should be written to f: it must be a terminal and NO_COLOR unset.
+func colorEnabled(f *os.File) bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -8,10 +8,12 @@ import (
 	"log/slog"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"syscall"
 	"text/template"
 	"time"
 
@@ -34,6 +36,12 @@ func newManageEnvCommand(opts *Options) *cobra.Command {
 		newManageEnvCleanupCommand(opts),
 		newManageEnvCleanupPRCommand(opts),
 		newManageEnvCleanupIssueCommand(opts),
+		newManageEnvGCCommand(opts),
+		newManageEnvReconcileCommand(opts),
+		newManageEnvListCommand(opts),
+		newManageEnvWarmCommand(opts),
+		newManageEnvHibernateCommand(opts),
+		newManageEnvSnapshotCommand(opts),
 		newManageEnvCloseLinkedIssueCommand(opts),
 		newManageEnvDeleteBranchCommand(opts),
 		newManageEnvSetCommand(opts),
@@ -95,7 +103,7 @@ func newManageEnvCleanupCommand(opts *Options) *cobra.Command {
 	cmd.Flags().IntVar(&slot, "slot", 0, "Explicit slot number")
 	cmd.Flags().IntVar(&issue, "issue", 0, "Issue number selector")
 	cmd.Flags().IntVar(&pr, "pr", 0, "PR number selector")
-	cmd.Flags().BoolVar(&withConfigMap, "with-configmap", false, "Remove state ConfigMap for the selected environment")
+	cmd.Flags().BoolVar(&withConfigMap, "with-configmap", false, "Remove the state record (ConfigMap, CodexSlot or local entry) of the selected environment")
 	cmd.Flags().BoolVar(&cleanupAll, "all", false, "Cleanup all matching environments for the selected env")
 
 	return cmd
@@ -193,7 +201,7 @@ func newManageEnvCleanupPRCommand(opts *Options) *cobra.Command {
 	cmd.Flags().IntVar(&pr, "pr", 0, "PR number to clean up")
 	cmd.Flags().StringVar(&branch, "branch", "", "Branch ref (used for cleanup hints and issue linking)")
 	cmd.Flags().StringVar(&repo, "repo", "", "GitHub repository slug owner/repo (defaults to CODEXCTL_REPO)")
-	cmd.Flags().BoolVar(&withConfigMap, "with-configmap", false, "Remove state ConfigMap for the selected environment")
+	cmd.Flags().BoolVar(&withConfigMap, "with-configmap", false, "Remove the state record (ConfigMap, CodexSlot or local entry) of the selected environment")
 	cmd.Flags().BoolVar(&deleteBranch, "delete-branch", false, "Delete the PR branch (if it matches codex/*)")
 	cmd.Flags().BoolVar(&closeIssue, "close-issue", false, "Close a linked issue based on the branch name")
 	cmd.Flags().BoolVar(&includeRepair, "include-ai-repair", false, "Also clean ai-repair env even if the branch is not ai-repair")
@@ -274,7 +282,7 @@ func newManageEnvCleanupIssueCommand(opts *Options) *cobra.Command {
 
 	cmd.Flags().IntVar(&issue, "issue", 0, "Issue number to clean up")
 	cmd.Flags().StringVar(&repo, "repo", "", "GitHub repository slug owner/repo (defaults to CODEXCTL_REPO)")
-	cmd.Flags().BoolVar(&withConfigMap, "with-configmap", false, "Remove state ConfigMap for the selected environment")
+	cmd.Flags().BoolVar(&withConfigMap, "with-configmap", false, "Remove the state record (ConfigMap, CodexSlot or local entry) of the selected environment")
 	cmd.Flags().BoolVar(&deleteBranch, "delete-branch", false, "Delete codex/* branches associated with the issue")
 
 	return cmd
@@ -409,7 +417,7 @@ type syncTarget struct {
 	// Image is the container image used by the sync pod.
 	Image string
 	// KubeClient is the Kubernetes client used for sync operations.
-	KubeClient *kube.Client
+	KubeClient kube.Orchestrator
 }
 
 // syncSources copies files from source into a PVC-backed workspace.
@@ -446,25 +454,35 @@ func syncSources(ctx context.Context, logger *slog.Logger, source string, target
 	}
 
 	logger.Info("creating sync pod", "namespace", target.Namespace, "pod", podName)
-	if err := target.KubeClient.Apply(ctx, podYAML); err != nil {
+	if err := target.KubeClient.Apply(ctx, podYAML, kube.ApplyOptions{}); err != nil {
 		return fmt.Errorf("apply sync pod: %w", err)
 	}
+	podRef := kube.ObjectRef{APIVersion: "v1", Kind: "Pod", Namespace: target.Namespace, Name: podName}
 	defer func() {
-		_ = target.KubeClient.RunRaw(context.Background(), nil, "-n", target.Namespace, "delete", "pod", podName, "--ignore-not-found")
+		_ = target.KubeClient.DeleteObject(context.Background(), podRef)
 	}()
 
 	waitCtx, cancelWait := context.WithTimeout(ctx, 2*time.Minute)
 	defer cancelWait()
-	if err := target.KubeClient.RunRaw(waitCtx, nil, "-n", target.Namespace, "wait", "--for=condition=Ready", "pod/"+podName, "--timeout=120s"); err != nil {
+	if err := target.KubeClient.WaitForCondition(waitCtx, podRef, "Ready", "120s"); err != nil {
 		return fmt.Errorf("wait for sync pod: %w", err)
 	}
 
 	cleanCmd := fmt.Sprintf("mkdir -p %q && find %q -mindepth 1 -maxdepth 1 -exec rm -rf {} +", targetPath, targetPath)
-	if err := target.KubeClient.RunRaw(ctx, nil, "-n", target.Namespace, "exec", podName, "--", "sh", "-c", cleanCmd); err != nil {
+	if err := target.KubeClient.Exec(ctx, kube.ExecRequest{
+		Namespace: target.Namespace,
+		Target:    podName,
+		Command:   []string{"sh", "-c", cleanCmd},
+	}); err != nil {
 		return fmt.Errorf("prepare workspace dir: %w", err)
 	}
 
-	if err := kubectlCopyToPod(ctx, target.KubeClient, target.Namespace, podName, source, targetPath); err != nil {
+	if err := target.KubeClient.Copy(ctx, kube.CopyRequest{
+		Namespace: target.Namespace,
+		Pod:       podName,
+		Source:    source,
+		Dest:      targetPath,
+	}); err != nil {
 		return fmt.Errorf("copy sources to workspace: %w", err)
 	}
 
@@ -550,30 +568,13 @@ func resolveWorkspaceRelativeTarget(envName string, slot int, codeRootBase, work
 	return rel, nil
 }
 
-// kubectlCopyToPod copies sources into the target pod using kubectl cp.
-func kubectlCopyToPod(ctx context.Context, client *kube.Client, namespace, pod, source, dest string) error {
-	if client == nil {
-		return fmt.Errorf("kube client is nil")
-	}
-	src := filepath.Clean(source)
-	src = filepath.Join(src, ".")
-	dst := fmt.Sprintf("%s/%s:%s", namespace, pod, dest)
-
-	cmd := exec.CommandContext(ctx, "kubectl", "cp", src, dst)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("kubectl cp failed: %w", err)
-	}
-	return nil
-}
-
-// newManageEnvSetCommand creates "manage-env set" to patch issue/pr fields for a slot.
+// newManageEnvSetCommand creates "manage-env set" to patch issue/pr/branch fields for a slot.
 func newManageEnvSetCommand(opts *Options) *cobra.Command {
 	var issue, pr, slot int
+	var branch, headSHA string
 	cmd := &cobra.Command{
 		Use:   "set",
-		Short: "Update metadata (issue/pr) for a slot",
+		Short: "Update metadata (issue/pr/branch) for a slot",
 		RunE: func(cmd *cobra.Command, _ []string) error {
 			logger := LoggerFromContext(cmd.Context())
 			envCfg := manageEnvEnv{}
@@ -589,6 +590,12 @@ func newManageEnvSetCommand(opts *Options) *cobra.Command {
 			if !cmd.Flags().Changed("pr") && envPresent("CODEXCTL_PR_NUMBER") {
 				pr = envCfg.PR
 			}
+			if !cmd.Flags().Changed("branch") && envPresent("CODEXCTL_BRANCH") {
+				branch = strings.TrimSpace(envCfg.Branch)
+			}
+			if !cmd.Flags().Changed("head-sha") && envPresent("CODEXCTL_HEAD_SHA") {
+				headSHA = strings.TrimSpace(envCfg.HeadSHA)
+			}
 			if slot <= 0 {
 				return fmt.Errorf("slot must be >0")
 			}
@@ -598,14 +605,17 @@ func newManageEnvSetCommand(opts *Options) *cobra.Command {
 				envName = "ai"
 			}
 
-			envStore, err := loadEnvSlotStore(opts.ConfigPath, envName, config.LoadOptions{Env: envName}, logger)
+			envStore, err := loadEnvSlotStore(opts, envName, config.LoadOptions{Env: envName}, logger, false)
 			if err != nil {
 				return err
 			}
 
 			ctx, cancel := context.WithTimeout(cmd.Context(), 30*time.Second)
 			defer cancel()
-			return envStore.store.UpdateAttributes(ctx, slot, issue, pr)
+			_, err = state.UpdateRecord(ctx, envStore.store, slot, func(state.EnvRecord) (state.RecordUpdate, bool, error) {
+				return state.RecordUpdate{Issue: issue, PR: pr, Branch: branch, HeadSHA: headSHA}, true, nil
+			})
+			return err
 		},
 	}
 	cmd.Flags().StringVar(&opts.Env, "env", "ai", "Environment type (default: ai)")
@@ -613,6 +623,8 @@ func newManageEnvSetCommand(opts *Options) *cobra.Command {
 	_ = cmd.MarkFlagRequired("slot")
 	cmd.Flags().IntVar(&issue, "issue", 0, "Issue number to set")
 	cmd.Flags().IntVar(&pr, "pr", 0, "PR number to set")
+	cmd.Flags().StringVar(&branch, "branch", "", "Working branch to set")
+	cmd.Flags().StringVar(&headSHA, "head-sha", "", "Head commit SHA of the branch to set")
 	return cmd
 }
 
@@ -645,12 +657,10 @@ func newManageEnvCommentCommand(opts *Options) *cobra.Command {
 			if err != nil {
 				return err
 			}
-			siteHost := ctxData.BaseDomain[envName]
-			if envName == "ai" {
-				siteHost = fmt.Sprintf("dev-%d.%s", slot, ctxData.BaseDomain["ai"])
-			}
+			siteHost := envSiteHost(ctxData, envName, slot)
+			hibernated := slotHibernated(cmd.Context(), LoggerFromContext(cmd.Context()), opts, envName, slot)
 
-			body, err := prompt.RenderEnvComment(strings.ToLower(lang), siteHost, slot, ctxData.Codex.Links)
+			body, err := prompt.RenderEnvComment(strings.ToLower(lang), siteHost, slot, ctxData.Codex.Links, hibernated)
 			if err != nil {
 				return err
 			}
@@ -718,12 +728,10 @@ func newManageEnvCommentPRCommand(opts *Options) *cobra.Command {
 			if err != nil {
 				return err
 			}
-			siteHost := ctxData.BaseDomain[envName]
-			if envName == "ai" {
-				siteHost = fmt.Sprintf("dev-%d.%s", slot, ctxData.BaseDomain["ai"])
-			}
+			siteHost := envSiteHost(ctxData, envName, slot)
+			hibernated := slotHibernated(cmd.Context(), LoggerFromContext(cmd.Context()), opts, envName, slot)
 
-			body, err := prompt.RenderEnvComment(strings.ToLower(lang), siteHost, slot, ctxData.Codex.Links)
+			body, err := prompt.RenderEnvComment(strings.ToLower(lang), siteHost, slot, ctxData.Codex.Links, hibernated)
 			if err != nil {
 				return err
 			}
@@ -861,7 +869,7 @@ func runEnvCleanup(
 	}
 
 	// Load stack/state store once to enumerate known environments.
-	envStore, err := loadEnvSlotStore(opts.ConfigPath, envName, config.LoadOptions{Env: envName}, logger)
+	envStore, err := loadEnvSlotStore(opts, envName, config.LoadOptions{Env: envName}, logger, false)
 	if err != nil {
 		return err
 	}
@@ -871,8 +879,6 @@ func runEnvCleanup(
 		return err
 	}
 
-	stateNS := envStore.stackCfg.State.ConfigMapNamespace
-
 	for _, rec := range records {
 		if rec.Env != envName {
 			continue
@@ -891,29 +897,43 @@ func runEnvCleanup(
 
 		logger.Info("destroying environment for selector", "slot", rec.Slot, "namespace", rec.Namespace, "env", rec.Env, "issue", rec.Issue, "pr", rec.PR)
 
-		// Load stack config for this particular slot/namespace.
-		loadOptsSlot := config.LoadOptions{
-			Env:       envName,
-			Namespace: rec.Namespace,
-			Slot:      rec.Slot,
-		}
-		stackSlot, ctxData, err := config.LoadStackConfig(opts.ConfigPath, loadOptsSlot)
-		if err != nil {
+		// The activity dates the destroying phase, so that reconcile leaves the slot alone while cleanup runs.
+		updateSlotRecord(ctx, logger, envStore.store, rec.Slot, state.RecordUpdate{Phase: state.PhaseDestroying, LastActivityAt: time.Now()})
+		if err := destroySlotEnvironment(ctx, logger, opts, envStore, rec); err != nil {
 			return err
 		}
 
-		if err := destroyStack(ctx, logger, stackSlot, ctxData, envStore.envCfg, envName); err != nil {
-			return err
+		if withConfigMap {
+			if err := envStore.store.Release(ctx, rec.Slot); err != nil {
+				logger.Warn("failed to delete state record", "slot", rec.Slot, "record", rec.Name, "error", err)
+			}
 		}
+	}
 
-		if withConfigMap && stateNS != "" && rec.ConfigName != "" {
-			_, _ = envStore.kubeClient.RunAndCapture(ctx, nil,
-				"-n", stateNS,
-				"delete", "configmap", rec.ConfigName, "--ignore-not-found",
-			)
+	return nil
+}
+
+// destroySlotEnvironment loads the stack for the slot and namespace of rec and destroys it together with the
+// snapshot copies restored into its namespace.
+func destroySlotEnvironment(ctx context.Context, logger *slog.Logger, opts *Options, envStore *envSlotStore, rec state.EnvRecord) error {
+	loadOptsSlot := config.LoadOptions{
+		Env:       rec.Env,
+		Namespace: rec.Namespace,
+		Slot:      rec.Slot,
+	}
+	stackSlot, ctxData, err := config.LoadStackConfig(opts.ConfigPath, loadOptsSlot)
+	if err != nil {
+		return err
+	}
+	if err := destroyStack(ctx, logger, envStore.kubeClient, stackSlot, ctxData, envStore.envCfg, rec.Env); err != nil {
+		return err
+	}
+	if rec.Namespace != "" {
+		// Clusters without the snapshot CRDs fail the lookup; there is nothing to remove then.
+		if err := kube.DeleteSnapshotCopies(ctx, envStore.kubeClient, rec.Namespace); err != nil {
+			logger.Debug("snapshot copies of the slot were not removed", "slot", rec.Slot, "namespace", rec.Namespace, "error", err)
 		}
 	}
-
 	return nil
 }
 
@@ -926,20 +946,21 @@ type envSlotStore struct {
 	// envCfg is the resolved environment configuration.
 	envCfg config.Environment
 	// kubeClient is the Kubernetes client for slot operations.
-	kubeClient *kube.Client
+	kubeClient kube.Orchestrator
 	// store manages slot state persistence.
-	store *state.Store
+	store state.StateBackend
 }
 
 // loadEnvSlotStore loads stack configuration, resolves the target environment, constructs a Kubernetes client
-// and initializes the state store for slot management.
+// and initializes the state store for slot management. With machineOutput, Kubernetes progress output goes to stderr.
 func loadEnvSlotStore(
-	configPath string,
+	opts *Options,
 	envName string,
 	loadOpts config.LoadOptions,
 	logger *slog.Logger,
+	machineOutput bool,
 ) (*envSlotStore, error) {
-	stackCfg, ctxData, err := config.LoadStackConfig(configPath, loadOpts)
+	stackCfg, ctxData, err := config.LoadStackConfig(opts.ConfigPath, loadOpts)
 	if err != nil {
 		return nil, err
 	}
@@ -949,8 +970,11 @@ func loadEnvSlotStore(
 		return nil, err
 	}
 
-	kubeClient := kube.NewClient()
-	store, err := state.NewStore(stackCfg, kubeClient, logger)
+	kubeClient, err := envKubeClient(opts, envCfg, ctxData, machineOutput)
+	if err != nil {
+		return nil, err
+	}
+	store, err := newStateStore(opts, stackCfg, ctxData, kubeClient, logger, machineOutput)
 	if err != nil {
 		return nil, err
 	}
@@ -964,43 +988,135 @@ func loadEnvSlotStore(
 	}, nil
 }
 
+// newStateStore constructs the state backend of stackCfg. The state lives in the cluster of envClient
+// unless state.cluster points elsewhere.
+func newStateStore(
+	opts *Options,
+	stackCfg *config.StackConfig,
+	ctxData config.TemplateContext,
+	envClient kube.Orchestrator,
+	logger *slog.Logger,
+	machineOutput bool,
+) (state.StateBackend, error) {
+	stateClient := envClient
+	if stackCfg.State.Cluster != nil {
+		var err error
+		stateClient, err = newKubeClient(opts, kubeClientParams{
+			cluster:       stackCfg.State.Cluster,
+			projectRoot:   ctxData.ProjectRoot,
+			machineOutput: machineOutput,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("state backend: %w", err)
+		}
+	}
+	return state.NewStore(stackCfg, stateClient, ctxData.ProjectRoot, logger)
+}
+
 // allocateSlotWithRetry encapsulates the common allocation loop for helpers
-// that need to allocate a new slot (e.g. ensure-slot).
+// that need to allocate a new slot (e.g. ensure-slot). Warm pool slots are claimed before cold slots are
+// allocated (see acquireSlot). When every slot is taken, the runner joins the
+// persistent slot queue of the environment and allocates once its position fits into the free slots,
+// so waiting runners are served by priority and then in arrival order. Runners that find other waiters
+// queue up behind them instead of racing for a freed slot. The queue entry is heartbeated while waiting
+// and removed when the wait ends, including on cancellation or SIGINT/SIGTERM.
 func allocateSlotWithRetry(
 	ctx context.Context,
-	store *state.Store,
-	stackCfg *config.StackConfig,
-	baseCtx config.TemplateContext,
-	envName string,
-	maxSlots int,
-	prefer int,
-	issue int,
-	pr int,
+	store state.StateBackend,
+	req state.AllocateRequest,
+	queue slotQueueRequest,
 	logger *slog.Logger,
-) (state.EnvRecord, error) {
+) (slotAllocation, error) {
 	const retryDelay = 30 * time.Second
 
-	for {
-		record, err := store.AllocateSlot(ctx, stackCfg, baseCtx, envName, maxSlots, prefer, issue, pr)
-		if err == nil {
-			return record, nil
-		}
+	var res slotAllocation
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-		// If the error is not about lack of free slots, return immediately.
-		if !state.IsNoFreeSlotError(err) {
-			return state.EnvRecord{}, err
+	entry := state.QueueEntry{ID: queue.holder, Issue: req.Issue, PR: req.PR}
+	var queuedAt time.Time
+	defer func() {
+		if queuedAt.IsZero() {
+			return
 		}
+		dequeueCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+		defer cancel()
+		if err := state.Dequeue(dequeueCtx, store, req.Env, entry.ID); err != nil {
+			logger.Warn("failed to leave slot queue", "env", req.Env, "id", entry.ID, "error", err)
+		}
+	}()
 
-		logger.Info("no free slot available yet; waiting before retry",
-			"env", envName,
-			"maxSlots", maxSlots,
-			"retryDelay", retryDelay.String(),
-		)
+	position := 0
+	for {
+		if queuedAt.IsZero() {
+			// Runners that arrive while others wait queue up behind them.
+			q, err := state.UpdateQueue(ctx, store, req.Env, func(entries []state.QueueEntry) ([]state.QueueEntry, bool) {
+				return entries, false
+			})
+			if err != nil {
+				return res, fmt.Errorf("read slot queue: %w", err)
+			}
+			if len(q.Entries) == 0 {
+				record, warm, err := acquireSlot(ctx, logger, store, req)
+				if err == nil {
+					res.record, res.warm = record, warm
+					return res, nil
+				}
+				// If the error is not about lack of free slots, return immediately.
+				if !state.IsNoFreeSlotError(err) {
+					return res, err
+				}
+			} else {
+				logger.Info("other runners are waiting for a slot; joining the queue", "env", req.Env, "waiting", len(q.Entries))
+			}
 
-		select {
-		case <-ctx.Done():
-			return state.EnvRecord{}, fmt.Errorf("timed out waiting for free slot: %w", ctx.Err())
-		case <-time.After(retryDelay):
+			if queue.priority != nil {
+				entry.Priority = queue.priority(ctx)
+			}
+			q, err = state.Enqueue(ctx, store, req.Env, entry)
+			if err != nil {
+				return res, fmt.Errorf("join slot queue: %w", err)
+			}
+			queuedAt = time.Now()
+			position = q.Position(entry.ID)
+			res.queuePosition = position
+			logger.Info("no free slot available yet; waiting in slot queue",
+				"env", req.Env,
+				"maxSlots", req.MaxSlots,
+				"position", position,
+				"queueLength", len(q.Entries),
+				"priority", entry.Priority,
+				"retryDelay", retryDelay.String(),
+			)
+		} else {
+			q, err := state.Enqueue(ctx, store, req.Env, entry)
+			if err != nil {
+				return res, fmt.Errorf("refresh slot queue entry: %w", err)
+			}
+			if pos := q.Position(entry.ID); pos != position {
+				position = pos
+				logger.Info("slot queue position changed", "env", req.Env, "position", position, "queueLength", len(q.Entries))
+			}
+			free, err := freeSlotCount(ctx, store, req.Env, req.MaxSlots)
+			if err != nil {
+				return res, err
+			}
+			if position <= free {
+				record, warm, err := acquireSlot(ctx, logger, store, req)
+				if err == nil {
+					res.record, res.warm = record, warm
+					res.queueWait = time.Since(queuedAt)
+					logger.Info("allocated slot after waiting in queue", "env", req.Env, "slot", record.Slot, "waited", res.queueWait.Truncate(time.Second).String())
+					return res, nil
+				}
+				if !state.IsNoFreeSlotError(err) {
+					return res, err
+				}
+			}
+		}
+
+		if err := waitForSlotTurn(ctx, retryDelay); err != nil {
+			return res, err
 		}
 	}
 }
@@ -1009,7 +1125,7 @@ func allocateSlotWithRetry(
 // matching the provided selector (envName/slot/issue/pr). When no record is found, it returns (nil, nil).
 func findMatchingEnvRecord(
 	ctx context.Context,
-	store *state.Store,
+	store state.StateBackend,
 	envName string,
 	slot int,
 	issue int,
@@ -1021,21 +1137,72 @@ func findMatchingEnvRecord(
 	}
 
 	for i := range records {
-		rec := records[i]
-		if envName != "" && rec.Env != envName {
-			continue
+		if envRecordMatches(records[i], envName, slot, issue, pr) {
+			return &records[i], nil
 		}
-		if slot > 0 && rec.Slot != slot {
+	}
+
+	return nil, nil
+}
+
+// envRecordMatches reports whether rec matches the selector; zero selector fields match any value.
+func envRecordMatches(rec state.EnvRecord, envName string, slot, issue, pr int) bool {
+	switch {
+	case envName != "" && rec.Env != envName:
+		return false
+	case slot > 0 && rec.Slot != slot:
+		return false
+	case issue > 0 && rec.Issue != issue:
+		return false
+	case pr > 0 && rec.PR != pr:
+		return false
+	}
+	return true
+}
+
+// settleDuplicateAllocation resolves the race of concurrent runs that allocated separate slots for the same
+// issue/PR: the earliest record (the lowest slot on ties) wins, the other runs release their own record (or
+// return their claimed warm slot to the pool) and continue with the winner. It returns the record to use and whether own was released.
+func settleDuplicateAllocation(
+	ctx context.Context,
+	logger *slog.Logger,
+	store state.StateBackend,
+	own state.EnvRecord,
+	warm bool,
+	issue int,
+	pr int,
+) (state.EnvRecord, bool, error) {
+	if issue <= 0 && pr <= 0 {
+		return own, false, nil
+	}
+	records, err := store.List(ctx)
+	if err != nil {
+		return own, false, err
+	}
+	winner := own
+	for _, rec := range records {
+		if !envRecordMatches(rec, own.Env, 0, issue, pr) {
 			continue
 		}
-		if issue > 0 && rec.Issue != issue {
-			continue
+		if rec.CreatedAt.Before(winner.CreatedAt) || (rec.CreatedAt.Equal(winner.CreatedAt) && rec.Slot < winner.Slot) {
+			winner = rec
 		}
-		if pr > 0 && rec.PR != pr {
-			continue
+	}
+	if winner.Slot == own.Slot {
+		return own, false, nil
+	}
+	if warm {
+		logger.Warn("another run allocated a slot for the same selector; returning our warm slot to the pool",
+			"slot", own.Slot, "winnerSlot", winner.Slot, "env", own.Env, "issue", issue, "pr", pr)
+		if err := store.Update(ctx, own.Slot, state.RecordUpdate{ClearLinks: true, Phase: state.PhaseWarm}); err != nil {
+			return own, false, fmt.Errorf("return duplicate slot %d to the warm pool: %w", own.Slot, err)
 		}
-		return &records[i], nil
+		return winner, true, nil
 	}
-
-	return nil, nil
+	logger.Warn("another run allocated a slot for the same selector; releasing ours",
+		"slot", own.Slot, "winnerSlot", winner.Slot, "env", own.Env, "issue", issue, "pr", pr)
+	if err := store.Release(ctx, own.Slot); err != nil {
+		return own, false, fmt.Errorf("release duplicate slot %d: %w", own.Slot, err)
+	}
+	return winner, true, nil
 }
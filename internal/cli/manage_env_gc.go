@@ -0,0 +1,215 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/codex-k8s/codexctl/internal/config"
+	"github.com/codex-k8s/codexctl/internal/githubapi"
+	"github.com/codex-k8s/codexctl/internal/state"
+)
+
+// newManageEnvGCCommand creates the "manage-env gc" subcommand that destroys environments whose slots
+// are older than --ttl or idle for longer than --idle and then drops their state records.
+func newManageEnvGCCommand(opts *Options) *cobra.Command {
+	var (
+		ttl      time.Duration
+		idle     time.Duration
+		dryRun   bool
+		skipOpen bool
+		repo     string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Destroy environments of expired or idle slots and drop their state",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			logger := LoggerFromContext(cmd.Context())
+			envCfg := gcEnv{}
+			if err := parseEnv(&envCfg); err != nil {
+				return err
+			}
+			if !cmd.Flags().Changed("ttl") && envPresent("CODEXCTL_GC_TTL") {
+				d, err := time.ParseDuration(envCfg.TTL)
+				if err != nil {
+					return fmt.Errorf("invalid CODEXCTL_GC_TTL: %w", err)
+				}
+				ttl = d
+			}
+			if !cmd.Flags().Changed("idle") && envPresent("CODEXCTL_GC_IDLE") {
+				d, err := time.ParseDuration(envCfg.Idle)
+				if err != nil {
+					return fmt.Errorf("invalid CODEXCTL_GC_IDLE: %w", err)
+				}
+				idle = d
+			}
+			if !cmd.Flags().Changed("dry-run") && envPresent("CODEXCTL_DRY_RUN") {
+				dryRun = envCfg.DryRun
+			}
+			if !cmd.Flags().Changed("skip-open") && envPresent("CODEXCTL_SKIP_OPEN") {
+				skipOpen = envCfg.SkipOpen
+			}
+			if !cmd.Flags().Changed("repo") && envPresent("CODEXCTL_REPO") {
+				repo = strings.TrimSpace(envCfg.Repo)
+			}
+			if ttl < 0 || idle < 0 {
+				return fmt.Errorf("--ttl and --idle must not be negative")
+			}
+			if ttl == 0 && idle == 0 {
+				return fmt.Errorf("at least one of --ttl or --idle must be set")
+			}
+
+			envName := opts.Env
+			if envName == "" {
+				envName = "ai"
+			}
+
+			var keep func(context.Context, state.EnvRecord) (string, error)
+			if skipOpen {
+				var err error
+				keep, err = openLinkKeeper(logger, resolveGitHubRepo(repo))
+				if err != nil {
+					return err
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), time.Hour)
+			defer cancel()
+
+			envStore, err := loadEnvSlotStore(opts, envName, config.LoadOptions{Env: envName}, logger, false)
+			if err != nil {
+				return err
+			}
+			collected, gcErr := envStore.store.GC(ctx, state.GCRequest{
+				Env:    envName,
+				TTL:    ttl,
+				Idle:   idle,
+				DryRun: dryRun,
+				Holder: "gc/" + slotLeaseHolder(envStore.templateCtx.EnvMap),
+				Keep:   keep,
+				Destroy: func(ctx context.Context, rec state.EnvRecord) error {
+					return destroySlotEnvironment(ctx, logger, opts, envStore, rec)
+				},
+			})
+			if err := printGCResult(cmd.OutOrStdout(), collected, dryRun); err != nil {
+				return err
+			}
+			return gcErr
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Env, "env", "ai", "Environment type (default: ai)")
+	cmd.Flags().DurationVar(&ttl, "ttl", 72*time.Hour, "Collect slots allocated longer ago than this (0 disables the age check)")
+	cmd.Flags().DurationVar(&idle, "idle", 0, "Collect slots without activity (prompt run, ensure-ready, apply) for this long (0 disables the idle check)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "List the slots that would be collected without destroying anything")
+	cmd.Flags().BoolVar(&skipOpen, "skip-open", false, "Keep slots whose linked issue or PR is still open on GitHub")
+	cmd.Flags().StringVar(&repo, "repo", "", "GitHub repository slug owner/repo for --skip-open (defaults to CODEXCTL_REPO)")
+
+	return cmd
+}
+
+// openLinkKeeper returns a GC keep check that retains slots whose issue or PR is open in repo.
+// States are cached for the duration of the run.
+func openLinkKeeper(logger *slog.Logger, repo string) (func(context.Context, state.EnvRecord) (string, error), error) {
+	links, err := newGitHubLinkStates(logger, repo)
+	if err != nil {
+		return nil, fmt.Errorf("--skip-open: %w", err)
+	}
+	return links.openLink, nil
+}
+
+// githubLinkStates looks up the GitHub states of the issues and PRs linked to slots and caches them for the
+// duration of a run.
+type githubLinkStates struct {
+	// client queries the repository.
+	client *githubapi.Client
+	// states maps issue and PR numbers to their state (OPEN, CLOSED or MERGED).
+	states map[int]string
+}
+
+// newGitHubLinkStates creates a link state lookup for repo; it requires a GitHub token.
+func newGitHubLinkStates(logger *slog.Logger, repo string) (*githubLinkStates, error) {
+	if repo == "" {
+		return nil, fmt.Errorf("GitHub repository is not set (use --repo or CODEXCTL_REPO)")
+	}
+	token, err := lookupGitHubToken()
+	if err != nil {
+		return nil, fmt.Errorf("GitHub token is required: %w", err)
+	}
+	client, err := githubapi.NewClient(logger, token, repo)
+	if err != nil {
+		return nil, err
+	}
+	return &githubLinkStates{client: client, states: map[int]string{}}, nil
+}
+
+// openLink describes the first open issue or PR linked to rec, e.g. "issue #12 is open", or returns "" when
+// rec has no open links.
+func (l *githubLinkStates) openLink(ctx context.Context, rec state.EnvRecord) (string, error) {
+	links := []struct {
+		kind   string
+		number int
+	}{{"issue", rec.Issue}, {"PR", rec.PR}}
+	for _, link := range links {
+		if link.number <= 0 {
+			continue
+		}
+		st, ok := l.states[link.number]
+		if !ok {
+			var err error
+			st, err = l.client.FetchIssueState(ctx, link.number)
+			if err != nil {
+				return "", fmt.Errorf("get state of %s #%d: %w", link.kind, link.number, err)
+			}
+			l.states[link.number] = st
+		}
+		if st == "OPEN" {
+			return fmt.Sprintf("%s #%d is open", link.kind, link.number), nil
+		}
+	}
+	return "", nil
+}
+
+// printGCResult prints the collected slots, or the slots that would be collected in dry-run mode.
+func printGCResult(w io.Writer, records []state.EnvRecord, dryRun bool) error {
+	if len(records) == 0 {
+		_, err := fmt.Fprintln(w, "No expired environments.")
+		return err
+	}
+	title := "Collected environments:"
+	if dryRun {
+		title = "Environments that would be collected:"
+	}
+	if _, err := fmt.Fprintln(w, title); err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "SLOT\tNAMESPACE\tISSUE\tPR\tAGE\tIDLE")
+	now := time.Now()
+	for _, rec := range records {
+		_, _ = fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n",
+			rec.Slot,
+			dashIfEmpty(rec.Namespace),
+			numberOrDash(rec.Issue),
+			numberOrDash(rec.PR),
+			shortDuration(now.Sub(rec.CreatedAt)),
+			shortDuration(now.Sub(rec.IdleSince())),
+		)
+	}
+	return tw.Flush()
+}
+
+// numberOrDash formats an issue or PR number, or "-" when it is unset.
+func numberOrDash(n int) string {
+	if n <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("#%d", n)
+}
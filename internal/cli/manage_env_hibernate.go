@@ -0,0 +1,153 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/codex-k8s/codexctl/internal/config"
+	"github.com/codex-k8s/codexctl/internal/kube"
+	"github.com/codex-k8s/codexctl/internal/state"
+)
+
+// defaultHibernateIdle is the idle time after which "manage-env hibernate" scales a slot down by default.
+const defaultHibernateIdle = 2 * time.Hour
+
+// newManageEnvHibernateCommand creates the "manage-env hibernate" subcommand that scales the Deployments and
+// StatefulSets of slots idle for longer than --idle to zero. "ci ensure-ready" and "prompt run" wake a
+// hibernated slot before using it.
+func newManageEnvHibernateCommand(opts *Options) *cobra.Command {
+	var (
+		idle   time.Duration
+		dryRun bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "hibernate",
+		Short: "Scale the workloads of idle slots to zero until their next use",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			logger := LoggerFromContext(cmd.Context())
+			envCfg := hibernateEnv{}
+			if err := parseEnv(&envCfg); err != nil {
+				return err
+			}
+			if !cmd.Flags().Changed("idle") && envPresent("CODEXCTL_HIBERNATE_IDLE") {
+				d, err := time.ParseDuration(envCfg.Idle)
+				if err != nil {
+					return fmt.Errorf("invalid CODEXCTL_HIBERNATE_IDLE: %w", err)
+				}
+				idle = d
+			}
+			if !cmd.Flags().Changed("dry-run") && envPresent("CODEXCTL_DRY_RUN") {
+				dryRun = envCfg.DryRun
+			}
+			if idle <= 0 {
+				return fmt.Errorf("--idle must be positive")
+			}
+
+			envName := opts.Env
+			if envName == "" {
+				envName = "ai"
+			}
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), time.Hour)
+			defer cancel()
+
+			envStore, err := loadEnvSlotStore(opts, envName, config.LoadOptions{Env: envName}, logger, false)
+			if err != nil {
+				return err
+			}
+			hibernated, hibernateErr := state.Hibernate(ctx, logger, envStore.store, state.HibernateRequest{
+				Env:    envName,
+				Idle:   idle,
+				DryRun: dryRun,
+				Holder: "hibernate/" + slotLeaseHolder(envStore.templateCtx.EnvMap),
+				Scale: func(ctx context.Context, rec state.EnvRecord) error {
+					workloads, err := kube.HibernateWorkloads(ctx, envStore.kubeClient, rec.Namespace)
+					if err != nil {
+						return err
+					}
+					logger.Info("slot scaled to zero", "slot", rec.Slot, "namespace", rec.Namespace, "workloads", len(workloads))
+					return nil
+				},
+			})
+			if err := printHibernateResult(cmd.OutOrStdout(), hibernated, dryRun); err != nil {
+				return err
+			}
+			return hibernateErr
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Env, "env", "ai", "Environment type (default: ai)")
+	cmd.Flags().DurationVar(&idle, "idle", defaultHibernateIdle, "Hibernate slots without activity (prompt run, ensure-ready, apply) for this long")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "List the slots that would be hibernated without scaling anything")
+
+	return cmd
+}
+
+// wakeSlot scales the workloads of a hibernated slot namespace back to their recorded replicas and waits for
+// the rollout of the namespace. The rollout report is nil when the wait did not run, i.e. scaling failed.
+func wakeSlot(ctx context.Context, logger *slog.Logger, client kube.Orchestrator, namespace, waitTimeout string) (*kube.RolloutReport, error) {
+	if client == nil {
+		return nil, fmt.Errorf("kubernetes client is nil")
+	}
+	scaleCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	workloads, err := kube.WakeWorkloads(scaleCtx, client, namespace)
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("scale up workloads in %s: %w", namespace, err)
+	}
+	logger.Info("waking hibernated slot", "namespace", namespace, "workloads", len(workloads))
+	return waitForRollout(ctx, logger, client, namespace, waitTimeout)
+}
+
+// printHibernateResult prints the hibernated slots, or the slots that would be hibernated in dry-run mode.
+func printHibernateResult(w io.Writer, records []state.EnvRecord, dryRun bool) error {
+	if len(records) == 0 {
+		_, err := fmt.Fprintln(w, "No idle environments.")
+		return err
+	}
+	title := "Hibernated environments:"
+	if dryRun {
+		title = "Environments that would be hibernated:"
+	}
+	if _, err := fmt.Fprintln(w, title); err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "SLOT\tNAMESPACE\tISSUE\tPR\tIDLE")
+	now := time.Now()
+	for _, rec := range records {
+		_, _ = fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n",
+			rec.Slot,
+			dashIfEmpty(rec.Namespace),
+			numberOrDash(rec.Issue),
+			numberOrDash(rec.PR),
+			shortDuration(now.Sub(rec.IdleSince())),
+		)
+	}
+	return tw.Flush()
+}
+
+// slotHibernated reports whether the state record of slot in envName is hibernated. Lookup failures are
+// logged and report false, so that callers fall back to the awake view of the slot.
+func slotHibernated(ctx context.Context, logger *slog.Logger, opts *Options, envName string, slot int) bool {
+	envStore, err := loadEnvSlotStore(opts, envName, config.LoadOptions{Env: envName, Slot: slot}, logger, false)
+	if err != nil {
+		logger.Debug("state store unavailable; slot phase unknown", "slot", slot, "error", err)
+		return false
+	}
+	lookupCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	rec, err := state.FindRecord(lookupCtx, envStore.store, slot)
+	if err != nil {
+		logger.Debug("slot record unavailable; slot phase unknown", "slot", slot, "error", err)
+		return false
+	}
+	return rec.Phase == state.PhaseHibernated
+}
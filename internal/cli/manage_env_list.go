@@ -0,0 +1,243 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/codex-k8s/codexctl/internal/config"
+	"github.com/codex-k8s/codexctl/internal/kube"
+	"github.com/codex-k8s/codexctl/internal/state"
+)
+
+// slotListEntry is a slot record with its live health as shown by "manage-env list".
+type slotListEntry struct {
+	// Slot is the slot number.
+	Slot int `json:"slot" yaml:"slot"`
+	// Env is the environment name.
+	Env string `json:"env" yaml:"env"`
+	// Namespace is the slot namespace.
+	Namespace string `json:"namespace" yaml:"namespace"`
+	// Issue is the associated issue number.
+	Issue int `json:"issue,omitempty" yaml:"issue,omitempty"`
+	// PR is the associated pull request number.
+	PR int `json:"pr,omitempty" yaml:"pr,omitempty"`
+	// Owner is the run that allocated the slot.
+	Owner string `json:"owner,omitempty" yaml:"owner,omitempty"`
+	// Branch is the working branch.
+	Branch string `json:"branch,omitempty" yaml:"branch,omitempty"`
+	// HeadSHA is the head commit of Branch.
+	HeadSHA string `json:"headSha,omitempty" yaml:"headSha,omitempty"`
+	// PromptKind is the prompt kind of the last agent run.
+	PromptKind string `json:"promptKind,omitempty" yaml:"promptKind,omitempty"`
+	// Model is the model of the last agent run.
+	Model string `json:"model,omitempty" yaml:"model,omitempty"`
+	// Phase is the lifecycle phase.
+	Phase string `json:"phase,omitempty" yaml:"phase,omitempty"`
+	// Holder is the runner holding an active lease on the slot.
+	Holder string `json:"holder,omitempty" yaml:"holder,omitempty"`
+	// CreatedAt is the allocation time.
+	CreatedAt time.Time `json:"createdAt" yaml:"createdAt"`
+	// LastActivityAt is the last activity time, nil when none was recorded.
+	LastActivityAt *time.Time `json:"lastActivityAt,omitempty" yaml:"lastActivityAt,omitempty"`
+	// Health is the live state of the slot environment.
+	Health slotHealth `json:"health" yaml:"health"`
+}
+
+// slotHealth is the live state of a slot environment.
+type slotHealth struct {
+	// NamespaceExists reports whether the slot namespace exists.
+	NamespaceExists bool `json:"namespaceExists" yaml:"namespaceExists"`
+	// CodexReady reports whether the Codex Deployment finished its rollout.
+	CodexReady bool `json:"codexReady" yaml:"codexReady"`
+	// Error describes why the health could not be read.
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// newManageEnvListCommand creates the "manage-env list" subcommand that shows the slot records of an
+// environment with their live health.
+func newManageEnvListCommand(opts *Options) *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List environment slots with their metadata and live health",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			logger := LoggerFromContext(cmd.Context())
+			switch output {
+			case "table", "json", "yaml":
+			default:
+				return fmt.Errorf("unsupported output %q (use table, json or yaml)", output)
+			}
+
+			envName := opts.Env
+			if envName == "" {
+				envName = "ai"
+			}
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), 2*time.Minute)
+			defer cancel()
+
+			envStore, err := loadEnvSlotStore(opts, envName, config.LoadOptions{Env: envName}, logger, true)
+			if err != nil {
+				return err
+			}
+			records, err := envStore.store.List(ctx)
+			if err != nil {
+				return err
+			}
+
+			now := time.Now()
+			entries := []slotListEntry{}
+			for _, rec := range records {
+				if rec.Env != envName {
+					continue
+				}
+				entries = append(entries, newSlotListEntry(ctx, envStore.kubeClient, rec, now))
+			}
+			return printSlotList(os.Stdout, entries, output, now)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Env, "env", "ai", "Environment type (default: ai)")
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "Output format: table, json or yaml")
+
+	return cmd
+}
+
+// newSlotListEntry builds the list entry of rec and reads its health from the cluster.
+func newSlotListEntry(ctx context.Context, client kube.ObjectClient, rec state.EnvRecord, now time.Time) slotListEntry {
+	entry := slotListEntry{
+		Slot:       rec.Slot,
+		Env:        rec.Env,
+		Namespace:  rec.Namespace,
+		Issue:      rec.Issue,
+		PR:         rec.PR,
+		Owner:      rec.Owner,
+		Branch:     rec.Branch,
+		HeadSHA:    rec.HeadSHA,
+		PromptKind: rec.PromptKind,
+		Model:      rec.Model,
+		Phase:      rec.Phase,
+		CreatedAt:  rec.CreatedAt,
+	}
+	if rec.Lease.Active(now) {
+		entry.Holder = rec.Lease.Holder
+	}
+	if !rec.LastActivityAt.IsZero() {
+		at := rec.LastActivityAt
+		entry.LastActivityAt = &at
+	}
+	if strings.TrimSpace(rec.Namespace) == "" {
+		entry.Health.Error = "namespace is not recorded"
+		return entry
+	}
+
+	ns, err := client.GetObject(ctx, kube.ObjectRef{APIVersion: "v1", Kind: "Namespace", Name: rec.Namespace})
+	if err != nil {
+		entry.Health.Error = err.Error()
+		return entry
+	}
+	if ns == nil {
+		return entry
+	}
+	entry.Health.NamespaceExists = true
+	codex, err := kube.GetWorkloadState(ctx, client, "Deployment", rec.Namespace, codexDeployment)
+	if err != nil {
+		entry.Health.Error = err.Error()
+		return entry
+	}
+	entry.Health.CodexReady = codex != nil && codex.Ready
+	return entry
+}
+
+// printSlotList writes the entries as a table, JSON or YAML.
+func printSlotList(w io.Writer, entries []slotListEntry, output string, now time.Time) error {
+	switch output {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(entries); err != nil {
+			return fmt.Errorf("encode slot list: %w", err)
+		}
+		return nil
+	case "yaml":
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(entries); err != nil {
+			return fmt.Errorf("encode slot list: %w", err)
+		}
+		return enc.Close()
+	}
+
+	if len(entries) == 0 {
+		_, err := fmt.Fprintln(w, "No environment slots.")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SLOT\tNAMESPACE\tISSUE\tPR\tPHASE\tOWNER\tBRANCH\tAGE\tLAST ACTIVITY\tHEALTH")
+	for _, e := range entries {
+		lastActivity := "-"
+		if e.LastActivityAt != nil {
+			lastActivity = shortDuration(now.Sub(*e.LastActivityAt)) + " ago"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.Slot,
+			dashIfEmpty(e.Namespace),
+			numberOrDash(e.Issue),
+			numberOrDash(e.PR),
+			dashIfEmpty(e.Phase),
+			dashIfEmpty(e.Owner),
+			dashIfEmpty(e.Branch),
+			shortDuration(now.Sub(e.CreatedAt)),
+			lastActivity,
+			e.Health.summary(),
+		)
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("write slot list: %w", err)
+	}
+	return nil
+}
+
+// summary formats the health for the table output.
+func (h slotHealth) summary() string {
+	switch {
+	case h.Error != "":
+		return "unknown"
+	case !h.NamespaceExists:
+		return "no namespace"
+	case !h.CodexReady:
+		return "codex not ready"
+	default:
+		return "ready"
+	}
+}
+
+// shortDuration formats d with its two most significant units, e.g. 3d4h, 5h12m, 42m or 30s.
+func shortDuration(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	days := int(d / (24 * time.Hour))
+	hours := int(d / time.Hour % 24)
+	minutes := int(d / time.Minute % 60)
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd%dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh%dm", hours, minutes)
+	case minutes > 0:
+		return fmt.Sprintf("%dm", minutes)
+	default:
+		return fmt.Sprintf("%ds", int(d/time.Second))
+	}
+}
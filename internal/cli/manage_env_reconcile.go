@@ -0,0 +1,492 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/codex-k8s/codexctl/internal/config"
+	"github.com/codex-k8s/codexctl/internal/kube"
+	"github.com/codex-k8s/codexctl/internal/state"
+)
+
+// Kinds of findings reported by "manage-env reconcile".
+const (
+	// reconcileOrphanedSlot is a slot whose linked issues and PRs are all closed.
+	reconcileOrphanedSlot = "orphaned-slot"
+	// reconcileDanglingRecord is a state record whose namespace no longer exists.
+	reconcileDanglingRecord = "dangling-record"
+	// reconcileUnownedNamespace is a namespace matching the slot namespace pattern without a state record.
+	reconcileUnownedNamespace = "unowned-namespace"
+)
+
+// Actions taken on reconcile findings.
+const (
+	// reconcileDestroyed means the environment was destroyed and its state record (if any) released.
+	reconcileDestroyed = "destroyed"
+	// reconcileReleased means the state record was released.
+	reconcileReleased = "released"
+	// reconcileWouldDestroy is the dry-run counterpart of reconcileDestroyed.
+	reconcileWouldDestroy = "would destroy"
+	// reconcileWouldRelease is the dry-run counterpart of reconcileReleased.
+	reconcileWouldRelease = "would release"
+	// reconcileSkipped means a runner picked the slot up, or it was released or allocated, before it was reclaimed.
+	reconcileSkipped = "skipped"
+	// reconcileFailed means reclaiming failed; Error holds the reason.
+	reconcileFailed = "failed"
+)
+
+const (
+	// reconcileLeaseDuration bounds how long reconcile holds the lease of a slot it destroys.
+	reconcileLeaseDuration = 30 * time.Minute
+	// reconcileSlotSentinel is the slot number rendered into the namespace pattern to derive its slot regexp.
+	reconcileSlotSentinel = 987654321
+	// reconcileTransitionTimeout bounds how long a slot may stay allocating, warming or destroying without an
+	// active lease before reconcile treats the run that moved it there as dead; it covers warm provisioning,
+	// the longest of these transitions.
+	reconcileTransitionTimeout = warmProvisionTimeout
+	// reconcileNamespaceGrace is the minimum age of a namespace without a state record before reconcile destroys
+	// it, so that a slot allocated while reconcile runs is not taken for unowned.
+	reconcileNamespaceGrace = 15 * time.Minute
+)
+
+// reconcileReport is the outcome of "manage-env reconcile".
+type reconcileReport struct {
+	// Env is the reconciled environment.
+	Env string `json:"env" yaml:"env"`
+	// Repo is the GitHub repository the links were checked against.
+	Repo string `json:"repo" yaml:"repo"`
+	// DryRun reports that nothing was changed.
+	DryRun bool `json:"dryRun" yaml:"dryRun"`
+	// Items are the findings.
+	Items []reconcileItem `json:"items" yaml:"items"`
+}
+
+// reconcileItem is an orphaned slot, dangling state record or unowned namespace.
+type reconcileItem struct {
+	// Kind is one of the reconcile* finding kinds.
+	Kind string `json:"kind" yaml:"kind"`
+	// Slot is the slot number (for unowned namespaces, as derived from the namespace name).
+	Slot int `json:"slot" yaml:"slot"`
+	// Namespace is the slot namespace.
+	Namespace string `json:"namespace" yaml:"namespace"`
+	// Issue is the linked issue number.
+	Issue int `json:"issue,omitempty" yaml:"issue,omitempty"`
+	// PR is the linked pull request number.
+	PR int `json:"pr,omitempty" yaml:"pr,omitempty"`
+	// Reason explains the finding.
+	Reason string `json:"reason" yaml:"reason"`
+	// Action is what was done about it (one of the reconcile* actions).
+	Action string `json:"action" yaml:"action"`
+	// Error describes why the action failed.
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// newManageEnvReconcileCommand creates the "manage-env reconcile" subcommand that compares slot records and
+// slot namespaces with GitHub and the cluster, and destroys orphaned slots, releases dangling state records and
+// destroys unowned namespaces.
+func newManageEnvReconcileCommand(opts *Options) *cobra.Command {
+	var (
+		repo   string
+		dryRun bool
+		output string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "reconcile",
+		Short: "Clean up slots of closed issues/PRs, records without namespaces and namespaces without records",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			logger := LoggerFromContext(cmd.Context())
+			envCfg := reconcileEnv{}
+			if err := parseEnv(&envCfg); err != nil {
+				return err
+			}
+			if !cmd.Flags().Changed("repo") && envPresent("CODEXCTL_REPO") {
+				repo = strings.TrimSpace(envCfg.Repo)
+			}
+			if !cmd.Flags().Changed("dry-run") && envPresent("CODEXCTL_DRY_RUN") {
+				dryRun = envCfg.DryRun
+			}
+			switch output {
+			case "table", "json", "yaml":
+			default:
+				return fmt.Errorf("unsupported output %q (use table, json or yaml)", output)
+			}
+
+			envName := opts.Env
+			if envName == "" {
+				envName = "ai"
+			}
+			repo = resolveGitHubRepo(repo)
+			links, err := newGitHubLinkStates(logger, repo)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), time.Hour)
+			defer cancel()
+
+			envStore, err := loadEnvSlotStore(opts, envName, config.LoadOptions{Env: envName}, logger, output != "table")
+			if err != nil {
+				return err
+			}
+			report, reconcileErr := reconcileSlots(ctx, logger, opts, reconcileRequest{
+				envName:  envName,
+				envStore: envStore,
+				links:    links,
+				dryRun:   dryRun,
+				holder:   "reconcile/" + slotLeaseHolder(envStore.templateCtx.EnvMap),
+			})
+			report.Repo = repo
+			if err := printReconcileReport(os.Stdout, report, output); err != nil {
+				return err
+			}
+			return reconcileErr
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Env, "env", "ai", "Environment type (default: ai)")
+	cmd.Flags().StringVar(&repo, "repo", "", "GitHub repository slug owner/repo (defaults to CODEXCTL_REPO)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Report the findings without destroying or releasing anything")
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "Output format: table, json or yaml")
+
+	return cmd
+}
+
+// reconcileRequest describes a reconcile run.
+type reconcileRequest struct {
+	// envName is the reconciled environment.
+	envName string
+	// envStore holds the stack, cluster client and state backend of the environment.
+	envStore *envSlotStore
+	// links looks up the states of linked issues and PRs.
+	links *githubLinkStates
+	// dryRun reports the findings without acting on them.
+	dryRun bool
+	// holder is the lease holder reconcile takes on a slot while it destroys it.
+	holder string
+}
+
+// reconcileSlots finds and, unless req.dryRun, reclaims the orphaned slots, dangling state records and unowned
+// namespaces of req.envName. Slots with an active lease are left alone, and so are slots being allocated,
+// provisioned or destroyed until reconcileTransitionTimeout has passed since their last activity, after which the
+// run that moved them there is taken for dead. Namespaces younger than reconcileNamespaceGrace are not taken for
+// unowned; GitHub lookup failures keep the slot and are logged. The report lists every finding; the error joins
+// the failed actions.
+func reconcileSlots(ctx context.Context, logger *slog.Logger, opts *Options, req reconcileRequest) (reconcileReport, error) {
+	report := reconcileReport{Env: req.envName, DryRun: req.dryRun, Items: []reconcileItem{}}
+	store := req.envStore.store
+
+	records, err := store.List(ctx)
+	if err != nil {
+		return report, err
+	}
+	nsItems, err := req.envStore.kubeClient.GetObjects(ctx, "", "", []string{"namespaces"})
+	if err != nil {
+		return report, fmt.Errorf("list namespaces: %w", err)
+	}
+	namespaces := make(map[string]bool, len(nsItems))
+	nsCreated := make(map[string]time.Time, len(nsItems))
+	for _, item := range nsItems {
+		meta, _ := item["metadata"].(map[string]any)
+		status, _ := item["status"].(map[string]any)
+		name, _ := meta["name"].(string)
+		phase, _ := status["phase"].(string)
+		// A terminating namespace is already on its way out.
+		namespaces[name] = phase != "Terminating"
+		if created, _ := meta["creationTimestamp"].(string); created != "" {
+			if t, err := time.Parse(time.RFC3339, created); err == nil {
+				nsCreated[name] = t
+			}
+		}
+	}
+
+	var errs []error
+	owned := map[string]struct{}{}
+	now := time.Now()
+	for _, rec := range records {
+		owned[rec.Namespace] = struct{}{}
+		if rec.Env != req.envName || rec.Slot <= 0 || rec.Namespace == "" {
+			continue
+		}
+		if rec.Lease.Active(now) {
+			logger.Info("skipping slot with an active lease", "slot", rec.Slot, "holder", rec.Lease.Holder)
+			continue
+		}
+		switch rec.Phase {
+		case state.PhaseAllocating, state.PhaseWarming, state.PhaseDestroying:
+			// Fresh records may not be leased yet; the age counts from the last recorded activity.
+			if now.Sub(rec.IdleSince()) < reconcileTransitionTimeout {
+				continue
+			}
+			logger.Info("reconciling slot stuck in a transitional phase", "slot", rec.Slot, "phase", rec.Phase, "since", rec.IdleSince().Format(time.RFC3339))
+		}
+
+		item := reconcileItem{Slot: rec.Slot, Namespace: rec.Namespace, Issue: rec.Issue, PR: rec.PR}
+		if _, ok := namespaces[rec.Namespace]; !ok {
+			item.Kind = reconcileDanglingRecord
+			item.Reason = "namespace does not exist"
+		} else {
+			if rec.Issue <= 0 && rec.PR <= 0 {
+				continue
+			}
+			open, err := req.links.openLink(ctx, rec)
+			if err != nil {
+				logger.Warn("keeping slot: link state lookup failed", "slot", rec.Slot, "error", err)
+				continue
+			}
+			if open != "" {
+				continue
+			}
+			item.Kind = reconcileOrphanedSlot
+			item.Reason = closedLinksReason(rec)
+		}
+
+		if err := reclaimSlot(ctx, logger, opts, req, rec, &item); err != nil {
+			errs = append(errs, fmt.Errorf("%s slot %d: %w", item.Kind, rec.Slot, err))
+		}
+		report.Items = append(report.Items, item)
+	}
+
+	nsPatterns, err := slotNamespacePatterns(opts, req.envStore, req.envName)
+	if err != nil {
+		return report, errors.Join(append(errs, err)...)
+	}
+	if len(nsPatterns) == 0 {
+		logger.Info("namespace of the environment does not depend on the slot; skipping unowned namespaces", "env", req.envName)
+		return report, errors.Join(errs...)
+	}
+	names := make([]string, 0, len(namespaces))
+	for name := range namespaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := owned[name]; ok || !namespaces[name] {
+			continue
+		}
+		var m []string
+		for _, re := range nsPatterns {
+			if m = re.FindStringSubmatch(name); m != nil {
+				break
+			}
+		}
+		if m == nil {
+			continue
+		}
+		slot, err := strconv.Atoi(m[1])
+		if err != nil {
+			continue
+		}
+		if created, ok := nsCreated[name]; ok && now.Sub(created) < reconcileNamespaceGrace {
+			logger.Info("skipping recently created namespace without a state record", "namespace", name, "created", created.Format(time.RFC3339))
+			continue
+		}
+		item := reconcileItem{Kind: reconcileUnownedNamespace, Slot: slot, Namespace: name, Reason: "no state record references the namespace"}
+		if err := destroyUnownedNamespace(ctx, logger, opts, req, &item); err != nil {
+			errs = append(errs, fmt.Errorf("unowned namespace %s: %w", name, err))
+		}
+		report.Items = append(report.Items, item)
+	}
+	return report, errors.Join(errs...)
+}
+
+// reclaimSlot destroys the environment of an orphaned slot and releases its record, or only releases the record
+// of a dangling one. Reconcile holds the slot lease meanwhile; a slot picked up by a runner is skipped. The
+// outcome is recorded in item.
+func reclaimSlot(ctx context.Context, logger *slog.Logger, opts *Options, req reconcileRequest, rec state.EnvRecord, item *reconcileItem) error {
+	destroy := item.Kind == reconcileOrphanedSlot
+	if req.dryRun {
+		item.Action = reconcileWouldRelease
+		if destroy {
+			item.Action = reconcileWouldDestroy
+		}
+		logger.Info("would reconcile slot", "kind", item.Kind, "slot", rec.Slot, "namespace", rec.Namespace, "reason", item.Reason)
+		return nil
+	}
+
+	store := req.envStore.store
+	if _, err := state.AcquireLease(ctx, store, rec.Slot, req.holder, reconcileLeaseDuration, state.RecordUpdate{Phase: state.PhaseDestroying}); err != nil {
+		var held *state.LeaseHeldError
+		switch {
+		case errors.As(err, &held):
+			logger.Info("skipping slot picked up by a runner", "slot", rec.Slot, "holder", held.Lease.Holder)
+			item.Action = reconcileSkipped
+			return nil
+		case errors.Is(err, state.ErrRecordNotFound):
+			logger.Info("skipping slot released meanwhile", "slot", rec.Slot)
+			item.Action = reconcileSkipped
+			return nil
+		}
+		return failReconcileItem(item, fmt.Errorf("lease slot: %w", err))
+	}
+	logger.Info("reconciling slot", "kind", item.Kind, "slot", rec.Slot, "namespace", rec.Namespace, "reason", item.Reason)
+	if destroy {
+		if err := destroySlotEnvironment(ctx, logger, opts, req.envStore, rec); err != nil {
+			if err := state.ReleaseLease(context.WithoutCancel(ctx), store, rec.Slot, req.holder, state.RecordUpdate{}); err != nil {
+				logger.Warn("failed to release reconcile lease", "slot", rec.Slot, "error", err)
+			}
+			return failReconcileItem(item, fmt.Errorf("destroy: %w", err))
+		}
+	}
+	if err := store.Release(ctx, rec.Slot); err != nil {
+		return failReconcileItem(item, fmt.Errorf("release state record %s: %w", rec.Name, err))
+	}
+	item.Action = reconcileReleased
+	if destroy {
+		item.Action = reconcileDestroyed
+	}
+	return nil
+}
+
+// destroyUnownedNamespace destroys the slot environment deployed into an unowned namespace and deletes the
+// namespace. The state records are read again first: a namespace whose slot was allocated after reconcile listed
+// the records is skipped. The outcome is recorded in item.
+func destroyUnownedNamespace(ctx context.Context, logger *slog.Logger, opts *Options, req reconcileRequest, item *reconcileItem) error {
+	records, err := req.envStore.store.List(ctx)
+	if err != nil {
+		return failReconcileItem(item, fmt.Errorf("list state records: %w", err))
+	}
+	for _, rec := range records {
+		if rec.Namespace == item.Namespace || (rec.Env == req.envName && rec.Slot == item.Slot) {
+			logger.Info("skipping namespace of a slot allocated meanwhile", "namespace", item.Namespace, "slot", rec.Slot)
+			item.Action = reconcileSkipped
+			return nil
+		}
+	}
+	if req.dryRun {
+		item.Action = reconcileWouldDestroy
+		logger.Info("would destroy unowned namespace", "namespace", item.Namespace, "slot", item.Slot)
+		return nil
+	}
+	logger.Info("destroying unowned namespace", "namespace", item.Namespace, "slot", item.Slot)
+	rec := state.EnvRecord{Env: req.envName, Slot: item.Slot, Namespace: item.Namespace}
+	if err := destroySlotEnvironment(ctx, logger, opts, req.envStore, rec); err != nil {
+		return failReconcileItem(item, fmt.Errorf("destroy: %w", err))
+	}
+	ref := kube.ObjectRef{APIVersion: "v1", Kind: "Namespace", Name: item.Namespace}
+	if err := req.envStore.kubeClient.DeleteObject(ctx, ref); err != nil {
+		return failReconcileItem(item, fmt.Errorf("delete namespace: %w", err))
+	}
+	item.Action = reconcileDestroyed
+	return nil
+}
+
+// failReconcileItem marks item as failed with err and returns err.
+func failReconcileItem(item *reconcileItem, err error) error {
+	item.Action = reconcileFailed
+	item.Error = err.Error()
+	return err
+}
+
+// closedLinksReason describes the closed links of an orphaned slot, e.g. "issue #12 and PR #15 are closed".
+func closedLinksReason(rec state.EnvRecord) string {
+	var parts []string
+	if rec.Issue > 0 {
+		parts = append(parts, fmt.Sprintf("issue #%d", rec.Issue))
+	}
+	if rec.PR > 0 {
+		parts = append(parts, fmt.Sprintf("PR #%d", rec.PR))
+	}
+	if len(parts) == 1 {
+		return parts[0] + " is closed"
+	}
+	return strings.Join(parts, " and ") + " are closed"
+}
+
+// slotNamespacePatterns returns regexps matching the namespaces of envName slots, with the slot number as their
+// first group: the namespace slots are allocated with and, when it differs, the namespace the stack renders for
+// a slot (namespace.patterns). It returns none when the namespace of the environment does not depend on the slot.
+func slotNamespacePatterns(opts *Options, envStore *envSlotStore, envName string) ([]*regexp.Regexp, error) {
+	ctx := envStore.templateCtx
+	ctx.Namespace = ""
+	ctx.Slot = reconcileSlotSentinel
+	resolved, err := config.ResolveNamespace(envStore.stackCfg, ctx, envName)
+	if err != nil {
+		return nil, err
+	}
+	_, slotCtx, err := config.LoadStackConfig(opts.ConfigPath, config.LoadOptions{Env: envName, Slot: reconcileSlotSentinel})
+	if err != nil {
+		return nil, err
+	}
+	candidates := []string{resolved, slotCtx.Namespace}
+
+	sentinel := strconv.Itoa(reconcileSlotSentinel)
+	seen := map[string]struct{}{}
+	var out []*regexp.Regexp
+	for _, ns := range candidates {
+		if _, ok := seen[ns]; ok || !strings.Contains(ns, sentinel) {
+			continue
+		}
+		seen[ns] = struct{}{}
+		parts := strings.Split(ns, sentinel)
+		for i, part := range parts {
+			parts[i] = regexp.QuoteMeta(part)
+		}
+		re, err := regexp.Compile("^" + strings.Join(parts, "([1-9][0-9]*)") + "$")
+		if err != nil {
+			return nil, fmt.Errorf("compile namespace pattern of env %q: %w", envName, err)
+		}
+		out = append(out, re)
+	}
+	return out, nil
+}
+
+// printReconcileReport writes the report as a table, JSON or YAML.
+func printReconcileReport(w io.Writer, report reconcileReport, output string) error {
+	switch output {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return fmt.Errorf("encode reconcile report: %w", err)
+		}
+		return nil
+	case "yaml":
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(report); err != nil {
+			return fmt.Errorf("encode reconcile report: %w", err)
+		}
+		return enc.Close()
+	}
+
+	if len(report.Items) == 0 {
+		_, err := fmt.Fprintln(w, "No orphaned slots, dangling records or unowned namespaces.")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tSLOT\tNAMESPACE\tISSUE\tPR\tACTION\tREASON")
+	for _, item := range report.Items {
+		reason := item.Reason
+		if item.Error != "" {
+			reason += ": " + item.Error
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			item.Kind,
+			item.Slot,
+			dashIfEmpty(item.Namespace),
+			numberOrDash(item.Issue),
+			numberOrDash(item.PR),
+			item.Action,
+			reason,
+		)
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("write reconcile report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,473 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/codex-k8s/codexctl/internal/config"
+	"github.com/codex-k8s/codexctl/internal/kube"
+	"github.com/codex-k8s/codexctl/internal/state"
+)
+
+const (
+	// defaultSnapshotTimeout bounds each snapshot wait: snapshot readiness, pod termination, claim deletion
+	// and the rollout of scaled-up workloads.
+	defaultSnapshotTimeout = "10m"
+	// snapshotCommandTimeout bounds a whole snapshot create or restore command.
+	snapshotCommandTimeout = time.Hour
+)
+
+// snapshotTarget is the namespace a snapshot command works on.
+type snapshotTarget struct {
+	// envName is the environment name.
+	envName string
+	// slot is the slot number (0 for environments without slots).
+	slot int
+	// namespace is the environment namespace.
+	namespace string
+	// stackCfg is the stack configuration loaded for the namespace.
+	stackCfg *config.StackConfig
+	// envCfg is the resolved environment configuration.
+	envCfg config.Environment
+	// kubeClient is the Kubernetes client of the environment cluster.
+	kubeClient kube.Orchestrator
+	// store is the state backend holding the snapshot catalog.
+	store state.StateBackend
+}
+
+// newManageEnvSnapshotCommand creates the "manage-env snapshot" group that takes CSI VolumeSnapshots of the
+// data volumes of an environment namespace and restores them.
+func newManageEnvSnapshotCommand(opts *Options) *cobra.Command {
+	return newGroupCommand("snapshot", "Snapshot and restore the data volumes of an environment",
+		newManageEnvSnapshotCreateCommand(opts),
+		newManageEnvSnapshotRestoreCommand(opts),
+		newManageEnvSnapshotListCommand(opts),
+	)
+}
+
+// newManageEnvSnapshotCreateCommand creates "manage-env snapshot create" that snapshots every bound claim of
+// the environment namespace and records the snapshot in the state backend.
+func newManageEnvSnapshotCreateCommand(opts *Options) *cobra.Command {
+	var (
+		sel         slotSelector
+		name        string
+		class       string
+		waitTimeout string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Take VolumeSnapshots of the persistent volume claims of an environment",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			logger := LoggerFromContext(cmd.Context())
+			envCfg := snapshotEnv{}
+			if err := parseEnv(&envCfg); err != nil {
+				return err
+			}
+			if !cmd.Flags().Changed("name") && envPresent("CODEXCTL_SNAPSHOT_NAME") {
+				name = envCfg.Name
+			}
+			if !cmd.Flags().Changed("class") && envPresent("CODEXCTL_SNAPSHOT_CLASS") {
+				class = envCfg.Class
+			}
+			if !cmd.Flags().Changed("wait-timeout") && envPresent("CODEXCTL_WAIT_TIMEOUT") {
+				waitTimeout = envCfg.WaitTimeout
+			}
+			name = strings.TrimSpace(name)
+			if name == "" {
+				name = time.Now().UTC().Format("20060102-150405")
+			}
+			if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+				return fmt.Errorf("invalid snapshot name %q: %s", name, strings.Join(errs, "; "))
+			}
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), snapshotCommandTimeout)
+			defer cancel()
+			target, err := resolveSnapshotTarget(ctx, logger, opts, cmd, sel)
+			if err != nil {
+				return err
+			}
+			if err := state.CheckSnapshotName(ctx, target.store, target.envName, name); err != nil {
+				return err
+			}
+
+			logger.Info("taking volume snapshots", "env", target.envName, "slot", target.slot, "namespace", target.namespace, "snapshot", name)
+			volumes, err := kube.CreateVolumeSnapshots(ctx, target.kubeClient, kube.SnapshotRequest{
+				Namespace: target.namespace,
+				Name:      name,
+				Class:     class,
+				Timeout:   waitTimeout,
+			})
+			if err == nil {
+				err = state.RecordSnapshot(ctx, target.store, state.Snapshot{
+					Name:      name,
+					Env:       target.envName,
+					Slot:      target.slot,
+					Namespace: target.namespace,
+					CreatedAt: time.Now().UTC().Truncate(time.Second),
+					Volumes:   volumes,
+				})
+			}
+			if err != nil {
+				cleanupCtx, cancelCleanup := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+				defer cancelCleanup()
+				if cleanupErr := kube.DeleteVolumeSnapshots(cleanupCtx, target.kubeClient, target.namespace, volumes); cleanupErr != nil {
+					logger.Warn("failed to delete volume snapshots of the failed snapshot", "snapshot", name, "error", cleanupErr)
+				}
+				return fmt.Errorf("snapshot %s: %w", target.namespace, err)
+			}
+
+			w := cmd.OutOrStdout()
+			fmt.Fprintf(w, "Snapshot %q of %s (%s):\n", name, target.namespace, target.envName)
+			for _, vol := range volumes {
+				fmt.Fprintf(w, "  %s -> volumesnapshot/%s (%s)\n", vol.PVC, vol.VolumeSnapshot, dashIfEmpty(vol.RestoreSize))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Env, "env", "ai", "Environment to snapshot (e.g. ai, ai-staging)")
+	addSlotSelectorFlags(cmd, &sel)
+	cmd.Flags().StringVar(&name, "name", "", "Snapshot name (defaults to the UTC time, e.g. 20260101-120000)")
+	cmd.Flags().StringVar(&class, "class", "", "VolumeSnapshotClass (defaults to the default class of the CSI driver)")
+	cmd.Flags().StringVar(&waitTimeout, "wait-timeout", defaultSnapshotTimeout, "How long to wait for the snapshots to become ready to use")
+	cmd.Flags().String("vars", "", "Additional variables in k=v,k2=v2 format")
+	cmd.Flags().String("var-file", "", "Path to YAML/ENV file with additional variables")
+
+	return cmd
+}
+
+// newManageEnvSnapshotRestoreCommand creates "manage-env snapshot restore" that replaces the claims of the
+// environment namespace with volumes restored from a recorded snapshot.
+func newManageEnvSnapshotRestoreCommand(opts *Options) *cobra.Command {
+	var (
+		sel         slotSelector
+		name        string
+		fromEnv     string
+		waitTimeout string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "restore",
+		Short: "Restore the persistent volume claims of an environment from a snapshot",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			logger := LoggerFromContext(cmd.Context())
+			envCfg := snapshotEnv{}
+			if err := parseEnv(&envCfg); err != nil {
+				return err
+			}
+			if !cmd.Flags().Changed("name") && envPresent("CODEXCTL_SNAPSHOT_NAME") {
+				name = envCfg.Name
+			}
+			if !cmd.Flags().Changed("wait-timeout") && envPresent("CODEXCTL_WAIT_TIMEOUT") {
+				waitTimeout = envCfg.WaitTimeout
+			}
+			name = strings.TrimSpace(name)
+			if name == "" {
+				return fmt.Errorf("--name is required")
+			}
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), snapshotCommandTimeout)
+			defer cancel()
+			target, err := resolveSnapshotTarget(ctx, logger, opts, cmd, sel)
+			if err != nil {
+				return err
+			}
+			fromEnv = strings.TrimSpace(fromEnv)
+			if fromEnv == "" {
+				fromEnv = target.envName
+			}
+
+			res, err := restoreSnapshot(ctx, logger, restoreSnapshotParams{
+				kubeClient:  target.kubeClient,
+				store:       target.store,
+				stackCfg:    target.stackCfg,
+				envName:     target.envName,
+				envCfg:      target.envCfg,
+				namespace:   target.namespace,
+				fromEnv:     fromEnv,
+				snapshot:    name,
+				waitTimeout: waitTimeout,
+			})
+			if err != nil {
+				return err
+			}
+			touchSlotActivity(ctx, logger, target.store, target.slot, "")
+
+			w := cmd.OutOrStdout()
+			fmt.Fprintf(w, "Restored snapshot %q (%s) into %s:\n", name, fromEnv, target.namespace)
+			for _, pvc := range res.Replaced {
+				fmt.Fprintf(w, "  %s replaced\n", pvc)
+			}
+			for _, pvc := range res.Created {
+				fmt.Fprintf(w, "  %s created\n", pvc)
+			}
+			for _, wl := range res.Workloads {
+				fmt.Fprintf(w, "  %s/%s scaled back to %d\n", strings.ToLower(wl.Kind), wl.Name, wl.Replicas)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Env, "env", "ai", "Environment to restore into (e.g. ai, ai-staging)")
+	addSlotSelectorFlags(cmd, &sel)
+	cmd.Flags().StringVar(&name, "name", "", "Snapshot name")
+	cmd.Flags().StringVar(&fromEnv, "from-env", "", "Environment the snapshot was taken from (defaults to --env)")
+	cmd.Flags().StringVar(&waitTimeout, "wait-timeout", defaultSnapshotTimeout, "Timeout of each wait: snapshot readiness, pod termination, claim deletion and rollout")
+	cmd.Flags().String("vars", "", "Additional variables in k=v,k2=v2 format")
+	cmd.Flags().String("var-file", "", "Path to YAML/ENV file with additional variables")
+
+	return cmd
+}
+
+// newManageEnvSnapshotListCommand creates "manage-env snapshot list" that shows the recorded snapshots of an
+// environment.
+func newManageEnvSnapshotListCommand(opts *Options) *cobra.Command {
+	var (
+		slot   int
+		output string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the recorded snapshots of an environment",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			logger := LoggerFromContext(cmd.Context())
+			switch output {
+			case "table", "json", "yaml":
+			default:
+				return fmt.Errorf("unsupported output %q (use table, json or yaml)", output)
+			}
+			envCfg := manageEnvEnv{}
+			if err := parseEnv(&envCfg); err != nil {
+				return err
+			}
+			if !cmd.Flags().Changed("slot") && envPresent("CODEXCTL_SLOT") {
+				slot = envCfg.Slot
+			}
+
+			envName := opts.Env
+			if envName == "" {
+				envName = "ai"
+			}
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), 2*time.Minute)
+			defer cancel()
+
+			envStore, err := loadEnvSlotStore(opts, envName, config.LoadOptions{Env: envName}, logger, true)
+			if err != nil {
+				return err
+			}
+			snaps, err := envStore.store.LoadSnapshots(ctx, envName)
+			if err != nil {
+				return err
+			}
+			items := []state.Snapshot{}
+			for _, snap := range snaps.Items {
+				if slot <= 0 || snap.Slot == slot {
+					items = append(items, snap)
+				}
+			}
+			return printSnapshotList(os.Stdout, items, output, time.Now())
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Env, "env", "ai", "Environment type (default: ai)")
+	cmd.Flags().IntVar(&slot, "slot", 0, "Only list snapshots taken from this slot")
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "Output format: table, json or yaml")
+
+	return cmd
+}
+
+// resolveSnapshotTarget resolves the namespace selected by sel (see resolveSlotTarget) together with the
+// Kubernetes client and the state backend of its environment.
+func resolveSnapshotTarget(ctx context.Context, logger *slog.Logger, opts *Options, cmd *cobra.Command, sel slotSelector) (snapshotTarget, error) {
+	var target snapshotTarget
+	slotTgt, err := resolveSlotTarget(ctx, logger, opts, cmd, sel)
+	if err != nil {
+		return target, err
+	}
+	client, err := envKubeClient(opts, slotTgt.envCfg, slotTgt.ctxData, false)
+	if err != nil {
+		return target, err
+	}
+	store, err := newStateStore(opts, slotTgt.stackCfg, slotTgt.ctxData, client, logger, false)
+	if err != nil {
+		return target, err
+	}
+	target.envName = opts.Env
+	if target.envName == "" {
+		target.envName = "ai"
+	}
+	target.slot = slotTgt.ctxData.Slot
+	target.namespace = slotTgt.ctxData.Namespace
+	target.stackCfg, target.envCfg = slotTgt.stackCfg, slotTgt.envCfg
+	target.kubeClient, target.store = client, store
+	return target, nil
+}
+
+// restoreSnapshotParams describes restoring a recorded snapshot into a namespace.
+type restoreSnapshotParams struct {
+	// kubeClient is the Kubernetes client of the target namespace.
+	kubeClient kube.Orchestrator
+	// store is the state backend holding the snapshot catalog.
+	store state.StateBackend
+	// stackCfg is the stack configuration, used to resolve fromEnv.
+	stackCfg *config.StackConfig
+	// envName is the environment of the target namespace.
+	envName string
+	// envCfg is the resolved configuration of envName.
+	envCfg config.Environment
+	// namespace is the target namespace.
+	namespace string
+	// fromEnv is the environment the snapshot was taken from.
+	fromEnv string
+	// snapshot is the snapshot name.
+	snapshot string
+	// waitTimeout bounds each wait of the restore and the rollout of the scaled-up workloads.
+	waitTimeout string
+}
+
+// restoreSnapshot restores the recorded snapshot p.snapshot of p.fromEnv into p.namespace and waits for the
+// rollout of the workloads scaled down around it. Snapshots of another environment must come from the same
+// cluster, since VolumeSnapshots cannot be restored across clusters.
+func restoreSnapshot(ctx context.Context, logger *slog.Logger, p restoreSnapshotParams) (kube.RestoreResult, error) {
+	if p.fromEnv != p.envName {
+		fromCfg, err := config.ResolveEnvironment(p.stackCfg, p.fromEnv)
+		if err != nil {
+			return kube.RestoreResult{}, err
+		}
+		if !sameCluster(fromCfg.Cluster, p.envCfg.Cluster) {
+			return kube.RestoreResult{}, fmt.Errorf("snapshots of %s cannot be restored into %s: the environments run in different clusters", p.fromEnv, p.envName)
+		}
+	}
+	snap, ok, err := state.FindSnapshot(ctx, p.store, p.fromEnv, p.snapshot)
+	if err != nil {
+		return kube.RestoreResult{}, err
+	}
+	if !ok {
+		return kube.RestoreResult{}, fmt.Errorf("%s snapshot %q not found (see manage-env snapshot list --env %s)", p.fromEnv, p.snapshot, p.fromEnv)
+	}
+	if _, err := p.kubeClient.EnsureNamespace(ctx, p.namespace); err != nil {
+		return kube.RestoreResult{}, fmt.Errorf("ensure namespace %s: %w", p.namespace, err)
+	}
+
+	logger.Info("restoring snapshot", "snapshot", snap.Name, "from", snap.Namespace, "namespace", p.namespace, "volumes", len(snap.Volumes))
+	res, err := kube.RestoreVolumeSnapshots(ctx, p.kubeClient, kube.RestoreRequest{
+		SourceNamespace: snap.Namespace,
+		Namespace:       p.namespace,
+		Name:            snap.Name,
+		Volumes:         snap.Volumes,
+		Timeout:         p.waitTimeout,
+	})
+	if err != nil {
+		return res, fmt.Errorf("restore snapshot %q into %s: %w", snap.Name, p.namespace, err)
+	}
+	var errs []error
+	for _, w := range res.Workloads {
+		if w.Replicas == 0 {
+			continue
+		}
+		if err := p.kubeClient.WaitForWorkload(ctx, w.Kind, w.Name, p.namespace, p.waitTimeout); err != nil {
+			errs = append(errs, fmt.Errorf("wait for %s/%s: %w", strings.ToLower(w.Kind), w.Name, err))
+		}
+	}
+	return res, errors.Join(errs...)
+}
+
+// seedSlotData restores the environments.<env>.seedFrom snapshot into the namespace of a new slot before its
+// bootstrap infra and stack are applied, so that the stateful services start with the seeded data. Without
+// seedFrom it does nothing.
+func seedSlotData(ctx context.Context, logger *slog.Logger, envStore *envSlotStore, envName string, rec state.EnvRecord) error {
+	if envStore == nil || envStore.envCfg.SeedFrom == nil {
+		return nil
+	}
+	seed := envStore.envCfg.SeedFrom
+	if strings.TrimSpace(seed.Env) == "" || strings.TrimSpace(seed.Snapshot) == "" {
+		return fmt.Errorf("environments.%s.seedFrom requires env and snapshot", envName)
+	}
+	if strings.TrimSpace(rec.Namespace) == "" {
+		return fmt.Errorf("seed slot %d: namespace is empty", rec.Slot)
+	}
+	res, err := restoreSnapshot(ctx, logger, restoreSnapshotParams{
+		kubeClient:  envStore.kubeClient,
+		store:       envStore.store,
+		stackCfg:    envStore.stackCfg,
+		envName:     envName,
+		envCfg:      envStore.envCfg,
+		namespace:   rec.Namespace,
+		fromEnv:     seed.Env,
+		snapshot:    seed.Snapshot,
+		waitTimeout: defaultSnapshotTimeout,
+	})
+	if err != nil {
+		return fmt.Errorf("seed slot %d: %w", rec.Slot, err)
+	}
+	logger.Info("slot seeded from snapshot", "slot", rec.Slot, "namespace", rec.Namespace, "from", seed.Env, "snapshot", seed.Snapshot, "claims", append(res.Created, res.Replaced...))
+	return nil
+}
+
+// sameCluster reports whether two cluster settings select the same cluster (nil is the default cluster).
+func sameCluster(a, b *config.ClusterSpec) bool {
+	var x, y config.ClusterSpec
+	if a != nil {
+		x = *a
+	}
+	if b != nil {
+		y = *b
+	}
+	return x == y
+}
+
+// printSnapshotList writes snapshots as a table, JSON or YAML.
+func printSnapshotList(w io.Writer, snapshots []state.Snapshot, output string, now time.Time) error {
+	switch output {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(snapshots); err != nil {
+			return fmt.Errorf("encode snapshot list: %w", err)
+		}
+		return nil
+	case "yaml":
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(snapshots); err != nil {
+			return fmt.Errorf("encode snapshot list: %w", err)
+		}
+		return enc.Close()
+	}
+
+	if len(snapshots) == 0 {
+		_, err := fmt.Fprintln(w, "No snapshots.")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSLOT\tNAMESPACE\tCLAIMS\tAGE")
+	for _, s := range snapshots {
+		claims := make([]string, 0, len(s.Volumes))
+		for _, vol := range s.Volumes {
+			claims = append(claims, vol.PVC)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			s.Name,
+			numberOrDash(s.Slot),
+			dashIfEmpty(s.Namespace),
+			dashIfEmpty(strings.Join(claims, ",")),
+			shortDuration(now.Sub(s.CreatedAt)),
+		)
+	}
+	return tw.Flush()
+}
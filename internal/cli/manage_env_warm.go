@@ -0,0 +1,390 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/codex-k8s/codexctl/internal/config"
+	"github.com/codex-k8s/codexctl/internal/env"
+	"github.com/codex-k8s/codexctl/internal/state"
+)
+
+const (
+	// warmProvisionTimeout bounds the provisioning of one warm slot (images, apply and rollout wait); the
+	// provisioning lease lasts as long.
+	warmProvisionTimeout = 2 * time.Hour
+	// warmRemoveLeaseDuration bounds how long a surplus warm slot is leased while it is torn down.
+	warmRemoveLeaseDuration = 30 * time.Minute
+)
+
+// warmPoolRequest describes a warm pool reconciliation.
+type warmPoolRequest struct {
+	// envName is the environment whose pool is reconciled.
+	envName string
+	// size is the number of warm slots to keep.
+	size int
+	// maxSlots limits the slot range; 0 means unlimited.
+	maxSlots int
+	// prepareImages mirrors and builds images before applying the stack.
+	prepareImages bool
+	// waitTimeout overrides the rollout wait timeout.
+	waitTimeout string
+	// waitTimeoutSet indicates explicit wait-timeout usage.
+	waitTimeoutSet bool
+	// inlineVars are inline variables for template rendering.
+	inlineVars env.Vars
+	// varFiles are additional var-file paths.
+	varFiles []string
+}
+
+// warmPoolResult is the outcome of a warm pool reconciliation.
+type warmPoolResult struct {
+	// provisioning are the slots another run is provisioning.
+	provisioning []int
+	// provisioned are the slots provisioned by this run.
+	provisioned []int
+	// removed are the surplus or stale warm slots torn down by this run.
+	removed []int
+	// ready is the number of warm slots after the run.
+	ready int
+}
+
+// newManageEnvWarmCommand creates the "manage-env warm" subcommand that keeps environments.<env>.warmPool.size
+// unassigned slots provisioned, so that ensure-slot/ensure-ready can claim them instead of creating a slot
+// from scratch.
+func newManageEnvWarmCommand(opts *Options) *cobra.Command {
+	var (
+		size          int
+		maxSlots      int
+		prepareImages bool
+		waitTimeout   string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "warm",
+		Short: "Provision or trim the warm slot pool to its configured size",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			logger := LoggerFromContext(cmd.Context())
+			envCfg := warmEnv{}
+			if err := parseEnv(&envCfg); err != nil {
+				return err
+			}
+			sizeSet := cmd.Flags().Changed("size")
+			if !sizeSet && envPresent("CODEXCTL_WARM_POOL_SIZE") {
+				size, sizeSet = envCfg.Size, true
+			}
+			if !cmd.Flags().Changed("max") && envPresent("CODEXCTL_DEV_SLOTS_MAX") {
+				maxSlots = envCfg.MaxSlots
+			}
+			if !cmd.Flags().Changed("prepare-images") && envPresent("CODEXCTL_PREPARE_IMAGES") {
+				prepareImages = envCfg.PrepareImages
+			}
+			waitTimeoutSet := cmd.Flags().Changed("wait-timeout")
+			if !waitTimeoutSet && envPresent("CODEXCTL_WAIT_TIMEOUT") {
+				waitTimeout, waitTimeoutSet = envCfg.WaitTimeout, true
+			}
+
+			inlineVars, varFiles, err := parseInlineVarsAndFiles(cmd)
+			if err != nil {
+				return err
+			}
+
+			envName := opts.Env
+			if envName == "" {
+				envName = "ai"
+			}
+			envStore, err := loadEnvSlotStore(opts, envName, config.LoadOptions{
+				Env:      envName,
+				UserVars: inlineVars,
+				VarFiles: varFiles,
+			}, logger, false)
+			if err != nil {
+				return err
+			}
+			if !sizeSet {
+				size = 0
+				if pool := envStore.envCfg.WarmPool; pool != nil {
+					size = pool.Size
+				}
+			}
+			if size < 0 {
+				return fmt.Errorf("warm pool size must not be negative")
+			}
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), 6*time.Hour)
+			defer cancel()
+
+			res, err := reconcileWarmPool(ctx, logger, opts, envStore, warmPoolRequest{
+				envName:        envName,
+				size:           size,
+				maxSlots:       maxSlots,
+				prepareImages:  prepareImages,
+				waitTimeout:    waitTimeout,
+				waitTimeoutSet: waitTimeoutSet,
+				inlineVars:     inlineVars,
+				varFiles:       varFiles,
+			})
+			if printErr := printWarmPoolResult(cmd.OutOrStdout(), envName, size, res); printErr != nil {
+				return printErr
+			}
+			return err
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Env, "env", "ai", "Environment type (default: ai)")
+	cmd.Flags().IntVar(&size, "size", 0, "Number of warm slots to keep (defaults to environments.<env>.warmPool.size)")
+	cmd.Flags().IntVar(&maxSlots, "max", 0, "Maximum number of slots (0 means unlimited)")
+	cmd.Flags().BoolVar(&prepareImages, "prepare-images", false, "Mirror and build images before applying the stack of a new warm slot")
+	cmd.Flags().StringVar(&waitTimeout, "wait-timeout", "", "Rollout wait timeout for new warm slots (defaults to codex.timeouts.deployWait)")
+	cmd.Flags().String("vars", "", "Additional variables in k=v,k2=v2 format")
+	cmd.Flags().String("var-file", "", "Path to YAML/ENV file with additional variables")
+
+	return cmd
+}
+
+// reconcileWarmPool brings the number of warm and provisioning slots of req.envName to req.size: stale
+// provisioning attempts and surplus warm slots (oldest first) are torn down, missing slots are provisioned
+// one by one. No slots are provisioned while runners wait in the slot queue, since they need the free slots.
+func reconcileWarmPool(ctx context.Context, logger *slog.Logger, opts *Options, envStore *envSlotStore, req warmPoolRequest) (warmPoolResult, error) {
+	var res warmPoolResult
+	store := envStore.store
+	holder := "warm/" + slotLeaseHolder(envStore.templateCtx.EnvMap)
+
+	records, err := store.List(ctx)
+	if err != nil {
+		return res, err
+	}
+	now := time.Now()
+	var warm, stale []state.EnvRecord
+	for _, rec := range records {
+		if rec.Env != req.envName || rec.Issue > 0 || rec.PR > 0 {
+			continue
+		}
+		switch {
+		case rec.IsWarm(now):
+			warm = append(warm, rec)
+			res.ready++
+		case rec.Phase == state.PhaseWarming && rec.Lease.Active(now):
+			res.provisioning = append(res.provisioning, rec.Slot)
+		case rec.Phase == state.PhaseWarming && now.Sub(rec.CreatedAt) > slotLeaseDuration:
+			// A provisioning run died before it finished (fresh records may not be leased yet).
+			stale = append(stale, rec)
+		}
+	}
+
+	var errs []error
+	sort.Slice(warm, func(i, j int) bool { return warm[i].CreatedAt.Before(warm[j].CreatedAt) })
+	surplus := len(warm) + len(res.provisioning) - req.size
+	for i := 0; i < surplus && i < len(warm); i++ {
+		stale = append(stale, warm[i])
+	}
+	for _, rec := range stale {
+		logger.Info("removing warm slot", "env", req.envName, "slot", rec.Slot, "namespace", rec.Namespace, "phase", rec.Phase)
+		removed, err := removeWarmSlot(ctx, logger, opts, envStore, rec, holder)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !removed {
+			continue
+		}
+		res.removed = append(res.removed, rec.Slot)
+		if rec.Phase == state.PhaseWarm {
+			res.ready--
+		}
+	}
+
+	missing := req.size - len(warm) - len(res.provisioning)
+	if missing <= 0 {
+		return res, errors.Join(errs...)
+	}
+	q, err := state.UpdateQueue(ctx, store, req.envName, func(entries []state.QueueEntry) ([]state.QueueEntry, bool) {
+		return entries, false
+	})
+	if err != nil {
+		return res, errors.Join(append(errs, fmt.Errorf("read slot queue: %w", err))...)
+	}
+	if len(q.Entries) > 0 {
+		logger.Info("runners are waiting for slots; not provisioning warm slots", "env", req.envName, "waiting", len(q.Entries), "missing", missing)
+		return res, errors.Join(errs...)
+	}
+
+	for i := 0; i < missing; i++ {
+		slot, err := provisionWarmSlot(ctx, logger, opts, envStore, req, holder)
+		if state.IsNoFreeSlotError(err) {
+			logger.Info("no free slot left for the warm pool", "env", req.envName, "maxSlots", req.maxSlots, "missing", missing-i)
+			break
+		}
+		if err != nil {
+			errs = append(errs, err)
+			break
+		}
+		res.provisioned = append(res.provisioned, slot)
+		res.ready++
+	}
+	return res, errors.Join(errs...)
+}
+
+// provisionWarmSlot allocates an unassigned slot in the warming phase, applies slotBootstrapInfra and the
+// full stack while holding its lease, waits for the rollout and marks the slot warm. A failed slot is
+// torn down and released.
+func provisionWarmSlot(ctx context.Context, logger *slog.Logger, opts *Options, envStore *envSlotStore, req warmPoolRequest, holder string) (int, error) {
+	store := envStore.store
+	rec, err := store.Allocate(ctx, state.AllocateRequest{
+		StackConfig: envStore.stackCfg,
+		BaseContext: envStore.templateCtx,
+		Env:         req.envName,
+		MaxSlots:    req.maxSlots,
+		Phase:       state.PhaseWarming,
+	})
+	if err != nil {
+		return 0, err
+	}
+	logger.Info("provisioning warm slot", "env", req.envName, "slot", rec.Slot, "namespace", rec.Namespace)
+
+	fail := func(err error) (int, error) {
+		cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Minute)
+		defer cancel()
+		if destroyErr := destroySlotEnvironment(cleanupCtx, logger, opts, envStore, rec); destroyErr != nil {
+			logger.Warn("failed to tear down warm slot", "slot", rec.Slot, "error", destroyErr)
+		}
+		if releaseErr := store.Release(cleanupCtx, rec.Slot); releaseErr != nil {
+			logger.Warn("failed to release warm slot", "slot", rec.Slot, "error", releaseErr)
+		}
+		return 0, fmt.Errorf("provision warm slot %d: %w", rec.Slot, err)
+	}
+
+	provisionCtx, cancel := context.WithTimeout(ctx, warmProvisionTimeout)
+	defer cancel()
+	if _, err := state.AcquireLease(provisionCtx, store, rec.Slot, holder, warmProvisionTimeout, state.RecordUpdate{}); err != nil {
+		return fail(err)
+	}
+
+	if err := seedSlotData(provisionCtx, logger, envStore, req.envName, rec); err != nil {
+		return fail(err)
+	}
+	if err := applySlotBootstrapInfra(provisionCtx, logger, opts, envStore, rec, ensureSlotRequest{
+		envName:    req.envName,
+		inlineVars: req.inlineVars,
+		varFiles:   req.varFiles,
+	}); err != nil {
+		return fail(err)
+	}
+
+	stackCfg, ctxData, err := config.LoadStackConfig(opts.ConfigPath, config.LoadOptions{
+		Env:       req.envName,
+		Namespace: rec.Namespace,
+		Slot:      rec.Slot,
+		UserVars:  req.inlineVars,
+		VarFiles:  req.varFiles,
+	})
+	if err != nil {
+		return fail(err)
+	}
+	if req.prepareImages {
+		if err := mirrorExternalImages(provisionCtx, logger, stackCfg); err != nil {
+			return fail(err)
+		}
+		if err := buildImages(provisionCtx, logger, stackCfg, ctxData); err != nil {
+			return fail(err)
+		}
+	}
+	if err := applyStack(provisionCtx, logger, applyStackParams{
+		kubeClient: envStore.kubeClient,
+		stackCfg:   stackCfg,
+		ctxData:    ctxData,
+		envName:    req.envName,
+		envCfg:     envStore.envCfg,
+		preflight:  true,
+	}); err != nil {
+		return fail(err)
+	}
+	if rec.Namespace != "" {
+		waitTimeout := resolveDeployWaitTimeout(stackCfg, req.waitTimeout, req.waitTimeoutSet)
+		if _, err := waitForRollout(provisionCtx, logger, envStore.kubeClient, rec.Namespace, waitTimeout); err != nil {
+			return fail(err)
+		}
+	}
+
+	if err := state.ReleaseLease(provisionCtx, store, rec.Slot, holder, state.RecordUpdate{
+		Phase:          state.PhaseWarm,
+		LastActivityAt: time.Now(),
+	}); err != nil {
+		return fail(err)
+	}
+	logger.Info("warm slot is ready", "env", req.envName, "slot", rec.Slot, "namespace", rec.Namespace)
+	return rec.Slot, nil
+}
+
+// removeWarmSlot tears down the environment of an unassigned warm slot and releases its record while holding
+// its lease, so that the slot cannot be claimed in the meantime. It reports false when the slot was claimed
+// or released by another run first.
+func removeWarmSlot(ctx context.Context, logger *slog.Logger, opts *Options, envStore *envSlotStore, rec state.EnvRecord, holder string) (bool, error) {
+	store := envStore.store
+	claimed := false
+	_, err := state.UpdateRecord(ctx, store, rec.Slot, func(cur state.EnvRecord) (state.RecordUpdate, bool, error) {
+		now := time.Now()
+		if cur.Issue > 0 || cur.PR > 0 || (cur.Lease.Active(now) && cur.Lease.Holder != holder) {
+			return state.RecordUpdate{}, false, nil
+		}
+		claimed = true
+		return state.RecordUpdate{
+			Lease: &state.Lease{Holder: holder, RenewedAt: now.UTC(), Duration: warmRemoveLeaseDuration},
+			Phase: state.PhaseDestroying,
+		}, true, nil
+	})
+	if errors.Is(err, state.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("lease warm slot %d: %w", rec.Slot, err)
+	}
+	if !claimed {
+		logger.Info("warm slot was claimed in the meantime; keeping it", "slot", rec.Slot)
+		return false, nil
+	}
+	if err := destroySlotEnvironment(ctx, logger, opts, envStore, rec); err != nil {
+		if releaseErr := state.ReleaseLease(context.WithoutCancel(ctx), store, rec.Slot, holder, state.RecordUpdate{}); releaseErr != nil {
+			logger.Warn("failed to release warm slot lease", "slot", rec.Slot, "error", releaseErr)
+		}
+		return false, fmt.Errorf("destroy warm slot %d: %w", rec.Slot, err)
+	}
+	if err := store.Release(ctx, rec.Slot); err != nil {
+		return false, fmt.Errorf("release warm slot %d: %w", rec.Slot, err)
+	}
+	return true, nil
+}
+
+// printWarmPoolResult prints the pool state and the changes made by the reconciliation.
+func printWarmPoolResult(w io.Writer, envName string, size int, res warmPoolResult) error {
+	_, err := fmt.Fprintf(w, "warm pool %s: %d/%d warm, %d provisioning elsewhere\nprovisioned: %s\nremoved: %s\n",
+		envName,
+		res.ready,
+		size,
+		len(res.provisioning),
+		slotListOrDash(res.provisioned),
+		slotListOrDash(res.removed),
+	)
+	return err
+}
+
+// slotListOrDash formats slot numbers as a comma-separated list, or "-" when there are none.
+func slotListOrDash(slots []int) string {
+	if len(slots) == 0 {
+		return "-"
+	}
+	parts := make([]string, 0, len(slots))
+	for _, slot := range slots {
+		parts = append(parts, strconv.Itoa(slot))
+	}
+	return strings.Join(parts, ", ")
+}
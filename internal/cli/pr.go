@@ -306,12 +306,10 @@ func commentPREnvironment(ctx context.Context, logger *slog.Logger, opts *Option
 		return fmt.Errorf("load stack config for env %q slot %d: %w", envName, slot, err)
 	}
 
-	siteHost := ctxData.BaseDomain[envName]
-	if envName == "ai" {
-		siteHost = fmt.Sprintf("dev-%d.%s", slot, ctxData.BaseDomain["ai"])
-	}
+	siteHost := envSiteHost(ctxData, envName, slot)
 
-	body, err := prompt.RenderEnvComment(strings.ToLower(lang), siteHost, slot, ctxData.Codex.Links)
+	hibernated := slotHibernated(ctx, logger, opts, envName, slot)
+	body, err := prompt.RenderEnvComment(strings.ToLower(lang), siteHost, slot, ctxData.Codex.Links, hibernated)
 	if err != nil {
 		return fmt.Errorf("render environment comment: %w", err)
 	}
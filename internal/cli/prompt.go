@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"strings"
@@ -11,6 +12,7 @@ import (
 	"github.com/codex-k8s/codexctl/internal/config"
 	"github.com/codex-k8s/codexctl/internal/kube"
 	"github.com/codex-k8s/codexctl/internal/prompt"
+	"github.com/codex-k8s/codexctl/internal/state"
 )
 
 // newPromptCommand creates the "prompt" group command for AI prompt operations.
@@ -119,11 +121,31 @@ func newPromptRunCommand(opts *Options) *cobra.Command {
 				ctxData.EnvMap["CODEXCTL_LANG"] = lang
 			}
 
-			if _, err := config.ResolveEnvironment(stackCfg, envName); err != nil {
+			envCfg, err := config.ResolveEnvironment(stackCfg, envName)
+			if err != nil {
 				return err
 			}
 
-			kubeClient := kube.NewClient()
+			kubeClient, err := envKubeClient(opts, envCfg, ctxData, false)
+			if err != nil {
+				return err
+			}
+
+			// Hold the slot lease while the agent runs so that the slot is not reclaimed under it; runCtx is
+			// canceled when the lease is lost.
+			store, err := newStateStore(opts, stackCfg, ctxData, kubeClient, logger, false)
+			if err != nil {
+				return err
+			}
+			waitTimeout := resolveDeployWaitTimeout(stackCfg, "", false)
+			runCtx, releaseLease, err := holdSlotLease(cmd.Context(), logger, store, slot, slotLeaseHolder(ctxData.EnvMap), func(ctx context.Context, rec state.EnvRecord) error {
+				_, err := wakeSlot(ctx, logger, kubeClient, rec.Namespace, waitTimeout)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			defer releaseLease()
 
 			if raw := strings.TrimSpace(ctxData.EnvMap["CODEXCTL_MODEL"]); raw != "" {
 				model, err := normalizeModel(raw)
@@ -142,8 +164,8 @@ func newPromptRunCommand(opts *Options) *cobra.Command {
 				stackCfg.Codex.ModelReasoningEffort = effort
 			}
 
-			applyIssueCodexOverrides(cmd.Context(), logger, envName, issue, pr, stackCfg, &ctxData)
-			applyIssueContext(cmd.Context(), logger, envName, issue, pr, ctxData.EnvMap["CODEXCTL_FOCUS_ISSUE_NUMBER"], &ctxData)
+			applyIssueCodexOverrides(runCtx, logger, envName, issue, pr, stackCfg, &ctxData)
+			applyIssueContext(runCtx, logger, envName, issue, pr, ctxData.EnvMap["CODEXCTL_FOCUS_ISSUE_NUMBER"], &ctxData)
 			if !cmd.Flags().Changed("model") && envPresent("CODEXCTL_MODEL") {
 				modelOverride = envVars.Model
 			}
@@ -231,7 +253,7 @@ func newPromptRunCommand(opts *Options) *cobra.Command {
 				}
 			}
 
-			ctxExec, cancel := context.WithTimeout(cmd.Context(), execTimeout)
+			ctxExec, cancel := context.WithTimeout(runCtx, execTimeout)
 			defer cancel()
 
 			logger.Info("waiting for codex deployment to be ready", "namespace", ns)
@@ -239,13 +261,10 @@ func newPromptRunCommand(opts *Options) *cobra.Command {
 			if rolloutTimeout == "" {
 				rolloutTimeout = "1200s"
 			}
-			if err := kubeClient.RunRaw(
-				ctxExec,
-				nil,
-				"-n", ns,
-				"rollout", "status", "deploy/codex",
-				"--timeout="+rolloutTimeout,
-			); err != nil {
+			if err := kubeClient.WaitForWorkload(ctxExec, "Deployment", "codex", ns, rolloutTimeout); err != nil {
+				if lost := slotLeaseLost(runCtx); lost != nil {
+					return lost
+				}
 				if infraUnhealthy {
 					logger.Warn("codex rollout not ready; continuing due to infra-unhealthy", "namespace", ns, "error", err)
 				} else {
@@ -260,14 +279,15 @@ func newPromptRunCommand(opts *Options) *cobra.Command {
 				configPreview = configPreview[:maxConfigPreview] + "...(truncated)"
 			}
 			logger.Debug("codex config preview", "config", configPreview)
-			if err := kubeClient.RunRaw(
-				ctxExec,
-				configBytes,
-				"-n", ns,
-				"exec", "-i", "deploy/codex",
-				"--", "sh", "-lc",
-				"mkdir -p ~/.codex && cat > ~/.codex/config.toml",
-			); err != nil {
+			if err := kubeClient.Exec(ctxExec, kube.ExecRequest{
+				Namespace: ns,
+				Target:    "deploy/codex",
+				Command:   []string{"sh", "-lc", "mkdir -p ~/.codex && cat > ~/.codex/config.toml"},
+				Stdin:     bytes.NewReader(configBytes),
+			}); err != nil {
+				if lost := slotLeaseLost(runCtx); lost != nil {
+					return lost
+				}
 				if infraUnhealthy {
 					logger.Warn("failed to upload Codex config; continuing due to infra-unhealthy", "namespace", ns, "error", err)
 					return nil
@@ -349,14 +369,15 @@ func newPromptRunCommand(opts *Options) *cobra.Command {
 			for i, line := range lines {
 				logger.Debug("prompt line", "index", i, "text", line)
 			}
-			if err := kubeClient.RunRaw(
-				ctxExec,
-				promptText,
-				"-n", ns,
-				"exec", "-i", "deploy/codex",
-				"--", "sh", "-lc",
-				"cat > /tmp/codex_prompt.txt",
-			); err != nil {
+			if err := kubeClient.Exec(ctxExec, kube.ExecRequest{
+				Namespace: ns,
+				Target:    "deploy/codex",
+				Command:   []string{"sh", "-lc", "cat > /tmp/codex_prompt.txt"},
+				Stdin:     bytes.NewReader(promptText),
+			}); err != nil {
+				if lost := slotLeaseLost(runCtx); lost != nil {
+					return lost
+				}
 				if infraUnhealthy {
 					logger.Warn("failed to upload prompt; continuing due to infra-unhealthy", "namespace", ns, "error", err)
 					return nil
@@ -380,15 +401,13 @@ func newPromptRunCommand(opts *Options) *cobra.Command {
 				execCmd = execCmd + " resume --last"
 			}
 
+			updateSlotRecord(cmd.Context(), logger, store, slot, state.RecordUpdate{PromptKind: kind, Model: ctxData.Codex.Model})
+
 			logger.Info("starting Codex execution", "namespace", ns, "slot", slot, "kind", kind)
-			if err := kubeClient.RunRaw(
-				ctxExec,
-				nil,
-				"-n", ns,
-				"exec", "deploy/codex",
-				"--", "sh", "-lc",
-				execCmd,
-			); err != nil {
+			if err := runCodexPodShell(ctxExec, kubeClient, ns, execCmd); err != nil {
+				if lost := slotLeaseLost(runCtx); lost != nil {
+					return fmt.Errorf("run Codex exec inside pod: %w", lost)
+				}
 				if infraUnhealthy {
 					logger.Warn("failed to run Codex exec; continuing due to infra-unhealthy", "namespace", ns, "error", err)
 					return nil
@@ -396,6 +415,12 @@ func newPromptRunCommand(opts *Options) *cobra.Command {
 				return fmt.Errorf("run Codex exec inside pod: %w", err)
 			}
 
+			if branch, sha, err := codexWorkspaceHead(ctxExec, kubeClient, ns); err != nil {
+				logger.Debug("failed to read the workspace head of the Codex pod", "namespace", ns, "error", err)
+			} else {
+				updateSlotRecord(cmd.Context(), logger, store, slot, state.RecordUpdate{Branch: branch, HeadSHA: sha})
+			}
+
 			return nil
 		},
 	}
@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/codex-k8s/codexctl/internal/config"
+	"github.com/codex-k8s/codexctl/internal/engine"
+	"github.com/codex-k8s/codexctl/internal/kube"
+)
+
+// pruneSkippedResources lists resource types that inherit labels from other objects and
+// must never be pruned directly.
+var pruneSkippedResources = map[string]struct{}{
+	"events":                          {},
+	"events.events.k8s.io":            {},
+	"endpoints":                       {},
+	"endpointslices.discovery.k8s.io": {},
+	"pods":                            {},
+	"pods.metrics.k8s.io":             {},
+	"controllerrevisions.apps":        {},
+}
+
+// pruneParams describes a prune run after apply (or a stale-object lookup for diff).
+type pruneParams struct {
+	// kubeClient lists and deletes objects.
+	kubeClient kube.Orchestrator
+	// stackCfg is the loaded stack configuration.
+	stackCfg *config.StackConfig
+	// ctxData is the template context used for rendering.
+	ctxData config.TemplateContext
+	// renderOpts are the filters in effect; only objects of selected components are pruned.
+	renderOpts engine.RenderOptions
+	// rendered is the applied manifest stream.
+	rendered []byte
+	// dryRun only lists objects that would be deleted.
+	dryRun bool
+	// out receives the dry-run listing.
+	out io.Writer
+}
+
+// pruneStack deletes labelled objects in the target namespace that belong to the selected
+// components but are no longer part of the rendered manifests.
+func pruneStack(ctx context.Context, logger *slog.Logger, params pruneParams) error {
+	namespace := strings.TrimSpace(params.ctxData.Namespace)
+	if namespace == "" {
+		logger.Warn("skip prune: namespace is empty")
+		return nil
+	}
+
+	stale, err := findStaleObjects(ctx, params)
+	if err != nil {
+		return err
+	}
+	if len(stale) == 0 {
+		logger.Info("prune: nothing to delete", "namespace", namespace)
+		return nil
+	}
+
+	for _, ref := range stale {
+		if params.dryRun {
+			fmt.Fprintf(params.out, "would prune %s\n", ref)
+			continue
+		}
+		logger.Info("pruning object no longer rendered", "object", ref.String())
+		if err := params.kubeClient.DeleteObject(ctx, ref); err != nil {
+			return fmt.Errorf("prune %s: %w", ref, err)
+		}
+	}
+	return nil
+}
+
+// findStaleObjects returns labelled objects in the target namespace that belong to the components
+// selected by params.renderOpts but are missing from params.rendered.
+func findStaleObjects(ctx context.Context, params pruneParams) ([]kube.ObjectRef, error) {
+	namespace := strings.TrimSpace(params.ctxData.Namespace)
+	if namespace == "" {
+		return nil, nil
+	}
+
+	renderOpts, err := engine.ExpandDependencies(params.stackCfg, params.renderOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	docs, err := kube.DecodeDocuments(params.rendered)
+	if err != nil {
+		return nil, err
+	}
+	keep := make(map[string]struct{}, len(docs))
+	for _, doc := range docs {
+		ref := kube.ObjectRefOf(doc)
+		if ref.Namespace == "" {
+			ref.Namespace = namespace
+		}
+		keep[ref.Key()] = struct{}{}
+	}
+
+	resources, err := params.kubeClient.ListNamespacedResources(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list resource types: %w", err)
+	}
+	filtered := resources[:0]
+	for _, r := range resources {
+		if _, skip := pruneSkippedResources[r]; !skip {
+			filtered = append(filtered, r)
+		}
+	}
+
+	selector := engine.OwnershipSelector(params.ctxData)
+	live, err := params.kubeClient.GetObjects(ctx, namespace, selector, filtered)
+	if err != nil {
+		return nil, fmt.Errorf("list labelled objects: %w", err)
+	}
+
+	var stale []kube.ObjectRef
+	for _, obj := range live {
+		meta, _ := obj["metadata"].(map[string]any)
+		if owners, _ := meta["ownerReferences"].([]any); len(owners) > 0 {
+			continue
+		}
+		labels, _ := meta["labels"].(map[string]any)
+		component, _ := labels[engine.LabelComponent].(string)
+		componentType, _ := labels[engine.LabelComponentType].(string)
+		if component == "" || !renderOpts.Includes(config.NodeKind(componentType), component) {
+			continue
+		}
+		ref := kube.ObjectRefOf(obj)
+		if _, ok := keep[ref.Key()]; ok {
+			continue
+		}
+		stale = append(stale, ref)
+	}
+	return stale, nil
+}
@@ -17,6 +17,7 @@ func newRenderCommand(opts *Options) *cobra.Command {
 		skipServices string
 		onlyInfra    string
 		skipInfra    string
+		withDeps     bool
 	)
 
 	cmd := &cobra.Command{
@@ -34,6 +35,7 @@ func newRenderCommand(opts *Options) *cobra.Command {
 				SkipInfra:    parseNameSet(skipInfra),
 				OnlyServices: parseNameSet(onlyServices),
 				SkipServices: parseNameSet(skipServices),
+				WithDeps:     withDeps,
 			}
 
 			manifests, err := eng.RenderStackWithOptions(stackCfg, ctxData, renderOpts)
@@ -52,6 +54,7 @@ func newRenderCommand(opts *Options) *cobra.Command {
 	cmd.Flags().StringVar(&opts.Namespace, "namespace", "", "Namespace override for rendering")
 	cmd.Flags().IntVar(&slot, "slot", 0, "Slot number for slot-based environments (e.g. ai)")
 	addRenderFilterFlags(cmd, &onlyServices, &skipServices, &onlyInfra, &skipInfra, "Render", "Skip")
+	addWithDepsFlag(cmd, &withDeps)
 	addVarsFlags(cmd)
 	_ = cmd.MarkFlagRequired("env")
 
@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/codex-k8s/codexctl/internal/kube"
+)
+
+// waitForRollout waits until the workloads of namespace are ready and prints diagnostics of the failing
+// ones to stderr. The wait runs under a context deadline slightly above waitTimeout so a stuck API call
+// cannot hang the command.
+func waitForRollout(ctx context.Context, logger *slog.Logger, client kube.Waiter, namespace, waitTimeout string) (*kube.RolloutReport, error) {
+	if client == nil {
+		return nil, fmt.Errorf("kubernetes client is nil")
+	}
+	ctxWait := ctx
+	if waitTimeout != "" {
+		if d, err := time.ParseDuration(waitTimeout); err == nil {
+			var cancel context.CancelFunc
+			ctxWait, cancel = context.WithTimeout(ctx, d+time.Minute)
+			defer cancel()
+		}
+	}
+	logger.Info("waiting for workloads to roll out", "namespace", namespace, "timeout", waitTimeout)
+	report, err := client.WaitForRollout(ctxWait, kube.RolloutRequest{Namespace: namespace, Timeout: waitTimeout})
+	if err != nil && report != nil {
+		printRolloutDiagnostics(os.Stderr, report)
+	}
+	return report, err
+}
+
+// printRolloutDiagnostics writes the failing workloads of report with their pods, events and log tails.
+func printRolloutDiagnostics(w io.Writer, report *kube.RolloutReport) {
+	failing := report.Failing()
+	if len(failing) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "rollout diagnostics for namespace %s:\n", report.Namespace)
+	for _, wl := range failing {
+		fmt.Fprintf(w, "%s: %s\n", wl, wl.Message)
+		for _, pod := range wl.Pods {
+			fmt.Fprintf(w, "  pod %s (%s)", pod.Name, pod.Phase)
+			if pod.Reason != "" {
+				fmt.Fprintf(w, ": %s", pod.Reason)
+			}
+			fmt.Fprintln(w)
+			for _, c := range pod.Containers {
+				details := []string{c.State, fmt.Sprintf("restarts: %d", c.RestartCount)}
+				if c.LastTermination != "" {
+					details = append(details, "last termination: "+c.LastTermination)
+				}
+				fmt.Fprintf(w, "    container %s: %s\n", c.Name, strings.Join(details, ", "))
+				for _, line := range strings.Split(c.Logs, "\n") {
+					if line != "" {
+						fmt.Fprintf(w, "      | %s\n", line)
+					}
+				}
+			}
+		}
+		if len(wl.Events) > 0 {
+			fmt.Fprintln(w, "  events:")
+			for _, ev := range wl.Events {
+				fmt.Fprintf(w, "    %s\n", ev)
+			}
+		}
+	}
+}
+
+// rolloutOutputs returns GitHub step outputs describing report: rollout_ready, rollout_failed (comma-separated
+// workloads) and rollout_report (compact JSON). A nil report yields empty values.
+func rolloutOutputs(report *kube.RolloutReport) (map[string]string, error) {
+	out := map[string]string{"rollout_ready": "", "rollout_failed": "", "rollout_report": ""}
+	if report == nil {
+		return out, nil
+	}
+	raw, err := json.Marshal(report)
+	if err != nil {
+		return nil, fmt.Errorf("encode rollout report: %w", err)
+	}
+	var failed []string
+	for _, wl := range report.Failing() {
+		failed = append(failed, wl.String())
+	}
+	out["rollout_ready"] = fmt.Sprintf("%t", report.Ready)
+	out["rollout_failed"] = strings.Join(failed, ",")
+	out["rollout_report"] = string(raw)
+	return out, nil
+}
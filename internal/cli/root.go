@@ -3,20 +3,48 @@ package cli
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/spf13/cobra"
 
+	"github.com/codex-k8s/codexctl/internal/kube"
 	"github.com/codex-k8s/codexctl/internal/logging"
 )
 
 const (
 	// defaultConfigPath is the default path to the stack configuration file.
 	defaultConfigPath = "services.yaml"
+	// errorExitCodeAnnotation is the command annotation holding the exit code of its failures when it differs
+	// from 1 (e.g. because the command reserves 1 for an expected outcome).
+	errorExitCodeAnnotation = "codexctl.io/error-exit-code"
 )
 
+// ExitError asks the binary to exit with Code. Commands return it for outcomes that are not failures but
+// must be visible to scripts, such as diff finding differences; Err is reported as a failure when set.
+type ExitError struct {
+	// Code is the process exit code.
+	Code int
+	// Err is the underlying error (nil for an expected outcome).
+	Err error
+}
+
+// Error implements error.
+func (e *ExitError) Error() string {
+	if e.Err == nil {
+		return "exit status " + strconv.Itoa(e.Code)
+	}
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
 // Options stores global CLI options shared between commands.
 type Options struct {
 	// ConfigPath is the path to services.yaml.
@@ -27,6 +55,8 @@ type Options struct {
 	Namespace string
 	// LogLevel controls structured logging verbosity.
 	LogLevel logging.Level
+	// KubeBackend selects the Kubernetes orchestrator implementation (client-go or kubectl).
+	KubeBackend string
 }
 
 // Execute builds the root command, runs it with the provided args and logger, and returns any error.
@@ -43,7 +73,19 @@ func Execute(args []string, logger *slog.Logger) error {
 	rootCmd := newRootCommand(rootOpts, logger)
 	rootCmd.SetArgs(args)
 
-	return rootCmd.Execute()
+	cmd, err := rootCmd.ExecuteC()
+	if err == nil || cmd == nil {
+		return err
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return err
+	}
+	// Flag, validation and run failures of commands with their own failure exit code.
+	if code, convErr := strconv.Atoi(cmd.Annotations[errorExitCodeAnnotation]); convErr == nil {
+		return &ExitError{Code: code, Err: err}
+	}
+	return err
 }
 
 // newRootCommand constructs the root cobra.Command with global flags and subcommands.
@@ -62,6 +104,10 @@ func newRootCommand(opts *Options, logger *slog.Logger) *cobra.Command {
 	if logLevelDefault == "" {
 		logLevelDefault = "info"
 	}
+	kubeBackendDefault := strings.TrimSpace(baseCfg.KubeBackend)
+	if kubeBackendDefault == "" {
+		kubeBackendDefault = kube.BackendClientGo
+	}
 
 	cmd := &cobra.Command{
 		Use:   "codexctl",
@@ -81,16 +127,22 @@ func newRootCommand(opts *Options, logger *slog.Logger) *cobra.Command {
 	cmd.PersistentFlags().StringVar(&opts.Env, "env", envDefault, "Environment name (e.g. dev, ai-staging, ai)")
 	cmd.PersistentFlags().StringVar(&opts.Namespace, "namespace", namespaceDefault, "Target Kubernetes namespace override")
 	cmd.PersistentFlags().String("log-level", logLevelDefault, "Log level (debug, info, warn, error)")
+	cmd.PersistentFlags().StringVar(&opts.KubeBackend, "kube-backend", kubeBackendDefault, "Kubernetes backend: client-go (built-in API client) or kubectl (kubectl subprocesses)")
 
 	cmd.AddCommand(
 		newApplyCommand(opts),
 		newCICommand(opts),
+		newConfigCommand(opts),
+		newDiffCommand(opts),
+		newForwardCommand(opts),
 		newImagesCommand(opts),
+		newLogsCommand(opts),
 		newManageEnvCommand(opts),
 		newRenderCommand(opts),
 		newPromptCommand(opts),
 		newPlanCommand(opts),
 		newPRCommand(opts),
+		newStatusCommand(opts),
 	)
 
 	return cmd
@@ -0,0 +1,187 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codex-k8s/codexctl/internal/state"
+)
+
+const (
+	// slotLeaseDuration is how long a slot lease stays valid without a heartbeat.
+	slotLeaseDuration = 5 * time.Minute
+	// slotLeaseRenewInterval is how often the holder renews its slot lease.
+	slotLeaseRenewInterval = time.Minute
+)
+
+// slotLeaseHolder identifies this runner: the GitHub Actions run, attempt and job when available,
+// otherwise the host and process.
+func slotLeaseHolder(envMap map[string]string) string {
+	if runID := strings.TrimSpace(envMap["GITHUB_RUN_ID"]); runID != "" {
+		holder := "github-run/" + runID
+		if attempt := strings.TrimSpace(envMap["GITHUB_RUN_ATTEMPT"]); attempt != "" {
+			holder += "/" + attempt
+		}
+		if job := strings.TrimSpace(envMap["GITHUB_JOB"]); job != "" {
+			holder += "/" + job
+		}
+		return holder
+	}
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "localhost"
+	}
+	return fmt.Sprintf("%s/%d", host, os.Getpid())
+}
+
+// errSlotLeaseLost is the cancellation cause of a run whose slot lease was taken over by another holder or
+// whose slot record was released while it ran.
+var errSlotLeaseLost = errors.New("slot lease lost")
+
+// holdSlotLease acquires the lease of slot for holder and renews it in the background until the returned
+// function is called, which stops the heartbeat and releases the lease. The slot is in the running phase
+// while the lease is held and idle afterwards; its activity is recorded when the lease is acquired and
+// released. A hibernated slot stays hibernated under the lease until wake succeeds, so that a crash or a
+// failed wake leaves it for the next run to wake; when wake fails, the lease is released and its error
+// returned. It fails with *state.LeaseHeldError when another runner holds an active lease and with the error of
+// the state backend when the lease cannot be acquired; only slots without a state record are not leased. The returned context is derived from ctx and canceled with errSlotLeaseLost
+// when the heartbeat finds the lease taken over (e.g. by GC, reconcile or hibernate after a missed renewal)
+// or the record gone, so that the run stops working in a slot it no longer owns.
+func holdSlotLease(ctx context.Context, logger *slog.Logger, store state.StateBackend, slot int, holder string, wake func(context.Context, state.EnvRecord) error) (context.Context, func(), error) {
+	noop := func() {}
+
+	acquireCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	rec, err := state.AcquireLease(acquireCtx, store, slot, holder, slotLeaseDuration, state.RecordUpdate{
+		LastActivityAt: time.Now(),
+	})
+	cancel()
+	var held *state.LeaseHeldError
+	switch {
+	case errors.As(err, &held):
+		return ctx, noop, err
+	case errors.Is(err, state.ErrRecordNotFound):
+		logger.Debug("slot has no state record; running without a slot lease", "slot", slot)
+		return ctx, noop, nil
+	case err != nil:
+		// Running without a lease would let GC, hibernate or reconcile reclaim the slot under the agent.
+		return ctx, noop, fmt.Errorf("acquire lease of slot %d: %w", slot, err)
+	}
+	if rec.Lease.Holder != "" && rec.Lease.Holder != holder {
+		logger.Info("took over expired slot lease", "slot", slot, "previousHolder", rec.Lease.Holder)
+	}
+	logger.Debug("acquired slot lease", "slot", slot, "holder", holder, "duration", slotLeaseDuration.String())
+
+	runCtx, abort := context.WithCancelCause(ctx)
+	heartbeatCtx, stopHeartbeat := context.WithCancel(context.WithoutCancel(ctx))
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(slotLeaseRenewInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-heartbeatCtx.Done():
+				return
+			case <-ticker.C:
+			}
+			renewCtx, cancel := context.WithTimeout(heartbeatCtx, 30*time.Second)
+			err := state.RenewLease(renewCtx, store, slot, holder, slotLeaseDuration)
+			cancel()
+			switch {
+			case errors.As(err, &held):
+				logger.Error("slot lease was taken over by another holder; aborting the run", "slot", slot, "holder", held.Lease.Holder)
+				abort(fmt.Errorf("%w: slot %d is now held by %s", errSlotLeaseLost, slot, held.Lease.Holder))
+				return
+			case errors.Is(err, state.ErrRecordNotFound):
+				logger.Error("slot record was released; aborting the run", "slot", slot)
+				abort(fmt.Errorf("%w: slot %d record was released", errSlotLeaseLost, slot))
+				return
+			case err != nil && heartbeatCtx.Err() == nil:
+				logger.Warn("failed to renew slot lease", "slot", slot, "error", err)
+			}
+		}
+	}()
+
+	release := func(upd state.RecordUpdate) {
+		stopHeartbeat()
+		wg.Wait()
+		abort(nil)
+		if errors.Is(context.Cause(runCtx), errSlotLeaseLost) {
+			// The slot belongs to another holder now; its record must not be touched.
+			return
+		}
+		releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+		defer cancel()
+		if err := state.ReleaseLease(releaseCtx, store, slot, holder, upd); err != nil {
+			logger.Warn("failed to release slot lease", "slot", slot, "error", err)
+		}
+	}
+
+	if rec.Phase == state.PhaseHibernated && wake != nil {
+		if err := wake(runCtx, rec); err != nil {
+			// Release without a phase so that the slot stays hibernated and the next run wakes it again.
+			release(state.RecordUpdate{})
+			if lost := slotLeaseLost(runCtx); lost != nil {
+				return ctx, noop, lost
+			}
+			return ctx, noop, fmt.Errorf("wake hibernated slot %d: %w", slot, err)
+		}
+	}
+	updateSlotRecord(runCtx, logger, store, slot, state.RecordUpdate{Phase: state.PhaseRunning})
+
+	return runCtx, func() {
+		release(state.RecordUpdate{Phase: state.PhaseIdle, LastActivityAt: time.Now()})
+	}, nil
+}
+
+// slotLeaseLost returns the cause of ctx when it was canceled because the slot lease was lost, and nil
+// otherwise.
+func slotLeaseLost(ctx context.Context) error {
+	if cause := context.Cause(ctx); errors.Is(cause, errSlotLeaseLost) {
+		return cause
+	}
+	return nil
+}
+
+// touchSlotActivity records now as the last activity of slot and moves it to phase when set; failures are
+// logged and otherwise ignored.
+func touchSlotActivity(ctx context.Context, logger *slog.Logger, store state.StateBackend, slot int, phase string) {
+	if store == nil || slot <= 0 {
+		return
+	}
+	touchCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	err := state.TouchActivity(touchCtx, store, slot, time.Now(), phase)
+	switch {
+	case errors.Is(err, state.ErrRecordNotFound):
+		logger.Debug("slot has no state record; activity not recorded", "slot", slot)
+	case err != nil:
+		logger.Warn("failed to record slot activity", "slot", slot, "error", err)
+	}
+}
+
+// updateSlotRecord applies upd to the record of slot; failures are logged and otherwise ignored. A nil store
+// (no state backend) is a no-op.
+func updateSlotRecord(ctx context.Context, logger *slog.Logger, store state.StateBackend, slot int, upd state.RecordUpdate) {
+	if store == nil || slot <= 0 {
+		return
+	}
+	updateCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	_, err := state.UpdateRecord(updateCtx, store, slot, func(state.EnvRecord) (state.RecordUpdate, bool, error) {
+		return upd, true, nil
+	})
+	switch {
+	case errors.Is(err, state.ErrRecordNotFound):
+		logger.Debug("slot has no state record; record not updated", "slot", slot)
+	case err != nil:
+		logger.Warn("failed to update slot record", "slot", slot, "error", err)
+	}
+}
@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/codex-k8s/codexctl/internal/state"
+)
+
+// slotQueueRequest describes the waiter that joins the slot queue when no slot is free.
+type slotQueueRequest struct {
+	// holder identifies the waiter in the queue.
+	holder string
+	// priority resolves the queue priority; it is called once, when the waiter joins the queue.
+	priority func(ctx context.Context) int
+}
+
+// slotAllocation is the outcome of allocateSlotWithRetry.
+type slotAllocation struct {
+	// record is the allocated slot record.
+	record state.EnvRecord
+	// queuePosition is the position at which the runner joined the slot queue (0 when it did not wait).
+	queuePosition int
+	// queueWait is the time spent in the slot queue.
+	queueWait time.Duration
+	// warm reports that the slot was claimed from the warm pool.
+	warm bool
+}
+
+// freeSlotCount returns how many slots of the range 1..maxSlots have no record or are warm pool slots of
+// env; records of other environments count as taken because slot records are shared by all environments
+// of the state backend. Without a limit (maxSlots <= 0) the count is unbounded.
+func freeSlotCount(ctx context.Context, store state.StateBackend, env string, maxSlots int) (int, error) {
+	if maxSlots <= 0 {
+		return math.MaxInt, nil
+	}
+	records, err := store.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+	free := maxSlots
+	now := time.Now()
+	for _, rec := range records {
+		if rec.Slot >= 1 && rec.Slot <= maxSlots && !(rec.Env == env && rec.IsWarm(now)) {
+			free--
+		}
+	}
+	return max(free, 0), nil
+}
+
+// acquireSlot claims a warm pool slot for req and allocates a cold slot when none is available or claiming
+// fails. A request for an explicit slot (req.Prefer) or without an issue/PR never claims warm slots. It
+// reports whether the slot came from the warm pool.
+func acquireSlot(ctx context.Context, logger *slog.Logger, store state.StateBackend, req state.AllocateRequest) (state.EnvRecord, bool, error) {
+	if req.Prefer <= 0 && (req.Issue > 0 || req.PR > 0) {
+		rec, ok, err := state.ClaimWarm(ctx, store, req)
+		switch {
+		case err != nil:
+			logger.Warn("failed to claim a warm slot; allocating a cold one", "env", req.Env, "error", err)
+		case ok:
+			logger.Info("claimed warm slot", "env", req.Env, "slot", rec.Slot, "namespace", rec.Namespace, "issue", req.Issue, "pr", req.PR)
+			return rec, true, nil
+		}
+	}
+	rec, err := store.Allocate(ctx, req)
+	return rec, false, err
+}
+
+// slotQueuePriority returns the slot queue priority of the issue (or, without an issue, the PR) from its
+// [ai-priority-*] labels. Lookup failures are logged and give the default priority 0.
+func slotQueuePriority(ctx context.Context, logger *slog.Logger, issue, pr int) int {
+	if issue <= 0 && pr <= 0 {
+		return 0
+	}
+	repo := resolveGitHubRepo("")
+	if repo == "" {
+		logger.Debug("GitHub repository is not set; using default slot queue priority", "issue", issue, "pr", pr)
+		return 0
+	}
+	token, err := lookupGitHubToken()
+	if err != nil {
+		logger.Debug("GitHub token missing; using default slot queue priority", "issue", issue, "pr", pr, "error", err)
+		return 0
+	}
+
+	var labels []ghIssueLabel
+	if issue > 0 {
+		issueData, err := fetchGitHubEntity[ghIssue](ctx, logger, token, repo, "issue", "number,labels", issue)
+		if err != nil {
+			logger.Warn("failed to query issue labels; using default slot queue priority", "issue", issue, "repo", repo, "error", err)
+			return 0
+		}
+		labels = issueData.Labels
+	} else {
+		prData, err := fetchGitHubEntity[ghPR](ctx, logger, token, repo, "pr", "number,labels", pr)
+		if err != nil {
+			logger.Warn("failed to query PR labels; using default slot queue priority", "pr", pr, "repo", repo, "error", err)
+			return 0
+		}
+		labels = prData.Labels
+	}
+	priority := resolveQueuePriority(labels)
+	if priority != 0 {
+		logger.Info("slot queue priority from labels", "issue", issue, "pr", pr, "priority", priority)
+	}
+	return priority
+}
+
+// waitForSlotTurn sleeps for delay unless ctx ends first.
+func waitForSlotTurn(ctx context.Context, delay time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("wait for free slot: %w", ctx.Err())
+	case <-time.After(delay):
+		return nil
+	}
+}
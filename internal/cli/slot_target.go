@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/codex-k8s/codexctl/internal/config"
+)
+
+// slotSelector selects an environment slot like manage-env does: by slot number, issue or pull request.
+type slotSelector struct {
+	// slot is the explicit slot number.
+	slot int
+	// issue selects the slot allocated for the issue.
+	issue int
+	// pr selects the slot allocated for the pull request.
+	pr int
+}
+
+// addSlotSelectorFlags registers --slot, --issue and --pr.
+func addSlotSelectorFlags(cmd *cobra.Command, sel *slotSelector) {
+	cmd.Flags().IntVar(&sel.slot, "slot", 0, "Slot number for slot-based environments (e.g. ai)")
+	cmd.Flags().IntVar(&sel.issue, "issue", 0, "Select the slot allocated for this issue")
+	cmd.Flags().IntVar(&sel.pr, "pr", 0, "Select the slot allocated for this pull request")
+}
+
+// slotTarget is a loaded environment slot.
+type slotTarget struct {
+	// stackCfg is the stack configuration loaded for the slot.
+	stackCfg *config.StackConfig
+	// ctxData is the template context of the slot.
+	ctxData config.TemplateContext
+	// envCfg is the resolved environment configuration.
+	envCfg config.Environment
+	// issue is the issue of the slot record, if known.
+	issue int
+	// pr is the pull request of the slot record, if known.
+	pr int
+}
+
+// resolveSlotTarget loads the stack for the slot chosen by sel. Selectors not given as flags fall back to
+// CODEXCTL_SLOT, CODEXCTL_ISSUE_NUMBER and CODEXCTL_PR_NUMBER; an issue or PR selector is resolved to a slot
+// and namespace through the state store.
+func resolveSlotTarget(ctx context.Context, logger *slog.Logger, opts *Options, cmd *cobra.Command, sel slotSelector) (slotTarget, error) {
+	var target slotTarget
+	envCfg := manageEnvEnv{}
+	if err := parseEnv(&envCfg); err != nil {
+		return target, err
+	}
+	if !cmd.Flags().Changed("slot") && envPresent("CODEXCTL_SLOT") {
+		sel.slot = envCfg.Slot
+	}
+	if !cmd.Flags().Changed("issue") && envPresent("CODEXCTL_ISSUE_NUMBER") {
+		sel.issue = envCfg.Issue
+	}
+	if !cmd.Flags().Changed("pr") && envPresent("CODEXCTL_PR_NUMBER") {
+		sel.pr = envCfg.PR
+	}
+
+	if sel.issue > 0 || sel.pr > 0 {
+		envStore, err := loadEnvSlotStore(opts, opts.Env, config.LoadOptions{Env: opts.Env}, logger, true)
+		if err != nil {
+			return target, err
+		}
+		rec, err := findMatchingEnvRecord(ctx, envStore.store, opts.Env, sel.slot, sel.issue, sel.pr)
+		if err != nil {
+			return target, err
+		}
+		if rec == nil {
+			return target, fmt.Errorf("no %s environment found for issue=%d pr=%d slot=%d", opts.Env, sel.issue, sel.pr, sel.slot)
+		}
+		sel.slot, target.issue, target.pr = rec.Slot, rec.Issue, rec.PR
+		if strings.TrimSpace(opts.Namespace) == "" {
+			opts.Namespace = rec.Namespace
+		}
+	}
+
+	stackCfg, ctxData, _, _, err := loadStackConfigFromCmd(opts, cmd, sel.slot)
+	if err != nil {
+		return target, err
+	}
+	if strings.TrimSpace(ctxData.Namespace) == "" {
+		return target, fmt.Errorf("%s requires a resolved namespace (use --slot, --issue, --pr or --namespace)", cmd.Name())
+	}
+	resolved, err := config.ResolveEnvironment(stackCfg, opts.Env)
+	if err != nil {
+		return target, err
+	}
+	target.stackCfg, target.ctxData, target.envCfg = stackCfg, ctxData, resolved
+	return target, nil
+}
+
+// envSiteHost returns the public host of an environment: the base domain of envName, prefixed with
+// "dev-<slot>." for ai slots.
+func envSiteHost(ctxData config.TemplateContext, envName string, slot int) string {
+	if envName == "ai" {
+		return fmt.Sprintf("dev-%d.%s", slot, ctxData.BaseDomain["ai"])
+	}
+	return ctxData.BaseDomain[envName]
+}
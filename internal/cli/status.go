@@ -0,0 +1,446 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/codex-k8s/codexctl/internal/config"
+	"github.com/codex-k8s/codexctl/internal/engine"
+	"github.com/codex-k8s/codexctl/internal/kube"
+)
+
+// codexDeployment is the name of the Deployment that runs the Codex agent in an environment.
+const codexDeployment = "codex"
+
+// statusReport is the state of an environment as shown by "codexctl status".
+type statusReport struct {
+	// Project is the project name.
+	Project string `json:"project"`
+	// Env is the environment name.
+	Env string `json:"env"`
+	// Slot is the slot number of slot-based environments.
+	Slot int `json:"slot,omitempty"`
+	// Issue is the issue the slot is allocated for.
+	Issue int `json:"issue,omitempty"`
+	// PR is the pull request the slot is allocated for.
+	PR int `json:"pr,omitempty"`
+	// Namespace is the environment namespace.
+	Namespace string `json:"namespace"`
+	// NamespaceExists reports whether the namespace exists.
+	NamespaceExists bool `json:"namespaceExists"`
+	// Ready reports whether every component is ready.
+	Ready bool `json:"ready"`
+	// Components lists the enabled infrastructure blocks and services in declaration order.
+	Components []componentStatus `json:"components"`
+	// Codex is the state of the Codex agent Deployment; nil when the environment has none.
+	Codex *codexStatus `json:"codex,omitempty"`
+	// ObservedAt is when the state was read.
+	ObservedAt time.Time `json:"observedAt"`
+}
+
+// componentStatus is the state of a single infrastructure block or service.
+type componentStatus struct {
+	// Name is the infra block or service name.
+	Name string `json:"name"`
+	// Type is "infra" or "service".
+	Type config.NodeKind `json:"type"`
+	// Ready reports whether all workloads are ready; services without workloads are not ready.
+	Ready bool `json:"ready"`
+	// ExpectedImage is the image the service renders into its workloads (services only).
+	ExpectedImage string `json:"expectedImage,omitempty"`
+	// Workloads lists the workloads labelled with the component.
+	Workloads []workloadStatus `json:"workloads"`
+	// URLs lists the URLs of the ingresses labelled with the component.
+	URLs []string `json:"urls,omitempty"`
+}
+
+// workloadStatus is the state of a workload of a component.
+type workloadStatus struct {
+	// Kind is Deployment, StatefulSet, DaemonSet or Job.
+	Kind string `json:"kind"`
+	// Name is the workload name.
+	Name string `json:"name"`
+	// Ready reports whether the rollout finished (or the Job completed).
+	Ready bool `json:"ready"`
+	// ReadyReplicas is the number of ready pods.
+	ReadyReplicas int32 `json:"readyReplicas"`
+	// Replicas is the desired number of pods.
+	Replicas int32 `json:"replicas"`
+	// Message describes the pending state or the failure.
+	Message string `json:"message,omitempty"`
+	// Images lists the container images with their expected values.
+	Images []imageStatus `json:"images,omitempty"`
+	// Pods lists the pods of the workload, newest first.
+	Pods []kube.PodState `json:"pods,omitempty"`
+}
+
+// imageStatus compares a container image with the image the service renders.
+type imageStatus struct {
+	// Container is the container name.
+	Container string `json:"container"`
+	// Init reports an init container.
+	Init bool `json:"init,omitempty"`
+	// Image is the live image of the pod template.
+	Image string `json:"image"`
+	// Expected is the rendered service image; empty for containers the service image does not target.
+	Expected string `json:"expected,omitempty"`
+	// UpToDate reports whether Image equals Expected (always true without Expected).
+	UpToDate bool `json:"upToDate"`
+}
+
+// codexStatus is the state of the Codex agent Deployment.
+type codexStatus struct {
+	// Ready reports whether the Deployment finished its rollout.
+	Ready bool `json:"ready"`
+	// Message describes the pending state.
+	Message string `json:"message,omitempty"`
+	// Pods lists the Codex pods, newest first.
+	Pods []kube.PodState `json:"pods,omitempty"`
+}
+
+// newStatusCommand creates the "status" subcommand that shows the live state of an environment.
+func newStatusCommand(opts *Options) *cobra.Command {
+	var (
+		sel      slotSelector
+		output   string
+		watch    bool
+		interval time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show workloads, images, ingress URLs and the Codex pod of an environment",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			logger := LoggerFromContext(cmd.Context())
+			if output != "table" && output != "json" {
+				return fmt.Errorf("unsupported output %q (use table or json)", output)
+			}
+			if interval <= 0 {
+				return fmt.Errorf("--interval must be positive")
+			}
+
+			target, err := resolveSlotTarget(cmd.Context(), logger, opts, cmd, sel)
+			if err != nil {
+				return err
+			}
+			kubeClient, err := envKubeClient(opts, target.envCfg, target.ctxData, true)
+			if err != nil {
+				return err
+			}
+
+			read := func() (*statusReport, error) {
+				ctx, cancel := context.WithTimeout(cmd.Context(), 2*time.Minute)
+				defer cancel()
+				return collectStatus(ctx, kubeClient, target)
+			}
+			report, err := read()
+			if err != nil {
+				return err
+			}
+			if err := printStatus(os.Stdout, report, output, watch); err != nil {
+				return err
+			}
+			if !watch {
+				return nil
+			}
+
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-cmd.Context().Done():
+					return nil
+				case <-ticker.C:
+				}
+				next, err := read()
+				if err != nil {
+					logger.Warn("failed to read environment status", "namespace", target.ctxData.Namespace, "error", err)
+					continue
+				}
+				if sameStatus(report, next) {
+					continue
+				}
+				report = next
+				if err := printStatus(os.Stdout, report, output, watch); err != nil {
+					return err
+				}
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Env, "env", "", "Environment to inspect (dev, ai-staging, ai)")
+	cmd.Flags().StringVar(&opts.Namespace, "namespace", "", "Namespace override")
+	addSlotSelectorFlags(cmd, &sel)
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "Output format: table or json")
+	cmd.Flags().BoolVarP(&watch, "watch", "w", false, "Keep polling and print the status again whenever it changes")
+	cmd.Flags().DurationVar(&interval, "interval", 5*time.Second, "Polling interval for --watch")
+	addVarsFlags(cmd)
+	_ = cmd.MarkFlagRequired("env")
+
+	return cmd
+}
+
+// collectStatus reads the namespace of target and maps its workloads and ingresses to the declared components.
+func collectStatus(ctx context.Context, client kube.ObjectClient, target slotTarget) (*statusReport, error) {
+	ns, err := kube.GetNamespaceStatus(ctx, client, target.ctxData.Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("read namespace %s: %w", target.ctxData.Namespace, err)
+	}
+	report := &statusReport{
+		Project:         target.stackCfg.Project,
+		Env:             target.ctxData.Env,
+		Slot:            target.ctxData.Slot,
+		Issue:           target.issue,
+		PR:              target.pr,
+		Namespace:       ns.Namespace,
+		NamespaceExists: ns.Exists,
+		Ready:           ns.Exists,
+		Components:      []componentStatus{},
+		ObservedAt:      time.Now().UTC().Truncate(time.Second),
+	}
+
+	for _, infra := range target.stackCfg.Infrastructure {
+		ok, err := engine.ComponentEnabled(config.NodeInfra, infra.When, target.ctxData)
+		if err != nil {
+			return nil, fmt.Errorf("evaluate when for infra %q: %w", infra.Name, err)
+		}
+		if ok {
+			report.Components = append(report.Components, componentState(ns, config.NodeInfra, infra.Name, nil))
+		}
+	}
+	for i := range target.stackCfg.Services {
+		svc := &target.stackCfg.Services[i]
+		ok, err := engine.ComponentEnabled(config.NodeService, svc.When, target.ctxData)
+		if err != nil {
+			return nil, fmt.Errorf("evaluate when for service %q: %w", svc.Name, err)
+		}
+		if !ok {
+			continue
+		}
+		expected, err := engine.ServiceImage(*svc, target.ctxData)
+		if err != nil {
+			return nil, fmt.Errorf("render image for service %q: %w", svc.Name, err)
+		}
+		comp := componentState(ns, config.NodeService, svc.Name, func(c kube.ContainerImage) string {
+			if expected == "" {
+				return ""
+			}
+			if len(svc.Image.Containers) > 0 {
+				for _, name := range svc.Image.Containers {
+					if strings.TrimSpace(name) == c.Container {
+						return expected
+					}
+				}
+				return ""
+			}
+			if engine.ImageRepository(c.Image) == engine.ImageRepository(expected) {
+				return expected
+			}
+			return ""
+		})
+		comp.ExpectedImage = expected
+		report.Components = append(report.Components, comp)
+	}
+	for _, c := range report.Components {
+		report.Ready = report.Ready && c.Ready
+	}
+
+	for _, w := range ns.Workloads {
+		if w.Kind == "Deployment" && w.Name == codexDeployment {
+			report.Codex = &codexStatus{Ready: w.Ready, Message: w.Message, Pods: w.Pods}
+		}
+	}
+	return report, nil
+}
+
+// componentState collects the workloads and ingress URLs labelled with the component. expectedImage returns
+// the expected image of a container (empty when the container is not checked); nil disables the check.
+func componentState(ns *kube.NamespaceStatus, kind config.NodeKind, name string, expectedImage func(kube.ContainerImage) string) componentStatus {
+	owned := func(labels map[string]string) bool {
+		return labels[engine.LabelComponentType] == string(kind) && labels[engine.LabelComponent] == name
+	}
+	comp := componentStatus{Name: name, Type: kind, Ready: true, Workloads: []workloadStatus{}}
+	for _, w := range ns.Workloads {
+		if !owned(w.Labels) {
+			continue
+		}
+		ws := workloadStatus{
+			Kind:          w.Kind,
+			Name:          w.Name,
+			Ready:         w.Ready,
+			ReadyReplicas: w.ReadyReplicas,
+			Replicas:      w.Replicas,
+			Message:       w.Message,
+			Pods:          w.Pods,
+		}
+		for _, img := range w.Images {
+			is := imageStatus{Container: img.Container, Init: img.Init, Image: img.Image, UpToDate: true}
+			if expectedImage != nil {
+				if expected := expectedImage(img); expected != "" {
+					is.Expected, is.UpToDate = expected, img.Image == expected
+				}
+			}
+			ws.Images = append(ws.Images, is)
+		}
+		comp.Ready = comp.Ready && w.Ready
+		comp.Workloads = append(comp.Workloads, ws)
+	}
+	if kind == config.NodeService && len(comp.Workloads) == 0 {
+		comp.Ready = false
+	}
+	for _, ing := range ns.Ingresses {
+		if owned(ing.Labels) {
+			comp.URLs = append(comp.URLs, ing.URLs...)
+		}
+	}
+	return comp
+}
+
+// sameStatus reports whether two reports differ only in their observation time.
+func sameStatus(a, b *statusReport) bool {
+	ac, bc := *a, *b
+	ac.ObservedAt, bc.ObservedAt = time.Time{}, time.Time{}
+	ra, errA := json.Marshal(ac)
+	rb, errB := json.Marshal(bc)
+	return errA == nil && errB == nil && string(ra) == string(rb)
+}
+
+// printStatus writes report as a table or as JSON. In watch mode JSON reports are written one per line
+// and tables are preceded by the observation time.
+func printStatus(w io.Writer, report *statusReport, output string, watch bool) error {
+	if output == "json" {
+		enc := json.NewEncoder(w)
+		if !watch {
+			enc.SetIndent("", "  ")
+		}
+		if err := enc.Encode(report); err != nil {
+			return fmt.Errorf("encode status report: %w", err)
+		}
+		return nil
+	}
+	if watch {
+		fmt.Fprintf(w, "--- %s ---\n", report.ObservedAt.Local().Format(time.TimeOnly))
+	}
+	return printStatusTable(w, report)
+}
+
+// printStatusTable writes report as a human-readable table.
+func printStatusTable(w io.Writer, report *statusReport) error {
+	header := []string{"env " + report.Env}
+	if report.Slot > 0 {
+		header = append(header, fmt.Sprintf("slot %d", report.Slot))
+	}
+	if report.Issue > 0 {
+		header = append(header, fmt.Sprintf("issue #%d", report.Issue))
+	}
+	if report.PR > 0 {
+		header = append(header, fmt.Sprintf("PR #%d", report.PR))
+	}
+	header = append(header, "namespace "+report.Namespace)
+	state := "not ready"
+	if report.Ready {
+		state = "ready"
+	}
+	fmt.Fprintf(w, "%s: %s\n", strings.Join(header, ", "), state)
+	if !report.NamespaceExists {
+		fmt.Fprintf(w, "namespace %s does not exist\n", report.Namespace)
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "\nCOMPONENT\tTYPE\tWORKLOAD\tREADY\tIMAGE\tSTATUS")
+	for _, c := range report.Components {
+		if len(c.Workloads) == 0 {
+			status := "no workloads"
+			if c.Type == config.NodeService {
+				status = "not deployed"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t-\t-\t%s\t%s\n", c.Name, c.Type, dashIfEmpty(c.ExpectedImage), status)
+			continue
+		}
+		for _, wl := range c.Workloads {
+			fmt.Fprintf(tw, "%s\t%s\t%s/%s\t%d/%d\t%s\t%s\n",
+				c.Name, c.Type, strings.ToLower(wl.Kind), wl.Name, wl.ReadyReplicas, wl.Replicas, workloadImages(wl), workloadState(wl))
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("write status: %w", err)
+	}
+
+	var urls []string
+	for _, c := range report.Components {
+		for _, u := range c.URLs {
+			urls = append(urls, fmt.Sprintf("%s\t%s", c.Name, u))
+		}
+	}
+	if len(urls) > 0 {
+		fmt.Fprintln(tw, "\nINGRESS\tURL")
+		for _, u := range urls {
+			fmt.Fprintln(tw, u)
+		}
+		if err := tw.Flush(); err != nil {
+			return fmt.Errorf("write status: %w", err)
+		}
+	}
+
+	if report.Codex != nil {
+		fmt.Fprintln(tw, "\nCODEX POD\tPHASE\tREADY\tRESTARTS\tREASON")
+		if len(report.Codex.Pods) == 0 {
+			fmt.Fprintf(tw, "-\t-\t-\t-\t%s\n", dashIfEmpty(report.Codex.Message))
+		}
+		for _, p := range report.Codex.Pods {
+			fmt.Fprintf(tw, "%s\t%s\t%t\t%d\t%s\n", p.Name, p.Phase, p.Ready, p.Restarts, dashIfEmpty(p.Reason))
+		}
+		if err := tw.Flush(); err != nil {
+			return fmt.Errorf("write status: %w", err)
+		}
+	}
+	return nil
+}
+
+// workloadImages formats the container images of a workload, skipping init containers the service image
+// does not target; images that differ from the rendered service image are marked with the expected one.
+func workloadImages(wl workloadStatus) string {
+	var parts []string
+	for _, img := range wl.Images {
+		if img.Init && img.Expected == "" {
+			continue
+		}
+		s := img.Image
+		if !img.UpToDate {
+			s += " (expected " + img.Expected + ")"
+		}
+		parts = append(parts, s)
+	}
+	return dashIfEmpty(strings.Join(parts, ", "))
+}
+
+// workloadState formats the readiness of a workload with the reason of its first unhealthy pod.
+func workloadState(wl workloadStatus) string {
+	if wl.Ready {
+		return "ready"
+	}
+	state := dashIfEmpty(wl.Message)
+	for _, p := range wl.Pods {
+		if !p.Ready && p.Reason != "" {
+			return fmt.Sprintf("%s (pod %s: %s)", state, p.Name, p.Reason)
+		}
+	}
+	return state
+}
+
+// dashIfEmpty returns s or "-" when s is empty.
+func dashIfEmpty(s string) string {
+	if strings.TrimSpace(s) == "" {
+		return "-"
+	}
+	return s
+}
@@ -23,6 +23,9 @@ type StackConfig struct {
 	Project string `yaml:"project"`
 	// EnvFiles lists .env files to load before rendering.
 	EnvFiles []string `yaml:"envFiles,omitempty"`
+	// Imports lists project-relative paths or globs of additional services.yaml fragments
+	// rendered with the same template context and deep-merged into this config.
+	Imports []string `yaml:"imports,omitempty"`
 	// Codex contains Codex-specific integration settings.
 	Codex CodexConfig `yaml:"codex,omitempty"`
 	// Namespace defines namespace naming patterns by environment.
@@ -127,6 +130,45 @@ type Environment struct {
 	SlotBootstrapInfra []string `yaml:"slotBootstrapInfra,omitempty"`
 	// LocalRegistry configures an optional local registry for dev.
 	LocalRegistry *LocalRegistrySpec `yaml:"localRegistry,omitempty"`
+	// ServerSideApply switches apply to server-side apply with the "codexctl" field manager.
+	ServerSideApply *bool `yaml:"serverSideApply,omitempty"`
+	// Cluster selects the Kubernetes cluster of the environment (defaults to the current kubeconfig context).
+	Cluster *ClusterSpec `yaml:"cluster,omitempty"`
+	// WarmPool keeps pre-provisioned slots ready to be claimed by "ensure-slot"/"ensure-ready".
+	WarmPool *WarmPoolSpec `yaml:"warmPool,omitempty"`
+	// SeedFrom restores the data volumes of new slots from a snapshot taken with "manage-env snapshot create".
+	SeedFrom *SeedFromSpec `yaml:"seedFrom,omitempty"`
+}
+
+// SeedFromSpec names the snapshot new slots of an environment are seeded from.
+type SeedFromSpec struct {
+	// Env is the environment the snapshot was taken from (e.g. "ai-staging"); it must run in the same cluster.
+	Env string `yaml:"env"`
+	// Snapshot is the snapshot name.
+	Snapshot string `yaml:"snapshot"`
+}
+
+// WarmPoolSpec configures the warm slot pool of an environment.
+type WarmPoolSpec struct {
+	// Size is the number of unassigned slots "manage-env warm" keeps provisioned with slotBootstrapInfra and
+	// the full stack applied.
+	Size int `yaml:"size,omitempty"`
+}
+
+// ClusterSpec selects a Kubernetes cluster.
+type ClusterSpec struct {
+	// Kubeconfig is a kubeconfig path relative to the project root, or a list of paths separated by ":"
+	// (empty uses $KUBECONFIG and ~/.kube/config).
+	Kubeconfig string `yaml:"kubeconfig,omitempty"`
+	// Context is the kubeconfig context (empty uses the current context).
+	Context string `yaml:"context,omitempty"`
+	// InCluster uses the service account of the pod codexctl runs in; excludes kubeconfig and context.
+	InCluster bool `yaml:"inCluster,omitempty"`
+}
+
+// UsesServerSideApply reports whether the environment opted into server-side apply.
+func (e Environment) UsesServerSideApply() bool {
+	return e.ServerSideApply != nil && *e.ServerSideApply
 }
 
 // StorageConfig describes PVC settings for shared storage.
@@ -196,6 +238,8 @@ type InfraItem struct {
 	Manifests []ManifestRef `yaml:"manifests"`
 	// When is a template expression that enables this infra block.
 	When string `yaml:"when,omitempty"`
+	// DependsOn lists infra blocks or services that must be applied and ready first.
+	DependsOn []string `yaml:"dependsOn,omitempty"`
 	// Hooks contains infra-specific hook steps.
 	Hooks ResourceHooks `yaml:"hooks,omitempty"`
 }
@@ -218,6 +262,8 @@ type Service struct {
 	Ingress *ServiceIngress `yaml:"ingress,omitempty"`
 	// When is a template expression that enables this service.
 	When string `yaml:"when,omitempty"`
+	// DependsOn lists infra blocks or services that must be applied and ready first.
+	DependsOn []string `yaml:"dependsOn,omitempty"`
 	// Overlays contains per-environment overrides.
 	Overlays map[string]Overlay `yaml:"overlays,omitempty"`
 	// Hooks contains service-specific hook steps.
@@ -231,6 +277,10 @@ type ServiceImage struct {
 	Repository string `yaml:"repository"`
 	// Tag is a Go-template string that resolves to an image tag.
 	Tag string `yaml:"tagTemplate"`
+	// Containers lists container names (regular or init) that receive the image in every
+	// workload of the service. When empty, the first container of the workload named after
+	// the service is used.
+	Containers []string `yaml:"containers,omitempty"`
 }
 
 // ServiceIngress describes host mapping per environment for a service.
@@ -245,6 +295,43 @@ type Overlay struct {
 	PVCMounts []PVCMount `yaml:"pvcMounts,omitempty"`
 	// DropKinds lists Kubernetes kinds to exclude for the environment.
 	DropKinds []string `yaml:"dropKinds,omitempty"`
+	// Patches modify matching service resources after image and PVC injection.
+	Patches []Patch `yaml:"patches,omitempty"`
+}
+
+// Patch describes a modification of rendered service resources.
+// Exactly one of StrategicMerge and JSON6902 must be set.
+type Patch struct {
+	// Target selects the resources to patch.
+	Target PatchTarget `yaml:"target"`
+	// StrategicMerge is a partial resource merged into each target: mappings are merged
+	// recursively, null removes a key and lists of named items are merged by name.
+	StrategicMerge map[string]any `yaml:"strategicMerge,omitempty"`
+	// JSON6902 is a list of RFC 6902 operations applied to each target in order.
+	JSON6902 []JSONPatchOperation `yaml:"json6902,omitempty"`
+}
+
+// PatchTarget selects resources by kind, name and labels. Empty fields match any resource;
+// at least one field must be set.
+type PatchTarget struct {
+	// Kind is the resource kind (e.g. "Deployment").
+	Kind string `yaml:"kind,omitempty"`
+	// Name is the resource metadata.name.
+	Name string `yaml:"name,omitempty"`
+	// LabelSelector is an equality-based selector (e.g. "app=web,tier!=cache").
+	LabelSelector string `yaml:"labelSelector,omitempty"`
+}
+
+// JSONPatchOperation is a single RFC 6902 operation.
+type JSONPatchOperation struct {
+	// Op is one of add, remove, replace, move, copy or test.
+	Op string `yaml:"op"`
+	// Path is the JSON pointer of the target location.
+	Path string `yaml:"path"`
+	// From is the source JSON pointer for move and copy.
+	From string `yaml:"from,omitempty"`
+	// Value is the value for add, replace and test.
+	Value any `yaml:"value,omitempty"`
 }
 
 // PVCMount describes a persistent volume claim mount injected into workloads.
@@ -259,14 +346,20 @@ type PVCMount struct {
 	SubPath string `yaml:"subPath,omitempty"`
 	// ReadOnly toggles read-only mounts.
 	ReadOnly bool `yaml:"readOnly,omitempty"`
+	// Containers lists container names (regular or init) to mount into in every workload of
+	// the service. When empty, the first container and init containers of the workload named
+	// after the service are used.
+	Containers []string `yaml:"containers,omitempty"`
 }
 
 // StateConfig describes how environment state (slots, metadata) is stored.
-// For the initial implementation, only a ConfigMap-based backend is supported.
+// Backends: "configmap" (default), "crd" (CodexSlot custom resources) and "local" (a JSON file).
 type StateConfig struct {
-	Backend            string `yaml:"backend,omitempty"`            // e.g. "configmap"
-	ConfigMapNamespace string `yaml:"configmapNamespace,omitempty"` // namespace where state ConfigMaps live
-	ConfigMapPrefix    string `yaml:"configmapPrefix,omitempty"`    // prefix for state ConfigMap names
+	Backend            string       `yaml:"backend,omitempty"`            // "configmap", "crd" or "local"
+	ConfigMapNamespace string       `yaml:"configmapNamespace,omitempty"` // namespace where state ConfigMaps (or CodexSlots) live
+	ConfigMapPrefix    string       `yaml:"configmapPrefix,omitempty"`    // prefix for state record names
+	Path               string       `yaml:"path,omitempty"`               // state file of the local backend (default .codexctl/state.json)
+	Cluster            *ClusterSpec `yaml:"cluster,omitempty"`            // cluster holding the state (defaults to the environment cluster)
 }
 
 // HookSet describes global hooks executed around stack operations.
@@ -366,10 +459,12 @@ type rawHeader struct {
 	Namespace  struct {
 		Patterns map[string]string `yaml:"patterns"`
 	} `yaml:"namespace"`
+	Environments map[string]any `yaml:"environments"`
 }
 
 // LoadAndRender reads services.yaml, loads envFiles and user vars, and returns rendered YAML bytes
-// together with the template context that was used.
+// together with the template context that was used. Only the root file is rendered; see LoadFragments
+// for the files referenced by imports.
 func LoadAndRender(path string, opts LoadOptions) ([]byte, TemplateContext, error) {
 	var zeroCtx TemplateContext
 
@@ -460,19 +555,23 @@ func LoadAndRender(path string, opts LoadOptions) ([]byte, TemplateContext, erro
 	return rendered, ctx, nil
 }
 
-// LoadStackConfig loads, templates and parses services.yaml into StackConfig and TemplateContext.
+// LoadStackConfig loads, templates and parses services.yaml together with its imports into
+// StackConfig and TemplateContext.
 func LoadStackConfig(path string, opts LoadOptions) (*StackConfig, TemplateContext, error) {
-	rendered, ctx, err := LoadAndRender(path, opts)
+	fragments, ctx, err := LoadFragments(path, opts)
 	if err != nil {
 		return nil, TemplateContext{}, err
 	}
 
-	var cfg StackConfig
-	if err := yaml.Unmarshal(rendered, &cfg); err != nil {
-		return nil, TemplateContext{}, fmt.Errorf("parse rendered services.yaml: %w", err)
+	cfg, err := decodeFragments(fragments, ctx.ProjectRoot)
+	if err != nil {
+		return nil, TemplateContext{}, err
+	}
+	if _, err := BuildDependencyGraph(cfg); err != nil {
+		return nil, TemplateContext{}, err
 	}
 
-	ns, err := ResolveNamespace(&cfg, ctx, opts.Env)
+	ns, err := ResolveNamespace(cfg, ctx, opts.Env)
 	if err != nil {
 		return nil, TemplateContext{}, err
 	}
@@ -485,7 +584,7 @@ func LoadStackConfig(path string, opts LoadOptions) (*StackConfig, TemplateConte
 	ctx.Codex = cfg.Codex
 	ctx.Storage = cfg.Storage
 
-	return &cfg, ctx, nil
+	return cfg, ctx, nil
 }
 
 // executeTemplate renders the given YAML content using the stack template context.
@@ -644,6 +743,18 @@ func ResolveEnvironment(cfg *StackConfig, name string) (Environment, error) {
 		if envCfg.LocalRegistry != nil {
 			merged.LocalRegistry = envCfg.LocalRegistry
 		}
+		if envCfg.ServerSideApply != nil {
+			merged.ServerSideApply = envCfg.ServerSideApply
+		}
+		if envCfg.Cluster != nil {
+			merged.Cluster = envCfg.Cluster
+		}
+		if envCfg.WarmPool != nil {
+			merged.WarmPool = envCfg.WarmPool
+		}
+		if envCfg.SeedFrom != nil {
+			merged.SeedFrom = envCfg.SeedFrom
+		}
 		return merged, nil
 	}
 
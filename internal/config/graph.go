@@ -0,0 +1,238 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NodeKind identifies the type of a dependency graph node.
+type NodeKind string
+
+const (
+	// NodeInfra marks an infrastructure block.
+	NodeInfra NodeKind = "infra"
+	// NodeService marks a service.
+	NodeService NodeKind = "service"
+)
+
+// NodeKey identifies an infrastructure block or a service in the dependency graph.
+type NodeKey struct {
+	// Kind is the node type.
+	Kind NodeKind
+	// Name is the infra or service name as declared in services.yaml.
+	Name string
+}
+
+// String returns the key in "kind/name" form.
+func (k NodeKey) String() string {
+	return string(k.Kind) + "/" + k.Name
+}
+
+// DependencyGraph is the DAG built from dependsOn declarations of infrastructure blocks and services.
+type DependencyGraph struct {
+	order []NodeKey
+	deps  map[NodeKey][]NodeKey
+}
+
+// BuildDependencyGraph resolves dependsOn references and checks the resulting graph for cycles.
+// A reference is either a plain name, resolved against infrastructure and service names, or an
+// explicit "infra/<name>" or "service/<name>" when both kinds share the name.
+func BuildDependencyGraph(cfg *StackConfig) (*DependencyGraph, error) {
+	g := &DependencyGraph{deps: make(map[NodeKey][]NodeKey)}
+	if cfg == nil {
+		return g, nil
+	}
+
+	declared := make(map[NodeKey]struct{})
+	declare := func(key NodeKey) {
+		if _, ok := declared[key]; ok {
+			return
+		}
+		declared[key] = struct{}{}
+		g.order = append(g.order, key)
+	}
+	for _, infra := range cfg.Infrastructure {
+		declare(NodeKey{Kind: NodeInfra, Name: infra.Name})
+	}
+	for _, svc := range cfg.Services {
+		declare(NodeKey{Kind: NodeService, Name: svc.Name})
+	}
+
+	resolve := func(from NodeKey, ref string) (NodeKey, error) {
+		ref = strings.TrimSpace(ref)
+		if kind, name, ok := strings.Cut(ref, "/"); ok {
+			key := NodeKey{Kind: NodeKind(kind), Name: name}
+			if _, exists := declared[key]; !exists {
+				return NodeKey{}, fmt.Errorf("%s depends on unknown %q", from, ref)
+			}
+			return key, nil
+		}
+		infraKey := NodeKey{Kind: NodeInfra, Name: ref}
+		serviceKey := NodeKey{Kind: NodeService, Name: ref}
+		_, isInfra := declared[infraKey]
+		_, isService := declared[serviceKey]
+		switch {
+		case isInfra && isService:
+			return NodeKey{}, fmt.Errorf("%s depends on ambiguous %q: use %q or %q", from, ref, infraKey, serviceKey)
+		case isInfra:
+			return infraKey, nil
+		case isService:
+			return serviceKey, nil
+		default:
+			return NodeKey{}, fmt.Errorf("%s depends on unknown %q", from, ref)
+		}
+	}
+	addDeps := func(from NodeKey, refs []string) error {
+		for _, ref := range refs {
+			to, err := resolve(from, ref)
+			if err != nil {
+				return err
+			}
+			if to == from {
+				return fmt.Errorf("%s depends on itself", from)
+			}
+			g.deps[from] = append(g.deps[from], to)
+		}
+		return nil
+	}
+	for _, infra := range cfg.Infrastructure {
+		if err := addDeps(NodeKey{Kind: NodeInfra, Name: infra.Name}, infra.DependsOn); err != nil {
+			return nil, err
+		}
+	}
+	for _, svc := range cfg.Services {
+		if err := addDeps(NodeKey{Kind: NodeService, Name: svc.Name}, svc.DependsOn); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := g.checkCycles(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// checkCycles returns an error describing the first dependency cycle found.
+func (g *DependencyGraph) checkCycles() error {
+	const (
+		visiting = iota + 1
+		done
+	)
+	state := make(map[NodeKey]int)
+	var stack []NodeKey
+
+	var visit func(key NodeKey) error
+	visit = func(key NodeKey) error {
+		switch state[key] {
+		case done:
+			return nil
+		case visiting:
+			cycle := []string{key.String()}
+			for i := len(stack) - 1; i >= 0; i-- {
+				cycle = append([]string{stack[i].String()}, cycle...)
+				if stack[i] == key {
+					break
+				}
+			}
+			return fmt.Errorf("dependency cycle detected: %s", strings.Join(cycle, " -> "))
+		}
+		state[key] = visiting
+		stack = append(stack, key)
+		for _, dep := range g.deps[key] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[key] = done
+		return nil
+	}
+
+	for _, key := range g.order {
+		if err := visit(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HasEdges reports whether any node declares dependencies.
+func (g *DependencyGraph) HasEdges() bool {
+	return len(g.deps) > 0
+}
+
+// Dependencies returns the direct dependencies of key.
+func (g *DependencyGraph) Dependencies(key NodeKey) []NodeKey {
+	return g.deps[key]
+}
+
+// Closure returns roots together with all their transitive dependencies in declaration order.
+func (g *DependencyGraph) Closure(roots []NodeKey) []NodeKey {
+	included := make(map[NodeKey]struct{})
+	var walk func(key NodeKey)
+	walk = func(key NodeKey) {
+		if _, ok := included[key]; ok {
+			return
+		}
+		included[key] = struct{}{}
+		for _, dep := range g.deps[key] {
+			walk(dep)
+		}
+	}
+	for _, root := range roots {
+		walk(root)
+	}
+
+	out := make([]NodeKey, 0, len(included))
+	for _, key := range g.order {
+		if _, ok := included[key]; ok {
+			out = append(out, key)
+		}
+	}
+	return out
+}
+
+// Waves splits nodes into topological waves: every node only depends on nodes from earlier waves.
+// Dependencies outside of nodes (filtered out or disabled) are treated as satisfied, while
+// ordering through them is preserved.
+// Nodes keep their declaration order within a wave.
+func (g *DependencyGraph) Waves(nodes []NodeKey) [][]NodeKey {
+	selected := make(map[NodeKey]struct{}, len(nodes))
+	for _, key := range nodes {
+		selected[key] = struct{}{}
+	}
+	level := make(map[NodeKey]int, len(nodes))
+	ready := make(map[NodeKey]int)
+
+	// readyAt returns the first wave after which key and everything it depends on are applied.
+	var readyAt func(key NodeKey) int
+	readyAt = func(key NodeKey) int {
+		if r, ok := ready[key]; ok {
+			return r
+		}
+		l := 0
+		for _, dep := range g.deps[key] {
+			if r := readyAt(dep); r > l {
+				l = r
+			}
+		}
+		r := l
+		if _, ok := selected[key]; ok {
+			level[key] = l
+			r = l + 1
+		}
+		ready[key] = r
+		return r
+	}
+
+	var waves [][]NodeKey
+	for _, key := range nodes {
+		readyAt(key)
+		l := level[key]
+		for len(waves) <= l {
+			waves = append(waves, nil)
+		}
+		waves[l] = append(waves[l], key)
+	}
+	return waves
+}
@@ -0,0 +1,254 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Fragment is a single rendered services.yaml file: the root config or one of its imports.
+type Fragment struct {
+	// Path is the absolute path of the file on disk.
+	Path string
+	// Rendered is the file content after template rendering.
+	Rendered []byte
+}
+
+// importsHeader is a minimal struct used to extract the imports list from a rendered fragment.
+type importsHeader struct {
+	Imports []string `yaml:"imports"`
+}
+
+// LoadFragments renders services.yaml and every file reachable through its imports lists
+// with the same template context. The root file is always the first fragment; imported
+// files follow in depth-first order, each one listed once.
+func LoadFragments(path string, opts LoadOptions) ([]Fragment, TemplateContext, error) {
+	rendered, ctx, err := LoadAndRender(path, opts)
+	if err != nil {
+		return nil, TemplateContext{}, err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, TemplateContext{}, fmt.Errorf("resolve config path: %w", err)
+	}
+
+	loader := &fragmentLoader{
+		ctx:  ctx,
+		seen: map[string]struct{}{absPath: {}},
+	}
+	if err := loader.add(Fragment{Path: absPath, Rendered: rendered}); err != nil {
+		return nil, TemplateContext{}, err
+	}
+	return loader.fragments, ctx, nil
+}
+
+// fragmentLoader collects fragments while following imports.
+type fragmentLoader struct {
+	ctx       TemplateContext
+	seen      map[string]struct{}
+	fragments []Fragment
+}
+
+// add records frag and recursively loads the files it imports.
+func (l *fragmentLoader) add(frag Fragment) error {
+	l.fragments = append(l.fragments, frag)
+
+	var header importsHeader
+	if err := yaml.Unmarshal(frag.Rendered, &header); err != nil {
+		return fmt.Errorf("parse imports of %q: %w", frag.Path, err)
+	}
+
+	for _, pattern := range header.Imports {
+		files, err := l.resolve(pattern)
+		if err != nil {
+			return fmt.Errorf("resolve import %q in %q: %w", pattern, frag.Path, err)
+		}
+		for _, file := range files {
+			if _, ok := l.seen[file]; ok {
+				continue
+			}
+			l.seen[file] = struct{}{}
+
+			raw, err := os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("read import %q: %w", file, err)
+			}
+			rendered, err := executeTemplate(raw, l.ctx)
+			if err != nil {
+				return fmt.Errorf("render import %q: %w", file, err)
+			}
+			if err := l.add(Fragment{Path: file, Rendered: rendered}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolve expands a project-relative path or glob into a sorted list of absolute file paths.
+// A plain path must exist; a glob may match nothing.
+func (l *fragmentLoader) resolve(pattern string) ([]string, error) {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" {
+		return nil, fmt.Errorf("import path is empty")
+	}
+	full := pattern
+	if !filepath.IsAbs(full) {
+		full = filepath.Join(l.ctx.ProjectRoot, pattern)
+	}
+
+	if !strings.ContainsAny(pattern, "*?[") {
+		if _, err := os.Stat(full); err != nil {
+			return nil, err
+		}
+		return []string{filepath.Clean(full)}, nil
+	}
+
+	matches, err := filepath.Glob(full)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// decodeFragments parses each fragment into a StackConfig, rebases its manifest paths and
+// deep-merges the results in order. Services and infrastructure blocks are keyed by name
+// and may not be defined by more than one file.
+func decodeFragments(fragments []Fragment, projectRoot string) (*StackConfig, error) {
+	var merged StackConfig
+	serviceOrigin := make(map[string]string)
+	infraOrigin := make(map[string]string)
+
+	for _, frag := range fragments {
+		var part StackConfig
+		if err := yaml.Unmarshal(frag.Rendered, &part); err != nil {
+			return nil, fmt.Errorf("parse rendered %s: %w", displayPath(frag.Path, projectRoot), err)
+		}
+		name := displayPath(frag.Path, projectRoot)
+		rebaseManifestPaths(&part, filepath.Dir(frag.Path), projectRoot)
+
+		for _, svc := range part.Services {
+			if origin, ok := serviceOrigin[svc.Name]; ok && origin != name {
+				return nil, fmt.Errorf("service %q is defined in both %s and %s", svc.Name, origin, name)
+			}
+			serviceOrigin[svc.Name] = name
+		}
+		for _, infra := range part.Infrastructure {
+			if origin, ok := infraOrigin[infra.Name]; ok && origin != name {
+				return nil, fmt.Errorf("infrastructure %q is defined in both %s and %s", infra.Name, origin, name)
+			}
+			infraOrigin[infra.Name] = name
+		}
+
+		if err := mergeValue(reflect.ValueOf(&merged).Elem(), reflect.ValueOf(part), ""); err != nil {
+			return nil, fmt.Errorf("merge %s: %w", name, err)
+		}
+	}
+	return &merged, nil
+}
+
+// rebaseManifestPaths rewrites relative manifest paths declared in a fragment located in dir
+// so that they stay relative to the project root.
+func rebaseManifestPaths(cfg *StackConfig, dir, projectRoot string) {
+	rel, err := filepath.Rel(projectRoot, dir)
+	if err != nil || rel == "." {
+		return
+	}
+	rebase := func(refs []ManifestRef) {
+		for i := range refs {
+			if refs[i].Path != "" && !filepath.IsAbs(refs[i].Path) {
+				refs[i].Path = filepath.Join(rel, refs[i].Path)
+			}
+		}
+	}
+	for i := range cfg.Infrastructure {
+		rebase(cfg.Infrastructure[i].Manifests)
+	}
+	for i := range cfg.Services {
+		rebase(cfg.Services[i].Manifests)
+	}
+}
+
+// mergeValue deep-merges src into dst: structs and maps are merged field by field, slices are
+// appended and scalars are taken from src when dst is unset. Two different non-empty scalar
+// values for the same path are reported as a conflict.
+func mergeValue(dst, src reflect.Value, path string) error {
+	switch dst.Kind() {
+	case reflect.Struct:
+		t := dst.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if name == "" {
+				name = strings.ToLower(field.Name)
+			}
+			if err := mergeValue(dst.Field(i), src.Field(i), joinPath(path, name)); err != nil {
+				return err
+			}
+		}
+	case reflect.Pointer:
+		if src.IsNil() {
+			return nil
+		}
+		if dst.IsNil() {
+			dst.Set(src)
+			return nil
+		}
+		return mergeValue(dst.Elem(), src.Elem(), path)
+	case reflect.Map:
+		if src.Len() == 0 {
+			return nil
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMapWithSize(dst.Type(), src.Len()))
+		}
+		iter := src.MapRange()
+		for iter.Next() {
+			key, val := iter.Key(), iter.Value()
+			existing := dst.MapIndex(key)
+			if !existing.IsValid() {
+				dst.SetMapIndex(key, val)
+				continue
+			}
+			next := reflect.New(dst.Type().Elem()).Elem()
+			next.Set(existing)
+			if err := mergeValue(next, val, joinPath(path, fmt.Sprint(key.Interface()))); err != nil {
+				return err
+			}
+			dst.SetMapIndex(key, next)
+		}
+	case reflect.Slice:
+		if src.Len() > 0 {
+			dst.Set(reflect.AppendSlice(dst, src))
+		}
+	default:
+		if src.IsZero() {
+			return nil
+		}
+		if dst.IsZero() {
+			dst.Set(src)
+			return nil
+		}
+		if !reflect.DeepEqual(dst.Interface(), src.Interface()) {
+			return fmt.Errorf("%s: conflicting values %v and %v", path, dst.Interface(), src.Interface())
+		}
+	}
+	return nil
+}
+
+// displayPath returns path relative to the project root for messages, falling back to path.
+func displayPath(path, projectRoot string) string {
+	if rel, err := filepath.Rel(projectRoot, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// SchemaID is the canonical identifier of the published services.yaml JSON Schema.
+const SchemaID = "https://raw.githubusercontent.com/codex-k8s/codexctl/main/docs/schema/services.schema.json"
+
+// JSONSchema builds a JSON Schema (draft-07) document describing services.yaml.
+// The schema is derived from the StackConfig Go types via their yaml tags, so it always
+// matches what the loader accepts. Struct types become shared definitions and reject
+// unknown properties.
+func JSONSchema() map[string]any {
+	b := &schemaBuilder{definitions: make(map[string]any)}
+	root := b.structSchema(reflect.TypeOf(StackConfig{}))
+	root["$schema"] = "http://json-schema.org/draft-07/schema#"
+	root["$id"] = SchemaID
+	root["title"] = "codexctl services.yaml"
+	root["definitions"] = b.definitions
+	return root
+}
+
+// schemaBuilder accumulates named definitions while walking Go types.
+type schemaBuilder struct {
+	definitions map[string]any
+}
+
+// typeSchema returns the schema fragment for an arbitrary Go type.
+func (b *schemaBuilder) typeSchema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": b.typeSchema(t.Elem())}
+	case reflect.Map:
+		elem := t.Elem()
+		if elem.Kind() == reflect.Interface {
+			return map[string]any{"type": "object"}
+		}
+		return map[string]any{"type": "object", "additionalProperties": b.typeSchema(elem)}
+	case reflect.Struct:
+		name := t.Name()
+		if name == "" {
+			return b.structSchema(t)
+		}
+		if _, ok := b.definitions[name]; !ok {
+			// Reserve the name first so recursive types terminate.
+			b.definitions[name] = map[string]any{}
+			b.definitions[name] = b.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/definitions/" + name}
+	default:
+		return map[string]any{}
+	}
+}
+
+// structSchema returns an object schema listing every yaml-tagged field of t.
+func (b *schemaBuilder) structSchema(t reflect.Type) map[string]any {
+	props := make(map[string]any)
+	for _, field := range yamlFields(t) {
+		props[field.name] = b.typeSchema(field.typ)
+	}
+	return map[string]any{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+}
+
+// yamlField describes a struct field as seen by the YAML decoder.
+type yamlField struct {
+	// name is the YAML key.
+	name string
+	// typ is the Go type of the field.
+	typ reflect.Type
+}
+
+// yamlFields lists exported fields of t keyed by their yaml tag names.
+func yamlFields(t reflect.Type) []yamlField {
+	var out []yamlField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("yaml")
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		out = append(out, yamlField{name: name, typ: f.Type})
+	}
+	return out
+}
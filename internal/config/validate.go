@@ -0,0 +1,232 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationError describes a single problem found in a rendered services.yaml document.
+type ValidationError struct {
+	// File is the config file the problem was found in.
+	File string
+	// Line is the 1-based line in the rendered document (0 when unknown).
+	Line int
+	// Column is the 1-based column in the rendered document (0 when unknown).
+	Column int
+	// Path is the dotted YAML path of the offending node (e.g. services[2].image).
+	Path string
+	// Message describes the problem.
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	var sb strings.Builder
+	sb.WriteString(e.File)
+	if e.Line > 0 {
+		fmt.Fprintf(&sb, ":%d:%d", e.Line, e.Column)
+	}
+	if e.Path != "" {
+		sb.WriteString(": ")
+		sb.WriteString(e.Path)
+	}
+	sb.WriteString(": ")
+	sb.WriteString(e.Message)
+	return sb.String()
+}
+
+// DeclaredEnvironments returns the sorted environment names declared in the
+// environments blocks of services.yaml and its imports, rendered with opts.
+func DeclaredEnvironments(path string, opts LoadOptions) ([]string, error) {
+	fragments, _, err := LoadFragments(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]struct{})
+	var names []string
+	for _, frag := range fragments {
+		var header rawHeader
+		if err := yaml.Unmarshal(frag.Rendered, &header); err != nil {
+			return nil, fmt.Errorf("parse top-level fields of %q: %w", frag.Path, err)
+		}
+		for name := range header.Environments {
+			if _, ok := seen[name]; ok {
+				continue
+			}
+			seen[name] = struct{}{}
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// ValidateStack renders services.yaml and its imports with opts and checks every file strictly
+// against the StackConfig model: unknown fields, wrong node kinds and invalid scalars are reported
+// with positions taken from the rendered YAML. Merge conflicts between files and semantic checks
+// (dependency graph, environment inheritance, namespace patterns) run once all files are structurally valid.
+// A non-nil error is returned only when rendering itself fails.
+func ValidateStack(path string, opts LoadOptions) ([]ValidationError, error) {
+	fragments, ctx, err := LoadFragments(path, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []ValidationError
+	for _, frag := range fragments {
+		issues = append(issues, ValidateRendered(displayPath(frag.Path, ctx.ProjectRoot), frag.Rendered)...)
+	}
+	if len(issues) > 0 {
+		return issues, nil
+	}
+
+	cfg, err := decodeFragments(fragments, ctx.ProjectRoot)
+	if err != nil {
+		return []ValidationError{{File: path, Message: err.Error()}}, nil
+	}
+	if _, err := BuildDependencyGraph(cfg); err != nil {
+		issues = append(issues, ValidationError{File: path, Path: "dependsOn", Message: err.Error()})
+	}
+	if opts.Env != "" {
+		if _, err := ResolveEnvironment(cfg, opts.Env); err != nil {
+			issues = append(issues, ValidationError{File: path, Path: "environments", Message: err.Error()})
+		}
+		if _, err := ResolveNamespace(cfg, ctx, opts.Env); err != nil {
+			issues = append(issues, ValidationError{File: path, Path: "namespace.patterns", Message: err.Error()})
+		}
+	}
+	return issues, nil
+}
+
+// ValidateRendered checks a rendered services.yaml document against the StackConfig model
+// and returns all structural problems found. file is only used for error reporting.
+func ValidateRendered(file string, rendered []byte) []ValidationError {
+	var root yaml.Node
+	if err := yaml.Unmarshal(rendered, &root); err != nil {
+		return []ValidationError{{File: file, Message: err.Error()}}
+	}
+	v := &nodeValidator{file: file}
+	v.check(&root, reflect.TypeOf(StackConfig{}), "")
+	return v.issues
+}
+
+// nodeValidator walks a yaml.Node tree alongside the Go type it should decode into.
+type nodeValidator struct {
+	file   string
+	issues []ValidationError
+}
+
+// report records a problem at the position of node.
+func (v *nodeValidator) report(node *yaml.Node, path, format string, args ...any) {
+	v.issues = append(v.issues, ValidationError{
+		File:    v.file,
+		Line:    node.Line,
+		Column:  node.Column,
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// check validates node against t, descending into mappings and sequences.
+func (v *nodeValidator) check(node *yaml.Node, t reflect.Type, path string) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			v.check(child, t, path)
+		}
+		return
+	case yaml.AliasNode:
+		if node.Alias != nil {
+			v.check(node.Alias, t, path)
+		}
+		return
+	}
+	if node.Kind == yaml.ScalarNode && node.ShortTag() == "!!null" {
+		return
+	}
+
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		return
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			v.report(node, path, "expected a mapping, got %s", nodeKindName(node))
+			return
+		}
+		fields := make(map[string]reflect.Type)
+		for _, f := range yamlFields(t) {
+			fields[f.name] = f.typ
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, val := node.Content[i], node.Content[i+1]
+			if key.Value == "<<" {
+				continue
+			}
+			ft, ok := fields[key.Value]
+			if !ok {
+				v.report(key, path, "unknown field %q", key.Value)
+				continue
+			}
+			v.check(val, ft, joinPath(path, key.Value))
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			v.report(node, path, "expected a mapping, got %s", nodeKindName(node))
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, val := node.Content[i], node.Content[i+1]
+			v.check(val, t.Elem(), joinPath(path, key.Value))
+		}
+	case reflect.Slice, reflect.Array:
+		if node.Kind != yaml.SequenceNode {
+			v.report(node, path, "expected a sequence, got %s", nodeKindName(node))
+			return
+		}
+		for i, item := range node.Content {
+			v.check(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))
+		}
+	case reflect.Bool:
+		if node.Kind != yaml.ScalarNode || node.ShortTag() != "!!bool" {
+			v.report(node, path, "expected a boolean, got %s", nodeKindName(node))
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if node.Kind != yaml.ScalarNode || node.ShortTag() != "!!int" {
+			v.report(node, path, "expected an integer, got %s", nodeKindName(node))
+		}
+	default:
+		if node.Kind != yaml.ScalarNode {
+			v.report(node, path, "expected a scalar, got %s", nodeKindName(node))
+		}
+	}
+}
+
+// joinPath appends a mapping key to a dotted YAML path.
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// nodeKindName returns a human-readable description of a YAML node for error messages.
+func nodeKindName(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a sequence"
+	case yaml.ScalarNode:
+		return fmt.Sprintf("%s %q", node.ShortTag(), node.Value)
+	default:
+		return "an unexpected node"
+	}
+}
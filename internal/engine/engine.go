@@ -34,6 +34,8 @@ type RenderOptions struct {
 	OnlyServices map[string]struct{}
 	// SkipServices excludes service names in this set.
 	SkipServices map[string]struct{}
+	// WithDeps extends OnlyServices/OnlyInfra with the transitive dependsOn dependencies of the selection.
+	WithDeps bool
 }
 
 // RenderStack renders infrastructure and service manifests for the given stack into a single YAML stream.
@@ -44,11 +46,42 @@ func (e *Engine) RenderStack(cfg *config.StackConfig, ctx config.TemplateContext
 
 // RenderStackWithOptions renders infrastructure and service manifests for the given stack with filters applied.
 func (e *Engine) RenderStackWithOptions(cfg *config.StackConfig, ctx config.TemplateContext, opts RenderOptions) ([]byte, error) {
+	nodes, err := e.renderNodes(cfg, ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
 	var documents []map[string]any
+	for _, node := range nodes {
+		documents = append(documents, node.docs...)
+	}
+	return encodeDocuments(documents)
+}
+
+// renderedNode holds the documents rendered for a single infrastructure block or service.
+type renderedNode struct {
+	// key identifies the infra block or service.
+	key config.NodeKey
+	// docs are the rendered manifest documents.
+	docs []map[string]any
+	// hooks are the resource hooks declared for the node.
+	hooks config.ResourceHooks
+}
+
+// renderNodes renders every infrastructure block and service that passes filters and "when"
+// expressions, infrastructure first, each in declaration order. Every document is stamped with
+// ownership labels.
+func (e *Engine) renderNodes(cfg *config.StackConfig, ctx config.TemplateContext, opts RenderOptions) ([]renderedNode, error) {
+	opts, err := ExpandDependencies(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []renderedNode
 
 	// Render infrastructure manifests first.
 	for _, infra := range cfg.Infrastructure {
-		if !resourceIncluded(infra.Name, opts.OnlyInfra, opts.SkipInfra) {
+		if !opts.Includes(config.NodeInfra, infra.Name) {
 			continue
 		}
 		ok, err := evaluateInfraWhen(infra.When, ctx)
@@ -58,18 +91,23 @@ func (e *Engine) RenderStackWithOptions(cfg *config.StackConfig, ctx config.Temp
 		if !ok {
 			continue
 		}
+		node := renderedNode{key: config.NodeKey{Kind: config.NodeInfra, Name: infra.Name}, hooks: infra.Hooks}
 		for _, ref := range infra.Manifests {
 			docs, err := e.loadManifestDocuments(ref.Path, ctx)
 			if err != nil {
 				return nil, fmt.Errorf("render infra %q (%s): %w", infra.Name, ref.Path, err)
 			}
-			documents = append(documents, docs...)
+			for _, doc := range docs {
+				applyOwnershipLabels(doc, ctx, node.key)
+				node.docs = append(node.docs, doc)
+			}
 		}
+		nodes = append(nodes, node)
 	}
 
 	// Render service manifests with per-environment overlays.
 	for _, svc := range cfg.Services {
-		if !resourceIncluded(svc.Name, opts.OnlyServices, opts.SkipServices) {
+		if !opts.Includes(config.NodeService, svc.Name) {
 			continue
 		}
 		ok, err := evaluateServiceWhen(svc.When, ctx)
@@ -79,6 +117,7 @@ func (e *Engine) RenderStackWithOptions(cfg *config.StackConfig, ctx config.Temp
 		if !ok {
 			continue
 		}
+		node := renderedNode{key: config.NodeKey{Kind: config.NodeService, Name: svc.Name}, hooks: svc.Hooks}
 		overlay := svc.Overlays[ctx.Env]
 		for _, ref := range svc.Manifests {
 			docs, err := e.loadManifestDocuments(ref.Path, ctx)
@@ -94,11 +133,21 @@ func (e *Engine) RenderStackWithOptions(cfg *config.StackConfig, ctx config.Temp
 					return nil, fmt.Errorf("render image for service %q: %w", svc.Name, err)
 				}
 				applyPVCMounts(doc, svc, overlay)
-				documents = append(documents, doc)
+				applyOwnershipLabels(doc, ctx, node.key)
+				node.docs = append(node.docs, doc)
 			}
 		}
+		if err := applyPatches(node.docs, overlay.Patches); err != nil {
+			return nil, fmt.Errorf("apply overlay patches for service %q (env %s): %w", svc.Name, ctx.Env, err)
+		}
+		nodes = append(nodes, node)
 	}
 
+	return nodes, nil
+}
+
+// encodeDocuments serializes documents into a multi-document YAML stream.
+func encodeDocuments(documents []map[string]any) ([]byte, error) {
 	var buf bytes.Buffer
 	enc := yaml.NewEncoder(&buf)
 	enc.SetIndent(2)
@@ -115,9 +164,17 @@ func (e *Engine) RenderStackWithOptions(cfg *config.StackConfig, ctx config.Temp
 	return buf.Bytes(), nil
 }
 
+// Includes reports whether the infra block or service name passes the include/exclude filters.
+func (o RenderOptions) Includes(kind config.NodeKind, name string) bool {
+	if kind == config.NodeInfra {
+		return resourceIncluded(name, o.OnlyInfra, o.SkipInfra)
+	}
+	return resourceIncluded(name, o.OnlyServices, o.SkipServices)
+}
+
 // resourceIncluded reports whether name passes include/exclude filters.
 func resourceIncluded(name string, only, skip map[string]struct{}) bool {
-	key := strings.ToLower(strings.TrimSpace(name))
+	key := normalizeName(name)
 	if len(only) > 0 {
 		if _, ok := only[key]; !ok {
 			return false
@@ -149,6 +206,11 @@ func evaluateWhen(kind, expr string, ctx config.TemplateContext) (bool, error) {
 	return true, nil
 }
 
+// ComponentEnabled reports whether the "when" expression of an infrastructure block or service is true for ctx.
+func ComponentEnabled(kind config.NodeKind, when string, ctx config.TemplateContext) (bool, error) {
+	return evaluateWhen(string(kind), when, ctx)
+}
+
 // evaluateServiceWhen evaluates a service "when" expression.
 func evaluateServiceWhen(expr string, ctx config.TemplateContext) (bool, error) {
 	return evaluateWhen("service", expr, ctx)
@@ -234,108 +296,219 @@ func applyNamespace(doc map[string]any, ns string) {
 	meta["namespace"] = ns
 }
 
-// applyServiceImage sets the container image for the main deployment and its init containers.
+// applyServiceImage sets the service image on workload containers.
+// With image.containers set, containers and init containers with those names are updated in every
+// workload of the service. Otherwise the first container of the workload named after the service
+// is updated together with init containers that shared its image, and in any workload containers
+// already using the service repository receive the rendered tag.
 // It evaluates the image tag template for the current context when provided.
 func applyServiceImage(doc map[string]any, svc config.Service, ctx config.TemplateContext) error {
 	fullRepo := strings.TrimSpace(svc.Image.Repository)
 	if fullRepo == "" {
 		return nil
 	}
-	image := fullRepo
-	tagTemplate := strings.TrimSpace(svc.Image.Tag)
-	if tagTemplate != "" {
-		renderedTag, err := config.RenderTemplate("tag", []byte(tagTemplate), ctx)
-		if err != nil {
-			return fmt.Errorf("render tag template: %w", err)
-		}
-		tag := strings.TrimSpace(string(renderedTag))
-		if tag != "" {
-			image = fullRepo + ":" + tag
-		}
-	}
-
-	kind, _ := doc["kind"].(string)
-	if kind != "Deployment" {
-		return nil
+	image, err := ServiceImage(svc, ctx)
+	if err != nil {
+		return err
 	}
 
-	meta := getOrCreateMap(doc, "metadata")
-	name, _ := meta["name"].(string)
-	if name == "" || name != svc.Name {
+	podSpec := workloadPodSpec(doc)
+	if podSpec == nil {
 		return nil
 	}
 
-	spec := getOrCreateMap(doc, "spec")
-	template := getOrCreateMap(spec, "template")
-	podSpec := getOrCreateMap(template, "spec")
-
-	// Update the main container image (first container in the list).
 	containers := getSliceOfMaps(podSpec, "containers")
-	if len(containers) == 0 {
-		return nil
-	}
-	main := containers[0]
-	oldImage, _ := main["image"].(string)
-	main["image"] = image
-	containers[0] = main
-	podSpec["containers"] = containers
-
-	// Keep init containers aligned with the main image when they share it.
 	initContainers := getSliceOfMaps(podSpec, "initContainers")
-	for i, ic := range initContainers {
-		icImg, _ := ic["image"].(string)
-		if icImg == "" || icImg == oldImage {
-			ic["image"] = image
-			initContainers[i] = ic
+
+	if len(svc.Image.Containers) > 0 {
+		for _, c := range append(append([]map[string]any(nil), containers...), initContainers...) {
+			if containerSelected(c, svc.Image.Containers) {
+				c["image"] = image
+			}
+		}
+	} else {
+		if workloadName(doc) == svc.Name && len(containers) > 0 {
+			main := containers[0]
+			oldImage, _ := main["image"].(string)
+			main["image"] = image
+
+			// Keep init containers aligned with the main image when they share it.
+			for _, ic := range initContainers {
+				icImg, _ := ic["image"].(string)
+				if icImg == "" || icImg == oldImage {
+					ic["image"] = image
+				}
+			}
+		}
+		for _, c := range append(append([]map[string]any(nil), containers...), initContainers...) {
+			current, _ := c["image"].(string)
+			if current != "" && ImageRepository(current) == fullRepo {
+				c["image"] = image
+			}
 		}
 	}
+
+	if len(containers) > 0 {
+		podSpec["containers"] = containers
+	}
 	if len(initContainers) > 0 {
 		podSpec["initContainers"] = initContainers
 	}
 	return nil
 }
 
-// applyPVCMounts injects PVC volumes and mounts into a deployment according to overlay.
+// ServiceImage returns the image reference rendered into the workloads of svc: the repository with the
+// rendered tag template, or the bare repository when the tag is empty. It is empty when svc declares no image.
+func ServiceImage(svc config.Service, ctx config.TemplateContext) (string, error) {
+	image := strings.TrimSpace(svc.Image.Repository)
+	if image == "" {
+		return "", nil
+	}
+	if tagTemplate := strings.TrimSpace(svc.Image.Tag); tagTemplate != "" {
+		renderedTag, err := config.RenderTemplate("tag", []byte(tagTemplate), ctx)
+		if err != nil {
+			return "", fmt.Errorf("render tag template: %w", err)
+		}
+		if tag := strings.TrimSpace(string(renderedTag)); tag != "" {
+			image += ":" + tag
+		}
+	}
+	return image, nil
+}
+
+// applyPVCMounts injects PVC volumes and mounts into workloads according to overlay.
+// Mounts with containers set target those containers and init containers in every workload of the
+// service; other mounts go to the first container and init containers of the workload named after
+// the service.
 func applyPVCMounts(doc map[string]any, svc config.Service, overlay config.Overlay) {
 	if len(overlay.PVCMounts) == 0 {
 		return
 	}
 
-	kind, _ := doc["kind"].(string)
-	if kind != "Deployment" {
+	podSpec := workloadPodSpec(doc)
+	if podSpec == nil {
 		return
 	}
+	isMain := workloadName(doc) == svc.Name
 
-	meta := getOrCreateMap(doc, "metadata")
-	name, _ := meta["name"].(string)
-	if name == "" || name != svc.Name {
+	containers := getSliceOfMaps(podSpec, "containers")
+	if len(containers) == 0 {
 		return
 	}
+	initContainers := getSliceOfMaps(podSpec, "initContainers")
 
-	spec := getOrCreateMap(doc, "spec")
-	template := getOrCreateMap(spec, "template")
-	podSpec := getOrCreateMap(template, "spec")
+	var used []config.PVCMount
+	mountsFor := func(c map[string]any, isFirst, isInit bool) []config.PVCMount {
+		var out []config.PVCMount
+		for _, m := range overlay.PVCMounts {
+			if len(m.Containers) > 0 {
+				if containerSelected(c, m.Containers) {
+					out = append(out, m)
+				}
+				continue
+			}
+			if isMain && (isFirst || isInit) {
+				out = append(out, m)
+			}
+		}
+		return out
+	}
+	markUsed := func(mounts []config.PVCMount) {
+		for _, m := range mounts {
+			found := false
+			for _, u := range used {
+				if u.Name == m.Name {
+					found = true
+					break
+				}
+			}
+			if !found {
+				used = append(used, m)
+			}
+		}
+	}
 
-	containers := getSliceOfMaps(podSpec, "containers")
-	if len(containers) == 0 {
+	for i, c := range containers {
+		mounts := mountsFor(c, i == 0, false)
+		if len(mounts) == 0 {
+			continue
+		}
+		containers[i] = applyPVCVolumeMounts(c, mounts)
+		markUsed(mounts)
+	}
+	for i, ic := range initContainers {
+		mounts := mountsFor(ic, false, true)
+		if len(mounts) == 0 {
+			continue
+		}
+		initContainers[i] = applyPVCVolumeMounts(ic, mounts)
+		markUsed(mounts)
+	}
+	if len(used) == 0 {
 		return
 	}
-	main := containers[0]
 
 	volumes := getSliceOfMaps(podSpec, "volumes")
-	volumes = applyPVCVolumes(volumes, overlay.PVCMounts)
-	podSpec["volumes"] = volumes
+	podSpec["volumes"] = applyPVCVolumes(volumes, used)
+	podSpec["containers"] = containers
+	if len(initContainers) > 0 {
+		podSpec["initContainers"] = initContainers
+	}
+}
 
-	main = applyPVCVolumeMounts(main, overlay.PVCMounts)
-	containers[0] = main
+// workloadPodSpec returns the pod spec of a workload document or nil for other kinds.
+// CronJob pod templates are nested under spec.jobTemplate.
+func workloadPodSpec(doc map[string]any) map[string]any {
+	kind, _ := doc["kind"].(string)
+	var path []string
+	switch kind {
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "Job":
+		path = []string{"spec", "template", "spec"}
+	case "CronJob":
+		path = []string{"spec", "jobTemplate", "spec", "template", "spec"}
+	case "Pod":
+		path = []string{"spec"}
+	default:
+		return nil
+	}
+	current := doc
+	for _, key := range path {
+		next, ok := current[key].(map[string]any)
+		if !ok {
+			return nil
+		}
+		current = next
+	}
+	return current
+}
 
-	initContainers := getSliceOfMaps(podSpec, "initContainers")
-	for i, ic := range initContainers {
-		initContainers[i] = applyPVCVolumeMounts(ic, overlay.PVCMounts)
+// workloadName returns metadata.name of a document.
+func workloadName(doc map[string]any) string {
+	meta, _ := doc["metadata"].(map[string]any)
+	name, _ := meta["name"].(string)
+	return name
+}
+
+// containerSelected reports whether the container name is listed in names.
+func containerSelected(container map[string]any, names []string) bool {
+	name, _ := container["name"].(string)
+	for _, n := range names {
+		if strings.TrimSpace(n) == name {
+			return true
+		}
 	}
-	if len(initContainers) > 0 {
-		podSpec["initContainers"] = initContainers
+	return false
+}
+
+// ImageRepository strips the tag and digest from an image reference.
+func ImageRepository(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
 	}
+	return image
 }
 
 // getOrCreateMap returns an existing nested map or creates a new one at the given key.
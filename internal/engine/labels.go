@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/codex-k8s/codexctl/internal/config"
+)
+
+const (
+	// LabelManagedBy marks resources rendered by codexctl.
+	LabelManagedBy = "app.kubernetes.io/managed-by"
+	// ManagedByValue is the LabelManagedBy value set by codexctl.
+	ManagedByValue = "codexctl"
+	// LabelProject holds the project name.
+	LabelProject = "codexctl.io/project"
+	// LabelEnv holds the environment name.
+	LabelEnv = "codexctl.io/env"
+	// LabelSlot holds the slot number for slot-based environments.
+	LabelSlot = "codexctl.io/slot"
+	// LabelComponent holds the infra block or service name the resource belongs to.
+	LabelComponent = "codexctl.io/component"
+	// LabelComponentType tells whether LabelComponent refers to an infra block or a service.
+	LabelComponentType = "codexctl.io/component-type"
+)
+
+// OwnershipSelector returns the label selector matching every resource codexctl rendered for the
+// project, environment and slot of ctx.
+func OwnershipSelector(ctx config.TemplateContext) string {
+	parts := []string{
+		LabelManagedBy + "=" + ManagedByValue,
+		LabelProject + "=" + labelValue(ctx.Project),
+		LabelEnv + "=" + labelValue(ctx.Env),
+	}
+	if ctx.Slot > 0 {
+		parts = append(parts, LabelSlot+"="+strconv.Itoa(ctx.Slot))
+	}
+	return strings.Join(parts, ",")
+}
+
+// applyOwnershipLabels stamps doc with codexctl ownership labels.
+func applyOwnershipLabels(doc map[string]any, ctx config.TemplateContext, key config.NodeKey) {
+	meta := getOrCreateMap(doc, "metadata")
+	labels := getOrCreateMap(meta, "labels")
+	labels[LabelManagedBy] = ManagedByValue
+	if v := labelValue(ctx.Project); v != "" {
+		labels[LabelProject] = v
+	}
+	if v := labelValue(ctx.Env); v != "" {
+		labels[LabelEnv] = v
+	}
+	if ctx.Slot > 0 {
+		labels[LabelSlot] = strconv.Itoa(ctx.Slot)
+	}
+	if v := labelValue(key.Name); v != "" {
+		labels[LabelComponent] = v
+		labels[LabelComponentType] = string(key.Kind)
+	}
+}
+
+// labelValue converts s into a valid Kubernetes label value: at most 63 characters from
+// [A-Za-z0-9-_.], starting and ending with an alphanumeric character.
+func labelValue(s string) string {
+	var sb strings.Builder
+	for _, r := range strings.TrimSpace(s) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			sb.WriteRune(r)
+		default:
+			sb.WriteRune('-')
+		}
+	}
+	v := sb.String()
+	if len(v) > 63 {
+		v = v[:63]
+	}
+	return strings.Trim(v, "-_.")
+}
@@ -0,0 +1,466 @@
+package engine
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/codex-k8s/codexctl/internal/config"
+)
+
+// applyPatches applies overlay patches to the rendered documents of a service.
+// Every patch must match at least one document so that stale overlays surface as errors.
+func applyPatches(docs []map[string]any, patches []config.Patch) error {
+	for i, patch := range patches {
+		label := describePatch(i, patch)
+		if patch.Target.Kind == "" && patch.Target.Name == "" && patch.Target.LabelSelector == "" {
+			return fmt.Errorf("%s: target must set kind, name or labelSelector", label)
+		}
+		if (patch.StrategicMerge == nil) == (len(patch.JSON6902) == 0) {
+			return fmt.Errorf("%s: exactly one of strategicMerge and json6902 must be set", label)
+		}
+		selector, err := parseLabelSelector(patch.Target.LabelSelector)
+		if err != nil {
+			return fmt.Errorf("%s: %w", label, err)
+		}
+
+		matched := 0
+		for j, doc := range docs {
+			if !patchTargetMatches(doc, patch.Target, selector) {
+				continue
+			}
+			matched++
+			normalized, _ := normalizeValue(doc).(map[string]any)
+			if patch.StrategicMerge != nil {
+				docs[j] = mergePatch(normalized, normalizeValue(patch.StrategicMerge).(map[string]any))
+				continue
+			}
+			var patched any = normalized
+			for _, op := range patch.JSON6902 {
+				patched, err = applyJSONPatchOperation(patched, op)
+				if err != nil {
+					return fmt.Errorf("%s: %s %s: %w", label, op.Op, op.Path, err)
+				}
+			}
+			result, ok := patched.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s: patch replaced the document with a non-object value", label)
+			}
+			docs[j] = result
+		}
+		if matched == 0 {
+			return fmt.Errorf("%s matched no resources", label)
+		}
+	}
+	return nil
+}
+
+// describePatch returns a short patch description for error messages.
+func describePatch(index int, patch config.Patch) string {
+	var parts []string
+	if patch.Target.Kind != "" {
+		parts = append(parts, "kind="+patch.Target.Kind)
+	}
+	if patch.Target.Name != "" {
+		parts = append(parts, "name="+patch.Target.Name)
+	}
+	if patch.Target.LabelSelector != "" {
+		parts = append(parts, "labelSelector="+patch.Target.LabelSelector)
+	}
+	return fmt.Sprintf("patch #%d (%s)", index+1, strings.Join(parts, ", "))
+}
+
+// patchTargetMatches reports whether doc is selected by target.
+func patchTargetMatches(doc map[string]any, target config.PatchTarget, selector []labelRequirement) bool {
+	kind, _ := doc["kind"].(string)
+	if target.Kind != "" && !strings.EqualFold(kind, target.Kind) {
+		return false
+	}
+	meta, _ := doc["metadata"].(map[string]any)
+	name, _ := meta["name"].(string)
+	if target.Name != "" && name != target.Name {
+		return false
+	}
+	labels, _ := meta["labels"].(map[string]any)
+	for _, req := range selector {
+		if !req.matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// labelRequirement is a single term of an equality-based label selector.
+type labelRequirement struct {
+	key    string
+	value  string
+	op     string
+	hasVal bool
+}
+
+// matches reports whether labels satisfy the requirement.
+func (r labelRequirement) matches(labels map[string]any) bool {
+	raw, exists := labels[r.key]
+	value := fmt.Sprint(raw)
+	switch r.op {
+	case "!":
+		return !exists
+	case "!=":
+		return !exists || value != r.value
+	case "=":
+		if !r.hasVal {
+			return exists
+		}
+		return exists && value == r.value
+	}
+	return false
+}
+
+// parseLabelSelector parses "k=v,k==v,k!=v,k,!k" selectors.
+func parseLabelSelector(raw string) ([]labelRequirement, error) {
+	var out []labelRequirement
+	for _, term := range strings.Split(raw, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		var req labelRequirement
+		switch {
+		case strings.Contains(term, "!="):
+			k, v, _ := strings.Cut(term, "!=")
+			req = labelRequirement{key: k, value: v, op: "!=", hasVal: true}
+		case strings.Contains(term, "=="):
+			k, v, _ := strings.Cut(term, "==")
+			req = labelRequirement{key: k, value: v, op: "=", hasVal: true}
+		case strings.Contains(term, "="):
+			k, v, _ := strings.Cut(term, "=")
+			req = labelRequirement{key: k, value: v, op: "=", hasVal: true}
+		case strings.HasPrefix(term, "!"):
+			req = labelRequirement{key: strings.TrimPrefix(term, "!"), op: "!"}
+		default:
+			req = labelRequirement{key: term, op: "="}
+		}
+		req.key = strings.TrimSpace(req.key)
+		req.value = strings.TrimSpace(req.value)
+		if req.key == "" {
+			return nil, fmt.Errorf("invalid label selector term %q", term)
+		}
+		out = append(out, req)
+	}
+	return out, nil
+}
+
+// normalizeValue deep-copies a decoded YAML value, converting typed slices and maps produced by
+// the injection helpers into map[string]any and []any.
+func normalizeValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			out[k] = normalizeValue(item)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = normalizeValue(item)
+		}
+		return out
+	case []map[string]any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = normalizeValue(item)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// mergePatch applies a strategic-merge-style patch to dst and returns the result.
+// Mappings are merged recursively and a null value removes the key. Lists whose items all carry
+// a "name" field are merged by name (an item with "$patch: delete" removes the match); other lists
+// are replaced.
+func mergePatch(dst, patch map[string]any) map[string]any {
+	if dst == nil {
+		dst = make(map[string]any)
+	}
+	for key, pv := range patch {
+		if pv == nil {
+			delete(dst, key)
+			continue
+		}
+		switch p := pv.(type) {
+		case map[string]any:
+			existing, _ := dst[key].(map[string]any)
+			dst[key] = mergePatch(existing, p)
+		case []any:
+			existing, _ := dst[key].([]any)
+			dst[key] = mergeList(existing, p)
+		default:
+			dst[key] = p
+		}
+	}
+	return dst
+}
+
+// mergeList merges patch items into dst by their "name" field when every item is named,
+// otherwise it returns the patch list.
+func mergeList(dst, patch []any) []any {
+	if !namedItems(patch) || !namedItems(dst) {
+		return withoutDirectives(patch)
+	}
+	out := append([]any(nil), dst...)
+	for _, item := range patch {
+		pm := item.(map[string]any)
+		name := pm["name"]
+		idx := -1
+		for i, existing := range out {
+			if existing.(map[string]any)["name"] == name {
+				idx = i
+				break
+			}
+		}
+		if directive, _ := pm["$patch"].(string); directive == "delete" {
+			if idx >= 0 {
+				out = append(out[:idx], out[idx+1:]...)
+			}
+			continue
+		}
+		if idx >= 0 {
+			out[idx] = mergePatch(out[idx].(map[string]any), pm)
+		} else {
+			out = append(out, mergePatch(nil, pm))
+		}
+	}
+	return out
+}
+
+// namedItems reports whether every list item is a mapping with a "name" key.
+func namedItems(items []any) bool {
+	for _, item := range items {
+		m, ok := item.(map[string]any)
+		if !ok {
+			return false
+		}
+		if _, ok := m["name"]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// withoutDirectives drops "$patch: delete" items from a list that replaces the original one.
+func withoutDirectives(items []any) []any {
+	out := make([]any, 0, len(items))
+	for _, item := range items {
+		if m, ok := item.(map[string]any); ok {
+			if directive, _ := m["$patch"].(string); directive == "delete" {
+				continue
+			}
+		}
+		out = append(out, item)
+	}
+	return out
+}
+
+// applyJSONPatchOperation applies a single RFC 6902 operation to doc and returns the new document.
+func applyJSONPatchOperation(doc any, op config.JSONPatchOperation) (any, error) {
+	path, err := parseJSONPointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	switch op.Op {
+	case "add":
+		return jsonPointerSet(doc, path, normalizeValue(op.Value), true)
+	case "replace":
+		if _, err := jsonPointerGet(doc, path); err != nil {
+			return nil, err
+		}
+		return jsonPointerSet(doc, path, normalizeValue(op.Value), false)
+	case "remove":
+		return jsonPointerRemove(doc, path)
+	case "test":
+		current, err := jsonPointerGet(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(normalizeValue(current), normalizeValue(op.Value)) {
+			return nil, fmt.Errorf("test failed: value is %v", current)
+		}
+		return doc, nil
+	case "move", "copy":
+		from, err := parseJSONPointer(op.From)
+		if err != nil {
+			return nil, fmt.Errorf("from: %w", err)
+		}
+		value, err := jsonPointerGet(doc, from)
+		if err != nil {
+			return nil, fmt.Errorf("from: %w", err)
+		}
+		value = normalizeValue(value)
+		if op.Op == "move" {
+			if doc, err = jsonPointerRemove(doc, from); err != nil {
+				return nil, err
+			}
+		}
+		return jsonPointerSet(doc, path, value, true)
+	default:
+		return nil, fmt.Errorf("unsupported operation %q", op.Op)
+	}
+}
+
+// parseJSONPointer splits an RFC 6901 pointer into unescaped tokens.
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// jsonPointerGet returns the value at path.
+func jsonPointerGet(doc any, path []string) (any, error) {
+	current := doc
+	for _, token := range path {
+		switch c := current.(type) {
+		case map[string]any:
+			next, ok := c[token]
+			if !ok {
+				return nil, fmt.Errorf("path segment %q not found", token)
+			}
+			current = next
+		case []any:
+			idx, err := arrayIndex(token, len(c), false)
+			if err != nil {
+				return nil, err
+			}
+			current = c[idx]
+		default:
+			return nil, fmt.Errorf("path segment %q does not refer to an object or array", token)
+		}
+	}
+	return current, nil
+}
+
+// jsonPointerSet stores value at path. With insert set, array targets insert before the index
+// (or append with "-"); otherwise the element is replaced.
+func jsonPointerSet(doc any, path []string, value any, insert bool) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	token := path[0]
+	switch c := doc.(type) {
+	case map[string]any:
+		if len(path) == 1 {
+			c[token] = value
+			return c, nil
+		}
+		child, ok := c[token]
+		if !ok {
+			return nil, fmt.Errorf("path segment %q not found", token)
+		}
+		updated, err := jsonPointerSet(child, path[1:], value, insert)
+		if err != nil {
+			return nil, err
+		}
+		c[token] = updated
+		return c, nil
+	case []any:
+		if len(path) == 1 {
+			if insert {
+				idx, err := arrayIndex(token, len(c), true)
+				if err != nil {
+					return nil, err
+				}
+				out := append(c[:idx:idx], value)
+				return append(out, c[idx:]...), nil
+			}
+			idx, err := arrayIndex(token, len(c), false)
+			if err != nil {
+				return nil, err
+			}
+			c[idx] = value
+			return c, nil
+		}
+		idx, err := arrayIndex(token, len(c), false)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := jsonPointerSet(c[idx], path[1:], value, insert)
+		if err != nil {
+			return nil, err
+		}
+		c[idx] = updated
+		return c, nil
+	default:
+		return nil, fmt.Errorf("path segment %q does not refer to an object or array", token)
+	}
+}
+
+// jsonPointerRemove deletes the value at path.
+func jsonPointerRemove(doc any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("cannot remove the whole document")
+	}
+	token := path[0]
+	switch c := doc.(type) {
+	case map[string]any:
+		child, ok := c[token]
+		if !ok {
+			return nil, fmt.Errorf("path segment %q not found", token)
+		}
+		if len(path) == 1 {
+			delete(c, token)
+			return c, nil
+		}
+		updated, err := jsonPointerRemove(child, path[1:])
+		if err != nil {
+			return nil, err
+		}
+		c[token] = updated
+		return c, nil
+	case []any:
+		idx, err := arrayIndex(token, len(c), false)
+		if err != nil {
+			return nil, err
+		}
+		if len(path) == 1 {
+			return append(c[:idx:idx], c[idx+1:]...), nil
+		}
+		updated, err := jsonPointerRemove(c[idx], path[1:])
+		if err != nil {
+			return nil, err
+		}
+		c[idx] = updated
+		return c, nil
+	default:
+		return nil, fmt.Errorf("path segment %q does not refer to an object or array", token)
+	}
+}
+
+// arrayIndex parses an array index token; "-" (append) and index == length are allowed on insert.
+func arrayIndex(token string, length int, insert bool) (int, error) {
+	if insert && token == "-" {
+		return length, nil
+	}
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx < 0 {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	limit := length - 1
+	if insert {
+		limit = length
+	}
+	if idx > limit {
+		return 0, fmt.Errorf("array index %d out of range", idx)
+	}
+	return idx, nil
+}
@@ -0,0 +1,187 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/codex-k8s/codexctl/internal/config"
+)
+
+// Plan is a rendered stack split into dependency waves.
+type Plan struct {
+	// Waves lists groups of nodes that can be applied in parallel; every node depends only on
+	// nodes from earlier waves.
+	Waves [][]PlanNode
+}
+
+// PlanNode is a rendered infrastructure block or service.
+type PlanNode struct {
+	// Key identifies the infra block or service.
+	Key config.NodeKey
+	// Manifests is the multi-document YAML rendered for the node.
+	Manifests []byte
+	// Workloads lists resources whose readiness can be awaited after apply.
+	Workloads []Workload
+	// Hooks are the resource hooks declared for the node.
+	Hooks config.ResourceHooks
+}
+
+// Workload references a Deployment, StatefulSet, DaemonSet or Job from rendered manifests.
+type Workload struct {
+	// Kind is the Kubernetes kind.
+	Kind string
+	// Name is the resource name.
+	Name string
+	// Namespace is the resource namespace (empty when not set in the manifest).
+	Namespace string
+}
+
+// RenderPlan renders the stack like RenderStackWithOptions but keeps nodes separate and orders them
+// into topological waves according to dependsOn declarations.
+func (e *Engine) RenderPlan(cfg *config.StackConfig, ctx config.TemplateContext, opts RenderOptions) (*Plan, error) {
+	graph, err := config.BuildDependencyGraph(cfg)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := e.renderNodes(cfg, ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := make(map[config.NodeKey]*renderedNode, len(nodes))
+	var keys []config.NodeKey
+	for i := range nodes {
+		node := nodes[i]
+		if existing, ok := merged[node.key]; ok {
+			existing.docs = append(existing.docs, node.docs...)
+			existing.hooks = appendHooks(existing.hooks, node.hooks)
+			continue
+		}
+		merged[node.key] = &node
+		keys = append(keys, node.key)
+	}
+
+	plan := &Plan{}
+	for _, wave := range graph.Waves(keys) {
+		planWave := make([]PlanNode, 0, len(wave))
+		for _, key := range wave {
+			node := merged[key]
+			manifests, err := encodeDocuments(node.docs)
+			if err != nil {
+				return nil, fmt.Errorf("render %s: %w", key, err)
+			}
+			planWave = append(planWave, PlanNode{
+				Key:       key,
+				Manifests: manifests,
+				Workloads: collectWorkloads(node.docs),
+				Hooks:     node.hooks,
+			})
+		}
+		plan.Waves = append(plan.Waves, planWave)
+	}
+	return plan, nil
+}
+
+// Manifests returns the manifests of all plan nodes as a single multi-document YAML stream.
+func (p *Plan) Manifests() []byte {
+	var buf bytes.Buffer
+	for _, wave := range p.Waves {
+		for _, node := range wave {
+			if len(node.Manifests) == 0 {
+				continue
+			}
+			if buf.Len() > 0 {
+				buf.WriteString("---\n")
+			}
+			buf.Write(node.Manifests)
+		}
+	}
+	return buf.Bytes()
+}
+
+// ExpandDependencies adds transitive dependencies of the selected services and infra blocks
+// to the include filters when opts.WithDeps is set. Empty include filters already select everything
+// and are left untouched.
+func ExpandDependencies(cfg *config.StackConfig, opts RenderOptions) (RenderOptions, error) {
+	if !opts.WithDeps || (len(opts.OnlyServices) == 0 && len(opts.OnlyInfra) == 0) {
+		return opts, nil
+	}
+	graph, err := config.BuildDependencyGraph(cfg)
+	if err != nil {
+		return opts, err
+	}
+
+	var roots []config.NodeKey
+	for _, infra := range cfg.Infrastructure {
+		if _, ok := opts.OnlyInfra[normalizeName(infra.Name)]; ok {
+			roots = append(roots, config.NodeKey{Kind: config.NodeInfra, Name: infra.Name})
+		}
+	}
+	for _, svc := range cfg.Services {
+		if _, ok := opts.OnlyServices[normalizeName(svc.Name)]; ok {
+			roots = append(roots, config.NodeKey{Kind: config.NodeService, Name: svc.Name})
+		}
+	}
+
+	onlyInfra := copyNameSet(opts.OnlyInfra)
+	onlyServices := copyNameSet(opts.OnlyServices)
+	for _, key := range graph.Closure(roots) {
+		switch {
+		case key.Kind == config.NodeInfra && onlyInfra != nil:
+			onlyInfra[normalizeName(key.Name)] = struct{}{}
+		case key.Kind == config.NodeService && onlyServices != nil:
+			onlyServices[normalizeName(key.Name)] = struct{}{}
+		}
+	}
+	opts.OnlyInfra = onlyInfra
+	opts.OnlyServices = onlyServices
+	return opts, nil
+}
+
+// collectWorkloads returns workloads that support readiness checks from docs.
+func collectWorkloads(docs []map[string]any) []Workload {
+	var out []Workload
+	for _, doc := range docs {
+		kind, _ := doc["kind"].(string)
+		switch kind {
+		case "Deployment", "StatefulSet", "DaemonSet", "Job":
+		default:
+			continue
+		}
+		meta, _ := doc["metadata"].(map[string]any)
+		name, _ := meta["name"].(string)
+		if name == "" {
+			continue
+		}
+		namespace, _ := meta["namespace"].(string)
+		out = append(out, Workload{Kind: kind, Name: name, Namespace: namespace})
+	}
+	return out
+}
+
+// appendHooks concatenates hook lists of two declarations of the same node.
+func appendHooks(dst, src config.ResourceHooks) config.ResourceHooks {
+	dst.BeforeApply = append(dst.BeforeApply, src.BeforeApply...)
+	dst.AfterApply = append(dst.AfterApply, src.AfterApply...)
+	dst.BeforeDestroy = append(dst.BeforeDestroy, src.BeforeDestroy...)
+	dst.AfterDestroy = append(dst.AfterDestroy, src.AfterDestroy...)
+	return dst
+}
+
+// copyNameSet returns a copy of a name set, keeping nil as nil.
+func copyNameSet(set map[string]struct{}) map[string]struct{} {
+	if len(set) == 0 {
+		return nil
+	}
+	out := make(map[string]struct{}, len(set))
+	for k := range set {
+		out[k] = struct{}{}
+	}
+	return out
+}
+
+// normalizeName lower-cases and trims a resource name for filter lookups.
+func normalizeName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
@@ -180,6 +180,37 @@ func (c *Client) FetchReviewComments(ctx context.Context, number int) ([]ReviewC
 	return out, nil
 }
 
+// FetchIssueState returns the state of the issue or pull request with the given number:
+// OPEN or CLOSED for issues, OPEN, CLOSED or MERGED for pull requests.
+func (c *Client) FetchIssueState(ctx context.Context, number int) (string, error) {
+	if number <= 0 {
+		return "", fmt.Errorf("issue number must be positive")
+	}
+	query := `query($owner: String!, $name: String!, $number: Int!) {
+  repository(owner: $owner, name: $name) {
+    issueOrPullRequest(number: $number) {
+      ... on Issue { state }
+      ... on PullRequest { state }
+    }
+  }
+}`
+
+	resp := issueStateResponse{}
+	vars := map[string]any{
+		"owner":  c.owner,
+		"name":   c.name,
+		"number": number,
+	}
+	if err := c.runGraphQL(ctx, query, vars, &resp); err != nil {
+		return "", err
+	}
+	node := resp.Data.Repository.IssueOrPullRequest
+	if node == nil || strings.TrimSpace(node.State) == "" {
+		return "", fmt.Errorf("issue or pull request #%d not found in %s", number, c.repo)
+	}
+	return strings.TrimSpace(node.State), nil
+}
+
 // runGraphQL executes a gh api graphql call and decodes the JSON response into out.
 func (c *Client) runGraphQL(ctx context.Context, query string, vars map[string]any, out any) error {
 	args := []string{"api", "graphql", "-f", "query=" + query}
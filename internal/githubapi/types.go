@@ -82,3 +82,13 @@ type reviewCommentBlock struct {
 	Nodes    []commentNode `json:"nodes"`
 	PageInfo pageInfo      `json:"pageInfo"`
 }
+
+type issueStateResponse struct {
+	Data struct {
+		Repository struct {
+			IssueOrPullRequest *struct {
+				State string `json:"state"`
+			} `json:"issueOrPullRequest"`
+		} `json:"repository"`
+	} `json:"data"`
+}
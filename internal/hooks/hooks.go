@@ -2,8 +2,8 @@
 package hooks
 
 import (
-	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"log/slog"
@@ -30,8 +30,8 @@ type StepContext struct {
 	Template config.TemplateContext
 	// EnvName is the target environment name.
 	EnvName string
-	// KubeClient provides kubectl execution for built-in hooks.
-	KubeClient *kube.Client
+	// KubeClient is the Kubernetes orchestrator used by built-in hooks.
+	KubeClient kube.Orchestrator
 }
 
 // NewExecutor constructs a new Executor instance with the given logger.
@@ -145,10 +145,14 @@ func (e *Executor) runBuiltin(ctx context.Context, step config.HookStep, stepCtx
 		return e.runEnsureCodexSecrets(ctx, step, stepCtx)
 	case "codex.reuse-dev-tls-secret":
 		return e.runReuseDevTLSSecret(ctx, step, stepCtx)
+	case "k8s.job", "kubectl.job":
+		return e.runJob(ctx, step, stepCtx)
+	case "http.wait", "http.check":
+		return e.runHTTPWait(ctx, step, stepCtx)
 	case "sleep":
 		return e.runSleep(ctx, step)
 	case "preflight":
-		return e.runPreflight(ctx)
+		return e.runPreflight(ctx, stepCtx)
 	default:
 		return fmt.Errorf("unknown hook use %q for step %q", step.Use, step.Name)
 	}
@@ -178,17 +182,8 @@ func (e *Executor) runKubectlWait(ctx context.Context, step config.HookStep, ste
 
 	e.logger.Info("running kubectl.wait hook", "step", step.Name, "kind", kind, "name", name, "namespace", ns, "condition", condition, "timeout", timeout)
 
-	args := []string{
-		"wait",
-		fmt.Sprintf("--for=condition=%s", condition),
-		fmt.Sprintf("%s/%s", kind, name),
-		fmt.Sprintf("--timeout=%s", timeout),
-	}
-	if ns != "" {
-		args = append(args, "-n", ns)
-	}
-
-	return stepCtx.KubeClient.RunRaw(ctx, nil, args...)
+	ref := kube.ObjectRef{Kind: kind, Namespace: ns, Name: name}
+	return stepCtx.KubeClient.WaitForCondition(ctx, ref, condition, timeout)
 }
 
 // runGitHubComment posts a comment via the gh CLI.
@@ -269,7 +264,11 @@ func (e *Executor) runSleep(ctx context.Context, step config.HookStep) error {
 }
 
 // runPreflight performs minimal checks required for hook execution.
-func (e *Executor) runPreflight(_ context.Context) error {
+func (e *Executor) runPreflight(_ context.Context, stepCtx StepContext) error {
+	if _, ok := stepCtx.KubeClient.(*kube.KubectlClient); !ok && stepCtx.KubeClient != nil {
+		e.logger.Info("preflight hook: using the built-in Kubernetes API client, kubectl is not required")
+		return nil
+	}
 	// Minimal preflight for hooks: verify that kubectl binary is available.
 	_, err := exec.LookPath("kubectl")
 	if err != nil {
@@ -281,8 +280,8 @@ func (e *Executor) runPreflight(_ context.Context) error {
 }
 
 // RunPreflightBasic exposes the minimal kubectl presence check for reuse in doctor.
-func (e *Executor) RunPreflightBasic(ctx context.Context) error {
-	return e.runPreflight(ctx)
+func (e *Executor) RunPreflightBasic(ctx context.Context, stepCtx StepContext) error {
+	return e.runPreflight(ctx, stepCtx)
 }
 
 // runEnsureCodexSecrets ensures required secrets exist in the target namespace.
@@ -383,7 +382,7 @@ func (e *Executor) runReuseDevTLSSecret(ctx context.Context, step config.HookSte
 }
 
 // applyGenericSecret creates or updates a secret with literal key/value data.
-func applyGenericSecret(ctx context.Context, client *kube.Client, namespace, name string, data map[string]string) error {
+func applyGenericSecret(ctx context.Context, client kube.Orchestrator, namespace, name string, data map[string]string) error {
 	if client == nil {
 		return fmt.Errorf("kubernetes client is nil")
 	}
@@ -391,30 +390,38 @@ func applyGenericSecret(ctx context.Context, client *kube.Client, namespace, nam
 		return nil
 	}
 
-	args := []string{"-n", namespace, "create", "secret", "generic", name}
+	encoded := make(map[string]any, len(data))
 	for k, v := range data {
 		if strings.TrimSpace(k) == "" {
 			continue
 		}
-		args = append(args, fmt.Sprintf("--from-literal=%s=%s", k, v))
-	}
-	args = append(args, "--dry-run=client", "-o", "yaml")
-
-	manifest, err := client.RunAndCapture(ctx, nil, args...)
+		encoded[k] = base64.StdEncoding.EncodeToString([]byte(v))
+	}
+	secret := map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"type":       "Opaque",
+		"metadata": map[string]any{
+			"name":      name,
+			"namespace": namespace,
+		},
+		"data": encoded,
+	}
+	manifest, err := json.Marshal(secret)
 	if err != nil {
-		return err
+		return fmt.Errorf("encode secret %q: %w", name, err)
 	}
-	return client.RunRaw(ctx, manifest, "-n", namespace, "apply", "-f", "-")
+	return client.Apply(ctx, manifest, kube.ApplyOptions{})
 }
 
 // waitForSecret polls until a secret exists or the context is canceled.
-func waitForSecret(ctx context.Context, client *kube.Client, namespace, name string, attempts int, delay time.Duration) bool {
+func waitForSecret(ctx context.Context, client kube.Orchestrator, namespace, name string, attempts int, delay time.Duration) bool {
 	if client == nil || namespace == "" || name == "" {
 		return false
 	}
 	for i := 0; i < attempts; i++ {
-		raw, err := client.RunAndCapture(ctx, nil, "-n", namespace, "get", "secret", name, "-o", "json", "--ignore-not-found")
-		if err == nil && len(bytes.TrimSpace(raw)) > 0 {
+		obj, err := client.GetObject(ctx, secretRef(namespace, name))
+		if err == nil && obj != nil {
 			return true
 		}
 		select {
@@ -427,7 +434,7 @@ func waitForSecret(ctx context.Context, client *kube.Client, namespace, name str
 }
 
 // copySecret copies a secret object between namespaces, stripping server metadata.
-func copySecret(ctx context.Context, client *kube.Client, srcNamespace, dstNamespace, name string) error {
+func copySecret(ctx context.Context, client kube.Orchestrator, srcNamespace, dstNamespace, name string) error {
 	if client == nil {
 		return fmt.Errorf("kubernetes client is nil")
 	}
@@ -435,26 +442,29 @@ func copySecret(ctx context.Context, client *kube.Client, srcNamespace, dstNames
 		return nil
 	}
 
-	raw, err := client.RunAndCapture(ctx, nil, "-n", srcNamespace, "get", "secret", name, "-o", "json", "--ignore-not-found")
+	obj, err := client.GetObject(ctx, secretRef(srcNamespace, name))
 	if err != nil {
 		return err
 	}
-	if len(bytes.TrimSpace(raw)) == 0 {
+	if obj == nil {
 		return nil
 	}
-
-	var obj map[string]any
-	if err := json.Unmarshal(raw, &obj); err != nil {
-		return fmt.Errorf("decode secret %q: %w", name, err)
-	}
 	sanitizeSecretMetadata(obj)
+	if meta, ok := obj["metadata"].(map[string]any); ok {
+		meta["namespace"] = dstNamespace
+	}
 
 	payload, err := json.Marshal(obj)
 	if err != nil {
 		return fmt.Errorf("encode secret %q: %w", name, err)
 	}
 
-	return client.RunRaw(ctx, payload, "-n", dstNamespace, "apply", "-f", "-")
+	return client.Apply(ctx, payload, kube.ApplyOptions{})
+}
+
+// secretRef references a Secret by namespace and name.
+func secretRef(namespace, name string) kube.ObjectRef {
+	return kube.ObjectRef{APIVersion: "v1", Kind: "Secret", Namespace: namespace, Name: name}
 }
 
 // sanitizeSecretMetadata removes server-owned metadata fields.
@@ -0,0 +1,455 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/util/jsonpath"
+
+	"github.com/codex-k8s/codexctl/internal/config"
+	"github.com/codex-k8s/codexctl/internal/engine"
+	"github.com/codex-k8s/codexctl/internal/kube"
+)
+
+const (
+	// defaultHTTPWaitTimeout bounds an http.wait step when with.timeout is not set.
+	defaultHTTPWaitTimeout = 5 * time.Minute
+	// defaultHTTPWaitInterval is the delay between http.wait attempts when with.interval is not set.
+	defaultHTTPWaitInterval = 5 * time.Second
+	// defaultHTTPRequestTimeout bounds a single request when with.requestTimeout is not set.
+	defaultHTTPRequestTimeout = 10 * time.Second
+	// maxHTTPProbeBody limits the response body read for assertions.
+	maxHTTPProbeBody = 1 << 20
+	// httpProbePodReadyTimeout bounds the start of the short-lived pod of an in-cluster probe.
+	httpProbePodReadyTimeout = "2m"
+)
+
+// httpProbe is a request with its assertions, built from the with block of an http.wait or http.check step.
+type httpProbe struct {
+	// method is the HTTP method.
+	method string
+	// url is the requested URL.
+	url string
+	// headers are the request headers.
+	headers map[string]string
+	// body is the request body (empty sends none).
+	body string
+	// expectStatus lists the accepted status code ranges.
+	expectStatus []statusRange
+	// bodyContains lists substrings the response body must contain.
+	bodyContains []string
+	// jsonPath maps JSONPath expressions to the value they must print for the JSON response body.
+	jsonPath map[string]string
+	// requestTimeout bounds a single request.
+	requestTimeout time.Duration
+	// insecure skips TLS certificate verification.
+	insecure bool
+	// inCluster sends the request with curl from a pod of the cluster instead of from codexctl.
+	inCluster bool
+	// namespace is the namespace of the pod used in-cluster.
+	namespace string
+	// target is the pod used in-cluster, a pod name or "deploy/<name>".
+	target string
+	// container is the container of target (empty selects the default container).
+	container string
+	// image starts a short-lived pod with this image for in-cluster requests instead of using target.
+	image string
+}
+
+// statusRange is an inclusive range of accepted HTTP status codes.
+type statusRange struct {
+	// lo is the lowest accepted code.
+	lo int
+	// hi is the highest accepted code.
+	hi int
+}
+
+// httpResponse is the part of a response the probe assertions look at.
+type httpResponse struct {
+	// status is the HTTP status code.
+	status int
+	// body is the response body, truncated to maxHTTPProbeBody.
+	body []byte
+}
+
+// runHTTPWait implements the http.wait and http.check built-in hooks. http.wait repeats the request every
+// interval until the assertions pass or the timeout expires; http.check sends it once.
+func (e *Executor) runHTTPWait(ctx context.Context, step config.HookStep, stepCtx StepContext) error {
+	probe, err := parseHTTPProbe(step, stepCtx)
+	if err != nil {
+		return err
+	}
+	wait := step.Use == "http.wait"
+	timeout, err := withDuration(step, "timeout", defaultHTTPWaitTimeout)
+	if err != nil {
+		return err
+	}
+	interval, err := withDuration(step, "interval", defaultHTTPWaitInterval)
+	if err != nil {
+		return err
+	}
+
+	if wait {
+		e.logger.Info("running http.wait hook", "step", step.Name, "method", probe.method, "url", probe.url, "inCluster", probe.inCluster, "timeout", timeout.String())
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	} else {
+		e.logger.Info("running http.check hook", "step", step.Name, "method", probe.method, "url", probe.url, "inCluster", probe.inCluster)
+	}
+	if probe.inCluster && probe.image != "" {
+		cleanup, err := e.startHTTPProbePod(ctx, stepCtx.KubeClient, &probe)
+		if err != nil {
+			return fmt.Errorf("%s step %q: %w", step.Use, step.Name, err)
+		}
+		defer cleanup()
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := probe.check(probe.send(ctx, stepCtx.KubeClient))
+		if err == nil {
+			e.logger.Info(step.Use+" hook passed", "step", step.Name, "url", probe.url, "attempts", attempt)
+			return nil
+		}
+		if !wait {
+			return fmt.Errorf("http.check step %q: %s %s: %w", step.Name, probe.method, probe.url, err)
+		}
+		e.logger.Debug("endpoint not ready yet", "step", step.Name, "url", probe.url, "attempt", attempt, "error", err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("http.wait step %q: %s %s not ready after %s: %w", step.Name, probe.method, probe.url, timeout, err)
+		case <-time.After(interval):
+		}
+	}
+}
+
+// parseHTTPProbe reads the request and assertions of an http.wait or http.check step.
+func parseHTTPProbe(step config.HookStep, stepCtx StepContext) (httpProbe, error) {
+	probe := httpProbe{
+		method:       http.MethodGet,
+		headers:      map[string]string{},
+		expectStatus: []statusRange{{lo: 200, hi: 299}},
+		jsonPath:     map[string]string{},
+		target:       "deploy/codex",
+		namespace:    strings.TrimSpace(stepCtx.Template.Namespace),
+	}
+	probe.url, _ = step.With["url"].(string)
+	probe.url = strings.TrimSpace(probe.url)
+	if probe.url == "" {
+		return probe, fmt.Errorf("%s requires url in with", step.Use)
+	}
+	if v, _ := step.With["method"].(string); strings.TrimSpace(v) != "" {
+		probe.method = strings.ToUpper(strings.TrimSpace(v))
+	}
+	probe.body, _ = step.With["body"].(string)
+	if raw, ok := step.With["headers"]; ok {
+		headers, ok := raw.(map[string]any)
+		if !ok {
+			return probe, fmt.Errorf("%s headers must be a mapping", step.Use)
+		}
+		for k, v := range headers {
+			probe.headers[k] = fmt.Sprint(v)
+		}
+	}
+	if raw, ok := step.With["expectStatus"]; ok {
+		ranges, err := parseStatusRanges(raw)
+		if err != nil {
+			return probe, fmt.Errorf("%s expectStatus: %w", step.Use, err)
+		}
+		probe.expectStatus = ranges
+	}
+	switch v := step.With["bodyContains"].(type) {
+	case nil:
+	case string:
+		probe.bodyContains = []string{v}
+	case []any:
+		for _, item := range v {
+			probe.bodyContains = append(probe.bodyContains, fmt.Sprint(item))
+		}
+	default:
+		return probe, fmt.Errorf("%s bodyContains must be a string or a list", step.Use)
+	}
+	if raw, ok := step.With["jsonPath"]; ok {
+		paths, ok := raw.(map[string]any)
+		if !ok {
+			return probe, fmt.Errorf("%s jsonPath must map expressions to expected values", step.Use)
+		}
+		for expr, want := range paths {
+			if _, err := compileJSONPath(expr); err != nil {
+				return probe, fmt.Errorf("%s jsonPath %q: %w", step.Use, expr, err)
+			}
+			probe.jsonPath[expr] = fmt.Sprint(want)
+		}
+	}
+	var err error
+	if probe.requestTimeout, err = withDuration(step, "requestTimeout", defaultHTTPRequestTimeout); err != nil {
+		return probe, err
+	}
+	probe.insecure, _ = step.With["insecure"].(bool)
+	probe.inCluster, _ = step.With["inCluster"].(bool)
+	if v, _ := step.With["namespace"].(string); strings.TrimSpace(v) != "" {
+		probe.namespace = strings.TrimSpace(v)
+	}
+	if v, _ := step.With["pod"].(string); strings.TrimSpace(v) != "" {
+		probe.target = strings.TrimSpace(v)
+	}
+	if v, _ := step.With["container"].(string); strings.TrimSpace(v) != "" {
+		probe.container = strings.TrimSpace(v)
+	}
+	if v, _ := step.With["image"].(string); strings.TrimSpace(v) != "" {
+		probe.image = strings.TrimSpace(v)
+	}
+	if probe.inCluster {
+		if stepCtx.KubeClient == nil {
+			return probe, fmt.Errorf("%s with inCluster requires a Kubernetes client", step.Use)
+		}
+		if probe.namespace == "" {
+			return probe, fmt.Errorf("%s with inCluster requires a namespace", step.Use)
+		}
+	}
+	return probe, nil
+}
+
+// parseStatusRanges parses expectStatus: a code, a class such as "2xx", or a list of both.
+func parseStatusRanges(raw any) ([]statusRange, error) {
+	items, ok := raw.([]any)
+	if !ok {
+		items = []any{raw}
+	}
+	ranges := make([]statusRange, 0, len(items))
+	for _, item := range items {
+		s := strings.ToLower(strings.TrimSpace(fmt.Sprint(item)))
+		if len(s) == 3 && strings.HasSuffix(s, "xx") && s[0] >= '1' && s[0] <= '5' {
+			lo := int(s[0]-'0') * 100
+			ranges = append(ranges, statusRange{lo: lo, hi: lo + 99})
+			continue
+		}
+		code, err := toInt(item)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid status %q (use a code such as 200 or a class such as 2xx)", s)
+		}
+		ranges = append(ranges, statusRange{lo: code, hi: code})
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("no status given")
+	}
+	return ranges, nil
+}
+
+// withDuration reads a duration string from step.With[key], returning def when it is not set.
+func withDuration(step config.HookStep, key string, def time.Duration) (time.Duration, error) {
+	raw, _ := step.With[key].(string)
+	if strings.TrimSpace(raw) == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(raw))
+	if err != nil {
+		return 0, fmt.Errorf("parse %s %s %q: %w", step.Use, key, raw, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%s %s must be positive", step.Use, key)
+	}
+	return d, nil
+}
+
+// send performs one request of the probe, from codexctl or from a cluster pod.
+func (p httpProbe) send(ctx context.Context, client kube.PodRunner) (httpResponse, error) {
+	if p.inCluster {
+		return p.sendInCluster(ctx, client)
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.requestTimeout)
+	defer cancel()
+
+	var body io.Reader
+	if p.body != "" {
+		body = strings.NewReader(p.body)
+	}
+	req, err := http.NewRequestWithContext(ctx, p.method, p.url, body)
+	if err != nil {
+		return httpResponse{}, fmt.Errorf("build request: %w", err)
+	}
+	for k, v := range p.headers {
+		req.Header.Set(k, v)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if p.insecure {
+		// Opt-in for endpoints behind self-signed dev certificates.
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return httpResponse{}, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPProbeBody))
+	if err != nil {
+		return httpResponse{}, fmt.Errorf("read response body: %w", err)
+	}
+	return httpResponse{status: resp.StatusCode, body: data}, nil
+}
+
+// sendInCluster performs one request of the probe with curl in the probe pod, so that cluster-local service
+// names resolve. curl prints the status code on a line after the body.
+func (p httpProbe) sendInCluster(ctx context.Context, client kube.PodRunner) (httpResponse, error) {
+	args := []string{"curl", "-sS", "-X", p.method, "-o", "-", "-w", `\n%{http_code}`,
+		"--max-time", strconv.Itoa(int(p.requestTimeout.Round(time.Second).Seconds()))}
+	if p.insecure {
+		args = append(args, "-k")
+	}
+	names := make([]string, 0, len(p.headers))
+	for k := range p.headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		args = append(args, "-H", k+": "+p.headers[k])
+	}
+	req := kube.ExecRequest{Namespace: p.namespace, Target: p.target, Container: p.container}
+	if p.body != "" {
+		args = append(args, "--data-binary", "@-")
+		req.Stdin = strings.NewReader(p.body)
+	}
+	req.Command = append(args, p.url)
+
+	var stdout, stderr bytes.Buffer
+	req.Stdout, req.Stderr = &stdout, &stderr
+	// The request itself is bounded by --max-time; the extra time covers the exec round trip.
+	execCtx, cancel := context.WithTimeout(ctx, p.requestTimeout+30*time.Second)
+	defer cancel()
+	if err := client.Exec(execCtx, req); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return httpResponse{}, fmt.Errorf("curl in %s/%s: %s: %w", p.namespace, p.target, msg, err)
+		}
+		return httpResponse{}, fmt.Errorf("curl in %s/%s: %w", p.namespace, p.target, err)
+	}
+	out := stdout.Bytes()
+	i := bytes.LastIndexByte(out, '\n')
+	if i < 0 {
+		return httpResponse{}, fmt.Errorf("unexpected curl output %q", out)
+	}
+	status, err := strconv.Atoi(strings.TrimSpace(string(out[i+1:])))
+	if err != nil {
+		return httpResponse{}, fmt.Errorf("unexpected curl status %q", out[i+1:])
+	}
+	body := out[:i]
+	if len(body) > maxHTTPProbeBody {
+		body = body[:maxHTTPProbeBody]
+	}
+	return httpResponse{status: status, body: body}, nil
+}
+
+// check reports the first assertion of the probe the response fails, or the request error.
+func (p httpProbe) check(resp httpResponse, err error) error {
+	if err != nil {
+		return err
+	}
+	accepted := false
+	for _, r := range p.expectStatus {
+		if resp.status >= r.lo && resp.status <= r.hi {
+			accepted = true
+			break
+		}
+	}
+	if !accepted {
+		return fmt.Errorf("unexpected status %d", resp.status)
+	}
+	for _, s := range p.bodyContains {
+		if !bytes.Contains(resp.body, []byte(s)) {
+			return fmt.Errorf("response body does not contain %q", s)
+		}
+	}
+	if len(p.jsonPath) == 0 {
+		return nil
+	}
+	var data any
+	if err := json.Unmarshal(resp.body, &data); err != nil {
+		return fmt.Errorf("decode JSON response body: %w", err)
+	}
+	exprs := make([]string, 0, len(p.jsonPath))
+	for expr := range p.jsonPath {
+		exprs = append(exprs, expr)
+	}
+	sort.Strings(exprs)
+	for _, expr := range exprs {
+		jp, err := compileJSONPath(expr)
+		if err != nil {
+			return err
+		}
+		var out bytes.Buffer
+		if err := jp.Execute(&out, data); err != nil {
+			return fmt.Errorf("jsonPath %s: %w", expr, err)
+		}
+		if got, want := strings.TrimSpace(out.String()), p.jsonPath[expr]; got != want {
+			return fmt.Errorf("jsonPath %s is %q, want %q", expr, got, want)
+		}
+	}
+	return nil
+}
+
+// compileJSONPath parses a kubectl-style JSONPath expression. The braces are optional, so ".status" and
+// "{.status}" are the same expression.
+func compileJSONPath(expr string) (*jsonpath.JSONPath, error) {
+	expr = strings.TrimSpace(expr)
+	if !strings.HasPrefix(expr, "{") {
+		expr = "{" + strings.TrimPrefix(expr, "$") + "}"
+	}
+	jp := jsonpath.New("jsonPath")
+	if err := jp.Parse(expr); err != nil {
+		return nil, err
+	}
+	return jp, nil
+}
+
+// startHTTPProbePod starts a short-lived pod with probe.image in probe.namespace, waits until it is ready and
+// points the probe at it. The returned cleanup deletes the pod.
+func (e *Executor) startHTTPProbePod(ctx context.Context, client kube.Orchestrator, probe *httpProbe) (func(), error) {
+	name := "codexctl-http-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	pod := map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata": map[string]any{
+			"name":      name,
+			"namespace": probe.namespace,
+			"labels": map[string]any{
+				engine.LabelManagedBy: engine.ManagedByValue,
+			},
+		},
+		"spec": map[string]any{
+			"restartPolicy": "Never",
+			// The pod outlives a crashed codexctl by at most an hour.
+			"activeDeadlineSeconds": int64(3600),
+			"containers": []any{map[string]any{
+				"name":    "http",
+				"image":   probe.image,
+				"command": []any{"sleep", "3600"},
+			}},
+		},
+	}
+	ref := kube.ObjectRef{APIVersion: "v1", Kind: "Pod", Namespace: probe.namespace, Name: name}
+	if err := client.Create(ctx, pod); err != nil {
+		return nil, fmt.Errorf("create probe pod: %w", err)
+	}
+	cleanup := func() {
+		deleteCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+		defer cancel()
+		if err := client.DeleteObject(deleteCtx, ref); err != nil {
+			e.logger.Warn("failed to delete probe pod", "pod", name, "namespace", probe.namespace, "error", err)
+		}
+	}
+	e.logger.Info("started probe pod", "pod", name, "namespace", probe.namespace, "image", probe.image)
+	if err := client.WaitForCondition(ctx, ref, "Ready", httpProbePodReadyTimeout); err != nil {
+		cleanup()
+		return nil, fmt.Errorf("wait for probe pod: %w", err)
+	}
+	probe.target, probe.container = name, "http"
+	return cleanup, nil
+}
@@ -0,0 +1,134 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/codex-k8s/codexctl/internal/config"
+	"github.com/codex-k8s/codexctl/internal/kube"
+	"github.com/codex-k8s/codexctl/internal/logging"
+)
+
+// defaultJobTimeout bounds a k8s.job step when with.timeout is not set.
+const defaultJobTimeout = "30m"
+
+// runJob implements the k8s.job built-in hook: it renders a Job from with.manifest or with.path, replaces any
+// previous instance, streams the logs of its pods into the logger and waits until the Job completes or fails.
+func (e *Executor) runJob(ctx context.Context, step config.HookStep, stepCtx StepContext) error {
+	if stepCtx.KubeClient == nil {
+		return fmt.Errorf("%s requires a Kubernetes client", step.Use)
+	}
+	job, err := loadJobManifest(step, stepCtx)
+	if err != nil {
+		return err
+	}
+	timeout, _ := step.With["timeout"].(string)
+	if strings.TrimSpace(timeout) == "" {
+		timeout = defaultJobTimeout
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(timeout))
+	if err != nil {
+		return fmt.Errorf("parse %s timeout %q: %w", step.Use, timeout, err)
+	}
+	// The step timeout wins when it expires first, so that timeout errors report the limit that applied.
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		d = time.Until(deadline).Round(time.Second)
+	}
+	timeout = d.String()
+	container, _ := step.With["container"].(string)
+
+	ref := kube.ObjectRefOf(job)
+	e.logger.Info("running "+step.Use+" hook", "step", step.Name, "job", ref.Name, "namespace", ref.Namespace, "timeout", timeout)
+
+	err = kube.RunJob(ctx, stepCtx.KubeClient, kube.JobRequest{
+		Job:       job,
+		Timeout:   timeout,
+		Container: strings.TrimSpace(container),
+		Output: func(pod string) io.WriteCloser {
+			return logging.NewLineWriter(e.logger, "job output", "job", ref.Name, "pod", pod)
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("%s step %q: %w", step.Use, step.Name, err)
+	}
+	e.logger.Info("job completed", "step", step.Name, "job", ref.Name, "namespace", ref.Namespace)
+	return nil
+}
+
+// loadJobManifest renders the Job of a k8s.job step from the inline with.manifest (a YAML template or a
+// mapping) or the manifest file with.path, relative to the project root. The namespace defaults to the
+// environment namespace and with.name overrides the Job name.
+func loadJobManifest(step config.HookStep, stepCtx StepContext) (map[string]any, error) {
+	var (
+		raw  []byte
+		name string
+	)
+	path, _ := step.With["path"].(string)
+	if strings.TrimSpace(path) != "" && step.With["manifest"] != nil {
+		return nil, fmt.Errorf("%s accepts either manifest or path in with, not both", step.Use)
+	}
+	switch manifest := step.With["manifest"].(type) {
+	case nil:
+		if strings.TrimSpace(path) == "" {
+			return nil, fmt.Errorf("%s requires manifest or path in with", step.Use)
+		}
+		name = strings.TrimSpace(path)
+		if !filepath.IsAbs(name) && stepCtx.Template.ProjectRoot != "" {
+			name = filepath.Join(stepCtx.Template.ProjectRoot, name)
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("read job manifest: %w", err)
+		}
+		raw = data
+	case string:
+		name, raw = "job-manifest", []byte(manifest)
+	case map[string]any:
+		data, err := yaml.Marshal(manifest)
+		if err != nil {
+			return nil, fmt.Errorf("encode inline job manifest: %w", err)
+		}
+		name, raw = "job-manifest", data
+	default:
+		return nil, fmt.Errorf("%s manifest must be a YAML string or a mapping", step.Use)
+	}
+
+	rendered, err := config.RenderTemplate(name, raw, stepCtx.Template)
+	if err != nil {
+		return nil, fmt.Errorf("render job manifest for %q: %w", step.Name, err)
+	}
+	docs, err := kube.DecodeDocuments(rendered)
+	if err != nil {
+		return nil, fmt.Errorf("decode job manifest for %q: %w", step.Name, err)
+	}
+	if len(docs) != 1 {
+		return nil, fmt.Errorf("%s manifest must contain exactly one Job, got %d documents", step.Use, len(docs))
+	}
+	job := docs[0]
+	if kind, _ := job["kind"].(string); kind != "Job" {
+		return nil, fmt.Errorf("%s manifest must be a Job, got %q", step.Use, kind)
+	}
+
+	meta, _ := job["metadata"].(map[string]any)
+	if meta == nil {
+		meta = map[string]any{}
+		job["metadata"] = meta
+	}
+	if v, _ := step.With["name"].(string); strings.TrimSpace(v) != "" {
+		meta["name"] = strings.TrimSpace(v)
+	}
+	if v, _ := step.With["namespace"].(string); strings.TrimSpace(v) != "" {
+		meta["namespace"] = strings.TrimSpace(v)
+	}
+	if ns, _ := meta["namespace"].(string); ns == "" {
+		meta["namespace"] = strings.TrimSpace(stepCtx.Template.Namespace)
+	}
+	return job, nil
+}
@@ -0,0 +1,607 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/jsonmergepatch"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// serviceAccountNamespaceFile holds the namespace of the pod service account.
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// defaultPollInterval is how often wait operations re-check object state.
+const defaultPollInterval = 2 * time.Second
+
+// APIClient implements Orchestrator on top of client-go.
+type APIClient struct {
+	clientset    kubernetes.Interface
+	dynamic      dynamic.Interface
+	mapper       meta.RESTMapper
+	restConfig   *rest.Config
+	namespace    string
+	stdout       io.Writer
+	pollInterval time.Duration
+}
+
+var _ Orchestrator = (*APIClient)(nil)
+
+// Clients bundles the client-go interfaces an APIClient is built from. Tests pass fake implementations
+// such as k8s.io/client-go/kubernetes/fake.Clientset and k8s.io/client-go/dynamic/fake.
+type Clients struct {
+	// Clientset is the typed client; its discovery client also backs the default RESTMapper.
+	Clientset kubernetes.Interface
+	// Dynamic is the client used for arbitrary manifests.
+	Dynamic dynamic.Interface
+	// Mapper maps kinds to resources (optional, defaults to a discovery-backed mapper).
+	Mapper meta.RESTMapper
+	// RESTConfig is required for Exec and Copy (optional otherwise).
+	RESTConfig *rest.Config
+	// Namespace is used for namespaced objects without metadata.namespace (defaults to "default").
+	Namespace string
+	// Stdout receives progress output (defaults to os.Stdout).
+	Stdout io.Writer
+	// PollInterval is how often wait operations re-check object state (defaults to 2s).
+	PollInterval time.Duration
+}
+
+// NewAPIClient constructs a client-go backed orchestrator for the cluster selected by cfg: the in-cluster
+// service account, or cfg.Kubeconfig and cfg.Context on top of the default kubeconfig loading rules
+// ($KUBECONFIG, ~/.kube/config, in-cluster service account).
+func NewAPIClient(cfg Config) (*APIClient, error) {
+	restConfig, namespace, err := loadRESTConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if restConfig.QPS == 0 {
+		restConfig.QPS = 50
+		restConfig.Burst = 100
+	}
+	if cfg.RequestTimeout > 0 {
+		restConfig.Timeout = cfg.RequestTimeout
+	}
+
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("create kubernetes client: %w", err)
+	}
+	dyn, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("create dynamic client: %w", err)
+	}
+	return NewAPIClientFromClients(Clients{
+		Clientset:  clientset,
+		Dynamic:    dyn,
+		RESTConfig: restConfig,
+		Namespace:  namespace,
+		Stdout:     cfg.Stdout,
+	}), nil
+}
+
+// loadRESTConfig resolves the REST config and default namespace of the cluster selected by cfg.
+func loadRESTConfig(cfg Config) (*rest.Config, string, error) {
+	if cfg.InCluster {
+		restConfig, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, "", fmt.Errorf("load in-cluster config: %w", err)
+		}
+		namespace := metav1.NamespaceDefault
+		if raw, err := os.ReadFile(serviceAccountNamespaceFile); err == nil && strings.TrimSpace(string(raw)) != "" {
+			namespace = strings.TrimSpace(string(raw))
+		}
+		return restConfig, namespace, nil
+	}
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if paths := filepath.SplitList(cfg.Kubeconfig); len(paths) == 1 {
+		rules.ExplicitPath = paths[0]
+	} else if len(paths) > 1 {
+		rules.Precedence = paths
+	}
+	loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: cfg.Context})
+	restConfig, err := loader.ClientConfig()
+	if err != nil {
+		return nil, "", fmt.Errorf("load kubeconfig: %w", err)
+	}
+	namespace, _, err := loader.Namespace()
+	if err != nil {
+		return nil, "", fmt.Errorf("resolve kubeconfig namespace: %w", err)
+	}
+	return restConfig, namespace, nil
+}
+
+// NewAPIClientFromClients constructs a client-go backed orchestrator from existing clients.
+func NewAPIClientFromClients(clients Clients) *APIClient {
+	mapper := clients.Mapper
+	if mapper == nil {
+		disco := clients.Clientset.Discovery()
+		mapper = restmapper.NewShortcutExpander(
+			restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(disco)),
+			disco,
+			func(string) {},
+		)
+	}
+	namespace := clients.Namespace
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	pollInterval := clients.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = defaultPollInterval
+	}
+	return &APIClient{
+		clientset:    clients.Clientset,
+		dynamic:      clients.Dynamic,
+		mapper:       mapper,
+		restConfig:   clients.RESTConfig,
+		namespace:    namespace,
+		stdout:       stdoutOrDefault(clients.Stdout),
+		pollInterval: pollInterval,
+	}
+}
+
+// Apply creates or updates every object using a three-way merge against the last applied configuration,
+// like kubectl apply, or with server-side apply when opts.ServerSide is set.
+func (c *APIClient) Apply(ctx context.Context, manifests []byte, opts ApplyOptions) error {
+	docs, err := DecodeDocuments(manifests)
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		obj, action, err := c.applyDocument(ctx, doc, opts, false)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.stdout, "%s %s\n", displayName(obj), action)
+	}
+	return nil
+}
+
+// DryRunApply submits a single-object manifest with a server-side dry run.
+func (c *APIClient) DryRunApply(ctx context.Context, manifest []byte, opts ApplyOptions) (map[string]any, error) {
+	docs, err := DecodeDocuments(manifest)
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) != 1 {
+		return nil, fmt.Errorf("dry-run apply expects a single object, got %d", len(docs))
+	}
+	obj, _, err := c.applyDocument(ctx, docs[0], opts, true)
+	if err != nil {
+		return nil, err
+	}
+	return obj.Object, nil
+}
+
+// Delete deletes the objects of the manifest stream with background propagation.
+func (c *APIClient) Delete(ctx context.Context, manifests []byte, ignoreNotFound bool) error {
+	docs, err := DecodeDocuments(manifests)
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		ref := ObjectRefOf(doc)
+		err := c.deleteObject(ctx, ref)
+		if errors.Is(err, ErrNotFound) && ignoreNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetObject returns the live object referenced by ref or nil when it does not exist.
+func (c *APIClient) GetObject(ctx context.Context, ref ObjectRef) (map[string]any, error) {
+	ri, _, err := c.resource(ref)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := ri.Get(ctx, ref.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, apiError("get "+ref.String(), err)
+	}
+	return obj.Object, nil
+}
+
+// GetObjects returns objects of the given resource types in namespace that match the label selector.
+func (c *APIClient) GetObjects(ctx context.Context, namespace, selector string, resources []string) ([]map[string]any, error) {
+	var out []map[string]any
+	for _, resource := range resources {
+		gvr, err := c.resourceFor(schema.ParseGroupResource(resource))
+		if err != nil {
+			return nil, err
+		}
+		var ri dynamic.ResourceInterface = c.dynamic.Resource(gvr)
+		if namespace != "" {
+			ri = c.dynamic.Resource(gvr).Namespace(namespace)
+		}
+		list, err := ri.List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return nil, apiError("list "+resource, err)
+		}
+		for _, item := range list.Items {
+			out = append(out, item.Object)
+		}
+	}
+	return out, nil
+}
+
+// ListNamespacedResources returns the names of namespaced resource types that support list and delete.
+func (c *APIClient) ListNamespacedResources(_ context.Context) ([]string, error) {
+	lists, err := c.clientset.Discovery().ServerPreferredNamespacedResources()
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, fmt.Errorf("discover API resources: %w", err)
+	}
+	var names []string
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+		for _, r := range list.APIResources {
+			if strings.Contains(r.Name, "/") || !hasVerbs(r.Verbs, "list", "delete") {
+				continue
+			}
+			name := r.Name
+			if gv.Group != "" {
+				name += "." + gv.Group
+			}
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// Create creates a single object and fails with ErrAlreadyExists when it exists.
+func (c *APIClient) Create(ctx context.Context, obj map[string]any) error {
+	ref := ObjectRefOf(obj)
+	ri, _, err := c.resource(ref)
+	if err != nil {
+		return err
+	}
+	if _, err := ri.Create(ctx, &unstructured.Unstructured{Object: obj}, metav1.CreateOptions{FieldManager: FieldManager}); err != nil {
+		return apiError("create "+ref.String(), err)
+	}
+	return nil
+}
+
+// MergePatch applies a JSON merge patch to the object referenced by ref.
+func (c *APIClient) MergePatch(ctx context.Context, ref ObjectRef, patch []byte) error {
+	ri, _, err := c.resource(ref)
+	if err != nil {
+		return err
+	}
+	if _, err := ri.Patch(ctx, ref.Name, types.MergePatchType, patch, metav1.PatchOptions{FieldManager: FieldManager}); err != nil {
+		return apiError("patch "+ref.String(), err)
+	}
+	return nil
+}
+
+// MergePatchStatus applies a JSON merge patch to the status subresource of the object referenced by ref.
+func (c *APIClient) MergePatchStatus(ctx context.Context, ref ObjectRef, patch []byte) error {
+	ri, _, err := c.resource(ref)
+	if err != nil {
+		return err
+	}
+	if _, err := ri.Patch(ctx, ref.Name, types.MergePatchType, patch, metav1.PatchOptions{FieldManager: FieldManager}, "status"); err != nil {
+		return apiError("patch status of "+ref.String(), err)
+	}
+	return nil
+}
+
+// DeleteObject deletes the object referenced by ref; missing objects are ignored.
+func (c *APIClient) DeleteObject(ctx context.Context, ref ObjectRef) error {
+	if err := c.deleteObject(ctx, ref); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// EnsureNamespace creates the namespace when it is missing and reports whether it was created.
+func (c *APIClient) EnsureNamespace(ctx context.Context, name string) (bool, error) {
+	namespaces := c.clientset.CoreV1().Namespaces()
+	_, err := namespaces.Get(ctx, name, metav1.GetOptions{})
+	if err == nil {
+		return false, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return false, apiError("get namespace "+name, err)
+	}
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	if _, err := namespaces.Create(ctx, ns, metav1.CreateOptions{FieldManager: FieldManager}); err != nil {
+		if apierrors.IsAlreadyExists(err) {
+			return false, nil
+		}
+		return false, apiError("create namespace "+name, err)
+	}
+	return true, nil
+}
+
+// applyDocument applies a single object with the strategy selected by opts.
+func (c *APIClient) applyDocument(ctx context.Context, doc map[string]any, opts ApplyOptions, dryRun bool) (*unstructured.Unstructured, string, error) {
+	if opts.ServerSide {
+		return c.serverSideApply(ctx, doc, opts.ForceConflicts, dryRun)
+	}
+	return c.applyObject(ctx, doc, dryRun)
+}
+
+// serverSideApply sends doc as an apply patch owned by FieldManager. Field ownership conflicts are
+// returned as *ConflictError unless force is set.
+func (c *APIClient) serverSideApply(ctx context.Context, doc map[string]any, force, dryRun bool) (*unstructured.Unstructured, string, error) {
+	obj := &unstructured.Unstructured{Object: doc}
+	ref := ObjectRefOf(doc)
+	ri, mapping, err := c.resource(ref)
+	if err != nil {
+		return nil, "", err
+	}
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace && obj.GetNamespace() == "" {
+		obj.SetNamespace(c.namespace)
+		ref.Namespace = c.namespace
+	}
+	data, err := obj.MarshalJSON()
+	if err != nil {
+		return nil, "", fmt.Errorf("encode %s: %w", ref, err)
+	}
+	patchOpts := metav1.PatchOptions{FieldManager: FieldManager, Force: &force}
+	if dryRun {
+		patchOpts.DryRun = []string{metav1.DryRunAll}
+	}
+	applied, err := ri.Patch(ctx, obj.GetName(), types.ApplyPatchType, data, patchOpts)
+	if apierrors.IsConflict(err) {
+		return nil, "", conflictFromAPIError(displayName(obj), err)
+	}
+	if err != nil {
+		return nil, "", apiError("apply "+ref.String(), err)
+	}
+	return applied, "serverside-applied", nil
+}
+
+// applyObject creates doc or patches the live object with a three-way merge between the last applied
+// configuration, doc and the live state. It returns the resulting object and the kubectl-style action.
+func (c *APIClient) applyObject(ctx context.Context, doc map[string]any, dryRun bool) (*unstructured.Unstructured, string, error) {
+	obj := &unstructured.Unstructured{Object: doc}
+	ref := ObjectRefOf(doc)
+	ri, mapping, err := c.resource(ref)
+	if err != nil {
+		return nil, "", err
+	}
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace && obj.GetNamespace() == "" {
+		obj.SetNamespace(c.namespace)
+		ref.Namespace = c.namespace
+	}
+
+	if err := setLastApplied(obj); err != nil {
+		return nil, "", fmt.Errorf("encode %s: %w", ref, err)
+	}
+	var dryRunOpt []string
+	if dryRun {
+		dryRunOpt = []string{metav1.DryRunAll}
+	}
+
+	current, err := ri.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		created, err := ri.Create(ctx, obj, metav1.CreateOptions{DryRun: dryRunOpt, FieldManager: FieldManager})
+		if err != nil {
+			return nil, "", apiError("create "+ref.String(), err)
+		}
+		return created, "created", nil
+	}
+	if err != nil {
+		return nil, "", apiError("get "+ref.String(), err)
+	}
+
+	var original []byte
+	if v := current.GetAnnotations()[lastAppliedAnnotation]; v != "" {
+		original = []byte(v)
+	}
+	modified, err := obj.MarshalJSON()
+	if err != nil {
+		return nil, "", fmt.Errorf("encode %s: %w", ref, err)
+	}
+	live, err := current.MarshalJSON()
+	if err != nil {
+		return nil, "", fmt.Errorf("encode live %s: %w", ref, err)
+	}
+	patch, patchType, err := threeWayPatch(mapping.GroupVersionKind, original, modified, live)
+	if err != nil {
+		return nil, "", fmt.Errorf("compute patch for %s: %w", ref, err)
+	}
+	if string(patch) == "{}" {
+		return current, "unchanged", nil
+	}
+	patched, err := ri.Patch(ctx, obj.GetName(), patchType, patch, metav1.PatchOptions{DryRun: dryRunOpt, FieldManager: FieldManager})
+	if err != nil {
+		return nil, "", apiError("patch "+ref.String(), err)
+	}
+	return patched, "configured", nil
+}
+
+// deleteObject deletes a single object with background propagation.
+func (c *APIClient) deleteObject(ctx context.Context, ref ObjectRef) error {
+	ri, _, err := c.resource(ref)
+	if err != nil {
+		return err
+	}
+	propagation := metav1.DeletePropagationBackground
+	if err := ri.Delete(ctx, ref.Name, metav1.DeleteOptions{PropagationPolicy: &propagation}); err != nil {
+		return apiError("delete "+ref.String(), err)
+	}
+	fmt.Fprintf(c.stdout, "%s deleted\n", displayName(&unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": ref.APIVersion,
+		"kind":       ref.Kind,
+		"metadata":   map[string]any{"name": ref.Name},
+	}}))
+	return nil
+}
+
+// resource resolves ref into a dynamic client scoped to its namespace. When ref.APIVersion is empty,
+// ref.Kind is treated as a resource name (e.g. "deploy", "deployment", "deployments.apps").
+func (c *APIClient) resource(ref ObjectRef) (dynamic.ResourceInterface, *meta.RESTMapping, error) {
+	mapping, err := c.restMapping(ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return c.dynamic.Resource(mapping.Resource), mapping, nil
+	}
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = c.namespace
+	}
+	return c.dynamic.Resource(mapping.Resource).Namespace(namespace), mapping, nil
+}
+
+// restMapping resolves ref into a REST mapping, refreshing discovery once for kinds registered
+// during this run (e.g. custom resources applied right after their CRD).
+func (c *APIClient) restMapping(ref ObjectRef) (*meta.RESTMapping, error) {
+	mapping, err := c.lookupMapping(ref)
+	if meta.IsNoMatchError(err) {
+		if r, ok := c.mapper.(meta.ResettableRESTMapper); ok {
+			r.Reset()
+			mapping, err = c.lookupMapping(ref)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("resolve resource type for %s: %w", ref, err)
+	}
+	return mapping, nil
+}
+
+// lookupMapping performs a single REST mapping lookup for ref.
+func (c *APIClient) lookupMapping(ref ObjectRef) (*meta.RESTMapping, error) {
+	if ref.APIVersion != "" {
+		gv, err := schema.ParseGroupVersion(ref.APIVersion)
+		if err != nil {
+			return nil, err
+		}
+		return c.mapper.RESTMapping(schema.GroupKind{Group: gv.Group, Kind: ref.Kind}, gv.Version)
+	}
+	gvr, err := c.mapper.ResourceFor(schema.ParseGroupResource(strings.ToLower(ref.Kind)).WithVersion(""))
+	if err != nil {
+		return nil, err
+	}
+	gvk, err := c.mapper.KindFor(gvr)
+	if err != nil {
+		return nil, err
+	}
+	return c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+}
+
+// resourceFor resolves a "plural.group" resource name into its preferred version, refreshing discovery
+// once like restMapping.
+func (c *APIClient) resourceFor(gr schema.GroupResource) (schema.GroupVersionResource, error) {
+	gvr, err := c.mapper.ResourceFor(gr.WithVersion(""))
+	if meta.IsNoMatchError(err) {
+		if r, ok := c.mapper.(meta.ResettableRESTMapper); ok {
+			r.Reset()
+			gvr, err = c.mapper.ResourceFor(gr.WithVersion(""))
+		}
+	}
+	if err != nil {
+		return gvr, fmt.Errorf("resolve resource %s: %w", gr, err)
+	}
+	return gvr, nil
+}
+
+// setLastApplied stores the JSON of obj (without the annotation itself) in the last-applied annotation.
+func setLastApplied(obj *unstructured.Unstructured) error {
+	annotations := obj.GetAnnotations()
+	delete(annotations, lastAppliedAnnotation)
+	obj.SetAnnotations(annotations)
+	raw, err := json.Marshal(obj.Object)
+	if err != nil {
+		return err
+	}
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[lastAppliedAnnotation] = string(raw)
+	obj.SetAnnotations(annotations)
+	return nil
+}
+
+// threeWayPatch computes the kubectl apply patch: a strategic merge patch for built-in types and a
+// JSON merge patch for custom resources.
+func threeWayPatch(gvk schema.GroupVersionKind, original, modified, current []byte) ([]byte, types.PatchType, error) {
+	if versioned, err := scheme.Scheme.New(gvk); err == nil {
+		lookup, err := strategicpatch.NewPatchMetaFromStruct(versioned)
+		if err != nil {
+			return nil, "", err
+		}
+		patch, err := strategicpatch.CreateThreeWayMergePatch(original, modified, current, lookup, true)
+		return patch, types.StrategicMergePatchType, err
+	}
+	patch, err := jsonmergepatch.CreateThreeWayJSONMergePatch(original, modified, current)
+	return patch, types.MergePatchType, err
+}
+
+// apiError wraps an API server error and classifies it into the sentinel errors of this package.
+func apiError(op string, err error) error {
+	kerr := &Error{Op: op, Err: err}
+	switch {
+	case apierrors.IsNotFound(err):
+		kerr.Reason = ErrNotFound
+	case apierrors.IsAlreadyExists(err):
+		kerr.Reason = ErrAlreadyExists
+	case apierrors.IsConflict(err):
+		kerr.Reason = ErrConflict
+	case apierrors.IsInternalError(err) && strings.Contains(err.Error(), "failed calling webhook"):
+		kerr.Reason = ErrWebhookUnavailable
+	}
+	return kerr
+}
+
+// displayName formats obj as kubectl does in apply output (e.g. "deployment.apps/web").
+func displayName(obj *unstructured.Unstructured) string {
+	gvk := obj.GroupVersionKind()
+	kind := strings.ToLower(gvk.Kind)
+	if gvk.Group != "" {
+		kind += "." + gvk.Group
+	}
+	return kind + "/" + obj.GetName()
+}
+
+// hasVerbs reports whether verbs contains every wanted verb.
+func hasVerbs(verbs metav1.Verbs, wanted ...string) bool {
+	for _, w := range wanted {
+		found := false
+		for _, v := range verbs {
+			if v == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,101 @@
+package kube
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// FieldConflict is a single field server-side apply could not take over because another field manager owns it.
+type FieldConflict struct {
+	// Field is the field path as reported by the API server (e.g. ".spec.replicas").
+	Field string
+	// Manager is the competing field manager (e.g. "kube-controller-manager").
+	Manager string
+}
+
+// ConflictError reports field ownership conflicts of a server-side apply.
+type ConflictError struct {
+	// Object is the conflicting object in kubectl notation (e.g. "deployment.apps/web"); empty when unknown.
+	Object string
+	// Conflicts lists the conflicting fields and their managers.
+	Conflicts []FieldConflict
+	// Err is the underlying error.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *ConflictError) Error() string {
+	if len(e.Conflicts) == 0 {
+		return e.Err.Error()
+	}
+	parts := make([]string, 0, len(e.Conflicts))
+	for _, c := range e.Conflicts {
+		parts = append(parts, fmt.Sprintf("%s (managed by %q)", c.Field, c.Manager))
+	}
+	target := ""
+	if e.Object != "" {
+		target = " on " + e.Object
+	}
+	return fmt.Sprintf("server-side apply conflict%s: %s", target, strings.Join(parts, ", "))
+}
+
+// Unwrap classifies the error as ErrConflict and exposes the underlying error.
+func (e *ConflictError) Unwrap() []error {
+	return []error{ErrConflict, e.Err}
+}
+
+// conflictLineRe matches "conflict with "manager" using apps/v1: .spec.replicas" and the multi-field
+// form "conflicts with "manager":" followed by "- .field" lines.
+var conflictLineRe = regexp.MustCompile(`conflicts? with "([^"]+)"(?: using [^:\s]+)?(?::\s*(.*))?$`)
+
+// parseConflictMessage extracts field conflicts from an "Apply failed with N conflicts" message.
+func parseConflictMessage(msg string) []FieldConflict {
+	var (
+		out     []FieldConflict
+		manager string
+	)
+	for _, line := range strings.Split(msg, "\n") {
+		line = strings.TrimSpace(line)
+		if m := conflictLineRe.FindStringSubmatch(line); m != nil {
+			manager = m[1]
+			if field := strings.TrimSpace(m[2]); field != "" {
+				out = append(out, FieldConflict{Field: field, Manager: manager})
+			}
+			continue
+		}
+		if manager != "" && strings.HasPrefix(line, "- ") {
+			out = append(out, FieldConflict{Field: strings.TrimSpace(strings.TrimPrefix(line, "- ")), Manager: manager})
+		}
+	}
+	return out
+}
+
+// conflictFromAPIError builds a ConflictError from a server-side apply conflict returned by the API server,
+// preferring the structured status causes over the message text.
+func conflictFromAPIError(object string, err error) *ConflictError {
+	cerr := &ConflictError{Object: object, Err: err}
+	var status apierrors.APIStatus
+	if errors.As(err, &status) {
+		if details := status.Status().Details; details != nil {
+			for _, cause := range details.Causes {
+				if cause.Type != metav1.CauseTypeFieldManagerConflict {
+					continue
+				}
+				manager := ""
+				if m := conflictLineRe.FindStringSubmatch(cause.Message); m != nil {
+					manager = m[1]
+				}
+				cerr.Conflicts = append(cerr.Conflicts, FieldConflict{Field: cause.Field, Manager: manager})
+			}
+		}
+	}
+	if len(cerr.Conflicts) == 0 {
+		cerr.Conflicts = parseConflictMessage(err.Error())
+	}
+	return cerr
+}
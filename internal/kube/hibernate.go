@@ -0,0 +1,98 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// hibernateReplicasAnnotation keeps the replicas of a workload scaled to zero by hibernation, so that waking
+// the namespace restores them.
+const hibernateReplicasAnnotation = "codexctl.io/hibernate-replicas"
+
+// HibernateWorkloads scales every Deployment and StatefulSet of namespace that has replicas to zero and records
+// the current replicas in an annotation for WakeWorkloads. Workloads already at zero replicas are left alone,
+// so a repeated run keeps the replicas recorded by the first one. The scaled workloads are returned.
+func HibernateWorkloads(ctx context.Context, client ObjectClient, namespace string) ([]ScaledWorkload, error) {
+	items, err := listScalableWorkloads(ctx, client, namespace)
+	if err != nil {
+		return nil, err
+	}
+	var workloads []ScaledWorkload
+	for _, item := range items {
+		if item.replicas > 0 {
+			workloads = append(workloads, ScaledWorkload{Kind: item.Kind, Name: item.Name, Replicas: item.replicas})
+		}
+	}
+	return workloads, scaleDown(ctx, client, namespace, hibernateReplicasAnnotation, workloads)
+}
+
+// WakeWorkloads scales the Deployments and StatefulSets of namespace hibernated by HibernateWorkloads back to
+// their recorded replicas and drops the annotation. The scaled workloads are returned.
+func WakeWorkloads(ctx context.Context, client ObjectClient, namespace string) ([]ScaledWorkload, error) {
+	items, err := listScalableWorkloads(ctx, client, namespace)
+	if err != nil {
+		return nil, err
+	}
+	var workloads []ScaledWorkload
+	for _, item := range items {
+		if item.hibernated {
+			workloads = append(workloads, item.ScaledWorkload)
+		}
+	}
+	return workloads, scaleUp(ctx, client, namespace, hibernateReplicasAnnotation, workloads)
+}
+
+// scalableWorkload is a Deployment or StatefulSet with its hibernation state.
+type scalableWorkload struct {
+	ScaledWorkload
+	// replicas is the current spec.replicas.
+	replicas int32
+	// hibernated reports whether the workload carries the hibernation annotation.
+	hibernated bool
+}
+
+// listScalableWorkloads returns the Deployments and StatefulSets of namespace sorted by kind and name. The
+// replicas of a hibernated workload are the recorded ones, of any other the current ones.
+func listScalableWorkloads(ctx context.Context, client ObjectClient, namespace string) ([]scalableWorkload, error) {
+	items, err := client.GetObjects(ctx, namespace, "", []string{"deployments.apps", "statefulsets.apps"})
+	if err != nil {
+		return nil, fmt.Errorf("list workloads: %w", err)
+	}
+	out := make([]scalableWorkload, 0, len(items))
+	for _, item := range items {
+		var obj struct {
+			metav1.TypeMeta   `json:",inline"`
+			metav1.ObjectMeta `json:"metadata"`
+			Spec              struct {
+				Replicas *int32 `json:"replicas"`
+			} `json:"spec"`
+		}
+		if err := fromUnstructured(item, &obj); err != nil {
+			return nil, fmt.Errorf("decode workload: %w", err)
+		}
+		w := scalableWorkload{
+			ScaledWorkload: ScaledWorkload{Kind: obj.Kind, Name: obj.Name, Replicas: replicasOrOne(obj.Spec.Replicas)},
+			replicas:       replicasOrOne(obj.Spec.Replicas),
+		}
+		if v, ok := obj.Annotations[hibernateReplicasAnnotation]; ok {
+			w.hibernated = true
+			if n, err := strconv.ParseInt(v, 10, 32); err == nil {
+				w.Replicas = int32(n)
+			} else {
+				w.Replicas = max(w.replicas, 1)
+			}
+		}
+		out = append(out, w)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Kind != out[j].Kind {
+			return out[i].Kind < out[j].Kind
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out, nil
+}
@@ -0,0 +1,258 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// jobPollInterval is the delay between Job status and pod checks of RunJob.
+	jobPollInterval = 2 * time.Second
+	// jobDeleteTimeout bounds the wait for the previous instance of a Job to disappear.
+	jobDeleteTimeout = "2m"
+	// jobLogDrainTimeout bounds how long RunJob waits for log streams after the Job finished.
+	jobLogDrainTimeout = 30 * time.Second
+)
+
+// JobRequest describes a one-shot Job run by RunJob.
+type JobRequest struct {
+	// Job is the Job object; metadata.namespace must be set.
+	Job map[string]any
+	// Timeout bounds the wait for the Job to finish (empty uses the default wait timeout).
+	Timeout string
+	// Container selects the container whose logs are streamed (empty selects the default container).
+	Container string
+	// Output returns the writer that receives the logs of a Job pod; it is closed when the pod's stream ends.
+	// Logs are not streamed when Output is nil.
+	Output func(pod string) io.WriteCloser
+}
+
+// JobFailedError reports a Job that failed. ExitCode is the exit code of the last failed container of its
+// pods, or zero when no container exited with an error (e.g. the Job hit its active deadline first).
+type JobFailedError struct {
+	// Namespace is the Job namespace.
+	Namespace string
+	// Name is the Job name.
+	Name string
+	// Reason is the reason of the Failed condition, e.g. BackoffLimitExceeded.
+	Reason string
+	// Message is the message of the Failed condition.
+	Message string
+	// Pod is the pod of the failed container.
+	Pod string
+	// Container is the failed container.
+	Container string
+	// ExitCode is the exit code of the failed container.
+	ExitCode int32
+}
+
+// Error implements error.
+func (e *JobFailedError) Error() string {
+	msg := fmt.Sprintf("job %s/%s failed", e.Namespace, e.Name)
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	if e.Container != "" {
+		msg += fmt.Sprintf(": container %s of pod %s exited with code %d", e.Container, e.Pod, e.ExitCode)
+	} else if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// RunJob runs a one-shot Job: it deletes a previous instance of the same name (Job specs are immutable, so
+// re-applying a finished Job fails), creates the Job, streams the logs of its pods to req.Output and waits
+// until it completes or fails. A failed Job is returned as *JobFailedError. The Job is kept afterwards so
+// that it can be inspected until the next run replaces it.
+func RunJob(ctx context.Context, client Orchestrator, req JobRequest) error {
+	// A JSON round trip turns YAML-decoded values (e.g. int) into the JSON types unstructured objects expect.
+	data, err := json.Marshal(req.Job)
+	if err != nil {
+		return fmt.Errorf("encode job: %w", err)
+	}
+	var job map[string]any
+	if err := json.Unmarshal(data, &job); err != nil {
+		return fmt.Errorf("encode job: %w", err)
+	}
+	ref := ObjectRefOf(job)
+	if ref.Kind != "Job" || ref.Name == "" || ref.Namespace == "" {
+		return fmt.Errorf("job manifest must be a named Job with a namespace, got kind %q name %q namespace %q", ref.Kind, ref.Name, ref.Namespace)
+	}
+	if ref.APIVersion == "" {
+		ref.APIVersion = "batch/v1"
+		job["apiVersion"] = ref.APIVersion
+	}
+
+	if err := client.DeleteObject(ctx, ref); err != nil {
+		return fmt.Errorf("delete previous %s: %w", ref, err)
+	}
+	err = pollUntil(ctx, jobPollInterval, jobDeleteTimeout, "deletion of previous "+ref.String(), func(ctx context.Context) (bool, string, error) {
+		obj, err := client.GetObject(ctx, ref)
+		return obj == nil, "job still exists", err
+	})
+	if err != nil {
+		return err
+	}
+	if err := client.Create(ctx, job); err != nil {
+		return fmt.Errorf("create %s: %w", ref, err)
+	}
+
+	var selector string
+	logsDone := make(chan struct{})
+	finished := make(chan struct{})
+	logCtx, cancelLogs := context.WithCancel(ctx)
+	defer cancelLogs()
+
+	err = pollUntil(ctx, jobPollInterval, req.Timeout, ref.String(), func(ctx context.Context) (bool, string, error) {
+		job, err := getJob(ctx, client, ref)
+		if err != nil {
+			return false, "", err
+		}
+		if selector == "" && job.Spec.Selector != nil {
+			sel, err := metav1.LabelSelectorAsSelector(job.Spec.Selector)
+			if err != nil {
+				return false, "", fmt.Errorf("parse selector of %s: %w", ref, err)
+			}
+			selector = sel.String()
+			go func() {
+				defer close(logsDone)
+				if req.Output != nil {
+					streamJobLogs(logCtx, client, req, ref.Namespace, selector, finished)
+				}
+			}()
+		}
+		for _, cond := range job.Status.Conditions {
+			if cond.Status != corev1.ConditionTrue {
+				continue
+			}
+			switch cond.Type {
+			case batchv1.JobComplete:
+				return true, "", nil
+			case batchv1.JobFailed:
+				return false, "", &JobFailedError{Namespace: ref.Namespace, Name: ref.Name, Reason: cond.Reason, Message: cond.Message}
+			}
+		}
+		return false, fmt.Sprintf("%d active, %d succeeded, %d failed pods", job.Status.Active, job.Status.Succeeded, job.Status.Failed), nil
+	})
+
+	close(finished)
+	if selector != "" {
+		select {
+		case <-logsDone:
+		case <-time.After(jobLogDrainTimeout):
+			cancelLogs()
+			<-logsDone
+		}
+	}
+
+	var failed *JobFailedError
+	if errors.As(err, &failed) && selector != "" {
+		lookupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+		defer cancel()
+		if pods, lerr := jobPods(lookupCtx, client, ref.Namespace, selector); lerr == nil {
+			failed.Pod, failed.Container, failed.ExitCode = lastFailedContainer(pods)
+		}
+	}
+	return err
+}
+
+// getJob reads and decodes the Job referenced by ref.
+func getJob(ctx context.Context, client ObjectClient, ref ObjectRef) (*batchv1.Job, error) {
+	obj, err := client.GetObject(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		return nil, fmt.Errorf("%s was deleted while waiting for it", ref)
+	}
+	var job batchv1.Job
+	if err := fromUnstructured(obj, &job); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", ref, err)
+	}
+	return &job, nil
+}
+
+// jobPods returns the pods matching selector in namespace, oldest first.
+func jobPods(ctx context.Context, client ObjectClient, namespace, selector string) ([]corev1.Pod, error) {
+	items, err := client.GetObjects(ctx, namespace, selector, []string{"pods"})
+	if err != nil {
+		return nil, fmt.Errorf("list job pods: %w", err)
+	}
+	pods := make([]corev1.Pod, 0, len(items))
+	for _, item := range items {
+		var pod corev1.Pod
+		if fromUnstructured(item, &pod) == nil {
+			pods = append(pods, pod)
+		}
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].CreationTimestamp.Before(&pods[j].CreationTimestamp)
+	})
+	return pods, nil
+}
+
+// streamJobLogs streams the logs of every pod of a Job once, in creation order, until finished is closed and
+// the pods started so far have been streamed. Pods that are still pending are picked up by a later pass.
+func streamJobLogs(ctx context.Context, client Orchestrator, req JobRequest, namespace, selector string, finished <-chan struct{}) {
+	streamed := map[string]bool{}
+	for {
+		last := false
+		select {
+		case <-finished:
+			last = true
+		default:
+		}
+		pods, _ := jobPods(ctx, client, namespace, selector)
+		for _, pod := range pods {
+			if streamed[pod.Name] || pod.Status.Phase == corev1.PodPending || pod.Status.Phase == "" {
+				continue
+			}
+			streamed[pod.Name] = true
+			out := req.Output(pod.Name)
+			_ = client.Logs(ctx, LogsRequest{Namespace: namespace, Target: pod.Name, Container: req.Container, Follow: true, Out: out})
+			_ = out.Close()
+		}
+		if last || ctx.Err() != nil {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-finished:
+		case <-time.After(jobPollInterval):
+		}
+	}
+}
+
+// lastFailedContainer returns the pod, container and exit code of the most recent container termination
+// with a non-zero exit code among pods, or empty values when there is none.
+func lastFailedContainer(pods []corev1.Pod) (string, string, int32) {
+	var (
+		pod, container string
+		code           int32
+		at             time.Time
+	)
+	for _, p := range pods {
+		statuses := append(append([]corev1.ContainerStatus(nil), p.Status.InitContainerStatuses...), p.Status.ContainerStatuses...)
+		for _, cs := range statuses {
+			for _, t := range []*corev1.ContainerStateTerminated{cs.State.Terminated, cs.LastTerminationState.Terminated} {
+				if t == nil || t.ExitCode == 0 {
+					continue
+				}
+				if container == "" || !t.FinishedAt.Time.Before(at) {
+					pod, container, code, at = p.Name, cs.Name, t.ExitCode, t.FinishedAt.Time
+				}
+			}
+		}
+	}
+	return pod, container, code
+}
@@ -1,110 +1,256 @@
-// Package kube provides low-level integration with Kubernetes via kubectl and related helpers.
+// Package kube provides the Kubernetes orchestrator used by codexctl: a client-go backed implementation
+// (the default) and a kubectl-based one kept for environments that rely on kubectl behaviour.
 package kube
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
+	"strings"
+	"time"
 )
 
-// Client wraps kubectl execution for in-cluster workloads.
-type Client struct {
-	// StdoutToStderr redirects kubectl stdout to stderr (useful for machine-readable outputs).
-	StdoutToStderr bool
-}
+const (
+	// BackendClientGo talks to the API server directly via client-go.
+	BackendClientGo = "client-go"
+	// BackendKubectl runs kubectl subprocesses.
+	BackendKubectl = "kubectl"
+)
+
+// FieldManager is the field manager name codexctl uses for writes to the API server.
+const FieldManager = "codexctl"
+
+// defaultWaitTimeout is used when a wait call does not specify a timeout.
+const defaultWaitTimeout = "600s"
 
-// NewClient constructs a new Kubernetes client wrapper.
-func NewClient() *Client {
-	return &Client{}
+// lastAppliedAnnotation stores the last applied configuration for three-way merges (shared with kubectl).
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+var (
+	// ErrNotFound reports that the referenced object does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrAlreadyExists reports that an object with the same name already exists.
+	ErrAlreadyExists = errors.New("already exists")
+	// ErrConflict reports an optimistic concurrency or field ownership conflict.
+	ErrConflict = errors.New("conflict")
+	// ErrWebhookUnavailable reports that an admission webhook could not be called (typically not ready yet).
+	ErrWebhookUnavailable = errors.New("admission webhook unavailable")
+)
+
+// Error is a failed Kubernetes operation, classified by Reason when the failure matches one of the
+// sentinel errors of this package.
+type Error struct {
+	// Op describes the failed operation (e.g. "create ConfigMap/foo (ns)").
+	Op string
+	// Reason is one of ErrNotFound, ErrAlreadyExists, ErrConflict, ErrWebhookUnavailable or nil.
+	Reason error
+	// Err is the underlying error.
+	Err error
 }
 
-// Apply applies the given multi-document YAML to the cluster using kubectl apply -f -.
-func (c *Client) Apply(ctx context.Context, yaml []byte) error {
-	args := []string{"apply", "-f", "-"}
-	return c.runKubectl(ctx, yaml, args...)
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return e.Op + ": " + e.Err.Error()
 }
 
-// Delete deletes resources described by the given YAML using kubectl delete -f -.
-// When ignoreNotFound is true, NotFound errors are ignored via --ignore-not-found.
-func (c *Client) Delete(ctx context.Context, yaml []byte, ignoreNotFound bool) error {
-	args := []string{"delete", "-f", "-"}
-	if ignoreNotFound {
-		args = append(args, "--ignore-not-found")
+// Unwrap exposes both the classification and the underlying error to errors.Is/As.
+func (e *Error) Unwrap() []error {
+	if e.Reason == nil {
+		return []error{e.Err}
 	}
-	return c.runKubectl(ctx, yaml, args...)
+	return []error{e.Reason, e.Err}
 }
 
-const defaultWaitTimeout = "600s"
+// Applier creates, updates and deletes objects from manifest streams.
+type Applier interface {
+	// Apply creates or updates every object of the multi-document YAML stream. Server-side apply field
+	// ownership conflicts are returned as *ConflictError.
+	Apply(ctx context.Context, manifests []byte, opts ApplyOptions) error
+	// DryRunApply submits a single-object manifest with a server-side dry run and returns the object
+	// as the API server would persist it (with defaults applied).
+	DryRunApply(ctx context.Context, manifest []byte, opts ApplyOptions) (map[string]any, error)
+	// Delete deletes the objects of the multi-document YAML stream. When ignoreNotFound is false,
+	// missing objects fail with ErrNotFound.
+	Delete(ctx context.Context, manifests []byte, ignoreNotFound bool) error
+}
 
-// WaitForDeployments waits until all deployments in the given namespace are Available.
-func (c *Client) WaitForDeployments(ctx context.Context, namespace string, timeout string) error {
-	if timeout == "" {
-		timeout = defaultWaitTimeout
-	}
-	args := []string{"wait", "--for=condition=Available", "deployment", "--all", fmt.Sprintf("--timeout=%s", timeout)}
-	if namespace != "" {
-		args = append(args, "-n", namespace)
-	}
-	return c.runKubectl(ctx, nil, args...)
+// ApplyOptions selects how Apply and DryRunApply write objects.
+type ApplyOptions struct {
+	// ServerSide uses server-side apply with FieldManager instead of the client-side three-way merge
+	// based on the last-applied-configuration annotation.
+	ServerSide bool
+	// ForceConflicts takes over fields owned by other field managers (server-side apply only).
+	ForceConflicts bool
 }
 
-// Status prints a simple status view for deployments, services and pods in a namespace.
-func (c *Client) Status(ctx context.Context, namespace string, watch bool) error {
-	args := []string{"get", "deploy,svc,pods"}
-	if namespace != "" {
-		args = append(args, "-n", namespace)
-	}
-	if watch {
-		args = append(args, "-w")
-	}
-	return c.runKubectl(ctx, nil, args...)
+// ObjectClient reads and writes individual objects.
+type ObjectClient interface {
+	// GetObject returns the live object referenced by ref or nil when it does not exist.
+	// ref.APIVersion may be empty, in which case ref.Kind may be any resource name kubectl accepts.
+	GetObject(ctx context.Context, ref ObjectRef) (map[string]any, error)
+	// GetObjects returns objects of the given resource types ("plural" or "plural.group") in namespace
+	// that match the label selector.
+	GetObjects(ctx context.Context, namespace, selector string, resources []string) ([]map[string]any, error)
+	// ListNamespacedResources returns the names ("plural" or "plural.group") of namespaced resource
+	// types that support list and delete.
+	ListNamespacedResources(ctx context.Context) ([]string, error)
+	// Create creates a single object and fails with ErrAlreadyExists when it exists.
+	Create(ctx context.Context, obj map[string]any) error
+	// MergePatch applies a JSON merge patch to the object referenced by ref.
+	MergePatch(ctx context.Context, ref ObjectRef, patch []byte) error
+	// MergePatchStatus applies a JSON merge patch to the status subresource of the object referenced by ref.
+	MergePatchStatus(ctx context.Context, ref ObjectRef, patch []byte) error
+	// DeleteObject deletes the object referenced by ref; missing objects are ignored.
+	DeleteObject(ctx context.Context, ref ObjectRef) error
+	// EnsureNamespace creates the namespace when it is missing and reports whether it was created.
+	EnsureNamespace(ctx context.Context, name string) (bool, error)
 }
 
-// RunRaw executes kubectl with the provided arguments and optional stdin payload.
-// It is primarily intended for hook implementations.
-func (c *Client) RunRaw(ctx context.Context, stdin []byte, args ...string) error {
-	return c.runKubectl(ctx, stdin, args...)
+// Waiter blocks until objects reach a desired state.
+type Waiter interface {
+	// WaitForRollout tracks the Deployments, StatefulSets, DaemonSets and Jobs of a namespace until all
+	// are ready, printing per-workload progress. On failure or timeout it returns an error together with
+	// a report that carries pod states, last termination reasons, recent events and log tails.
+	WaitForRollout(ctx context.Context, req RolloutRequest) (*RolloutReport, error)
+	// WaitForWorkload waits until a single workload is ready: a finished rollout for Deployments,
+	// StatefulSets and DaemonSets and the Complete condition for Jobs.
+	WaitForWorkload(ctx context.Context, kind, name, namespace, timeout string) error
+	// WaitForCondition waits until status.conditions of the referenced object has the condition set to True.
+	WaitForCondition(ctx context.Context, ref ObjectRef, condition, timeout string) error
 }
 
-// RunAndCapture executes kubectl and returns stdout bytes (stderr streamed).
-func (c *Client) RunAndCapture(ctx context.Context, stdin []byte, args ...string) ([]byte, error) {
-	cmd := exec.CommandContext(ctx, "kubectl", args...)
-	cmd.Stderr = os.Stderr
+// PodRunner runs commands in pods and transfers data to and from them.
+type PodRunner interface {
+	// Exec runs a command in a container.
+	Exec(ctx context.Context, req ExecRequest) error
+	// Copy copies a local directory into a container.
+	Copy(ctx context.Context, req CopyRequest) error
+	// Logs streams container logs.
+	Logs(ctx context.Context, req LogsRequest) error
+	// PortForward forwards local ports to a pod until ctx is done or the connection is lost.
+	PortForward(ctx context.Context, req PortForwardRequest) error
+}
 
-	if stdin != nil {
-		cmd.Stdin = bytes.NewReader(stdin)
-	}
+// Orchestrator is the Kubernetes port used by codexctl commands.
+type Orchestrator interface {
+	Applier
+	ObjectClient
+	Waiter
+	PodRunner
+}
 
-	out, err := cmd.Output()
-	if err != nil {
-		return nil, fmt.Errorf("kubectl %v failed: %w", args, err)
+// ExecRequest describes a command executed in a container.
+type ExecRequest struct {
+	// Namespace is the pod namespace.
+	Namespace string
+	// Target is a pod name or "deploy/<name>" to pick a running pod of a Deployment.
+	Target string
+	// Container is the container name (empty selects the default container).
+	Container string
+	// Command is the command and its arguments.
+	Command []string
+	// Stdin is streamed to the command when set.
+	Stdin io.Reader
+	// Stdout receives command output (defaults to the orchestrator output).
+	Stdout io.Writer
+	// Stderr receives command errors (defaults to os.Stderr).
+	Stderr io.Writer
+}
+
+// CopyRequest describes copying a local directory into a container.
+type CopyRequest struct {
+	// Namespace is the pod namespace.
+	Namespace string
+	// Pod is the pod name.
+	Pod string
+	// Container is the container name (empty selects the default container).
+	Container string
+	// Source is the local directory whose contents are copied.
+	Source string
+	// Dest is the destination directory inside the container.
+	Dest string
+}
+
+// LogsRequest describes a container log stream.
+type LogsRequest struct {
+	// Namespace is the pod namespace.
+	Namespace string
+	// Target is a pod name or "deploy/<name>" to pick a running pod of a Deployment.
+	Target string
+	// Container is the container name (empty selects the default container).
+	Container string
+	// Follow keeps streaming new log lines.
+	Follow bool
+	// TailLines limits output to the last lines (0 means all).
+	TailLines int64
+	// Since limits output to lines newer than the duration (0 means all).
+	Since time.Duration
+	// Previous returns logs of the previous container instance.
+	Previous bool
+	// Out receives the log stream (defaults to the orchestrator output).
+	Out io.Writer
+}
+
+// Config selects and configures an Orchestrator implementation.
+type Config struct {
+	// Backend is BackendClientGo (default) or BackendKubectl.
+	Backend string
+	// Stdout receives progress output such as "deployment.apps/web configured" (defaults to os.Stdout).
+	Stdout io.Writer
+	// RequestTimeout bounds every single API request (zero means no limit).
+	RequestTimeout time.Duration
+	// Kubeconfig is a kubeconfig path or a list of paths separated by the OS path list separator
+	// (empty uses $KUBECONFIG and ~/.kube/config).
+	Kubeconfig string
+	// Context is the kubeconfig context to use (empty uses the current context).
+	Context string
+	// InCluster uses the pod service account instead of a kubeconfig.
+	InCluster bool
+}
+
+// New constructs the Orchestrator selected by cfg.Backend.
+func New(cfg Config) (Orchestrator, error) {
+	if cfg.InCluster && (cfg.Kubeconfig != "" || cfg.Context != "") {
+		return nil, fmt.Errorf("in-cluster configuration cannot be combined with a kubeconfig or context")
+	}
+	switch strings.TrimSpace(cfg.Backend) {
+	case "", BackendClientGo:
+		return NewAPIClient(cfg)
+	case BackendKubectl:
+		return NewKubectlClient(cfg), nil
+	default:
+		return nil, fmt.Errorf("unsupported kube backend %q (use %s or %s)", cfg.Backend, BackendClientGo, BackendKubectl)
 	}
-	return out, nil
 }
 
-// runKubectl executes kubectl and streams output.
-func (c *Client) runKubectl(ctx context.Context, stdin []byte, args ...string) error {
-	cmd := exec.CommandContext(ctx, "kubectl", args...)
-	if c.StdoutToStderr {
-		cmd.Stdout = os.Stderr
-	} else {
-		cmd.Stdout = os.Stdout
+// stdoutOrDefault returns w or os.Stdout when w is nil.
+func stdoutOrDefault(w io.Writer) io.Writer {
+	if w == nil {
+		return os.Stdout
 	}
-	var stderr bytes.Buffer
-	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	return w
+}
 
-	if stdin != nil {
-		cmd.Stdin = bytes.NewReader(stdin)
+// parseTimeout converts a kubectl-style timeout ("600s", "2m") into a duration.
+func parseTimeout(timeout string) (time.Duration, error) {
+	if strings.TrimSpace(timeout) == "" {
+		timeout = defaultWaitTimeout
+	}
+	d, err := time.ParseDuration(timeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout %q: %w", timeout, err)
 	}
+	return d, nil
+}
 
-	if err := cmd.Run(); err != nil {
-		if stderr.Len() > 0 {
-			return fmt.Errorf("kubectl %v failed: %w; stderr: %s", args, err, stderr.String())
-		}
-		return fmt.Errorf("kubectl %v failed: %w", args, err)
+// splitTarget splits "deploy/<name>" style targets into a resource prefix and a name.
+// Plain pod names return an empty prefix.
+func splitTarget(target string) (string, string) {
+	prefix, name, found := strings.Cut(target, "/")
+	if !found {
+		return "", target
 	}
-	return nil
+	return strings.ToLower(prefix), name
 }
@@ -0,0 +1,388 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KubectlClient implements Orchestrator by running kubectl subprocesses.
+type KubectlClient struct {
+	// stdout receives kubectl stdout for streaming commands.
+	stdout io.Writer
+	// requestTimeout is passed as --request-timeout when positive.
+	requestTimeout time.Duration
+	// kubeconfig overrides $KUBECONFIG for kubectl subprocesses when set.
+	kubeconfig string
+	// context is passed as --context when set.
+	context string
+}
+
+var _ Orchestrator = (*KubectlClient)(nil)
+
+// NewKubectlClient constructs a kubectl-backed orchestrator.
+func NewKubectlClient(cfg Config) *KubectlClient {
+	kubeconfig := cfg.Kubeconfig
+	if cfg.InCluster {
+		// An empty kubeconfig makes kubectl fall back to the pod service account.
+		kubeconfig = os.DevNull
+	}
+	return &KubectlClient{
+		stdout:         stdoutOrDefault(cfg.Stdout),
+		requestTimeout: cfg.RequestTimeout,
+		kubeconfig:     kubeconfig,
+		context:        cfg.Context,
+	}
+}
+
+// command builds a kubectl invocation with the client-wide flags prepended and the kubeconfig selected.
+func (c *KubectlClient) command(ctx context.Context, args ...string) *exec.Cmd {
+	var global []string
+	if c.context != "" {
+		global = append(global, "--context="+c.context)
+	}
+	if c.requestTimeout > 0 {
+		global = append(global, "--request-timeout="+c.requestTimeout.String())
+	}
+	cmd := exec.CommandContext(ctx, "kubectl", append(global, args...)...)
+	if c.kubeconfig != "" {
+		cmd.Env = append(os.Environ(), "KUBECONFIG="+c.kubeconfig)
+	}
+	return cmd
+}
+
+// Apply applies the given multi-document YAML to the cluster using kubectl apply -f -.
+func (c *KubectlClient) Apply(ctx context.Context, manifests []byte, opts ApplyOptions) error {
+	return c.runKubectl(ctx, manifests, applyArgs(opts, "-f", "-")...)
+}
+
+// DryRunApply submits a single-object manifest with kubectl apply --dry-run=server.
+func (c *KubectlClient) DryRunApply(ctx context.Context, manifest []byte, opts ApplyOptions) (map[string]any, error) {
+	out, err := c.runAndCapture(ctx, manifest, applyArgs(opts, "--dry-run=server", "-o", "json", "-f", "-")...)
+	if err != nil {
+		return nil, err
+	}
+	var obj map[string]any
+	if err := json.Unmarshal(out, &obj); err != nil {
+		return nil, fmt.Errorf("decode kubectl dry-run output: %w", err)
+	}
+	return obj, nil
+}
+
+// Delete deletes resources described by the given YAML using kubectl delete -f -.
+func (c *KubectlClient) Delete(ctx context.Context, manifests []byte, ignoreNotFound bool) error {
+	args := []string{"delete", "-f", "-"}
+	if ignoreNotFound {
+		args = append(args, "--ignore-not-found")
+	}
+	return c.runKubectl(ctx, manifests, args...)
+}
+
+// GetObject returns the live object referenced by ref or nil when it does not exist.
+func (c *KubectlClient) GetObject(ctx context.Context, ref ObjectRef) (map[string]any, error) {
+	args := []string{"get", kubectlResource(ref), "-o", "json", "--ignore-not-found"}
+	if ref.Namespace != "" {
+		args = append(args, "-n", ref.Namespace)
+	}
+	out, err := c.runAndCapture(ctx, nil, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil, nil
+	}
+	var obj map[string]any
+	if err := json.Unmarshal(out, &obj); err != nil {
+		return nil, fmt.Errorf("decode kubectl get output: %w", err)
+	}
+	return obj, nil
+}
+
+// GetObjects returns objects of the given resource types in namespace that match the label selector.
+func (c *KubectlClient) GetObjects(ctx context.Context, namespace, selector string, resources []string) ([]map[string]any, error) {
+	if len(resources) == 0 {
+		return nil, nil
+	}
+	args := []string{"get", strings.Join(resources, ","), "-o", "json", "--ignore-not-found"}
+	if namespace != "" {
+		args = append(args, "-n", namespace)
+	}
+	if selector != "" {
+		args = append(args, "-l", selector)
+	}
+	out, err := c.runAndCapture(ctx, nil, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil, nil
+	}
+	var list struct {
+		Items []map[string]any `json:"items"`
+	}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, fmt.Errorf("decode kubectl get output: %w", err)
+	}
+	return list.Items, nil
+}
+
+// ListNamespacedResources returns the names of namespaced resource types that support list and delete.
+func (c *KubectlClient) ListNamespacedResources(ctx context.Context) ([]string, error) {
+	out, err := c.runAndCapture(ctx, nil, "api-resources", "--verbs=list,delete", "--namespaced", "-o", "name")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// Create creates a single object using kubectl create -f -.
+func (c *KubectlClient) Create(ctx context.Context, obj map[string]any) error {
+	payload, err := json.Marshal(obj)
+	if err != nil {
+		return fmt.Errorf("encode %s: %w", ObjectRefOf(obj), err)
+	}
+	_, err = c.runAndCapture(ctx, payload, "create", "-f", "-")
+	return err
+}
+
+// MergePatch applies a JSON merge patch using kubectl patch --type merge.
+func (c *KubectlClient) MergePatch(ctx context.Context, ref ObjectRef, patch []byte) error {
+	args := []string{"patch", kubectlResource(ref), "--type", "merge", "-p", string(patch)}
+	if ref.Namespace != "" {
+		args = append(args, "-n", ref.Namespace)
+	}
+	_, err := c.runAndCapture(ctx, nil, args...)
+	return err
+}
+
+// MergePatchStatus applies a JSON merge patch to the status subresource using kubectl patch --subresource=status.
+func (c *KubectlClient) MergePatchStatus(ctx context.Context, ref ObjectRef, patch []byte) error {
+	args := []string{"patch", kubectlResource(ref), "--subresource=status", "--type", "merge", "-p", string(patch)}
+	if ref.Namespace != "" {
+		args = append(args, "-n", ref.Namespace)
+	}
+	_, err := c.runAndCapture(ctx, nil, args...)
+	return err
+}
+
+// DeleteObject deletes a single object using kubectl delete --ignore-not-found.
+func (c *KubectlClient) DeleteObject(ctx context.Context, ref ObjectRef) error {
+	args := []string{"delete", kubectlResource(ref), "--ignore-not-found"}
+	if ref.Namespace != "" {
+		args = append(args, "-n", ref.Namespace)
+	}
+	return c.runKubectl(ctx, nil, args...)
+}
+
+// EnsureNamespace creates the namespace with kubectl create ns when it is missing.
+func (c *KubectlClient) EnsureNamespace(ctx context.Context, name string) (bool, error) {
+	ns, err := c.GetObject(ctx, ObjectRef{APIVersion: "v1", Kind: "Namespace", Name: name})
+	if err != nil {
+		return false, err
+	}
+	if ns != nil {
+		return false, nil
+	}
+	if _, err := c.runAndCapture(ctx, nil, "create", "ns", name); err != nil {
+		if errors.Is(err, ErrAlreadyExists) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// WaitForRollout tracks the workloads of req.Namespace by polling kubectl get until all are ready.
+func (c *KubectlClient) WaitForRollout(ctx context.Context, req RolloutRequest) (*RolloutReport, error) {
+	return watchRollout(ctx, c, c.stdout, defaultPollInterval, req)
+}
+
+// WaitForWorkload waits with kubectl rollout status (or kubectl wait for Jobs).
+func (c *KubectlClient) WaitForWorkload(ctx context.Context, kind, name, namespace, timeout string) error {
+	if timeout == "" {
+		timeout = defaultWaitTimeout
+	}
+	resource := strings.ToLower(kind) + "/" + name
+	var args []string
+	if kind == "Job" {
+		args = []string{"wait", "--for=condition=complete", resource, fmt.Sprintf("--timeout=%s", timeout)}
+	} else {
+		args = []string{"rollout", "status", resource, fmt.Sprintf("--timeout=%s", timeout)}
+	}
+	if namespace != "" {
+		args = append(args, "-n", namespace)
+	}
+	return c.runKubectl(ctx, nil, args...)
+}
+
+// WaitForCondition waits with kubectl wait --for=condition=<condition>.
+func (c *KubectlClient) WaitForCondition(ctx context.Context, ref ObjectRef, condition, timeout string) error {
+	if timeout == "" {
+		timeout = defaultWaitTimeout
+	}
+	args := []string{
+		"wait",
+		fmt.Sprintf("--for=condition=%s", condition),
+		kubectlResource(ref),
+		fmt.Sprintf("--timeout=%s", timeout),
+	}
+	if ref.Namespace != "" {
+		args = append(args, "-n", ref.Namespace)
+	}
+	return c.runKubectl(ctx, nil, args...)
+}
+
+// Exec runs a command with kubectl exec.
+func (c *KubectlClient) Exec(ctx context.Context, req ExecRequest) error {
+	args := []string{"-n", req.Namespace, "exec"}
+	if req.Stdin != nil {
+		args = append(args, "-i")
+	}
+	args = append(args, req.Target)
+	if req.Container != "" {
+		args = append(args, "-c", req.Container)
+	}
+	args = append(args, "--")
+	args = append(args, req.Command...)
+
+	cmd := c.command(ctx, args...)
+	cmd.Stdin = req.Stdin
+	cmd.Stdout = req.Stdout
+	if cmd.Stdout == nil {
+		cmd.Stdout = c.stdout
+	}
+	cmd.Stderr = req.Stderr
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+	if err := cmd.Run(); err != nil {
+		return &Error{Op: fmt.Sprintf("kubectl %v", args), Err: err}
+	}
+	return nil
+}
+
+// Copy copies a local directory into a container with kubectl cp.
+func (c *KubectlClient) Copy(ctx context.Context, req CopyRequest) error {
+	src := filepath.Join(filepath.Clean(req.Source), ".")
+	dst := fmt.Sprintf("%s/%s:%s", req.Namespace, req.Pod, req.Dest)
+	args := []string{"cp", src, dst}
+	if req.Container != "" {
+		args = append(args, "-c", req.Container)
+	}
+	return c.runKubectl(ctx, nil, args...)
+}
+
+// Logs streams container logs with kubectl logs.
+func (c *KubectlClient) Logs(ctx context.Context, req LogsRequest) error {
+	args := []string{"-n", req.Namespace, "logs", req.Target}
+	if req.Container != "" {
+		args = append(args, "-c", req.Container)
+	}
+	if req.Follow {
+		args = append(args, "-f")
+	}
+	if req.TailLines > 0 {
+		args = append(args, "--tail="+strconv.FormatInt(req.TailLines, 10))
+	}
+	if req.Since > 0 {
+		args = append(args, "--since="+req.Since.String())
+	}
+	if req.Previous {
+		args = append(args, "--previous")
+	}
+
+	cmd := c.command(ctx, args...)
+	cmd.Stdout = req.Out
+	if cmd.Stdout == nil {
+		cmd.Stdout = c.stdout
+	}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return &Error{Op: fmt.Sprintf("kubectl %v", args), Err: err}
+	}
+	return nil
+}
+
+// runAndCapture executes kubectl and returns stdout bytes (stderr streamed and kept for errors).
+func (c *KubectlClient) runAndCapture(ctx context.Context, stdin []byte, args ...string) ([]byte, error) {
+	cmd := c.command(ctx, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, kubectlError(args, err, stderr.String())
+	}
+	return out, nil
+}
+
+// runKubectl executes kubectl and streams output.
+func (c *KubectlClient) runKubectl(ctx context.Context, stdin []byte, args ...string) error {
+	cmd := c.command(ctx, args...)
+	cmd.Stdout = c.stdout
+	var stderr bytes.Buffer
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+
+	if err := cmd.Run(); err != nil {
+		return kubectlError(args, err, stderr.String())
+	}
+	return nil
+}
+
+// kubectlError wraps a failed kubectl run and classifies it by the reason kubectl printed.
+func kubectlError(args []string, err error, stderr string) error {
+	kerr := &Error{Op: fmt.Sprintf("kubectl %v", args), Err: err}
+	if stderr != "" {
+		kerr.Err = fmt.Errorf("%w; stderr: %s", err, strings.TrimSpace(stderr))
+	}
+	switch {
+	case strings.Contains(stderr, "Apply failed with"):
+		return &ConflictError{Conflicts: parseConflictMessage(stderr), Err: kerr}
+	case strings.Contains(stderr, "(AlreadyExists)"):
+		kerr.Reason = ErrAlreadyExists
+	case strings.Contains(stderr, "(NotFound)"):
+		kerr.Reason = ErrNotFound
+	case strings.Contains(stderr, "(Conflict)"):
+		kerr.Reason = ErrConflict
+	case strings.Contains(stderr, "failed calling webhook"):
+		kerr.Reason = ErrWebhookUnavailable
+	}
+	return kerr
+}
+
+// applyArgs builds kubectl apply arguments for opts followed by extra.
+func applyArgs(opts ApplyOptions, extra ...string) []string {
+	args := []string{"apply"}
+	if opts.ServerSide {
+		args = append(args, "--server-side", "--field-manager="+FieldManager)
+		if opts.ForceConflicts {
+			args = append(args, "--force-conflicts")
+		}
+	}
+	return append(args, extra...)
+}
+
+// kubectlResource returns the resource argument kubectl understands for ref.
+func kubectlResource(ref ObjectRef) string {
+	if ref.APIVersion == "" {
+		return strings.ToLower(ref.Kind) + "/" + ref.Name
+	}
+	return ref.Resource()
+}
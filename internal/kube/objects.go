@@ -0,0 +1,85 @@
+package kube
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ObjectRef identifies a Kubernetes object.
+type ObjectRef struct {
+	// APIVersion is the object apiVersion (e.g. "apps/v1").
+	APIVersion string `json:"apiVersion"`
+	// Kind is the object kind.
+	Kind string `json:"kind"`
+	// Namespace is the object namespace (empty for cluster-scoped or unset).
+	Namespace string `json:"namespace,omitempty"`
+	// Name is the object name.
+	Name string `json:"name"`
+}
+
+// Group returns the API group of the object ("" for the core group).
+func (r ObjectRef) Group() string {
+	group, _, found := strings.Cut(r.APIVersion, "/")
+	if !found {
+		return ""
+	}
+	return group
+}
+
+// Key returns a version-independent identity usable as a map key.
+func (r ObjectRef) Key() string {
+	return r.Group() + "/" + r.Kind + "/" + r.Namespace + "/" + r.Name
+}
+
+// Resource returns the "kind.version.group/name" reference understood by kubectl.
+func (r ObjectRef) Resource() string {
+	kind := r.Kind
+	if group := r.Group(); group != "" {
+		_, version, _ := strings.Cut(r.APIVersion, "/")
+		kind = kind + "." + version + "." + group
+	}
+	return kind + "/" + r.Name
+}
+
+// String returns a human-readable "Kind/name (namespace)" form.
+func (r ObjectRef) String() string {
+	if r.Namespace == "" {
+		return r.Kind + "/" + r.Name
+	}
+	return fmt.Sprintf("%s/%s (%s)", r.Kind, r.Name, r.Namespace)
+}
+
+// ObjectRefOf extracts the identity of a decoded object.
+func ObjectRefOf(obj map[string]any) ObjectRef {
+	apiVersion, _ := obj["apiVersion"].(string)
+	kind, _ := obj["kind"].(string)
+	meta, _ := obj["metadata"].(map[string]any)
+	name, _ := meta["name"].(string)
+	namespace, _ := meta["namespace"].(string)
+	return ObjectRef{APIVersion: apiVersion, Kind: kind, Namespace: namespace, Name: name}
+}
+
+// DecodeDocuments decodes a multi-document YAML stream, skipping empty documents.
+func DecodeDocuments(manifests []byte) ([]map[string]any, error) {
+	var docs []map[string]any
+	dec := yaml.NewDecoder(bytes.NewReader(manifests))
+	for {
+		var doc map[string]any
+		if err := dec.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("decode manifests: %w", err)
+		}
+		if len(doc) == 0 {
+			continue
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
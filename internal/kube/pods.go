@@ -0,0 +1,239 @@
+package kube
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// Exec runs a command in a container through the pods/exec subresource.
+func (c *APIClient) Exec(ctx context.Context, req ExecRequest) error {
+	if c.restConfig == nil {
+		return fmt.Errorf("exec requires a REST config")
+	}
+	pod, err := c.resolvePod(ctx, req.Namespace, req.Target)
+	if err != nil {
+		return err
+	}
+
+	execReq := c.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(req.Namespace).
+		Name(pod).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: req.Container,
+			Command:   req.Command,
+			Stdin:     req.Stdin != nil,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	spdyExec, err := remotecommand.NewSPDYExecutor(c.restConfig, "POST", execReq.URL())
+	if err != nil {
+		return fmt.Errorf("create exec stream: %w", err)
+	}
+	wsExec, err := remotecommand.NewWebSocketExecutor(c.restConfig, "GET", execReq.URL().String())
+	if err != nil {
+		return fmt.Errorf("create exec stream: %w", err)
+	}
+	executor, err := remotecommand.NewFallbackExecutor(wsExec, spdyExec, func(err error) bool {
+		return httpstream.IsUpgradeFailure(err) || httpstream.IsHTTPSProxyError(err)
+	})
+	if err != nil {
+		return fmt.Errorf("create exec stream: %w", err)
+	}
+
+	stdout := req.Stdout
+	if stdout == nil {
+		stdout = c.stdout
+	}
+	stderr := req.Stderr
+	if stderr == nil {
+		stderr = os.Stderr
+	}
+	if err := executor.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdin:  req.Stdin,
+		Stdout: stdout,
+		Stderr: stderr,
+	}); err != nil {
+		return &Error{Op: fmt.Sprintf("exec %v in %s/%s", req.Command, req.Namespace, pod), Err: err}
+	}
+	return nil
+}
+
+// Copy streams req.Source as a tar archive into "tar -xmf - -C req.Dest" inside the container,
+// the same way kubectl cp does.
+func (c *APIClient) Copy(ctx context.Context, req CopyRequest) error {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeTar(pw, req.Source))
+	}()
+	err := c.Exec(ctx, ExecRequest{
+		Namespace: req.Namespace,
+		Target:    req.Pod,
+		Container: req.Container,
+		Command:   []string{"tar", "-xmf", "-", "-C", req.Dest},
+		Stdin:     pr,
+	})
+	_ = pr.Close()
+	if err != nil {
+		return fmt.Errorf("copy %s to %s/%s:%s: %w", req.Source, req.Namespace, req.Pod, req.Dest, err)
+	}
+	return nil
+}
+
+// Logs streams container logs through the pods/log subresource.
+func (c *APIClient) Logs(ctx context.Context, req LogsRequest) error {
+	pod, err := c.resolvePod(ctx, req.Namespace, req.Target)
+	if err != nil {
+		return err
+	}
+	opts := &corev1.PodLogOptions{
+		Container: req.Container,
+		Follow:    req.Follow,
+		Previous:  req.Previous,
+	}
+	if req.TailLines > 0 {
+		opts.TailLines = &req.TailLines
+	}
+	if req.Since > 0 {
+		seconds := int64(req.Since.Seconds())
+		if seconds < 1 {
+			seconds = 1
+		}
+		opts.SinceSeconds = &seconds
+	}
+
+	stream, err := c.clientset.CoreV1().Pods(req.Namespace).GetLogs(pod, opts).Stream(ctx)
+	if err != nil {
+		return apiError(fmt.Sprintf("logs of %s/%s", req.Namespace, pod), err)
+	}
+	defer stream.Close()
+
+	out := req.Out
+	if out == nil {
+		out = c.stdout
+	}
+	if _, err := io.Copy(out, stream); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("read logs of %s/%s: %w", req.Namespace, pod, err)
+	}
+	return nil
+}
+
+// resolvePod turns a pod name or a "deploy/<name>", "sts/<name>", "ds/<name>", "job/<name>" target into
+// the name of a running pod, preferring the newest one.
+func (c *APIClient) resolvePod(ctx context.Context, namespace, target string) (string, error) {
+	prefix, name := splitTarget(target)
+	var selector *metav1.LabelSelector
+	apps := c.clientset.AppsV1()
+	switch prefix {
+	case "", "pod", "pods", "po":
+		return name, nil
+	case "deploy", "deployment", "deployments":
+		d, err := apps.Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", apiError("get deployment "+name, err)
+		}
+		selector = d.Spec.Selector
+	case "sts", "statefulset", "statefulsets":
+		s, err := apps.StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", apiError("get statefulset "+name, err)
+		}
+		selector = s.Spec.Selector
+	case "ds", "daemonset", "daemonsets":
+		d, err := apps.DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", apiError("get daemonset "+name, err)
+		}
+		selector = d.Spec.Selector
+	case "job", "jobs":
+		j, err := c.clientset.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", apiError("get job "+name, err)
+		}
+		selector = j.Spec.Selector
+	default:
+		return "", fmt.Errorf("unsupported pod target %q", target)
+	}
+
+	sel, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return "", fmt.Errorf("parse selector of %s: %w", target, err)
+	}
+	if sel.Empty() {
+		sel = labels.Everything()
+	}
+	pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: sel.String()})
+	if err != nil {
+		return "", apiError("list pods of "+target, err)
+	}
+	items := pods.Items
+	sort.Slice(items, func(i, j int) bool {
+		return items[j].CreationTimestamp.Before(&items[i].CreationTimestamp)
+	})
+	for _, p := range items {
+		if p.Status.Phase == corev1.PodRunning && p.DeletionTimestamp == nil {
+			return p.Name, nil
+		}
+	}
+	if len(items) > 0 {
+		return items[0].Name, nil
+	}
+	return "", &Error{Op: "resolve pod for " + target, Reason: ErrNotFound, Err: fmt.Errorf("no pods found in %s", namespace)}
+}
+
+// writeTar writes the contents of dir (not dir itself) to w as a tar archive.
+func writeTar(w io.Writer, dir string) error {
+	tw := tar.NewWriter(w)
+	root := filepath.Clean(dir)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("archive %s: %w", dir, err)
+	}
+	return tw.Close()
+}
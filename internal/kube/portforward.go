@@ -0,0 +1,225 @@
+package kube
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// ErrPortForwardLost reports that an established port-forward lost its connection to the pod.
+var ErrPortForwardLost = errors.New("port-forward connection lost")
+
+// PortForwardRequest describes forwarding local ports to a pod.
+type PortForwardRequest struct {
+	// Namespace is the pod namespace.
+	Namespace string
+	// Pod is the pod name.
+	Pod string
+	// Ports are "local:remote" pairs; local ports are bound on 127.0.0.1.
+	Ports []string
+	// Ready is closed once the local ports listen (optional).
+	Ready chan struct{}
+}
+
+// ServiceState is a Service with the ports that can be forwarded.
+type ServiceState struct {
+	// Name is the Service name.
+	Name string
+	// Labels are the Service labels (used to map it to codexctl components).
+	Labels map[string]string
+	// Ports lists the TCP ports of the Service.
+	Ports []ServicePort
+}
+
+// ServicePort is a TCP port of a Service.
+type ServicePort struct {
+	// Name is the port name (may be empty for single-port Services).
+	Name string
+	// Port is the Service port.
+	Port int32
+}
+
+// ListServices returns the Services of namespace sorted by name; Services without a selector (e.g.
+// ExternalName) are skipped because there is no pod to forward to.
+func ListServices(ctx context.Context, client ObjectClient, namespace string) ([]ServiceState, error) {
+	items, err := client.GetObjects(ctx, namespace, "", []string{"services"})
+	if err != nil {
+		return nil, err
+	}
+	var out []ServiceState
+	for _, item := range items {
+		var svc corev1.Service
+		if err := fromUnstructured(item, &svc); err != nil {
+			return nil, fmt.Errorf("decode Service: %w", err)
+		}
+		if len(svc.Spec.Selector) == 0 {
+			continue
+		}
+		state := ServiceState{Name: svc.Name, Labels: svc.Labels}
+		for _, p := range svc.Spec.Ports {
+			if p.Protocol == "" || p.Protocol == corev1.ProtocolTCP {
+				state.Ports = append(state.Ports, ServicePort{Name: p.Name, Port: p.Port})
+			}
+		}
+		out = append(out, state)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// ServicePod returns the newest ready pod behind the Service and maps each Service port to the container
+// port it targets, resolving named target ports against the pod's containers.
+func ServicePod(ctx context.Context, client ObjectClient, namespace, name string) (string, map[int32]int32, error) {
+	items, err := client.GetObjects(ctx, namespace, "", []string{"services"})
+	if err != nil {
+		return "", nil, err
+	}
+	var svc *corev1.Service
+	for _, item := range items {
+		var s corev1.Service
+		if fromUnstructured(item, &s) == nil && s.Name == name {
+			svc = &s
+			break
+		}
+	}
+	if svc == nil {
+		return "", nil, &Error{Op: "get service " + name, Reason: ErrNotFound, Err: fmt.Errorf("service %s/%s not found", namespace, name)}
+	}
+
+	selector := labels.SelectorFromSet(svc.Spec.Selector).String()
+	podItems, err := client.GetObjects(ctx, namespace, selector, []string{"pods"})
+	if err != nil {
+		return "", nil, err
+	}
+	var pod *corev1.Pod
+	for _, item := range podItems {
+		var p corev1.Pod
+		if fromUnstructured(item, &p) != nil || p.DeletionTimestamp != nil || !podReady(&p) {
+			continue
+		}
+		if pod == nil || pod.CreationTimestamp.Before(&p.CreationTimestamp) {
+			pp := p
+			pod = &pp
+		}
+	}
+	if pod == nil {
+		return "", nil, &Error{Op: "resolve pod for service " + name, Reason: ErrNotFound, Err: fmt.Errorf("no ready pods in %s", namespace)}
+	}
+
+	targets := map[int32]int32{}
+	for _, p := range svc.Spec.Ports {
+		switch {
+		case p.TargetPort.StrVal != "":
+			for _, c := range pod.Spec.Containers {
+				for _, cp := range c.Ports {
+					if cp.Name == p.TargetPort.StrVal {
+						targets[p.Port] = cp.ContainerPort
+					}
+				}
+			}
+		case p.TargetPort.IntVal != 0:
+			targets[p.Port] = p.TargetPort.IntVal
+		default:
+			targets[p.Port] = p.Port
+		}
+	}
+	return pod.Name, targets, nil
+}
+
+// PortForward forwards local ports to a pod through the pods/portforward subresource. It blocks until ctx is
+// done (returning nil) or the connection to the pod is lost (returning ErrPortForwardLost).
+func (c *APIClient) PortForward(ctx context.Context, req PortForwardRequest) error {
+	if c.restConfig == nil {
+		return fmt.Errorf("port-forward requires a REST config")
+	}
+	url := c.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(req.Namespace).
+		Name(req.Pod).
+		SubResource("portforward").
+		URL()
+
+	transport, upgrader, err := spdy.RoundTripperFor(c.restConfig)
+	if err != nil {
+		return fmt.Errorf("create port-forward transport: %w", err)
+	}
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, url)
+	wsDialer, err := portforward.NewSPDYOverWebsocketDialer(url, c.restConfig)
+	if err != nil {
+		return fmt.Errorf("create port-forward transport: %w", err)
+	}
+	fallback := portforward.NewFallbackDialer(wsDialer, dialer, func(err error) bool {
+		return httpstream.IsUpgradeFailure(err) || httpstream.IsHTTPSProxyError(err)
+	})
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			close(stop)
+		case <-done:
+		}
+	}()
+	ready := req.Ready
+	if ready == nil {
+		ready = make(chan struct{})
+	}
+	fw, err := portforward.NewOnAddresses(fallback, []string{"127.0.0.1"}, req.Ports, stop, ready, io.Discard, io.Discard)
+	if err != nil {
+		return fmt.Errorf("port-forward to %s/%s: %w", req.Namespace, req.Pod, err)
+	}
+	if err := fw.ForwardPorts(); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return &Error{Op: fmt.Sprintf("port-forward to %s/%s", req.Namespace, req.Pod), Reason: ErrPortForwardLost, Err: err}
+	}
+	if ctx.Err() == nil {
+		return &Error{Op: fmt.Sprintf("port-forward to %s/%s", req.Namespace, req.Pod), Reason: ErrPortForwardLost, Err: io.EOF}
+	}
+	return nil
+}
+
+// PortForward runs "kubectl port-forward" until ctx is done (returning nil) or kubectl exits (returning
+// ErrPortForwardLost). Ready is closed when kubectl reports the first forwarded port.
+func (c *KubectlClient) PortForward(ctx context.Context, req PortForwardRequest) error {
+	args := append([]string{"-n", req.Namespace, "port-forward", "--address=127.0.0.1", "pod/" + req.Pod}, req.Ports...)
+	cmd := c.command(ctx, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("kubectl port-forward: %w", err)
+	}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("kubectl port-forward: %w", err)
+	}
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		if req.Ready != nil && strings.HasPrefix(scanner.Text(), "Forwarding from") {
+			close(req.Ready)
+			req.Ready = nil
+		}
+	}
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err == nil {
+		err = io.EOF
+	}
+	return &Error{Op: fmt.Sprintf("kubectl %v", args), Reason: ErrPortForwardLost, Err: err}
+}
@@ -0,0 +1,492 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// defaultLogTailLines is how many log lines are collected per failing container.
+	defaultLogTailLines = 20
+	// maxDiagnosedPods caps the number of pods diagnosed per workload.
+	maxDiagnosedPods = 3
+	// maxWorkloadEvents caps the number of events reported per workload.
+	maxWorkloadEvents = 10
+	// diagnosticsTimeout bounds collecting pods, events and logs of failing workloads.
+	diagnosticsTimeout = time.Minute
+)
+
+// workloadResources lists the resource types tracked by WaitForRollout.
+var workloadResources = []string{"deployments.apps", "statefulsets.apps", "daemonsets.apps", "jobs.batch"}
+
+// RolloutRequest selects the workloads WaitForRollout tracks.
+type RolloutRequest struct {
+	// Namespace whose Deployments, StatefulSets, DaemonSets and Jobs are tracked.
+	Namespace string
+	// Timeout is a Go duration (defaults to 600s).
+	Timeout string
+	// LogTailLines is the number of log lines collected per failing container (defaults to 20).
+	LogTailLines int64
+}
+
+// RolloutReport is the outcome of WaitForRollout.
+type RolloutReport struct {
+	// Namespace is the tracked namespace.
+	Namespace string `json:"namespace"`
+	// Ready reports whether every workload finished its rollout.
+	Ready bool `json:"ready"`
+	// TimedOut reports whether the wait ended because of the timeout.
+	TimedOut bool `json:"timedOut,omitempty"`
+	// Duration is how long the wait took.
+	Duration string `json:"duration"`
+	// Workloads lists every tracked workload; failing ones carry diagnostics.
+	Workloads []WorkloadStatus `json:"workloads"`
+}
+
+// Failing returns the workloads that did not become ready.
+func (r *RolloutReport) Failing() []WorkloadStatus {
+	var out []WorkloadStatus
+	for _, w := range r.Workloads {
+		if !w.Ready {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// WorkloadStatus is the rollout state of a single workload.
+type WorkloadStatus struct {
+	// Kind is Deployment, StatefulSet, DaemonSet or Job.
+	Kind string `json:"kind"`
+	// Name is the workload name.
+	Name string `json:"name"`
+	// Ready reports whether the rollout finished (or the Job completed).
+	Ready bool `json:"ready"`
+	// Failed reports a terminal failure such as an exceeded progress deadline or a failed Job.
+	Failed bool `json:"failed,omitempty"`
+	// Message describes the pending state or the failure.
+	Message string `json:"message,omitempty"`
+	// Pods holds diagnostics of unhealthy pods of a workload that did not become ready.
+	Pods []PodDiagnostics `json:"pods,omitempty"`
+	// Events holds recent events of the workload and its pods, oldest first.
+	Events []string `json:"events,omitempty"`
+}
+
+// String returns the workload in kubectl notation (e.g. "deployment.apps/web").
+func (w WorkloadStatus) String() string {
+	group := ".apps"
+	if w.Kind == "Job" {
+		group = ".batch"
+	}
+	return strings.ToLower(w.Kind) + group + "/" + w.Name
+}
+
+// PodDiagnostics describes an unhealthy pod.
+type PodDiagnostics struct {
+	// Name is the pod name.
+	Name string `json:"name"`
+	// Phase is the pod phase.
+	Phase string `json:"phase"`
+	// Reason explains why the pod is not running, e.g. an Unschedulable condition message.
+	Reason string `json:"reason,omitempty"`
+	// Containers lists unhealthy init and regular containers.
+	Containers []ContainerDiagnostics `json:"containers,omitempty"`
+}
+
+// ContainerDiagnostics describes an unhealthy container.
+type ContainerDiagnostics struct {
+	// Name is the container name.
+	Name string `json:"name"`
+	// Ready reports container readiness.
+	Ready bool `json:"ready"`
+	// RestartCount is the number of restarts.
+	RestartCount int32 `json:"restartCount"`
+	// State is the current state, e.g. "waiting: CrashLoopBackOff".
+	State string `json:"state,omitempty"`
+	// LastTermination describes the previous termination, e.g. "Error (exit code 1)".
+	LastTermination string `json:"lastTermination,omitempty"`
+	// Logs is a tail of the container logs (of the previous instance after a restart).
+	Logs string `json:"logs,omitempty"`
+}
+
+// rolloutSource is what the rollout watcher needs from a backend.
+type rolloutSource interface {
+	GetObjects(ctx context.Context, namespace, selector string, resources []string) ([]map[string]any, error)
+	Logs(ctx context.Context, req LogsRequest) error
+}
+
+// trackedWorkload is a workload with its evaluated rollout state and pod selector.
+type trackedWorkload struct {
+	status   WorkloadStatus
+	selector *metav1.LabelSelector
+}
+
+// watchRollout polls the workloads of req.Namespace until all are ready, one fails or the timeout expires,
+// printing a line to out whenever the state of a workload changes. Failing workloads are diagnosed.
+func watchRollout(ctx context.Context, src rolloutSource, out io.Writer, interval time.Duration, req RolloutRequest) (*RolloutReport, error) {
+	if strings.TrimSpace(req.Namespace) == "" {
+		return nil, fmt.Errorf("rollout tracking requires a namespace")
+	}
+	timeout, err := parseTimeout(req.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	started := time.Now()
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	report := &RolloutReport{Namespace: req.Namespace}
+	printed := map[string]string{}
+	var workloads []trackedWorkload
+	for {
+		current, err := listWorkloads(waitCtx, src, req.Namespace)
+		if err != nil {
+			if waitCtx.Err() == nil {
+				return nil, err
+			}
+			report.TimedOut = true
+			break
+		}
+		workloads = current
+		for _, w := range workloads {
+			line := w.status.Message
+			if w.status.Ready {
+				line = "ready"
+			}
+			if printed[w.status.String()] != line {
+				printed[w.status.String()] = line
+				fmt.Fprintf(out, "%s: %s\n", w.status, line)
+			}
+		}
+		if rolloutFinished(workloads) {
+			break
+		}
+		select {
+		case <-waitCtx.Done():
+			report.TimedOut = true
+		case <-time.After(interval):
+			continue
+		}
+		break
+	}
+
+	// Diagnostics use the parent context so they still run after the wait timed out.
+	diagCtx, cancelDiag := context.WithTimeout(ctx, diagnosticsTimeout)
+	defer cancelDiag()
+	logTail := req.LogTailLines
+	if logTail <= 0 {
+		logTail = defaultLogTailLines
+	}
+	var events []corev1.Event
+	for _, w := range workloads {
+		if !w.status.Ready && events == nil {
+			events = listEvents(diagCtx, src, req.Namespace)
+		}
+		if !w.status.Ready {
+			w.status.Pods = diagnosePods(diagCtx, src, req.Namespace, w.selector, logTail)
+			w.status.Events = workloadEvents(events, w.status.Name)
+		}
+		report.Workloads = append(report.Workloads, w.status)
+	}
+	report.Duration = time.Since(started).Round(time.Second).String()
+
+	failing := report.Failing()
+	report.Ready = len(failing) == 0 && !report.TimedOut
+	if report.Ready {
+		return report, nil
+	}
+	parts := make([]string, 0, len(failing))
+	for _, w := range failing {
+		parts = append(parts, fmt.Sprintf("%s: %s", w, w.Message))
+	}
+	if report.TimedOut {
+		return report, fmt.Errorf("timed out after %s waiting for rollout in %s: %s", timeout, req.Namespace, strings.Join(parts, "; "))
+	}
+	return report, fmt.Errorf("rollout in %s failed: %s", req.Namespace, strings.Join(parts, "; "))
+}
+
+// rolloutFinished reports whether every workload is ready or any of them failed terminally.
+func rolloutFinished(workloads []trackedWorkload) bool {
+	ready := true
+	for _, w := range workloads {
+		if w.status.Failed {
+			return true
+		}
+		ready = ready && w.status.Ready
+	}
+	return ready
+}
+
+// listWorkloads lists and evaluates the tracked workloads of namespace, sorted by kind and name.
+// Jobs owned by CronJobs are skipped: their history does not describe the current rollout.
+func listWorkloads(ctx context.Context, src rolloutSource, namespace string) ([]trackedWorkload, error) {
+	items, err := src.GetObjects(ctx, namespace, "", workloadResources)
+	if err != nil {
+		return nil, err
+	}
+	var out []trackedWorkload
+	for _, item := range items {
+		kind, _ := item["kind"].(string)
+		var (
+			w   trackedWorkload
+			err error
+		)
+		switch kind {
+		case "Deployment":
+			var d appsv1.Deployment
+			if err = fromUnstructured(item, &d); err == nil {
+				w.selector = d.Spec.Selector
+				w.status = WorkloadStatus{Kind: kind, Name: d.Name}
+				var rolloutErr error
+				w.status.Ready, w.status.Message, rolloutErr = deploymentRolloutStatus(&d)
+				if rolloutErr != nil {
+					w.status.Failed, w.status.Message = true, rolloutErr.Error()
+				}
+			}
+		case "StatefulSet":
+			var s appsv1.StatefulSet
+			if err = fromUnstructured(item, &s); err == nil {
+				w.selector = s.Spec.Selector
+				w.status = WorkloadStatus{Kind: kind, Name: s.Name}
+				w.status.Ready, w.status.Message = statefulSetRolloutStatus(&s)
+			}
+		case "DaemonSet":
+			var d appsv1.DaemonSet
+			if err = fromUnstructured(item, &d); err == nil {
+				w.selector = d.Spec.Selector
+				w.status = WorkloadStatus{Kind: kind, Name: d.Name}
+				w.status.Ready, w.status.Message = daemonSetRolloutStatus(&d)
+			}
+		case "Job":
+			var j batchv1.Job
+			if err = fromUnstructured(item, &j); err != nil {
+				break
+			}
+			if ownedByCronJob(j.OwnerReferences) {
+				continue
+			}
+			w.selector = j.Spec.Selector
+			w.status = WorkloadStatus{Kind: kind, Name: j.Name}
+			if j.Spec.Suspend != nil && *j.Spec.Suspend {
+				w.status.Ready = true
+				break
+			}
+			var jobErr error
+			w.status.Ready, w.status.Message, jobErr = jobStatus(&j)
+			if jobErr != nil {
+				w.status.Failed, w.status.Message = true, jobErr.Error()
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decode %s: %w", kind, err)
+		}
+		out = append(out, w)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].status.Kind != out[j].status.Kind {
+			return out[i].status.Kind < out[j].status.Kind
+		}
+		return out[i].status.Name < out[j].status.Name
+	})
+	return out, nil
+}
+
+// diagnosePods describes up to maxDiagnosedPods unhealthy pods matched by selector, newest first.
+func diagnosePods(ctx context.Context, src rolloutSource, namespace string, selector *metav1.LabelSelector, logTail int64) []PodDiagnostics {
+	sel, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil || sel.Empty() {
+		return nil
+	}
+	items, err := src.GetObjects(ctx, namespace, sel.String(), []string{"pods"})
+	if err != nil {
+		return nil
+	}
+	pods := make([]corev1.Pod, 0, len(items))
+	for _, item := range items {
+		var pod corev1.Pod
+		if fromUnstructured(item, &pod) == nil {
+			pods = append(pods, pod)
+		}
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[j].CreationTimestamp.Before(&pods[i].CreationTimestamp)
+	})
+
+	var out []PodDiagnostics
+	for _, pod := range pods {
+		if len(out) == maxDiagnosedPods {
+			break
+		}
+		statuses := append(append([]corev1.ContainerStatus(nil), pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+		diag := PodDiagnostics{Name: pod.Name, Phase: string(pod.Status.Phase), Reason: podReason(&pod)}
+		for _, cs := range statuses {
+			if cs.Ready && cs.RestartCount == 0 {
+				continue
+			}
+			if cs.State.Terminated != nil && cs.State.Terminated.ExitCode == 0 {
+				continue // completed init container
+			}
+			diag.Containers = append(diag.Containers, diagnoseContainer(ctx, src, namespace, pod.Name, cs, logTail))
+		}
+		if podReady(&pod) && len(diag.Containers) == 0 {
+			continue
+		}
+		out = append(out, diag)
+	}
+	return out
+}
+
+// diagnoseContainer describes the state of a container and collects a tail of its logs when it ran.
+func diagnoseContainer(ctx context.Context, src rolloutSource, namespace, pod string, cs corev1.ContainerStatus, logTail int64) ContainerDiagnostics {
+	diag := ContainerDiagnostics{Name: cs.Name, Ready: cs.Ready, RestartCount: cs.RestartCount}
+	switch {
+	case cs.State.Waiting != nil:
+		diag.State = joinNonEmpty(": ", "waiting", cs.State.Waiting.Reason, cs.State.Waiting.Message)
+	case cs.State.Terminated != nil:
+		diag.State = "terminated: " + describeTermination(cs.State.Terminated)
+	case cs.State.Running != nil:
+		diag.State = "running"
+	}
+	last := cs.LastTerminationState.Terminated
+	if last != nil {
+		diag.LastTermination = describeTermination(last)
+	}
+	if last == nil && cs.State.Running == nil && cs.State.Terminated == nil {
+		return diag // never started, there are no logs
+	}
+	var buf bytes.Buffer
+	err := src.Logs(ctx, LogsRequest{
+		Namespace: namespace,
+		Target:    pod,
+		Container: cs.Name,
+		TailLines: logTail,
+		Previous:  last != nil && cs.State.Terminated == nil,
+		Out:       &buf,
+	})
+	if err == nil {
+		diag.Logs = strings.TrimRight(buf.String(), "\n")
+	}
+	return diag
+}
+
+// listEvents returns the events of namespace; failures yield no events.
+func listEvents(ctx context.Context, src rolloutSource, namespace string) []corev1.Event {
+	items, err := src.GetObjects(ctx, namespace, "", []string{"events"})
+	if err != nil {
+		return []corev1.Event{}
+	}
+	events := make([]corev1.Event, 0, len(items))
+	for _, item := range items {
+		var ev corev1.Event
+		if fromUnstructured(item, &ev) == nil {
+			events = append(events, ev)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return eventTime(&events[i]).Before(eventTime(&events[j]))
+	})
+	return events
+}
+
+// workloadEvents formats the latest events about the workload and the objects it owns (ReplicaSets, pods),
+// which are recognised by the "<name>-" prefix.
+func workloadEvents(events []corev1.Event, name string) []string {
+	var out []string
+	for _, ev := range events {
+		involved := ev.InvolvedObject.Name
+		if involved != name && !strings.HasPrefix(involved, name+"-") {
+			continue
+		}
+		line := fmt.Sprintf("%s %s %s/%s: %s", ev.Type, ev.Reason, strings.ToLower(ev.InvolvedObject.Kind), involved, strings.TrimSpace(ev.Message))
+		if ev.Count > 1 {
+			line += fmt.Sprintf(" (x%d)", ev.Count)
+		}
+		out = append(out, line)
+	}
+	if len(out) > maxWorkloadEvents {
+		out = out[len(out)-maxWorkloadEvents:]
+	}
+	return out
+}
+
+// eventTime returns the most recent timestamp of ev.
+func eventTime(ev *corev1.Event) time.Time {
+	switch {
+	case !ev.LastTimestamp.IsZero():
+		return ev.LastTimestamp.Time
+	case !ev.EventTime.IsZero():
+		return ev.EventTime.Time
+	}
+	return ev.FirstTimestamp.Time
+}
+
+// podReason explains why a pod is not running: its status reason or a failed condition such as Unschedulable.
+func podReason(pod *corev1.Pod) string {
+	if pod.Status.Reason != "" {
+		return joinNonEmpty(": ", pod.Status.Reason, pod.Status.Message)
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodScheduled && cond.Status == corev1.ConditionFalse {
+			return joinNonEmpty(": ", cond.Reason, cond.Message)
+		}
+	}
+	return ""
+}
+
+// podReady reports whether the Ready condition of pod is True.
+func podReady(pod *corev1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// describeTermination formats a container termination, e.g. "OOMKilled (exit code 137)".
+func describeTermination(t *corev1.ContainerStateTerminated) string {
+	desc := fmt.Sprintf("%s (exit code %d)", t.Reason, t.ExitCode)
+	if msg := strings.TrimSpace(t.Message); msg != "" {
+		desc += ": " + msg
+	}
+	return strings.TrimSpace(desc)
+}
+
+// ownedByCronJob reports whether refs contain a CronJob controller.
+func ownedByCronJob(refs []metav1.OwnerReference) bool {
+	for _, ref := range refs {
+		if ref.Kind == "CronJob" {
+			return true
+		}
+	}
+	return false
+}
+
+// fromUnstructured converts a decoded object into a typed API object.
+func fromUnstructured(obj map[string]any, into any) error {
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(obj, into)
+}
+
+// joinNonEmpty joins the non-empty parts with sep.
+func joinNonEmpty(sep string, parts ...string) string {
+	var out []string
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return strings.Join(out, sep)
+}
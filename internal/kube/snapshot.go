@@ -0,0 +1,620 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// snapshotAPIGroup is the API group of the CSI snapshot resources.
+	snapshotAPIGroup = "snapshot.storage.k8s.io"
+	// snapshotAPIVersion is the served version of the CSI snapshot resources.
+	snapshotAPIVersion = snapshotAPIGroup + "/v1"
+	// SnapshotLabel labels the VolumeSnapshots (and copied VolumeSnapshotContents) with the codexctl snapshot name.
+	SnapshotLabel = "codexctl.io/snapshot"
+	// snapshotCopyLabel labels the VolumeSnapshotContents pre-provisioned for snapshot copies with the
+	// namespace of the copy, so that they can be removed with it.
+	snapshotCopyLabel = "codexctl.io/namespace"
+	// restoreReplicasAnnotation keeps the replicas of a workload scaled down for a restore, so that an
+	// interrupted restore can be re-run without losing them.
+	restoreReplicasAnnotation = "codexctl.io/restore-replicas"
+	// snapshotPollInterval is how often snapshot and restore waits re-check object state.
+	snapshotPollInterval = 2 * time.Second
+	// maxObjectNameLength is the length limit of DNS subdomain object names.
+	maxObjectNameLength = 253
+)
+
+// SnapshotVolume is a PersistentVolumeClaim captured by a VolumeSnapshot, with the claim settings needed to
+// recreate it from the snapshot.
+type SnapshotVolume struct {
+	// PVC is the PersistentVolumeClaim name.
+	PVC string `json:"pvc" yaml:"pvc"`
+	// VolumeSnapshot is the VolumeSnapshot name.
+	VolumeSnapshot string `json:"volumeSnapshot" yaml:"volumeSnapshot"`
+	// StorageClass is the storage class of the claim.
+	StorageClass string `json:"storageClass,omitempty" yaml:"storageClass,omitempty"`
+	// AccessModes are the access modes of the claim.
+	AccessModes []string `json:"accessModes,omitempty" yaml:"accessModes,omitempty"`
+	// VolumeMode is the volume mode of the claim (Filesystem or Block).
+	VolumeMode string `json:"volumeMode,omitempty" yaml:"volumeMode,omitempty"`
+	// Size is the requested storage of the claim.
+	Size string `json:"size" yaml:"size"`
+	// RestoreSize is the minimum size of a volume restored from the snapshot, as reported by the driver.
+	RestoreSize string `json:"restoreSize,omitempty" yaml:"restoreSize,omitempty"`
+	// Labels are the claim labels, set on claims recreated from the snapshot.
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+}
+
+// SnapshotRequest describes taking VolumeSnapshots of the claims of a namespace.
+type SnapshotRequest struct {
+	// Namespace holds the claims.
+	Namespace string
+	// Name is the codexctl snapshot name; VolumeSnapshots are named <name>-<pvc>.
+	Name string
+	// Class is the VolumeSnapshotClass (empty uses the default class of the driver).
+	Class string
+	// Timeout bounds the wait for the snapshots to become ready to use (e.g. "10m").
+	Timeout string
+}
+
+// RestoreRequest describes replacing claims of a namespace with volumes restored from VolumeSnapshots.
+type RestoreRequest struct {
+	// SourceNamespace holds the VolumeSnapshots. When it differs from Namespace, the snapshots are copied
+	// into Namespace through pre-provisioned VolumeSnapshotContents.
+	SourceNamespace string
+	// Namespace holds the claims to restore.
+	Namespace string
+	// Name is the codexctl snapshot name.
+	Name string
+	// Volumes are the claims to restore.
+	Volumes []SnapshotVolume
+	// Timeout bounds each wait: snapshot readiness, pod termination and claim deletion (e.g. "10m").
+	Timeout string
+}
+
+// RestoreResult is the outcome of RestoreVolumeSnapshots.
+type RestoreResult struct {
+	// Workloads are the workloads scaled down around the restore and scaled back up.
+	Workloads []ScaledWorkload `json:"workloads,omitempty" yaml:"workloads,omitempty"`
+	// Replaced are the claims that existed and were replaced.
+	Replaced []string `json:"replaced,omitempty" yaml:"replaced,omitempty"`
+	// Created are the claims that did not exist and were created from the snapshot.
+	Created []string `json:"created,omitempty" yaml:"created,omitempty"`
+}
+
+// ScaledWorkload is a workload scaled down around a restore.
+type ScaledWorkload struct {
+	// Kind is Deployment or StatefulSet.
+	Kind string `json:"kind" yaml:"kind"`
+	// Name is the workload name.
+	Name string `json:"name" yaml:"name"`
+	// Replicas is the replica count restored after the restore.
+	Replicas int32 `json:"replicas" yaml:"replicas"`
+}
+
+// CreateVolumeSnapshots takes a VolumeSnapshot of every bound claim of req.Namespace and waits until all
+// of them are ready to use. Claims that are not bound yet hold no data and are skipped.
+func CreateVolumeSnapshots(ctx context.Context, client ObjectClient, req SnapshotRequest) ([]SnapshotVolume, error) {
+	pvcs, err := listClaims(ctx, client, req.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	var volumes []SnapshotVolume
+	for _, pvc := range pvcs {
+		if pvc.Status.Phase != corev1.ClaimBound {
+			continue
+		}
+		vol := snapshotVolume(pvc, objectName(req.Name, pvc.Name))
+		spec := map[string]any{
+			"source": map[string]any{"persistentVolumeClaimName": pvc.Name},
+		}
+		if req.Class != "" {
+			spec["volumeSnapshotClassName"] = req.Class
+		}
+		err := client.Create(ctx, map[string]any{
+			"apiVersion": snapshotAPIVersion,
+			"kind":       "VolumeSnapshot",
+			"metadata": map[string]any{
+				"name":      vol.VolumeSnapshot,
+				"namespace": req.Namespace,
+				"labels":    map[string]any{SnapshotLabel: req.Name},
+			},
+			"spec": spec,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("create volume snapshot of pvc %s: %w", pvc.Name, err)
+		}
+		volumes = append(volumes, vol)
+	}
+	if len(volumes) == 0 {
+		return nil, fmt.Errorf("namespace %s has no bound persistent volume claims", req.Namespace)
+	}
+	for i := range volumes {
+		size, err := waitSnapshotReady(ctx, client, req.Namespace, volumes[i].VolumeSnapshot, req.Timeout)
+		if err != nil {
+			return volumes, err
+		}
+		volumes[i].RestoreSize = size
+	}
+	return volumes, nil
+}
+
+// DeleteVolumeSnapshots deletes the VolumeSnapshots of volumes in namespace; missing ones are ignored.
+func DeleteVolumeSnapshots(ctx context.Context, client ObjectClient, namespace string, volumes []SnapshotVolume) error {
+	for _, vol := range volumes {
+		ref := ObjectRef{APIVersion: snapshotAPIVersion, Kind: "VolumeSnapshot", Namespace: namespace, Name: vol.VolumeSnapshot}
+		if err := client.DeleteObject(ctx, ref); err != nil {
+			return fmt.Errorf("delete volume snapshot %s: %w", vol.VolumeSnapshot, err)
+		}
+	}
+	return nil
+}
+
+// DeleteSnapshotCopies deletes the VolumeSnapshotContents pre-provisioned for snapshot copies into namespace.
+// They use the Retain policy and outlive the namespace, while the snapshot data stays with the source.
+func DeleteSnapshotCopies(ctx context.Context, client ObjectClient, namespace string) error {
+	items, err := client.GetObjects(ctx, "", snapshotCopyLabel+"="+namespace, []string{"volumesnapshotcontents." + snapshotAPIGroup})
+	if err != nil {
+		return fmt.Errorf("list volume snapshot contents: %w", err)
+	}
+	for _, item := range items {
+		name, _, _ := unstructured.NestedString(item, "metadata", "name")
+		ref := ObjectRef{APIVersion: snapshotAPIVersion, Kind: "VolumeSnapshotContent", Name: name}
+		if err := client.DeleteObject(ctx, ref); err != nil {
+			return fmt.Errorf("delete volume snapshot content %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// RestoreVolumeSnapshots replaces the claims of req.Volumes in req.Namespace with volumes restored from their
+// snapshots. The Deployments and StatefulSets mounting the claims are scaled to zero first and back to their
+// replicas afterwards; claims that do not exist yet (a fresh namespace) are simply created. When the restore
+// fails after a claim was deleted, the workloads stay scaled down and the restore can be re-run: the workloads
+// are looked up by every claim of req.Volumes, deleted or not, and by the replicas annotation left by the
+// interrupted run, so that the re-run scales them back up.
+func RestoreVolumeSnapshots(ctx context.Context, client ObjectClient, req RestoreRequest) (RestoreResult, error) {
+	var res RestoreResult
+	if len(req.Volumes) == 0 {
+		return res, fmt.Errorf("snapshot %s has no volumes", req.Name)
+	}
+	for _, vol := range req.Volumes {
+		if req.SourceNamespace != "" && req.SourceNamespace != req.Namespace {
+			if err := copyVolumeSnapshot(ctx, client, req.SourceNamespace, req.Namespace, req.Name, vol.VolumeSnapshot); err != nil {
+				return res, err
+			}
+		}
+		if _, err := waitSnapshotReady(ctx, client, req.Namespace, vol.VolumeSnapshot, req.Timeout); err != nil {
+			return res, err
+		}
+	}
+
+	pvcs, err := listClaims(ctx, client, req.Namespace)
+	if err != nil {
+		return res, err
+	}
+	existing := map[string]corev1.PersistentVolumeClaim{}
+	for _, pvc := range pvcs {
+		existing[pvc.Name] = pvc
+	}
+	// Claims deleted by an interrupted restore are included, so that their workloads are scaled back up.
+	claims := map[string]struct{}{}
+	for _, vol := range req.Volumes {
+		claims[vol.PVC] = struct{}{}
+	}
+
+	res.Workloads, err = claimWorkloads(ctx, client, req.Namespace, claims)
+	if err != nil {
+		return res, err
+	}
+	if err := scaleDown(ctx, client, req.Namespace, restoreReplicasAnnotation, res.Workloads); err != nil {
+		return res, errors.Join(err, scaleUp(ctx, client, req.Namespace, restoreReplicasAnnotation, res.Workloads))
+	}
+	if err := waitClaimsUnused(ctx, client, req.Namespace, claims, req.Timeout); err != nil {
+		return res, errors.Join(err, scaleUp(ctx, client, req.Namespace, restoreReplicasAnnotation, res.Workloads))
+	}
+
+	for _, vol := range req.Volumes {
+		pvc, ok := existing[vol.PVC]
+		if ok {
+			if err := deleteClaim(ctx, client, req.Namespace, vol.PVC, req.Timeout); err != nil {
+				return res, fmt.Errorf("%w (workloads stay scaled down; re-run the restore)", err)
+			}
+			if len(pvc.Labels) > 0 {
+				vol.Labels = pvc.Labels
+			}
+		}
+		if err := createClaimFromSnapshot(ctx, client, req.Namespace, vol); err != nil {
+			return res, fmt.Errorf("%w (workloads stay scaled down; re-run the restore)", err)
+		}
+		if ok {
+			res.Replaced = append(res.Replaced, vol.PVC)
+		} else {
+			res.Created = append(res.Created, vol.PVC)
+		}
+	}
+	return res, scaleUp(ctx, client, req.Namespace, restoreReplicasAnnotation, res.Workloads)
+}
+
+// listClaims returns the PersistentVolumeClaims of namespace sorted by name.
+func listClaims(ctx context.Context, client ObjectClient, namespace string) ([]corev1.PersistentVolumeClaim, error) {
+	items, err := client.GetObjects(ctx, namespace, "", []string{"persistentvolumeclaims"})
+	if err != nil {
+		return nil, fmt.Errorf("list persistent volume claims: %w", err)
+	}
+	pvcs := make([]corev1.PersistentVolumeClaim, 0, len(items))
+	for _, item := range items {
+		var pvc corev1.PersistentVolumeClaim
+		if err := fromUnstructured(item, &pvc); err != nil {
+			return nil, fmt.Errorf("decode persistent volume claim: %w", err)
+		}
+		pvcs = append(pvcs, pvc)
+	}
+	sort.Slice(pvcs, func(i, j int) bool { return pvcs[i].Name < pvcs[j].Name })
+	return pvcs, nil
+}
+
+// snapshotVolume describes pvc as captured by the VolumeSnapshot named snapshot.
+func snapshotVolume(pvc corev1.PersistentVolumeClaim, snapshot string) SnapshotVolume {
+	vol := SnapshotVolume{PVC: pvc.Name, VolumeSnapshot: snapshot, Labels: pvc.Labels}
+	if pvc.Spec.StorageClassName != nil {
+		vol.StorageClass = *pvc.Spec.StorageClassName
+	}
+	for _, mode := range pvc.Spec.AccessModes {
+		vol.AccessModes = append(vol.AccessModes, string(mode))
+	}
+	if pvc.Spec.VolumeMode != nil {
+		vol.VolumeMode = string(*pvc.Spec.VolumeMode)
+	}
+	if size, ok := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; ok {
+		vol.Size = size.String()
+	}
+	return vol
+}
+
+// waitSnapshotReady waits until the VolumeSnapshot is ready to use and returns its restore size.
+func waitSnapshotReady(ctx context.Context, client ObjectClient, namespace, name, timeout string) (string, error) {
+	ref := ObjectRef{APIVersion: snapshotAPIVersion, Kind: "VolumeSnapshot", Namespace: namespace, Name: name}
+	var size string
+	err := pollUntil(ctx, snapshotPollInterval, timeout, "volumesnapshot/"+name, func(ctx context.Context) (bool, string, error) {
+		obj, err := client.GetObject(ctx, ref)
+		if err != nil {
+			return false, "", err
+		}
+		if obj == nil {
+			return false, "", fmt.Errorf("volume snapshot %s/%s not found", namespace, name)
+		}
+		if msg, found, _ := unstructured.NestedString(obj, "status", "error", "message"); found && msg != "" {
+			return false, "", fmt.Errorf("volume snapshot %s/%s failed: %s", namespace, name, msg)
+		}
+		ready, _, _ := unstructured.NestedBool(obj, "status", "readyToUse")
+		if !ready {
+			return false, "not ready to use", nil
+		}
+		size, _, _ = unstructured.NestedString(obj, "status", "restoreSize")
+		return true, "", nil
+	})
+	return size, err
+}
+
+// copyVolumeSnapshot makes the VolumeSnapshot name of srcNamespace available in namespace: a
+// VolumeSnapshotContent with the Retain policy is pre-provisioned from the snapshot handle of the source
+// content and bound to a new VolumeSnapshot of the same name. An existing copy is reused.
+func copyVolumeSnapshot(ctx context.Context, client ObjectClient, srcNamespace, namespace, snapshot, name string) error {
+	ref := ObjectRef{APIVersion: snapshotAPIVersion, Kind: "VolumeSnapshot", Namespace: namespace, Name: name}
+	current, err := client.GetObject(ctx, ref)
+	if err != nil {
+		return fmt.Errorf("get volume snapshot %s/%s: %w", namespace, name, err)
+	}
+	if current != nil {
+		return nil
+	}
+
+	srcRef := ref
+	srcRef.Namespace = srcNamespace
+	src, err := client.GetObject(ctx, srcRef)
+	if err != nil {
+		return fmt.Errorf("get volume snapshot %s/%s: %w", srcNamespace, name, err)
+	}
+	if src == nil {
+		return fmt.Errorf("volume snapshot %s/%s not found", srcNamespace, name)
+	}
+	contentName, _, _ := unstructured.NestedString(src, "status", "boundVolumeSnapshotContentName")
+	if contentName == "" {
+		return fmt.Errorf("volume snapshot %s/%s is not bound to a content yet", srcNamespace, name)
+	}
+	content, err := client.GetObject(ctx, ObjectRef{APIVersion: snapshotAPIVersion, Kind: "VolumeSnapshotContent", Name: contentName})
+	if err != nil {
+		return fmt.Errorf("get volume snapshot content %s: %w", contentName, err)
+	}
+	if content == nil {
+		return fmt.Errorf("volume snapshot content %s not found", contentName)
+	}
+	handle, _, _ := unstructured.NestedString(content, "status", "snapshotHandle")
+	if handle == "" {
+		return fmt.Errorf("volume snapshot content %s has no snapshot handle yet", contentName)
+	}
+	driver, _, _ := unstructured.NestedString(content, "spec", "driver")
+	class, _, _ := unstructured.NestedString(content, "spec", "volumeSnapshotClassName")
+	sourceMode, _, _ := unstructured.NestedString(content, "spec", "sourceVolumeMode")
+
+	copyName := objectName(namespace, name)
+	labels := map[string]any{SnapshotLabel: snapshot}
+	contentSpec := map[string]any{
+		// Retain keeps the snapshot data when the copy is deleted with the slot namespace; the data is
+		// owned by the source snapshot.
+		"deletionPolicy":    "Retain",
+		"driver":            driver,
+		"source":            map[string]any{"snapshotHandle": handle},
+		"volumeSnapshotRef": map[string]any{"name": name, "namespace": namespace},
+	}
+	if class != "" {
+		contentSpec["volumeSnapshotClassName"] = class
+	}
+	if sourceMode != "" {
+		contentSpec["sourceVolumeMode"] = sourceMode
+	}
+	err = client.Create(ctx, map[string]any{
+		"apiVersion": snapshotAPIVersion,
+		"kind":       "VolumeSnapshotContent",
+		"metadata":   map[string]any{"name": copyName, "labels": map[string]any{SnapshotLabel: snapshot, snapshotCopyLabel: namespace}},
+		"spec":       contentSpec,
+	})
+	if err != nil && !errors.Is(err, ErrAlreadyExists) {
+		return fmt.Errorf("create volume snapshot content %s: %w", copyName, err)
+	}
+
+	spec := map[string]any{"source": map[string]any{"volumeSnapshotContentName": copyName}}
+	if class != "" {
+		spec["volumeSnapshotClassName"] = class
+	}
+	err = client.Create(ctx, map[string]any{
+		"apiVersion": snapshotAPIVersion,
+		"kind":       "VolumeSnapshot",
+		"metadata":   map[string]any{"name": name, "namespace": namespace, "labels": labels},
+		"spec":       spec,
+	})
+	if err != nil && !errors.Is(err, ErrAlreadyExists) {
+		return fmt.Errorf("create volume snapshot %s/%s: %w", namespace, name, err)
+	}
+	return nil
+}
+
+// claimWorkloads returns the Deployments and StatefulSets of namespace whose pods mount one of claims, through
+// a pod template volume or a StatefulSet volume claim template, and those still scaled down by an interrupted
+// restore (carrying restoreReplicasAnnotation). DaemonSets mounting a claim cannot be scaled down and fail the
+// lookup.
+func claimWorkloads(ctx context.Context, client ObjectClient, namespace string, claims map[string]struct{}) ([]ScaledWorkload, error) {
+	items, err := client.GetObjects(ctx, namespace, "", []string{"deployments.apps", "statefulsets.apps", "daemonsets.apps"})
+	if err != nil {
+		return nil, fmt.Errorf("list workloads: %w", err)
+	}
+	var workloads []ScaledWorkload
+	for _, item := range items {
+		kind, _ := item["kind"].(string)
+		switch kind {
+		case "Deployment":
+			var d appsv1.Deployment
+			if err := fromUnstructured(item, &d); err != nil {
+				return nil, fmt.Errorf("decode deployment: %w", err)
+			}
+			if templateMountsClaim(d.Spec.Template.Spec, claims) || restoreInterrupted(d.Annotations) {
+				workloads = append(workloads, ScaledWorkload{Kind: kind, Name: d.Name, Replicas: restoreReplicas(d.Annotations, d.Spec.Replicas)})
+			}
+		case "StatefulSet":
+			var s appsv1.StatefulSet
+			if err := fromUnstructured(item, &s); err != nil {
+				return nil, fmt.Errorf("decode statefulset: %w", err)
+			}
+			if templateMountsClaim(s.Spec.Template.Spec, claims) || statefulSetOwnsClaim(&s, claims) || restoreInterrupted(s.Annotations) {
+				workloads = append(workloads, ScaledWorkload{Kind: kind, Name: s.Name, Replicas: restoreReplicas(s.Annotations, s.Spec.Replicas)})
+			}
+		case "DaemonSet":
+			var d appsv1.DaemonSet
+			if err := fromUnstructured(item, &d); err != nil {
+				return nil, fmt.Errorf("decode daemonset: %w", err)
+			}
+			if templateMountsClaim(d.Spec.Template.Spec, claims) {
+				return nil, fmt.Errorf("daemonset %s mounts a restored claim and cannot be scaled down", d.Name)
+			}
+		}
+	}
+	sort.Slice(workloads, func(i, j int) bool {
+		if workloads[i].Kind != workloads[j].Kind {
+			return workloads[i].Kind < workloads[j].Kind
+		}
+		return workloads[i].Name < workloads[j].Name
+	})
+	return workloads, nil
+}
+
+// templateMountsClaim reports whether the pod spec mounts one of claims.
+func templateMountsClaim(spec corev1.PodSpec, claims map[string]struct{}) bool {
+	for _, v := range spec.Volumes {
+		if v.PersistentVolumeClaim == nil {
+			continue
+		}
+		if _, ok := claims[v.PersistentVolumeClaim.ClaimName]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// statefulSetOwnsClaim reports whether one of claims was created from a volume claim template of s, i.e. is
+// named <template>-<statefulset>-<ordinal>.
+func statefulSetOwnsClaim(s *appsv1.StatefulSet, claims map[string]struct{}) bool {
+	for _, tmpl := range s.Spec.VolumeClaimTemplates {
+		prefix := tmpl.Name + "-" + s.Name + "-"
+		for claim := range claims {
+			ordinal, ok := strings.CutPrefix(claim, prefix)
+			if !ok {
+				continue
+			}
+			if _, err := strconv.Atoi(ordinal); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// restoreInterrupted reports whether a workload was scaled down by a restore that did not finish.
+func restoreInterrupted(annotations map[string]string) bool {
+	_, ok := annotations[restoreReplicasAnnotation]
+	return ok
+}
+
+// restoreReplicas returns the replicas to scale back to: the value recorded by an interrupted restore, or
+// the current replicas.
+func restoreReplicas(annotations map[string]string, replicas *int32) int32 {
+	if v, ok := annotations[restoreReplicasAnnotation]; ok {
+		if n, err := strconv.ParseInt(v, 10, 32); err == nil {
+			return int32(n)
+		}
+	}
+	return replicasOrOne(replicas)
+}
+
+// scaleDown scales workloads to zero, recording their replicas in the annotation key.
+func scaleDown(ctx context.Context, client ObjectClient, namespace, key string, workloads []ScaledWorkload) error {
+	for _, w := range workloads {
+		patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}},"spec":{"replicas":0}}`, key, strconv.Itoa(int(w.Replicas)))
+		ref := ObjectRef{APIVersion: "apps/v1", Kind: w.Kind, Namespace: namespace, Name: w.Name}
+		if err := client.MergePatch(ctx, ref, []byte(patch)); err != nil {
+			return fmt.Errorf("scale down %s/%s: %w", strings.ToLower(w.Kind), w.Name, err)
+		}
+	}
+	return nil
+}
+
+// scaleUp restores the replicas of workloads and drops the annotation key recorded by scaleDown.
+func scaleUp(ctx context.Context, client ObjectClient, namespace, key string, workloads []ScaledWorkload) error {
+	var errs []error
+	for _, w := range workloads {
+		patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:null}},"spec":{"replicas":%d}}`, key, w.Replicas)
+		ref := ObjectRef{APIVersion: "apps/v1", Kind: w.Kind, Namespace: namespace, Name: w.Name}
+		if err := client.MergePatch(ctx, ref, []byte(patch)); err != nil {
+			errs = append(errs, fmt.Errorf("scale up %s/%s: %w", strings.ToLower(w.Kind), w.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// waitClaimsUnused waits until no pod of namespace mounts one of claims.
+func waitClaimsUnused(ctx context.Context, client ObjectClient, namespace string, claims map[string]struct{}, timeout string) error {
+	return pollUntil(ctx, snapshotPollInterval, timeout, "pods to release the claims", func(ctx context.Context) (bool, string, error) {
+		items, err := client.GetObjects(ctx, namespace, "", []string{"pods"})
+		if err != nil {
+			return false, "", fmt.Errorf("list pods: %w", err)
+		}
+		var using []string
+		for _, item := range items {
+			var pod corev1.Pod
+			if err := fromUnstructured(item, &pod); err != nil {
+				return false, "", fmt.Errorf("decode pod: %w", err)
+			}
+			if templateMountsClaim(pod.Spec, claims) {
+				using = append(using, pod.Name)
+			}
+		}
+		if len(using) > 0 {
+			sort.Strings(using)
+			return false, "still mounted by " + strings.Join(using, ", "), nil
+		}
+		return true, "", nil
+	})
+}
+
+// deleteClaim deletes the claim and waits until it is gone.
+func deleteClaim(ctx context.Context, client ObjectClient, namespace, name, timeout string) error {
+	ref := ObjectRef{APIVersion: "v1", Kind: "PersistentVolumeClaim", Namespace: namespace, Name: name}
+	if err := client.DeleteObject(ctx, ref); err != nil {
+		return fmt.Errorf("delete pvc %s: %w", name, err)
+	}
+	return pollUntil(ctx, snapshotPollInterval, timeout, "persistentvolumeclaim/"+name+" deletion", func(ctx context.Context) (bool, string, error) {
+		obj, err := client.GetObject(ctx, ref)
+		if err != nil {
+			return false, "", err
+		}
+		return obj == nil, "still terminating", nil
+	})
+}
+
+// createClaimFromSnapshot creates the claim of vol with the VolumeSnapshot as its data source. The requested
+// size is raised to the restore size of the snapshot when it is smaller.
+func createClaimFromSnapshot(ctx context.Context, client ObjectClient, namespace string, vol SnapshotVolume) error {
+	size, err := claimSize(vol)
+	if err != nil {
+		return err
+	}
+	apiGroup := snapshotAPIGroup
+	pvc := corev1.PersistentVolumeClaim{}
+	pvc.Name, pvc.Namespace, pvc.Labels = vol.PVC, namespace, vol.Labels
+	for _, mode := range vol.AccessModes {
+		pvc.Spec.AccessModes = append(pvc.Spec.AccessModes, corev1.PersistentVolumeAccessMode(mode))
+	}
+	if vol.StorageClass != "" {
+		class := vol.StorageClass
+		pvc.Spec.StorageClassName = &class
+	}
+	if vol.VolumeMode != "" {
+		mode := corev1.PersistentVolumeMode(vol.VolumeMode)
+		pvc.Spec.VolumeMode = &mode
+	}
+	pvc.Spec.Resources.Requests = corev1.ResourceList{corev1.ResourceStorage: size}
+	pvc.Spec.DataSource = &corev1.TypedLocalObjectReference{APIGroup: &apiGroup, Kind: "VolumeSnapshot", Name: vol.VolumeSnapshot}
+
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&pvc)
+	if err != nil {
+		return fmt.Errorf("encode pvc %s: %w", vol.PVC, err)
+	}
+	obj["apiVersion"], obj["kind"] = "v1", "PersistentVolumeClaim"
+	delete(obj, "status")
+	if err := client.Create(ctx, obj); err != nil {
+		return fmt.Errorf("create pvc %s from snapshot %s: %w", vol.PVC, vol.VolumeSnapshot, err)
+	}
+	return nil
+}
+
+// claimSize returns the storage request of a claim restored from vol: the larger of its size and the
+// restore size of the snapshot.
+func claimSize(vol SnapshotVolume) (resource.Quantity, error) {
+	var size resource.Quantity
+	for _, v := range []string{vol.Size, vol.RestoreSize} {
+		if strings.TrimSpace(v) == "" {
+			continue
+		}
+		q, err := resource.ParseQuantity(v)
+		if err != nil {
+			return size, fmt.Errorf("invalid size %q of pvc %s: %w", v, vol.PVC, err)
+		}
+		if q.Cmp(size) > 0 {
+			size = q
+		}
+	}
+	if size.IsZero() {
+		return size, fmt.Errorf("pvc %s has no recorded size", vol.PVC)
+	}
+	return size, nil
+}
+
+// objectName joins parts with "-" and trims the result to the object name length limit.
+func objectName(parts ...string) string {
+	name := strings.Join(parts, "-")
+	if len(name) > maxObjectNameLength {
+		name = strings.TrimRight(name[:maxObjectNameLength], "-.")
+	}
+	return name
+}
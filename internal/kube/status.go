@@ -0,0 +1,349 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// NamespaceStatus is a point-in-time view of the workloads and ingresses of a namespace.
+type NamespaceStatus struct {
+	// Namespace is the inspected namespace.
+	Namespace string `json:"namespace"`
+	// Exists reports whether the namespace exists; the other fields are empty when it does not.
+	Exists bool `json:"exists"`
+	// Workloads lists Deployments, StatefulSets, DaemonSets and Jobs sorted by kind and name.
+	Workloads []WorkloadState `json:"workloads,omitempty"`
+	// Ingresses lists the ingresses sorted by name.
+	Ingresses []IngressState `json:"ingresses,omitempty"`
+}
+
+// WorkloadState is the observed state of a single workload.
+type WorkloadState struct {
+	// Kind is Deployment, StatefulSet, DaemonSet or Job.
+	Kind string `json:"kind"`
+	// Name is the workload name.
+	Name string `json:"name"`
+	// Labels are the workload labels (used to map it to codexctl components).
+	Labels map[string]string `json:"labels,omitempty"`
+	// Ready reports whether the rollout finished (or the Job completed).
+	Ready bool `json:"ready"`
+	// Message describes the pending state or the failure.
+	Message string `json:"message,omitempty"`
+	// ReadyReplicas is the number of ready pods (succeeded pods for Jobs).
+	ReadyReplicas int32 `json:"readyReplicas"`
+	// Replicas is the desired number of pods (completions for Jobs).
+	Replicas int32 `json:"replicas"`
+	// Images lists the container images of the pod template, init containers first.
+	Images []ContainerImage `json:"images,omitempty"`
+	// Pods lists the pods matched by the workload selector, newest first.
+	Pods []PodState `json:"pods,omitempty"`
+}
+
+// ContainerImage is the image of a pod template container.
+type ContainerImage struct {
+	// Container is the container name.
+	Container string `json:"container"`
+	// Image is the image reference.
+	Image string `json:"image"`
+	// Init reports an init container.
+	Init bool `json:"init,omitempty"`
+}
+
+// PodState is the observed state of a pod.
+type PodState struct {
+	// Name is the pod name.
+	Name string `json:"name"`
+	// Phase is the pod phase.
+	Phase string `json:"phase"`
+	// Ready reports the Ready condition.
+	Ready bool `json:"ready"`
+	// Restarts is the sum of container restarts.
+	Restarts int32 `json:"restarts"`
+	// Reason explains why the pod is not ready, e.g. "CrashLoopBackOff" or an Unschedulable message.
+	Reason string `json:"reason,omitempty"`
+}
+
+// IngressState lists the URLs served by an ingress.
+type IngressState struct {
+	// Name is the ingress name.
+	Name string `json:"name"`
+	// Labels are the ingress labels.
+	Labels map[string]string `json:"labels,omitempty"`
+	// URLs are the rule URLs, https when the host is covered by a TLS entry.
+	URLs []string `json:"urls,omitempty"`
+	// Routes are the rule paths with their backend Services.
+	Routes []IngressRoute `json:"routes,omitempty"`
+}
+
+// IngressRoute is an ingress rule path routed to a Service port.
+type IngressRoute struct {
+	// Host is the rule host.
+	Host string `json:"host"`
+	// Path is the rule path ("/" when the rule has none).
+	Path string `json:"path"`
+	// Service is the backend Service name.
+	Service string `json:"service"`
+	// Port is the backend Service port number.
+	Port int32 `json:"port,omitempty"`
+	// PortName is the backend Service port name when the backend refers to the port by name.
+	PortName string `json:"portName,omitempty"`
+}
+
+// statusResources lists the resource types read by GetNamespaceStatus.
+var statusResources = append(append([]string(nil), workloadResources...), "ingresses.networking.k8s.io")
+
+// GetNamespaceStatus reads the workloads, their pods and the ingresses of namespace. Jobs owned by
+// CronJobs are skipped like in WaitForRollout.
+func GetNamespaceStatus(ctx context.Context, client ObjectClient, namespace string) (*NamespaceStatus, error) {
+	status := &NamespaceStatus{Namespace: namespace}
+	ns, err := client.GetObject(ctx, ObjectRef{APIVersion: "v1", Kind: "Namespace", Name: namespace})
+	if err != nil {
+		return nil, err
+	}
+	if ns == nil {
+		return status, nil
+	}
+	status.Exists = true
+
+	items, err := client.GetObjects(ctx, namespace, "", statusResources)
+	if err != nil {
+		return nil, err
+	}
+	podItems, err := client.GetObjects(ctx, namespace, "", []string{"pods"})
+	if err != nil {
+		return nil, err
+	}
+	pods := make([]corev1.Pod, 0, len(podItems))
+	for _, item := range podItems {
+		var pod corev1.Pod
+		if fromUnstructured(item, &pod) == nil {
+			pods = append(pods, pod)
+		}
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[j].CreationTimestamp.Before(&pods[i].CreationTimestamp)
+	})
+
+	for _, item := range items {
+		kind, _ := item["kind"].(string)
+		if kind == "Ingress" {
+			ing, err := ingressState(item)
+			if err != nil {
+				return nil, err
+			}
+			status.Ingresses = append(status.Ingresses, ing)
+			continue
+		}
+		w, selector, ok, err := workloadState(item)
+		if err != nil {
+			return nil, fmt.Errorf("decode %s: %w", kind, err)
+		}
+		if !ok {
+			continue
+		}
+		w.Pods = podStates(pods, selector)
+		status.Workloads = append(status.Workloads, w)
+	}
+	sort.Slice(status.Workloads, func(i, j int) bool {
+		a, b := status.Workloads[i], status.Workloads[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Name < b.Name
+	})
+	sort.Slice(status.Ingresses, func(i, j int) bool {
+		return status.Ingresses[i].Name < status.Ingresses[j].Name
+	})
+	return status, nil
+}
+
+// GetWorkloadState reads a single workload and evaluates it with the rollout status rules; pods are not
+// listed. It returns nil when the workload does not exist.
+func GetWorkloadState(ctx context.Context, client ObjectClient, kind, namespace, name string) (*WorkloadState, error) {
+	ref := ObjectRef{APIVersion: workloadAPIVersion(kind), Kind: kind, Namespace: namespace, Name: name}
+	item, err := client.GetObject(ctx, ref)
+	if err != nil || item == nil {
+		return nil, err
+	}
+	w, _, ok, err := workloadState(item)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s %s: %w", kind, name, err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("unsupported workload kind %q", kind)
+	}
+	return &w, nil
+}
+
+// workloadAPIVersion returns the API version of a workload kind.
+func workloadAPIVersion(kind string) string {
+	if kind == "Job" {
+		return "batch/v1"
+	}
+	return "apps/v1"
+}
+
+// workloadState decodes a workload object and evaluates it with the rollout status rules. It reports
+// false for CronJob-owned Jobs and unsupported kinds.
+func workloadState(item map[string]any) (WorkloadState, *metav1.LabelSelector, bool, error) {
+	kind, _ := item["kind"].(string)
+	w := WorkloadState{Kind: kind}
+	var (
+		selector *metav1.LabelSelector
+		template corev1.PodTemplateSpec
+	)
+	switch kind {
+	case "Deployment":
+		var d appsv1.Deployment
+		if err := fromUnstructured(item, &d); err != nil {
+			return w, nil, false, err
+		}
+		w.Name, w.Labels, selector, template = d.Name, d.Labels, d.Spec.Selector, d.Spec.Template
+		w.Replicas, w.ReadyReplicas = replicasOrOne(d.Spec.Replicas), d.Status.ReadyReplicas
+		var err error
+		w.Ready, w.Message, err = deploymentRolloutStatus(&d)
+		if err != nil {
+			w.Message = err.Error()
+		}
+	case "StatefulSet":
+		var s appsv1.StatefulSet
+		if err := fromUnstructured(item, &s); err != nil {
+			return w, nil, false, err
+		}
+		w.Name, w.Labels, selector, template = s.Name, s.Labels, s.Spec.Selector, s.Spec.Template
+		w.Replicas, w.ReadyReplicas = replicasOrOne(s.Spec.Replicas), s.Status.ReadyReplicas
+		w.Ready, w.Message = statefulSetRolloutStatus(&s)
+	case "DaemonSet":
+		var d appsv1.DaemonSet
+		if err := fromUnstructured(item, &d); err != nil {
+			return w, nil, false, err
+		}
+		w.Name, w.Labels, selector, template = d.Name, d.Labels, d.Spec.Selector, d.Spec.Template
+		w.Replicas, w.ReadyReplicas = d.Status.DesiredNumberScheduled, d.Status.NumberReady
+		w.Ready, w.Message = daemonSetRolloutStatus(&d)
+	case "Job":
+		var j batchv1.Job
+		if err := fromUnstructured(item, &j); err != nil {
+			return w, nil, false, err
+		}
+		if ownedByCronJob(j.OwnerReferences) {
+			return w, nil, false, nil
+		}
+		w.Name, w.Labels, selector, template = j.Name, j.Labels, j.Spec.Selector, j.Spec.Template
+		w.Replicas, w.ReadyReplicas = replicasOrOne(j.Spec.Completions), j.Status.Succeeded
+		var err error
+		w.Ready, w.Message, err = jobStatus(&j)
+		if err != nil {
+			w.Message = err.Error()
+		}
+	default:
+		return w, nil, false, nil
+	}
+	for _, c := range template.Spec.InitContainers {
+		w.Images = append(w.Images, ContainerImage{Container: c.Name, Image: c.Image, Init: true})
+	}
+	for _, c := range template.Spec.Containers {
+		w.Images = append(w.Images, ContainerImage{Container: c.Name, Image: c.Image})
+	}
+	return w, selector, true, nil
+}
+
+// replicasOrOne returns *n or 1 when n is nil, which is the API default for replicas and completions.
+func replicasOrOne(n *int32) int32 {
+	if n == nil {
+		return 1
+	}
+	return *n
+}
+
+// podStates returns the pods matched by selector; an empty or invalid selector matches nothing.
+func podStates(pods []corev1.Pod, selector *metav1.LabelSelector) []PodState {
+	sel, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil || sel.Empty() {
+		return nil
+	}
+	var out []PodState
+	for i := range pods {
+		pod := &pods[i]
+		if !sel.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+		ps := PodState{Name: pod.Name, Phase: string(pod.Status.Phase), Ready: podReady(pod), Reason: podReason(pod)}
+		for _, cs := range pod.Status.ContainerStatuses {
+			ps.Restarts += cs.RestartCount
+			if ps.Reason == "" && cs.State.Waiting != nil {
+				ps.Reason = cs.State.Waiting.Reason
+			}
+		}
+		out = append(out, ps)
+	}
+	return out
+}
+
+// ListIngresses returns the ingresses of namespace sorted by name.
+func ListIngresses(ctx context.Context, client ObjectClient, namespace string) ([]IngressState, error) {
+	items, err := client.GetObjects(ctx, namespace, "", []string{"ingresses.networking.k8s.io"})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]IngressState, 0, len(items))
+	for _, item := range items {
+		ing, err := ingressState(item)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ing)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// ingressState decodes an ingress into its URLs (one per host and path) and routes.
+func ingressState(item map[string]any) (IngressState, error) {
+	var ing networkingv1.Ingress
+	if err := fromUnstructured(item, &ing); err != nil {
+		return IngressState{}, fmt.Errorf("decode Ingress: %w", err)
+	}
+	state := IngressState{Name: ing.Name, Labels: ing.Labels}
+	tlsHosts := map[string]bool{}
+	for _, tls := range ing.Spec.TLS {
+		for _, h := range tls.Hosts {
+			tlsHosts[h] = true
+		}
+	}
+	for _, rule := range ing.Spec.Rules {
+		scheme := "http://"
+		if tlsHosts[rule.Host] {
+			scheme = "https://"
+		}
+		paths := []networkingv1.HTTPIngressPath{{Path: "/"}}
+		if rule.HTTP != nil && len(rule.HTTP.Paths) > 0 {
+			paths = rule.HTTP.Paths
+		}
+		for _, p := range paths {
+			path := "/" + strings.TrimPrefix(p.Path, "/")
+			if rule.Host != "" {
+				state.URLs = append(state.URLs, scheme+rule.Host+path)
+			}
+			if svc := p.Backend.Service; svc != nil {
+				state.Routes = append(state.Routes, IngressRoute{
+					Host:     rule.Host,
+					Path:     path,
+					Service:  svc.Name,
+					Port:     svc.Port.Number,
+					PortName: svc.Port.Name,
+				})
+			}
+		}
+	}
+	return state, nil
+}
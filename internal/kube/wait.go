@@ -0,0 +1,222 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// readinessCheck reports whether the awaited state was reached and, if not, what is still pending.
+type readinessCheck func(ctx context.Context) (bool, string, error)
+
+// WaitForRollout tracks the workloads of req.Namespace until all are ready.
+func (c *APIClient) WaitForRollout(ctx context.Context, req RolloutRequest) (*RolloutReport, error) {
+	return watchRollout(ctx, c, c.stdout, c.pollInterval, req)
+}
+
+// WaitForWorkload waits until a Deployment, StatefulSet or DaemonSet finished its rollout or a Job completed.
+func (c *APIClient) WaitForWorkload(ctx context.Context, kind, name, namespace, timeout string) error {
+	if namespace == "" {
+		namespace = c.namespace
+	}
+	apps := c.clientset.AppsV1()
+	var check readinessCheck
+	switch kind {
+	case "Deployment":
+		check = func(ctx context.Context) (bool, string, error) {
+			d, err := apps.Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return false, "", apiError("get deployment "+name, err)
+			}
+			return deploymentRolloutStatus(d)
+		}
+	case "StatefulSet":
+		check = func(ctx context.Context) (bool, string, error) {
+			s, err := apps.StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return false, "", apiError("get statefulset "+name, err)
+			}
+			done, msg := statefulSetRolloutStatus(s)
+			return done, msg, nil
+		}
+	case "DaemonSet":
+		check = func(ctx context.Context) (bool, string, error) {
+			d, err := apps.DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return false, "", apiError("get daemonset "+name, err)
+			}
+			done, msg := daemonSetRolloutStatus(d)
+			return done, msg, nil
+		}
+	case "Job":
+		check = func(ctx context.Context) (bool, string, error) {
+			j, err := c.clientset.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return false, "", apiError("get job "+name, err)
+			}
+			return jobStatus(j)
+		}
+	default:
+		return fmt.Errorf("waiting for %s is not supported", kind)
+	}
+	return c.poll(ctx, timeout, strings.ToLower(kind)+"/"+name, check)
+}
+
+// WaitForCondition waits until status.conditions of the referenced object has the condition set to True.
+// Objects that do not exist yet are awaited as well.
+func (c *APIClient) WaitForCondition(ctx context.Context, ref ObjectRef, condition, timeout string) error {
+	ri, _, err := c.resource(ref)
+	if err != nil {
+		return err
+	}
+	desc := fmt.Sprintf("condition %s on %s", condition, ref)
+	return c.poll(ctx, timeout, desc, func(ctx context.Context) (bool, string, error) {
+		obj, err := ri.Get(ctx, ref.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return false, "object does not exist yet", nil
+		}
+		if err != nil {
+			return false, "", apiError("get "+ref.String(), err)
+		}
+		conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+		for _, raw := range conditions {
+			cond, _ := raw.(map[string]any)
+			condType, _ := cond["type"].(string)
+			status, _ := cond["status"].(string)
+			if strings.EqualFold(condType, condition) {
+				if status == string(corev1.ConditionTrue) {
+					return true, "", nil
+				}
+				return false, fmt.Sprintf("%s=%s", condType, status), nil
+			}
+		}
+		return false, "condition not reported yet", nil
+	})
+}
+
+// poll runs check until it succeeds, fails, or the timeout expires. Timeout errors include the last
+// pending state reported by check.
+func (c *APIClient) poll(ctx context.Context, timeout, desc string, check readinessCheck) error {
+	return pollUntil(ctx, c.pollInterval, timeout, desc, check)
+}
+
+// pollUntil runs check every interval until it succeeds, fails, or the timeout expires. Timeout errors
+// include the last pending state reported by check.
+func pollUntil(ctx context.Context, interval time.Duration, timeout, desc string, check readinessCheck) error {
+	d, err := parseTimeout(timeout)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+
+	pending := ""
+	for {
+		done, msg, err := check(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("timed out after %s waiting for %s: %s", d, desc, pending)
+			}
+			return err
+		}
+		if done {
+			return nil
+		}
+		pending = msg
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out after %s waiting for %s: %s", d, desc, pending)
+		case <-time.After(interval):
+		}
+	}
+}
+
+// deploymentRolloutStatus mirrors kubectl rollout status for Deployments.
+func deploymentRolloutStatus(d *appsv1.Deployment) (bool, string, error) {
+	if d.Generation > d.Status.ObservedGeneration {
+		return false, "waiting for the deployment spec update to be observed", nil
+	}
+	for _, cond := range d.Status.Conditions {
+		if cond.Type == appsv1.DeploymentProgressing && cond.Reason == "ProgressDeadlineExceeded" {
+			return false, "", fmt.Errorf("deployment %q exceeded its progress deadline", d.Name)
+		}
+	}
+	replicas := int32(1)
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+	switch {
+	case d.Status.UpdatedReplicas < replicas:
+		return false, fmt.Sprintf("%d out of %d new replicas have been updated", d.Status.UpdatedReplicas, replicas), nil
+	case d.Status.Replicas > d.Status.UpdatedReplicas:
+		return false, fmt.Sprintf("%d old replicas are pending termination", d.Status.Replicas-d.Status.UpdatedReplicas), nil
+	case d.Status.AvailableReplicas < d.Status.UpdatedReplicas:
+		return false, fmt.Sprintf("%d of %d updated replicas are available", d.Status.AvailableReplicas, d.Status.UpdatedReplicas), nil
+	}
+	return true, "", nil
+}
+
+// statefulSetRolloutStatus mirrors kubectl rollout status for StatefulSets.
+func statefulSetRolloutStatus(s *appsv1.StatefulSet) (bool, string) {
+	if s.Status.ObservedGeneration == 0 || s.Generation > s.Status.ObservedGeneration {
+		return false, "waiting for the statefulset spec update to be observed"
+	}
+	replicas := int32(1)
+	if s.Spec.Replicas != nil {
+		replicas = *s.Spec.Replicas
+	}
+	if s.Status.ReadyReplicas < replicas {
+		return false, fmt.Sprintf("%d of %d pods are ready", s.Status.ReadyReplicas, replicas)
+	}
+	if s.Spec.UpdateStrategy.Type != appsv1.RollingUpdateStatefulSetStrategyType {
+		return true, ""
+	}
+	if ru := s.Spec.UpdateStrategy.RollingUpdate; ru != nil && ru.Partition != nil && *ru.Partition > 0 {
+		if s.Status.UpdatedReplicas < replicas-*ru.Partition {
+			return false, fmt.Sprintf("%d of %d pods updated for the partitioned rollout", s.Status.UpdatedReplicas, replicas-*ru.Partition)
+		}
+		return true, ""
+	}
+	if s.Status.UpdateRevision != s.Status.CurrentRevision {
+		return false, fmt.Sprintf("%d pods at revision %s", s.Status.UpdatedReplicas, s.Status.UpdateRevision)
+	}
+	return true, ""
+}
+
+// daemonSetRolloutStatus mirrors kubectl rollout status for DaemonSets.
+func daemonSetRolloutStatus(d *appsv1.DaemonSet) (bool, string) {
+	if d.Generation > d.Status.ObservedGeneration {
+		return false, "waiting for the daemonset spec update to be observed"
+	}
+	if d.Status.UpdatedNumberScheduled < d.Status.DesiredNumberScheduled {
+		return false, fmt.Sprintf("%d out of %d new pods have been updated", d.Status.UpdatedNumberScheduled, d.Status.DesiredNumberScheduled)
+	}
+	if d.Status.NumberAvailable < d.Status.DesiredNumberScheduled {
+		return false, fmt.Sprintf("%d of %d updated pods are available", d.Status.NumberAvailable, d.Status.DesiredNumberScheduled)
+	}
+	return true, ""
+}
+
+// jobStatus reports whether j completed; a failed Job is returned as an error.
+func jobStatus(j *batchv1.Job) (bool, string, error) {
+	for _, cond := range j.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch cond.Type {
+		case batchv1.JobComplete:
+			return true, "", nil
+		case batchv1.JobFailed:
+			return false, "", fmt.Errorf("job %q failed: %s: %s", j.Name, cond.Reason, cond.Message)
+		}
+	}
+	return false, fmt.Sprintf("%d active, %d succeeded, %d failed pods", j.Status.Active, j.Status.Succeeded, j.Status.Failed), nil
+}
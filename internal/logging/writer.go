@@ -1,6 +1,7 @@
 package logging
 
 import (
+	"bytes"
 	"log/slog"
 	"strings"
 )
@@ -25,3 +26,51 @@ func (w *Writer) Write(p []byte) (int, error) {
 	}
 	return len(p), nil
 }
+
+// LineWriter is an io.WriteCloser that splits a stream into lines and logs each line at info level.
+type LineWriter struct {
+	// logger receives the lines.
+	logger *slog.Logger
+	// msg is the log message of every line.
+	msg string
+	// attrs are logged with every line.
+	attrs []any
+	// buf holds an incomplete trailing line.
+	buf []byte
+}
+
+// NewLineWriter constructs a LineWriter that logs every line as msg with attrs.
+func NewLineWriter(logger *slog.Logger, msg string, attrs ...any) *LineWriter {
+	return &LineWriter{logger: logger, msg: msg, attrs: attrs}
+}
+
+// Write logs the complete lines of p; an incomplete trailing line is buffered until the next write or Close.
+func (w *LineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Close logs a buffered incomplete line.
+func (w *LineWriter) Close() error {
+	if len(w.buf) > 0 {
+		w.emit(w.buf)
+		w.buf = nil
+	}
+	return nil
+}
+
+// emit logs a single line.
+func (w *LineWriter) emit(line []byte) {
+	if w.logger == nil {
+		return
+	}
+	w.logger.Info(w.msg, append(append([]any(nil), w.attrs...), "line", strings.TrimRight(string(line), "\r"))...)
+}
@@ -9,8 +9,9 @@ import (
 )
 
 // RenderEnvComment renders an environment comment in the requested language.
-// Links are taken from project config; paths are appended to https://<host>.
-func RenderEnvComment(lang, host string, slot int, links []config.Link) (string, error) {
+// Links are taken from project config; paths are appended to https://<host>. A hibernated slot is marked
+// as such, since its links do not respond until the slot is woken.
+func RenderEnvComment(lang, host string, slot int, links []config.Link, hibernated bool) (string, error) {
 	tmplName := "templates/env_comment_en.tmpl"
 	switch strings.ToLower(lang) {
 	case "ru":
@@ -38,13 +39,15 @@ func RenderEnvComment(lang, host string, slot int, links []config.Link) (string,
 	}
 
 	data := struct {
-		Host  string
-		Slot  int
-		Links []link
+		Host       string
+		Slot       int
+		Links      []link
+		Hibernated bool
 	}{
-		Host:  host,
-		Slot:  slot,
-		Links: renderedLinks,
+		Host:       host,
+		Slot:       slot,
+		Links:      renderedLinks,
+		Hibernated: hibernated,
 	}
 
 	tmplData, err := commentTemplates.ReadFile(tmplName)
@@ -0,0 +1,293 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/codex-k8s/codexctl/internal/kube"
+)
+
+// configMapBackend stores every slot as a ConfigMap named <prefix><slot> in the state namespace.
+type configMapBackend struct {
+	// client reads and writes the ConfigMaps.
+	client kube.ObjectClient
+	// logger reports allocation progress.
+	logger *slog.Logger
+	// namespace holds the state ConfigMaps.
+	namespace string
+	// prefix is the ConfigMap name prefix.
+	prefix string
+}
+
+// newConfigMapBackend constructs the ConfigMap state backend.
+func newConfigMapBackend(client kube.ObjectClient, logger *slog.Logger, namespace, prefix string) *configMapBackend {
+	return &configMapBackend{client: client, logger: logger, namespace: namespace, prefix: prefix}
+}
+
+// List returns all stored environment records.
+func (s *configMapBackend) List(ctx context.Context) ([]EnvRecord, error) {
+	if err := ensureNamespace(ctx, s.client, s.namespace); err != nil {
+		return nil, err
+	}
+	raw, err := s.listConfigMaps(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []EnvRecord
+	for _, item := range raw.Items {
+		if _, ok := slotFromName(s.prefix, item.Metadata.Name); !ok {
+			continue
+		}
+		rec := recordFromFields(item.Metadata.Name, item.Data)
+		rec.ResourceVersion = item.Metadata.ResourceVersion
+		res = append(res, rec)
+	}
+	sortRecords(res)
+	return res, nil
+}
+
+// Allocate reserves a new slot by creating its ConfigMap; an existing ConfigMap means the slot is taken.
+func (s *configMapBackend) Allocate(ctx context.Context, req AllocateRequest) (EnvRecord, error) {
+	if err := ensureNamespace(ctx, s.client, s.namespace); err != nil {
+		return EnvRecord{}, err
+	}
+	return allocateSlot(ctx, s.logger, s.prefix, req, func(ctx context.Context, rec EnvRecord) error {
+		data := map[string]any{}
+		for k, v := range recordFields(rec) {
+			data[k] = v
+		}
+		cm := map[string]any{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata": map[string]any{
+				"name":      rec.Name,
+				"namespace": s.namespace,
+			},
+			"data": data,
+		}
+		err := s.client.Create(ctx, cm)
+		if errors.Is(err, kube.ErrAlreadyExists) {
+			return errSlotTaken
+		}
+		return err
+	})
+}
+
+// Update patches the fields set in upd into the slot ConfigMap; the API server rejects the patch with a
+// conflict when upd.ResourceVersion is set and no longer current.
+func (s *configMapBackend) Update(ctx context.Context, slot int, upd RecordUpdate) error {
+	if slot <= 0 || upd.empty() {
+		return nil
+	}
+	if err := ensureNamespace(ctx, s.client, s.namespace); err != nil {
+		return err
+	}
+	name := recordName(s.prefix, slot)
+	patchBytes, err := json.Marshal(casMetadata(map[string]any{"data": updateFields(upd)}, upd.ResourceVersion))
+	if err != nil {
+		return fmt.Errorf("encode configmap patch: %w", err)
+	}
+	if err := s.client.MergePatch(ctx, s.configMapRef(name), patchBytes); err != nil {
+		return patchError("configmap "+name, err)
+	}
+	return nil
+}
+
+// Release deletes the slot ConfigMap.
+func (s *configMapBackend) Release(ctx context.Context, slot int) error {
+	name := recordName(s.prefix, slot)
+	if err := s.client.DeleteObject(ctx, s.configMapRef(name)); err != nil {
+		return fmt.Errorf("delete configmap %s: %w", name, err)
+	}
+	return nil
+}
+
+// GC destroys and releases the expired environment records and returns them.
+func (s *configMapBackend) GC(ctx context.Context, req GCRequest) ([]EnvRecord, error) {
+	return collectGarbage(ctx, s.logger, s, req)
+}
+
+// LoadQueue returns the slot queue stored in the ConfigMap <prefix>queue-<env>.
+func (s *configMapBackend) LoadQueue(ctx context.Context, env string) (Queue, error) {
+	if err := ensureNamespace(ctx, s.client, s.namespace); err != nil {
+		return Queue{}, err
+	}
+	return loadConfigMapQueue(ctx, s.client, s.configMapRef(queueName(s.prefix, env)))
+}
+
+// StoreQueue writes the slot queue into the ConfigMap <prefix>queue-<env>.
+func (s *configMapBackend) StoreQueue(ctx context.Context, env string, q Queue) error {
+	if err := ensureNamespace(ctx, s.client, s.namespace); err != nil {
+		return err
+	}
+	return storeConfigMapQueue(ctx, s.client, s.configMapRef(queueName(s.prefix, env)), q)
+}
+
+// LoadSnapshots returns the snapshot catalog stored in the ConfigMap <prefix>snapshots-<env>.
+func (s *configMapBackend) LoadSnapshots(ctx context.Context, env string) (Snapshots, error) {
+	if err := ensureNamespace(ctx, s.client, s.namespace); err != nil {
+		return Snapshots{}, err
+	}
+	return loadConfigMapSnapshots(ctx, s.client, s.configMapRef(snapshotsName(s.prefix, env)))
+}
+
+// StoreSnapshots writes the snapshot catalog into the ConfigMap <prefix>snapshots-<env>.
+func (s *configMapBackend) StoreSnapshots(ctx context.Context, env string, snaps Snapshots) error {
+	if err := ensureNamespace(ctx, s.client, s.namespace); err != nil {
+		return err
+	}
+	return storeConfigMapSnapshots(ctx, s.client, s.configMapRef(snapshotsName(s.prefix, env)), snaps)
+}
+
+const (
+	// queueDataKey is the ConfigMap data key holding the JSON-encoded queue entries.
+	queueDataKey = "entries"
+	// snapshotsDataKey is the ConfigMap data key holding the JSON-encoded snapshot catalog.
+	snapshotsDataKey = "snapshots"
+)
+
+// loadConfigMapQueue reads the queue stored in the ConfigMap referenced by ref; a missing ConfigMap is an
+// empty queue.
+func loadConfigMapQueue(ctx context.Context, client kube.ObjectClient, ref kube.ObjectRef) (Queue, error) {
+	var q Queue
+	rv, err := loadConfigMapDocument(ctx, client, ref, queueDataKey, &q.Entries)
+	if err != nil {
+		return Queue{}, err
+	}
+	q.ResourceVersion = rv
+	return q, nil
+}
+
+// storeConfigMapQueue writes q into the ConfigMap referenced by ref, creating it when q was never stored.
+func storeConfigMapQueue(ctx context.Context, client kube.ObjectClient, ref kube.ObjectRef, q Queue) error {
+	return storeConfigMapDocument(ctx, client, ref, queueDataKey, q.ResourceVersion, nonNil(q.Entries))
+}
+
+// loadConfigMapSnapshots reads the snapshot catalog stored in the ConfigMap referenced by ref; a missing
+// ConfigMap is an empty catalog.
+func loadConfigMapSnapshots(ctx context.Context, client kube.ObjectClient, ref kube.ObjectRef) (Snapshots, error) {
+	var snaps Snapshots
+	rv, err := loadConfigMapDocument(ctx, client, ref, snapshotsDataKey, &snaps.Items)
+	if err != nil {
+		return Snapshots{}, err
+	}
+	snaps.ResourceVersion = rv
+	return snaps, nil
+}
+
+// storeConfigMapSnapshots writes snaps into the ConfigMap referenced by ref, creating it when snaps was never
+// stored.
+func storeConfigMapSnapshots(ctx context.Context, client kube.ObjectClient, ref kube.ObjectRef, snaps Snapshots) error {
+	return storeConfigMapDocument(ctx, client, ref, snapshotsDataKey, snaps.ResourceVersion, nonNil(snaps.Items))
+}
+
+// loadConfigMapDocument decodes the JSON document under key of the ConfigMap referenced by ref into v and
+// returns the ConfigMap resource version; a missing ConfigMap leaves v untouched and has an empty version.
+func loadConfigMapDocument(ctx context.Context, client kube.ObjectClient, ref kube.ObjectRef, key string, v any) (string, error) {
+	obj, err := client.GetObject(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("get configmap %s: %w", ref.Name, err)
+	}
+	if obj == nil {
+		return "", nil
+	}
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return "", fmt.Errorf("encode configmap %s: %w", ref.Name, err)
+	}
+	var item cmItem
+	if err := json.Unmarshal(raw, &item); err != nil {
+		return "", fmt.Errorf("parse configmap %s: %w", ref.Name, err)
+	}
+	if data := strings.TrimSpace(item.Data[key]); data != "" {
+		if err := json.Unmarshal([]byte(data), v); err != nil {
+			return "", fmt.Errorf("parse %s of configmap %s: %w", key, ref.Name, err)
+		}
+	}
+	return item.Metadata.ResourceVersion, nil
+}
+
+// storeConfigMapDocument writes v as a JSON document under key of the ConfigMap referenced by ref with a
+// compare-and-swap against resourceVersion, creating the ConfigMap when resourceVersion is empty.
+func storeConfigMapDocument(ctx context.Context, client kube.ObjectClient, ref kube.ObjectRef, key, resourceVersion string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encode %s of configmap %s: %w", key, ref.Name, err)
+	}
+	if resourceVersion == "" {
+		err := client.Create(ctx, map[string]any{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata": map[string]any{
+				"name":      ref.Name,
+				"namespace": ref.Namespace,
+			},
+			"data": map[string]any{key: string(data)},
+		})
+		if errors.Is(err, kube.ErrAlreadyExists) {
+			return fmt.Errorf("create configmap %s: %w", ref.Name, ErrConflict)
+		}
+		if err != nil {
+			return fmt.Errorf("create configmap %s: %w", ref.Name, err)
+		}
+		return nil
+	}
+	patchBytes, err := json.Marshal(casMetadata(map[string]any{"data": map[string]string{key: string(data)}}, resourceVersion))
+	if err != nil {
+		return fmt.Errorf("encode configmap patch: %w", err)
+	}
+	if err := client.MergePatch(ctx, ref, patchBytes); err != nil {
+		return patchError("configmap "+ref.Name, err)
+	}
+	return nil
+}
+
+// nonNil returns items or an empty slice when it is nil, so that documents encode as [] rather than null.
+func nonNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
+
+type cmList struct {
+	Items []cmItem `json:"items"`
+}
+
+type cmItem struct {
+	Metadata struct {
+		Name              string `json:"name"`
+		CreationTimestamp string `json:"creationTimestamp"`
+		ResourceVersion   string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Data map[string]string `json:"data"`
+}
+
+// listConfigMaps returns the raw ConfigMap list used for state storage.
+func (s *configMapBackend) listConfigMaps(ctx context.Context) (*cmList, error) {
+	items, err := s.client.GetObjects(ctx, s.namespace, "", []string{"configmaps"})
+	if err != nil {
+		return nil, fmt.Errorf("list state configmaps: %w", err)
+	}
+
+	// Round-trip through JSON to decode the generic objects into the typed view.
+	raw, err := json.Marshal(map[string]any{"items": items})
+	if err != nil {
+		return nil, fmt.Errorf("encode state configmaps: %w", err)
+	}
+	var list cmList
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, fmt.Errorf("parse state configmaps: %w", err)
+	}
+	return &list, nil
+}
+
+// configMapRef references a state ConfigMap by name.
+func (s *configMapBackend) configMapRef(name string) kube.ObjectRef {
+	return kube.ObjectRef{APIVersion: "v1", Kind: "ConfigMap", Namespace: s.namespace, Name: name}
+}
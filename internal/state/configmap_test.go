@@ -0,0 +1,200 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"strconv"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	"github.com/codex-k8s/codexctl/internal/kube"
+)
+
+// testStateNamespace holds the state ConfigMaps of the fake cluster.
+const testStateNamespace = "codex-state"
+
+// configMapGVR is the resource of the state ConfigMaps.
+var configMapGVR = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+// fakeCluster is a configmap backend over the client-go fakes. The fake tracker ignores resource versions,
+// so patches are handled like the API server does: a patch carrying a stale metadata.resourceVersion fails
+// with a conflict and every stored change bumps the resource version.
+type fakeCluster struct {
+	t       *testing.T
+	dynamic *dynamicfake.FakeDynamicClient
+	backend *configMapBackend
+	// patches counts the patch requests, including the rejected ones.
+	patches int
+	// beforePatch runs before patch request n (starting at 1) is checked, e.g. to store a concurrent change.
+	beforePatch func(n int)
+}
+
+// newFakeCluster returns an empty fake cluster with the state namespace.
+func newFakeCluster(t *testing.T) *fakeCluster {
+	t.Helper()
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		configMapGVR: "ConfigMapList",
+	})
+	client := kube.NewAPIClientFromClients(kube.Clients{
+		Clientset: fake.NewSimpleClientset(),
+		Dynamic:   dyn,
+		Mapper:    mapper,
+		Stdout:    io.Discard,
+	})
+	c := &fakeCluster{
+		t:       t,
+		dynamic: dyn,
+		backend: newConfigMapBackend(client, testLogger(), testStateNamespace, defaultRecordPrefix),
+	}
+	dyn.PrependReactor("patch", "configmaps", c.patch)
+	return c
+}
+
+// testLogger discards the log output of the code under test.
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// patch applies a JSON merge patch with the compare-and-swap semantics of the API server.
+func (c *fakeCluster) patch(action clienttesting.Action) (bool, runtime.Object, error) {
+	pa := action.(clienttesting.PatchAction)
+	c.patches++
+	if c.beforePatch != nil {
+		c.beforePatch(c.patches)
+	}
+	var patch map[string]any
+	if err := json.Unmarshal(pa.GetPatch(), &patch); err != nil {
+		return true, nil, apierrors.NewBadRequest(err.Error())
+	}
+	cur, err := c.get(pa.GetName())
+	if err != nil {
+		return true, nil, err
+	}
+	rv, _, _ := unstructured.NestedString(patch, "metadata", "resourceVersion")
+	if rv != "" && rv != cur.GetResourceVersion() {
+		return true, nil, apierrors.NewConflict(configMapGVR.GroupResource(), pa.GetName(), errors.New("the object has been modified"))
+	}
+	mergePatch(cur.Object, patch)
+	if err := c.put(cur); err != nil {
+		return true, nil, err
+	}
+	return true, cur, nil
+}
+
+// mergePatch applies the JSON merge patch (RFC 7386) to dst.
+func mergePatch(dst, patch map[string]any) {
+	for k, v := range patch {
+		switch v := v.(type) {
+		case nil:
+			delete(dst, k)
+		case map[string]any:
+			sub, ok := dst[k].(map[string]any)
+			if !ok {
+				sub = map[string]any{}
+			}
+			mergePatch(sub, v)
+			dst[k] = sub
+		default:
+			dst[k] = v
+		}
+	}
+}
+
+// get returns a copy of the stored ConfigMap name.
+func (c *fakeCluster) get(name string) (*unstructured.Unstructured, error) {
+	obj, err := c.dynamic.Tracker().Get(configMapGVR, testStateNamespace, name)
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*unstructured.Unstructured).DeepCopy(), nil
+}
+
+// put stores obj with the next resource version.
+func (c *fakeCluster) put(obj *unstructured.Unstructured) error {
+	rv, _ := strconv.Atoi(obj.GetResourceVersion())
+	obj.SetResourceVersion(strconv.Itoa(rv + 1))
+	return c.dynamic.Tracker().Update(configMapGVR, obj, testStateNamespace)
+}
+
+// seed stores rec, including its lease, as the state ConfigMap of its slot.
+func (c *fakeCluster) seed(rec EnvRecord) {
+	c.t.Helper()
+	data := map[string]any{}
+	for k, v := range recordFields(rec) {
+		data[k] = v
+	}
+	if rec.Lease.Holder != "" {
+		for k, v := range updateFields(RecordUpdate{Lease: &rec.Lease}) {
+			data[k] = v
+		}
+	}
+	obj := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]any{
+			"name":            recordName(defaultRecordPrefix, rec.Slot),
+			"namespace":       testStateNamespace,
+			"resourceVersion": "1",
+		},
+		"data": data,
+	}}
+	if err := c.dynamic.Tracker().Create(configMapGVR, obj, testStateNamespace); err != nil {
+		c.t.Fatalf("seed slot %d: %v", rec.Slot, err)
+	}
+}
+
+// store applies upd to the record of slot behind the back of the backend, like a concurrent runner.
+func (c *fakeCluster) store(slot int, upd RecordUpdate) {
+	c.t.Helper()
+	cur, err := c.get(recordName(defaultRecordPrefix, slot))
+	if err != nil {
+		c.t.Fatalf("get slot %d: %v", slot, err)
+	}
+	data := map[string]any{}
+	for k, v := range updateFields(upd) {
+		data[k] = v
+	}
+	mergePatch(cur.Object, map[string]any{"data": data})
+	if err := c.put(cur); err != nil {
+		c.t.Fatalf("store slot %d: %v", slot, err)
+	}
+}
+
+// record returns the stored record of slot and whether it exists.
+func (c *fakeCluster) record(slot int) (EnvRecord, bool) {
+	c.t.Helper()
+	cur, err := c.get(recordName(defaultRecordPrefix, slot))
+	if apierrors.IsNotFound(err) {
+		return EnvRecord{}, false
+	}
+	if err != nil {
+		c.t.Fatalf("get slot %d: %v", slot, err)
+	}
+	data, _, _ := unstructured.NestedStringMap(cur.Object, "data")
+	return recordFromFields(cur.GetName(), data), true
+}
+
+// testRecord returns a record of slot in the ai environment allocated age ago.
+func testRecord(slot int, age time.Duration) EnvRecord {
+	return EnvRecord{
+		Slot:      slot,
+		Env:       "ai",
+		Namespace: "project-ai-" + strconv.Itoa(slot),
+		Owner:     "1234",
+		CreatedAt: time.Now().UTC().Add(-age).Truncate(time.Second),
+		Phase:     PhaseIdle,
+	}
+}
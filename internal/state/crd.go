@@ -0,0 +1,464 @@
+package state
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/codex-k8s/codexctl/internal/engine"
+	"github.com/codex-k8s/codexctl/internal/kube"
+)
+
+// CodexSlot custom resource identifiers.
+const (
+	// codexSlotAPIVersion is the API version of CodexSlot objects.
+	codexSlotAPIVersion = "codexctl.io/v1alpha1"
+	// codexSlotKind is the kind of CodexSlot objects.
+	codexSlotKind = "CodexSlot"
+	// codexSlotResource is the "plural.group" resource name of CodexSlot.
+	codexSlotResource = "codexslots.codexctl.io"
+	// crdEstablishTimeout bounds the wait for a freshly created CRD to be served.
+	crdEstablishTimeout = 30 * time.Second
+	// crdRevisionAnnotation carries the revision of the embedded CRD; an installed CRD with another
+	// revision is updated so that new spec fields are not pruned.
+	crdRevisionAnnotation = "codexctl.io/crd-revision"
+)
+
+// codexSlotCRD is the CustomResourceDefinition of CodexSlot.
+//
+//go:embed crd/codexslots.yaml
+var codexSlotCRD []byte
+
+// crdBackend stores every slot as a CodexSlot custom resource named <prefix><slot> in the state namespace.
+type crdBackend struct {
+	// client reads and writes the CodexSlot objects.
+	client kube.ObjectClient
+	// logger reports allocation progress.
+	logger *slog.Logger
+	// namespace holds the CodexSlot objects.
+	namespace string
+	// prefix is the object name prefix.
+	prefix string
+	// ready is set once the namespace and the CRD are known to exist.
+	ready bool
+}
+
+// newCRDBackend constructs the CodexSlot state backend.
+func newCRDBackend(client kube.ObjectClient, logger *slog.Logger, namespace, prefix string) *crdBackend {
+	return &crdBackend{client: client, logger: logger, namespace: namespace, prefix: prefix}
+}
+
+// codexSlot is the typed view of a CodexSlot object.
+type codexSlot struct {
+	// Metadata holds the object name and creation time.
+	Metadata struct {
+		Name              string `json:"name"`
+		CreationTimestamp string `json:"creationTimestamp"`
+		ResourceVersion   string `json:"resourceVersion"`
+	} `json:"metadata"`
+	// Spec is the slot assignment.
+	Spec codexSlotSpec `json:"spec"`
+	// Status mirrors the lifecycle phase for display; objects written before the phase moved into the spec
+	// only have it here.
+	Status struct {
+		Phase string `json:"phase"`
+	} `json:"status"`
+}
+
+// codexSlotSpec is the spec of a CodexSlot object.
+type codexSlotSpec struct {
+	// Slot is the slot number.
+	Slot int `json:"slot"`
+	// Env is the environment name.
+	Env string `json:"env"`
+	// Namespace is the slot namespace.
+	Namespace string `json:"namespace,omitempty"`
+	// Issue is the associated GitHub issue number.
+	Issue int `json:"issue,omitempty"`
+	// PR is the associated GitHub pull request number.
+	PR int `json:"pr,omitempty"`
+	// Owner is the run that allocated the slot.
+	Owner string `json:"owner,omitempty"`
+	// CreatedAt is the allocation time in RFC 3339.
+	CreatedAt string `json:"createdAt,omitempty"`
+	// Lease is the runner lease, absent when the slot is not held.
+	Lease *codexSlotLease `json:"lease,omitempty"`
+	// LastActivityAt is the last time a command worked in the slot, in RFC 3339.
+	LastActivityAt string `json:"lastActivityAt,omitempty"`
+	// Branch is the git branch the agent works on.
+	Branch string `json:"branch,omitempty"`
+	// HeadSHA is the last known head commit of Branch.
+	HeadSHA string `json:"headSha,omitempty"`
+	// PromptKind is the prompt kind of the last agent run.
+	PromptKind string `json:"promptKind,omitempty"`
+	// Model is the model of the last agent run.
+	Model string `json:"model,omitempty"`
+	// Phase is the lifecycle phase. It lives in the spec so that it changes in the same compare-and-swap as
+	// the lease, and is mirrored into status.phase.
+	Phase string `json:"phase,omitempty"`
+}
+
+// codexSlotLease is the lease of a CodexSlot object.
+type codexSlotLease struct {
+	// Holder identifies the runner.
+	Holder string `json:"holder"`
+	// RenewedAt is the last heartbeat in RFC 3339.
+	RenewedAt string `json:"renewedAt"`
+	// DurationSeconds is the lease validity after RenewedAt.
+	DurationSeconds int `json:"durationSeconds"`
+}
+
+// List returns all stored environment records.
+func (s *crdBackend) List(ctx context.Context) ([]EnvRecord, error) {
+	if err := s.ensureReady(ctx); err != nil {
+		return nil, err
+	}
+	items, err := s.client.GetObjects(ctx, s.namespace, "", []string{codexSlotResource})
+	if err != nil {
+		return nil, fmt.Errorf("list %s: %w", codexSlotResource, err)
+	}
+
+	var res []EnvRecord
+	for _, item := range items {
+		raw, err := json.Marshal(item)
+		if err != nil {
+			return nil, fmt.Errorf("encode CodexSlot: %w", err)
+		}
+		var obj codexSlot
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			return nil, fmt.Errorf("parse CodexSlot: %w", err)
+		}
+		if _, ok := slotFromName(s.prefix, obj.Metadata.Name); !ok {
+			continue
+		}
+		rec := EnvRecord{
+			Slot:      obj.Spec.Slot,
+			Env:       obj.Spec.Env,
+			Namespace: obj.Spec.Namespace,
+			Issue:     obj.Spec.Issue,
+			PR:        obj.Spec.PR,
+			Name:      obj.Metadata.Name,
+
+			ResourceVersion: obj.Metadata.ResourceVersion,
+			Owner:           obj.Spec.Owner,
+			Branch:          obj.Spec.Branch,
+			HeadSHA:         obj.Spec.HeadSHA,
+			PromptKind:      obj.Spec.PromptKind,
+			Model:           obj.Spec.Model,
+			Phase:           obj.Spec.Phase,
+		}
+		if rec.Phase == "" {
+			rec.Phase = obj.Status.Phase
+		}
+		if l := obj.Spec.Lease; l != nil && l.Holder != "" {
+			rec.Lease.Holder = l.Holder
+			rec.Lease.RenewedAt, _ = time.Parse(time.RFC3339, l.RenewedAt)
+			rec.Lease.Duration = time.Duration(l.DurationSeconds) * time.Second
+		}
+		rec.LastActivityAt, _ = time.Parse(time.RFC3339, obj.Spec.LastActivityAt)
+		for _, ts := range []string{obj.Spec.CreatedAt, obj.Metadata.CreationTimestamp} {
+			if t, err := time.Parse(time.RFC3339, ts); err == nil {
+				rec.CreatedAt = t
+				break
+			}
+		}
+		res = append(res, rec)
+	}
+	sortRecords(res)
+	return res, nil
+}
+
+// Allocate reserves a new slot by creating its CodexSlot; an existing object means the slot is taken.
+func (s *crdBackend) Allocate(ctx context.Context, req AllocateRequest) (EnvRecord, error) {
+	if err := s.ensureReady(ctx); err != nil {
+		return EnvRecord{}, err
+	}
+	return allocateSlot(ctx, s.logger, s.prefix, req, func(ctx context.Context, rec EnvRecord) error {
+		spec := codexSlotSpec{
+			Slot:      rec.Slot,
+			Env:       rec.Env,
+			Namespace: rec.Namespace,
+			Issue:     rec.Issue,
+			PR:        rec.PR,
+			Owner:     rec.Owner,
+			CreatedAt: rec.CreatedAt.UTC().Format(time.RFC3339),
+
+			LastActivityAt: rec.LastActivityAt.UTC().Format(time.RFC3339),
+			Phase:          rec.Phase,
+		}
+		specMap, err := toMap(spec)
+		if err != nil {
+			return err
+		}
+		obj := map[string]any{
+			"apiVersion": codexSlotAPIVersion,
+			"kind":       codexSlotKind,
+			"metadata": map[string]any{
+				"name":      rec.Name,
+				"namespace": s.namespace,
+				"labels":    map[string]any{engine.LabelManagedBy: engine.ManagedByValue},
+			},
+			"spec": specMap,
+		}
+		err = s.client.Create(ctx, obj)
+		if errors.Is(err, kube.ErrAlreadyExists) {
+			return errSlotTaken
+		}
+		if err != nil {
+			return err
+		}
+		s.mirrorPhase(ctx, rec.Name, rec.Phase)
+		return nil
+	})
+}
+
+// Update patches the fields set in upd, the phase included, into the CodexSlot spec with a single patch that the
+// API server rejects with a conflict when upd.ResourceVersion is set and no longer current. The phase is then
+// mirrored into the status; a failed mirror only affects the display.
+func (s *crdBackend) Update(ctx context.Context, slot int, upd RecordUpdate) error {
+	if slot <= 0 || upd.empty() {
+		return nil
+	}
+	if err := s.ensureReady(ctx); err != nil {
+		return err
+	}
+	spec := map[string]any{}
+	if ns := strings.TrimSpace(upd.Namespace); ns != "" {
+		spec["namespace"] = ns
+	}
+	if upd.Issue > 0 {
+		spec["issue"] = upd.Issue
+	}
+	if upd.PR > 0 {
+		spec["pr"] = upd.PR
+	}
+	if upd.ClearLinks {
+		// Null values remove the links from the spec.
+		spec["issue"], spec["pr"] = nil, nil
+	}
+	if !upd.CreatedAt.IsZero() {
+		spec["createdAt"] = upd.CreatedAt.UTC().Format(time.RFC3339)
+	}
+	if l := upd.Lease; l != nil {
+		// A null lease removes it from the spec.
+		spec["lease"] = nil
+		if l.Holder != "" {
+			spec["lease"] = codexSlotLease{
+				Holder:          l.Holder,
+				RenewedAt:       l.RenewedAt.UTC().Format(time.RFC3339),
+				DurationSeconds: int(l.Duration / time.Second),
+			}
+		}
+	}
+	phase := strings.TrimSpace(upd.Phase)
+	if phase != "" {
+		spec["phase"] = phase
+	}
+	if !upd.LastActivityAt.IsZero() {
+		spec["lastActivityAt"] = upd.LastActivityAt.UTC().Format(time.RFC3339)
+	}
+	for key, value := range map[string]string{
+		"owner":      upd.Owner,
+		"branch":     upd.Branch,
+		"headSha":    upd.HeadSHA,
+		"promptKind": upd.PromptKind,
+		"model":      upd.Model,
+	} {
+		if v := strings.TrimSpace(value); v != "" {
+			spec[key] = v
+		}
+	}
+
+	if len(spec) == 0 {
+		return nil
+	}
+
+	name := recordName(s.prefix, slot)
+	patchBytes, err := json.Marshal(casMetadata(map[string]any{"spec": spec}, upd.ResourceVersion))
+	if err != nil {
+		return fmt.Errorf("encode CodexSlot patch: %w", err)
+	}
+	if err := s.client.MergePatch(ctx, s.slotRef(name), patchBytes); err != nil {
+		return patchError("CodexSlot "+name, err)
+	}
+	if phase != "" {
+		s.mirrorPhase(ctx, name, phase)
+	}
+	return nil
+}
+
+// mirrorPhase copies phase into the status of the CodexSlot name for kubectl get. The spec is authoritative,
+// so a failure is only logged.
+func (s *crdBackend) mirrorPhase(ctx context.Context, name, phase string) {
+	status, _ := json.Marshal(map[string]any{"status": map[string]any{"phase": phase}})
+	if err := s.client.MergePatchStatus(ctx, s.slotRef(name), status); err != nil {
+		s.logger.Warn("failed to mirror CodexSlot phase into its status", "name", name, "error", err)
+	}
+}
+
+// Release deletes the slot CodexSlot.
+func (s *crdBackend) Release(ctx context.Context, slot int) error {
+	name := recordName(s.prefix, slot)
+	if err := s.client.DeleteObject(ctx, s.slotRef(name)); err != nil {
+		return fmt.Errorf("delete CodexSlot %s: %w", name, err)
+	}
+	return nil
+}
+
+// GC destroys and releases the expired environment records and returns them.
+func (s *crdBackend) GC(ctx context.Context, req GCRequest) ([]EnvRecord, error) {
+	return collectGarbage(ctx, s.logger, s, req)
+}
+
+// LoadQueue returns the slot queue stored in the ConfigMap <prefix>queue-<env> next to the CodexSlot objects.
+func (s *crdBackend) LoadQueue(ctx context.Context, env string) (Queue, error) {
+	if err := ensureNamespace(ctx, s.client, s.namespace); err != nil {
+		return Queue{}, err
+	}
+	return loadConfigMapQueue(ctx, s.client, s.queueRef(env))
+}
+
+// StoreQueue writes the slot queue into the ConfigMap <prefix>queue-<env>.
+func (s *crdBackend) StoreQueue(ctx context.Context, env string, q Queue) error {
+	if err := ensureNamespace(ctx, s.client, s.namespace); err != nil {
+		return err
+	}
+	return storeConfigMapQueue(ctx, s.client, s.queueRef(env), q)
+}
+
+// LoadSnapshots returns the snapshot catalog stored in the ConfigMap <prefix>snapshots-<env>.
+func (s *crdBackend) LoadSnapshots(ctx context.Context, env string) (Snapshots, error) {
+	if err := ensureNamespace(ctx, s.client, s.namespace); err != nil {
+		return Snapshots{}, err
+	}
+	return loadConfigMapSnapshots(ctx, s.client, s.snapshotsRef(env))
+}
+
+// StoreSnapshots writes the snapshot catalog into the ConfigMap <prefix>snapshots-<env>.
+func (s *crdBackend) StoreSnapshots(ctx context.Context, env string, snaps Snapshots) error {
+	if err := ensureNamespace(ctx, s.client, s.namespace); err != nil {
+		return err
+	}
+	return storeConfigMapSnapshots(ctx, s.client, s.snapshotsRef(env), snaps)
+}
+
+// ensureReady creates the state namespace and installs the CodexSlot CRD when they are missing.
+func (s *crdBackend) ensureReady(ctx context.Context) error {
+	if s.ready {
+		return nil
+	}
+	if err := ensureNamespace(ctx, s.client, s.namespace); err != nil {
+		return err
+	}
+
+	var doc map[string]any
+	if err := yaml.Unmarshal(codexSlotCRD, &doc); err != nil {
+		return fmt.Errorf("decode CodexSlot CRD: %w", err)
+	}
+	// Round-trip through JSON so that numbers have the types unstructured objects expect.
+	crd, err := toMap(doc)
+	if err != nil {
+		return fmt.Errorf("encode CodexSlot CRD: %w", err)
+	}
+	ref := kube.ObjectRefOf(crd)
+	existing, err := s.client.GetObject(ctx, ref)
+	if err != nil {
+		return fmt.Errorf("get CodexSlot CRD: %w", err)
+	}
+	switch {
+	case existing == nil:
+		s.logger.Info("installing CodexSlot custom resource definition", "name", ref.Name)
+		if err := s.client.Create(ctx, crd); err != nil && !errors.Is(err, kube.ErrAlreadyExists) {
+			return fmt.Errorf("create CodexSlot CRD: %w", err)
+		}
+		if err := s.waitEstablished(ctx, ref); err != nil {
+			return err
+		}
+	case crdRevision(existing) != crdRevision(crd):
+		s.logger.Info("updating CodexSlot custom resource definition", "name", ref.Name, "revision", crdRevision(crd))
+		patch, err := json.Marshal(crd)
+		if err != nil {
+			return fmt.Errorf("encode CodexSlot CRD: %w", err)
+		}
+		if err := s.client.MergePatch(ctx, ref, patch); err != nil {
+			return fmt.Errorf("update CodexSlot CRD: %w", err)
+		}
+	}
+	s.ready = true
+	return nil
+}
+
+// waitEstablished polls the CRD until its Established condition is True.
+func (s *crdBackend) waitEstablished(ctx context.Context, ref kube.ObjectRef) error {
+	ctx, cancel := context.WithTimeout(ctx, crdEstablishTimeout)
+	defer cancel()
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		obj, err := s.client.GetObject(ctx, ref)
+		if err == nil && crdEstablished(obj) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("wait for CodexSlot CRD to be established: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// crdRevision returns the crdRevisionAnnotation value of a CRD object.
+func crdRevision(obj map[string]any) string {
+	metadata, _ := obj["metadata"].(map[string]any)
+	annotations, _ := metadata["annotations"].(map[string]any)
+	revision, _ := annotations[crdRevisionAnnotation].(string)
+	return revision
+}
+
+// crdEstablished reports whether the CRD object has the Established condition set to True.
+func crdEstablished(obj map[string]any) bool {
+	status, _ := obj["status"].(map[string]any)
+	conditions, _ := status["conditions"].([]any)
+	for _, c := range conditions {
+		cond, _ := c.(map[string]any)
+		if cond["type"] == "Established" && cond["status"] == "True" {
+			return true
+		}
+	}
+	return false
+}
+
+// slotRef references a CodexSlot by name.
+func (s *crdBackend) slotRef(name string) kube.ObjectRef {
+	return kube.ObjectRef{APIVersion: codexSlotAPIVersion, Kind: codexSlotKind, Namespace: s.namespace, Name: name}
+}
+
+// queueRef references the ConfigMap holding the slot queue of env.
+func (s *crdBackend) queueRef(env string) kube.ObjectRef {
+	return kube.ObjectRef{APIVersion: "v1", Kind: "ConfigMap", Namespace: s.namespace, Name: queueName(s.prefix, env)}
+}
+
+// snapshotsRef references the ConfigMap holding the snapshot catalog of env.
+func (s *crdBackend) snapshotsRef(env string) kube.ObjectRef {
+	return kube.ObjectRef{APIVersion: "v1", Kind: "ConfigMap", Namespace: s.namespace, Name: snapshotsName(s.prefix, env)}
+}
+
+// toMap converts v into a generic JSON object.
+func toMap(v any) (map[string]any, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out map[string]any
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,108 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// HibernateRequest describes a hibernation run over the slots of an environment.
+type HibernateRequest struct {
+	// Env limits the run to records of this environment when non-empty.
+	Env string
+	// Idle is the minimum time since the last activity in the slot.
+	Idle time.Duration
+	// DryRun reports the slots that would be hibernated without touching them.
+	DryRun bool
+	// Holder is the lease holder hibernation takes on a record while it is scaled down; "codexctl-hibernate"
+	// when empty.
+	Holder string
+	// Scale scales the workloads of rec to zero. When it fails the record stays hibernated, so that the next
+	// run in the slot wakes whatever was scaled down already.
+	Scale func(ctx context.Context, rec EnvRecord) error
+}
+
+// hibernatable reports whether rec is a deployed slot of req.Env that nobody holds and that has been idle for
+// at least req.Idle at now.
+func (req HibernateRequest) hibernatable(rec EnvRecord, now time.Time) bool {
+	if rec.Slot <= 0 || rec.Namespace == "" || (req.Env != "" && rec.Env != req.Env) {
+		return false
+	}
+	switch rec.Phase {
+	case PhaseReady, PhaseIdle, "":
+	default:
+		return false
+	}
+	return !rec.Lease.Active(now) && now.Sub(rec.IdleSince()) >= req.Idle
+}
+
+// Hibernate scales the environments of idle slots to zero and moves their records to PhaseHibernated. While a
+// slot is scaled down, hibernation holds its lease so that no runner starts in it in the meantime. The
+// hibernated records (or, in dry-run mode, the records that would be hibernated) are returned.
+func Hibernate(ctx context.Context, logger *slog.Logger, backend StateBackend, req HibernateRequest) ([]EnvRecord, error) {
+	if req.Idle <= 0 {
+		return nil, fmt.Errorf("hibernate idle threshold must be positive")
+	}
+	records, err := backend.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	holder := req.Holder
+	if holder == "" {
+		holder = "codexctl-hibernate"
+	}
+
+	var (
+		hibernated []EnvRecord
+		errs       []error
+	)
+	for _, rec := range records {
+		if !req.hibernatable(rec, time.Now().UTC()) {
+			continue
+		}
+		idle := time.Since(rec.IdleSince()).Truncate(time.Minute)
+		if req.DryRun {
+			logger.Info("would hibernate slot", "slot", rec.Slot, "env", rec.Env, "namespace", rec.Namespace, "idle", idle.String())
+			hibernated = append(hibernated, rec)
+			continue
+		}
+
+		// The record is re-checked under compare-and-swap: a runner may have picked the slot up since List.
+		leased := false
+		_, err := UpdateRecord(ctx, backend, rec.Slot, func(cur EnvRecord) (RecordUpdate, bool, error) {
+			now := time.Now().UTC()
+			leased = req.hibernatable(cur, now)
+			return RecordUpdate{
+				Phase: PhaseHibernated,
+				Lease: &Lease{Holder: holder, RenewedAt: now, Duration: hibernateLeaseDuration},
+			}, leased, nil
+		})
+		if errors.Is(err, ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("lease slot %d: %w", rec.Slot, err))
+			continue
+		}
+		if !leased {
+			logger.Info("skipping slot picked up by a runner", "slot", rec.Slot)
+			continue
+		}
+
+		logger.Info("hibernating slot", "slot", rec.Slot, "env", rec.Env, "namespace", rec.Namespace, "idle", idle.String())
+		if req.Scale != nil {
+			err = req.Scale(ctx, rec)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("hibernate slot %d: %w", rec.Slot, err))
+		} else {
+			hibernated = append(hibernated, rec)
+		}
+		if err := ReleaseLease(context.WithoutCancel(ctx), backend, rec.Slot, holder, RecordUpdate{}); err != nil {
+			logger.Warn("failed to release hibernate lease", "slot", rec.Slot, "error", err)
+		}
+	}
+	return hibernated, errors.Join(errs...)
+}
@@ -0,0 +1,176 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// maxUpdateAttempts bounds the compare-and-swap retries of UpdateRecord.
+const maxUpdateAttempts = 5
+
+// ErrRecordNotFound reports that no record exists for the slot.
+var ErrRecordNotFound = errors.New("state record not found")
+
+// LeaseHeldError reports that another runner holds an active lease on the slot.
+type LeaseHeldError struct {
+	// Slot is the slot number.
+	Slot int
+	// Lease is the active lease.
+	Lease Lease
+}
+
+func (e *LeaseHeldError) Error() string {
+	return fmt.Sprintf("slot %d is held by %s until %s", e.Slot, e.Lease.Holder, e.Lease.ExpiresAt().UTC().Format(time.RFC3339))
+}
+
+// FindRecord returns the record of slot or ErrRecordNotFound.
+func FindRecord(ctx context.Context, backend StateBackend, slot int) (EnvRecord, error) {
+	records, err := backend.List(ctx)
+	if err != nil {
+		return EnvRecord{}, err
+	}
+	for _, rec := range records {
+		if rec.Slot == slot {
+			return rec, nil
+		}
+	}
+	return EnvRecord{}, fmt.Errorf("slot %d: %w", slot, ErrRecordNotFound)
+}
+
+// UpdateRecord reads the record of slot, builds an update from it with mutate and stores it with
+// compare-and-swap, re-reading and retrying when a concurrent change wins. mutate returning false skips
+// the update. The record as seen by the last mutate call is returned.
+func UpdateRecord(ctx context.Context, backend StateBackend, slot int, mutate func(EnvRecord) (RecordUpdate, bool, error)) (EnvRecord, error) {
+	var lastErr error
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		rec, err := FindRecord(ctx, backend, slot)
+		if err != nil {
+			return rec, err
+		}
+		upd, ok, err := mutate(rec)
+		if err != nil || !ok {
+			return rec, err
+		}
+		upd.ResourceVersion = rec.ResourceVersion
+		err = backend.Update(ctx, slot, upd)
+		if err == nil {
+			return rec, nil
+		}
+		if !errors.Is(err, ErrConflict) {
+			return rec, err
+		}
+		lastErr = err
+	}
+	return EnvRecord{}, fmt.Errorf("update slot %d after %d attempts: %w", slot, maxUpdateAttempts, lastErr)
+}
+
+// AcquireLease makes holder the lease holder of slot for duration and applies the other fields of upd
+// (e.g. the phase) in the same update. It fails with *LeaseHeldError when another holder's lease is still
+// active; an expired lease (e.g. of a crashed runner) is taken over.
+func AcquireLease(ctx context.Context, backend StateBackend, slot int, holder string, duration time.Duration, upd RecordUpdate) (EnvRecord, error) {
+	return UpdateRecord(ctx, backend, slot, func(rec EnvRecord) (RecordUpdate, bool, error) {
+		now := time.Now().UTC()
+		if rec.Lease.Holder != holder && rec.Lease.Active(now) {
+			return RecordUpdate{}, false, &LeaseHeldError{Slot: slot, Lease: rec.Lease}
+		}
+		upd.Lease = &Lease{Holder: holder, RenewedAt: now, Duration: duration}
+		return upd, true, nil
+	})
+}
+
+// RenewLease extends the lease of holder on slot. It fails with *LeaseHeldError when the lease was
+// taken over by another holder after it expired.
+func RenewLease(ctx context.Context, backend StateBackend, slot int, holder string, duration time.Duration) error {
+	_, err := UpdateRecord(ctx, backend, slot, func(rec EnvRecord) (RecordUpdate, bool, error) {
+		if rec.Lease.Holder != "" && rec.Lease.Holder != holder {
+			return RecordUpdate{}, false, &LeaseHeldError{Slot: slot, Lease: rec.Lease}
+		}
+		return RecordUpdate{Lease: &Lease{Holder: holder, RenewedAt: time.Now().UTC(), Duration: duration}}, true, nil
+	})
+	return err
+}
+
+// confirmLease renews the lease of holder on slot like RenewLease, but fails with *LeaseHeldError as well when
+// the lease was cleared, so that the caller knows it still owns the slot for duration.
+func confirmLease(ctx context.Context, backend StateBackend, slot int, holder string, duration time.Duration) error {
+	_, err := UpdateRecord(ctx, backend, slot, func(rec EnvRecord) (RecordUpdate, bool, error) {
+		if rec.Lease.Holder != holder {
+			return RecordUpdate{}, false, &LeaseHeldError{Slot: slot, Lease: rec.Lease}
+		}
+		return RecordUpdate{Lease: &Lease{Holder: holder, RenewedAt: time.Now().UTC(), Duration: duration}}, true, nil
+	})
+	return err
+}
+
+// renewLeaseWhile renews the lease of holder on slot every third of duration until the returned function is
+// called. The returned context is derived from ctx and canceled when the lease was taken over or the record
+// released, so that the work guarded by the lease stops.
+func renewLeaseWhile(ctx context.Context, logger *slog.Logger, backend StateBackend, slot int, holder string, duration time.Duration) (context.Context, func()) {
+	workCtx, cancel := context.WithCancelCause(ctx)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(duration / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-workCtx.Done():
+				return
+			case <-ticker.C:
+			}
+			renewCtx, cancelRenew := context.WithTimeout(workCtx, 30*time.Second)
+			err := confirmLease(renewCtx, backend, slot, holder, duration)
+			cancelRenew()
+			var held *LeaseHeldError
+			switch {
+			case errors.As(err, &held), errors.Is(err, ErrRecordNotFound):
+				logger.Error("lease lost while working in the slot; stopping", "slot", slot, "holder", holder, "error", err)
+				cancel(fmt.Errorf("lease of slot %d lost: %w", slot, err))
+				return
+			case err != nil:
+				logger.Warn("failed to renew lease", "slot", slot, "holder", holder, "error", err)
+			}
+		}
+	}()
+	return workCtx, func() {
+		close(done)
+		<-stopped
+		cancel(nil)
+	}
+}
+
+// ReleaseLease clears the lease of slot when it is still held by holder and applies the other fields of
+// upd in the same update.
+func ReleaseLease(ctx context.Context, backend StateBackend, slot int, holder string, upd RecordUpdate) error {
+	_, err := UpdateRecord(ctx, backend, slot, func(rec EnvRecord) (RecordUpdate, bool, error) {
+		if rec.Lease.Holder != holder {
+			return RecordUpdate{}, false, nil
+		}
+		upd.Lease = &Lease{}
+		return upd, true, nil
+	})
+	return err
+}
+
+// TouchActivity records at as the last activity time of slot unless a later time is already stored, and
+// moves the slot to phase when set. A slot held by an active lease keeps its phase, and so does a hibernated
+// slot until it is woken.
+func TouchActivity(ctx context.Context, backend StateBackend, slot int, at time.Time, phase string) error {
+	_, err := UpdateRecord(ctx, backend, slot, func(rec EnvRecord) (RecordUpdate, bool, error) {
+		var upd RecordUpdate
+		if at.After(rec.LastActivityAt) {
+			upd.LastActivityAt = at.UTC()
+		}
+		if phase != "" && phase != rec.Phase && rec.Phase != PhaseHibernated && !rec.Lease.Active(time.Now()) {
+			upd.Phase = phase
+		}
+		return upd, !upd.empty(), nil
+	})
+	return err
+}
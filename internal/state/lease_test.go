@@ -0,0 +1,150 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUpdateRecordRetriesOnConflict(t *testing.T) {
+	c := newFakeCluster(t)
+	c.seed(testRecord(1, time.Hour))
+	c.beforePatch = func(n int) {
+		if n == 1 {
+			c.store(1, RecordUpdate{Issue: 7})
+		}
+	}
+
+	var seen []int
+	rec, err := UpdateRecord(context.Background(), c.backend, 1, func(rec EnvRecord) (RecordUpdate, bool, error) {
+		seen = append(seen, rec.Issue)
+		return RecordUpdate{PR: 9}, true, nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateRecord: %v", err)
+	}
+	if c.patches != 2 {
+		t.Errorf("patches = %d, want 2", c.patches)
+	}
+	if len(seen) != 2 || seen[0] != 0 || seen[1] != 7 {
+		t.Errorf("mutate saw issues %v, want [0 7]", seen)
+	}
+	if rec.Issue != 7 {
+		t.Errorf("returned issue = %d, want 7", rec.Issue)
+	}
+	stored, _ := c.record(1)
+	if stored.Issue != 7 || stored.PR != 9 {
+		t.Errorf("stored issue/pr = %d/%d, want 7/9", stored.Issue, stored.PR)
+	}
+}
+
+func TestUpdateRecordGivesUpAfterMaxAttempts(t *testing.T) {
+	c := newFakeCluster(t)
+	c.seed(testRecord(1, time.Hour))
+	c.beforePatch = func(n int) {
+		c.store(1, RecordUpdate{Issue: n})
+	}
+
+	_, err := UpdateRecord(context.Background(), c.backend, 1, func(EnvRecord) (RecordUpdate, bool, error) {
+		return RecordUpdate{PR: 9}, true, nil
+	})
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("UpdateRecord error = %v, want ErrConflict", err)
+	}
+	if c.patches != maxUpdateAttempts {
+		t.Errorf("patches = %d, want %d", c.patches, maxUpdateAttempts)
+	}
+	if stored, _ := c.record(1); stored.PR != 0 {
+		t.Errorf("stored pr = %d, want the update to be dropped", stored.PR)
+	}
+}
+
+func TestUpdateRecordMissingSlot(t *testing.T) {
+	c := newFakeCluster(t)
+	c.seed(testRecord(1, time.Hour))
+
+	_, err := UpdateRecord(context.Background(), c.backend, 2, func(EnvRecord) (RecordUpdate, bool, error) {
+		t.Fatal("mutate called for a missing slot")
+		return RecordUpdate{}, false, nil
+	})
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("UpdateRecord error = %v, want ErrRecordNotFound", err)
+	}
+}
+
+func TestAcquireLease(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	tests := []struct {
+		name string
+		// lease is stored with the record.
+		lease Lease
+		// race is stored by a concurrent runner right before the first patch.
+		race       *Lease
+		wantHeld   bool
+		wantHolder string
+	}{
+		{
+			name:       "free slot",
+			wantHolder: "runner-a",
+		},
+		{
+			name:       "active lease of another holder",
+			lease:      Lease{Holder: "runner-b", RenewedAt: now, Duration: time.Hour},
+			wantHeld:   true,
+			wantHolder: "runner-b",
+		},
+		{
+			name:       "expired lease of another holder is taken over",
+			lease:      Lease{Holder: "runner-b", RenewedAt: now.Add(-2 * time.Hour), Duration: time.Hour},
+			wantHolder: "runner-a",
+		},
+		{
+			name:       "own active lease is renewed",
+			lease:      Lease{Holder: "runner-a", RenewedAt: now, Duration: time.Hour},
+			wantHolder: "runner-a",
+		},
+		{
+			name:       "another holder wins the race after the read",
+			race:       &Lease{Holder: "runner-b", RenewedAt: now, Duration: time.Hour},
+			wantHeld:   true,
+			wantHolder: "runner-b",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newFakeCluster(t)
+			rec := testRecord(1, time.Hour)
+			rec.Lease = tt.lease
+			c.seed(rec)
+			if tt.race != nil {
+				c.beforePatch = func(n int) {
+					if n == 1 {
+						c.store(1, RecordUpdate{Lease: tt.race})
+					}
+				}
+			}
+
+			_, err := AcquireLease(context.Background(), c.backend, 1, "runner-a", 10*time.Minute, RecordUpdate{Phase: PhaseRunning})
+			var held *LeaseHeldError
+			if got := errors.As(err, &held); got != tt.wantHeld {
+				t.Fatalf("AcquireLease error = %v, want lease held %v", err, tt.wantHeld)
+			}
+			if !tt.wantHeld && err != nil {
+				t.Fatalf("AcquireLease: %v", err)
+			}
+
+			stored, _ := c.record(1)
+			if stored.Lease.Holder != tt.wantHolder {
+				t.Errorf("stored holder = %q, want %q", stored.Lease.Holder, tt.wantHolder)
+			}
+			wantPhase := PhaseIdle
+			if !tt.wantHeld {
+				wantPhase = PhaseRunning
+			}
+			if stored.Phase != wantPhase {
+				t.Errorf("stored phase = %q, want %q", stored.Phase, wantPhase)
+			}
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultLocalStatePath is the state file used by the local backend when state.path is empty.
+	defaultLocalStatePath = ".codexctl/state.json"
+	// localLockRetry is how often a locked state file is re-checked.
+	localLockRetry = 100 * time.Millisecond
+	// localLockTimeout bounds the wait for the state file lock.
+	localLockTimeout = 10 * time.Second
+	// localLockStale is the age after which a left-over lock file of a crashed process is removed.
+	localLockStale = time.Minute
+	// localVersionField is the record field holding the revision counter used for compare-and-swap.
+	localVersionField = "resourceVersion"
+)
+
+// localBackend stores all slots in a JSON file guarded by a lock file, for dev and tests.
+type localBackend struct {
+	// logger reports allocation progress.
+	logger *slog.Logger
+	// path is the state file path.
+	path string
+	// prefix is the record name prefix.
+	prefix string
+}
+
+// localState is the content of the state file.
+type localState struct {
+	// Records maps record names to their fields (the ConfigMap data layout).
+	Records map[string]map[string]string `json:"records"`
+	// Queues maps environment names to their slot queues.
+	Queues map[string]*localQueue `json:"queues,omitempty"`
+	// Snapshots maps environment names to their snapshot catalogs.
+	Snapshots map[string]*localSnapshots `json:"snapshots,omitempty"`
+}
+
+// localQueue is a slot queue in the state file.
+type localQueue struct {
+	// Version is the revision counter used for compare-and-swap.
+	Version int `json:"version"`
+	// Entries are the waiters in serving order.
+	Entries []QueueEntry `json:"entries"`
+}
+
+// localSnapshots is a snapshot catalog in the state file.
+type localSnapshots struct {
+	// Version is the revision counter used for compare-and-swap.
+	Version int `json:"version"`
+	// Items are the snapshots sorted by name.
+	Items []Snapshot `json:"items"`
+}
+
+// newLocalBackend constructs the local file state backend.
+func newLocalBackend(logger *slog.Logger, path, prefix string) *localBackend {
+	return &localBackend{logger: logger, path: path, prefix: prefix}
+}
+
+// resolveStatePath resolves state.path against the project root, defaulting to .codexctl/state.json.
+func resolveStatePath(projectRoot, path string) string {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		path = defaultLocalStatePath
+	}
+	if filepath.IsAbs(path) || projectRoot == "" {
+		return path
+	}
+	return filepath.Join(projectRoot, path)
+}
+
+// List returns all stored environment records.
+func (s *localBackend) List(ctx context.Context) ([]EnvRecord, error) {
+	var res []EnvRecord
+	err := s.withState(ctx, false, func(st *localState) error {
+		for name, fields := range st.Records {
+			if _, ok := slotFromName(s.prefix, name); ok {
+				rec := recordFromFields(name, fields)
+				rec.ResourceVersion = fields[localVersionField]
+				res = append(res, rec)
+			}
+		}
+		return nil
+	})
+	sortRecords(res)
+	return res, err
+}
+
+// Allocate reserves a new slot by adding its record to the state file.
+func (s *localBackend) Allocate(ctx context.Context, req AllocateRequest) (EnvRecord, error) {
+	return allocateSlot(ctx, s.logger, s.prefix, req, func(ctx context.Context, rec EnvRecord) error {
+		return s.withState(ctx, true, func(st *localState) error {
+			if _, ok := st.Records[rec.Name]; ok {
+				return errSlotTaken
+			}
+			fields := recordFields(rec)
+			fields[localVersionField] = "1"
+			st.Records[rec.Name] = fields
+			return nil
+		})
+	})
+}
+
+// Update changes the fields set in upd in the slot record and bumps its version.
+func (s *localBackend) Update(ctx context.Context, slot int, upd RecordUpdate) error {
+	if slot <= 0 || upd.empty() {
+		return nil
+	}
+	name := recordName(s.prefix, slot)
+	return s.withState(ctx, true, func(st *localState) error {
+		fields, ok := st.Records[name]
+		if !ok {
+			return fmt.Errorf("state record %s not found in %s", name, s.path)
+		}
+		version, _ := strconv.Atoi(fields[localVersionField])
+		if upd.ResourceVersion != "" && upd.ResourceVersion != fields[localVersionField] {
+			return fmt.Errorf("update state record %s: %w", name, ErrConflict)
+		}
+		for k, v := range updateFields(upd) {
+			fields[k] = v
+		}
+		fields[localVersionField] = strconv.Itoa(version + 1)
+		return nil
+	})
+}
+
+// Release removes the slot record from the state file.
+func (s *localBackend) Release(ctx context.Context, slot int) error {
+	name := recordName(s.prefix, slot)
+	return s.withState(ctx, true, func(st *localState) error {
+		delete(st.Records, name)
+		return nil
+	})
+}
+
+// GC destroys and releases the expired environment records and returns them.
+func (s *localBackend) GC(ctx context.Context, req GCRequest) ([]EnvRecord, error) {
+	return collectGarbage(ctx, s.logger, s, req)
+}
+
+// LoadQueue returns the slot queue of env stored in the state file.
+func (s *localBackend) LoadQueue(ctx context.Context, env string) (Queue, error) {
+	var q Queue
+	err := s.withState(ctx, false, func(st *localState) error {
+		if lq := st.Queues[env]; lq != nil {
+			q = Queue{Entries: lq.Entries, ResourceVersion: strconv.Itoa(lq.Version)}
+		}
+		return nil
+	})
+	return q, err
+}
+
+// StoreQueue replaces the slot queue of env in the state file and bumps its version.
+func (s *localBackend) StoreQueue(ctx context.Context, env string, q Queue) error {
+	return s.withState(ctx, true, func(st *localState) error {
+		version := ""
+		lq := st.Queues[env]
+		if lq != nil {
+			version = strconv.Itoa(lq.Version)
+		}
+		if q.ResourceVersion != version {
+			return fmt.Errorf("update %s slot queue: %w", env, ErrConflict)
+		}
+		if lq == nil {
+			lq = &localQueue{}
+			if st.Queues == nil {
+				st.Queues = map[string]*localQueue{}
+			}
+			st.Queues[env] = lq
+		}
+		lq.Version++
+		lq.Entries = q.Entries
+		return nil
+	})
+}
+
+// LoadSnapshots returns the snapshot catalog of env stored in the state file.
+func (s *localBackend) LoadSnapshots(ctx context.Context, env string) (Snapshots, error) {
+	var snaps Snapshots
+	err := s.withState(ctx, false, func(st *localState) error {
+		if ls := st.Snapshots[env]; ls != nil {
+			snaps = Snapshots{Items: ls.Items, ResourceVersion: strconv.Itoa(ls.Version)}
+		}
+		return nil
+	})
+	return snaps, err
+}
+
+// StoreSnapshots replaces the snapshot catalog of env in the state file and bumps its version.
+func (s *localBackend) StoreSnapshots(ctx context.Context, env string, snaps Snapshots) error {
+	return s.withState(ctx, true, func(st *localState) error {
+		version := ""
+		ls := st.Snapshots[env]
+		if ls != nil {
+			version = strconv.Itoa(ls.Version)
+		}
+		if snaps.ResourceVersion != version {
+			return fmt.Errorf("update %s snapshots: %w", env, ErrConflict)
+		}
+		if ls == nil {
+			ls = &localSnapshots{}
+			if st.Snapshots == nil {
+				st.Snapshots = map[string]*localSnapshots{}
+			}
+			st.Snapshots[env] = ls
+		}
+		ls.Version++
+		ls.Items = snaps.Items
+		return nil
+	})
+}
+
+// withState runs fn on the state file content while holding the file lock and, when write is set and
+// fn succeeds, atomically replaces the file with the modified content.
+func (s *localBackend) withState(ctx context.Context, write bool, fn func(*localState) error) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	st := &localState{Records: map[string]map[string]string{}}
+	raw, err := os.ReadFile(s.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("read state file: %w", err)
+	case len(strings.TrimSpace(string(raw))) > 0:
+		if err := json.Unmarshal(raw, st); err != nil {
+			return fmt.Errorf("parse state file %s: %w", s.path, err)
+		}
+		if st.Records == nil {
+			st.Records = map[string]map[string]string{}
+		}
+	}
+
+	if err := fn(st); err != nil {
+		return err
+	}
+	if !write {
+		return nil
+	}
+
+	out, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode state file: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, append(out, '\n'), 0o644); err != nil {
+		return fmt.Errorf("write state file: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("replace state file: %w", err)
+	}
+	return nil
+}
+
+// lock acquires the lock file next to the state file, removing locks left by crashed processes.
+func (s *localBackend) lock(ctx context.Context) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return nil, fmt.Errorf("create state directory: %w", err)
+	}
+	lockPath := s.path + ".lock"
+	ctx, cancel := context.WithTimeout(ctx, localLockTimeout)
+	defer cancel()
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			_, _ = fmt.Fprintf(f, "%d\n", os.Getpid())
+			_ = f.Close()
+			return func() { _ = os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("lock state file: %w", err)
+		}
+		if info, statErr := os.Stat(lockPath); statErr == nil && time.Since(info.ModTime()) > localLockStale {
+			s.logger.Warn("removing stale state lock", "path", lockPath)
+			_ = os.Remove(lockPath)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("lock state file %s: %w", s.path, ctx.Err())
+		case <-time.After(localLockRetry):
+		}
+	}
+}
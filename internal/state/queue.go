@@ -0,0 +1,138 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// QueueEntryTTL is how long a queue entry stays valid without a heartbeat; entries of crashed waiters
+// are dropped after it.
+const QueueEntryTTL = 3 * time.Minute
+
+// QueueEntry is a runner waiting for a free slot of an environment.
+type QueueEntry struct {
+	// ID identifies the waiter (its lease holder).
+	ID string `json:"id"`
+	// Issue is the GitHub issue the slot is requested for, if any.
+	Issue int `json:"issue,omitempty"`
+	// PR is the GitHub pull request the slot is requested for, if any.
+	PR int `json:"pr,omitempty"`
+	// Priority orders the queue before the arrival time; higher values are served first.
+	Priority int `json:"priority,omitempty"`
+	// EnqueuedAt is the time the waiter joined the queue.
+	EnqueuedAt time.Time `json:"enqueuedAt"`
+	// HeartbeatAt is the last time the waiter confirmed it is still waiting.
+	HeartbeatAt time.Time `json:"heartbeatAt"`
+}
+
+// Queue is the stored slot queue of an environment.
+type Queue struct {
+	// Entries are the waiters in serving order.
+	Entries []QueueEntry
+	// ResourceVersion identifies the stored revision for compare-and-swap updates; empty when the queue
+	// was never stored.
+	ResourceVersion string
+}
+
+// Position returns the 1-based position of the entry with id, or 0 when it is not queued.
+func (q Queue) Position(id string) int {
+	for i, e := range q.Entries {
+		if e.ID == id {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// UpdateQueue reads the slot queue of env, lets mutate change its entries and stores them with
+// compare-and-swap, re-reading and retrying when a concurrent change wins. Entries whose heartbeat is
+// older than QueueEntryTTL are dropped and the rest is kept in serving order: higher priority first,
+// then by arrival. mutate returning false skips the update. The resulting queue is returned.
+func UpdateQueue(ctx context.Context, backend StateBackend, env string, mutate func([]QueueEntry) ([]QueueEntry, bool)) (Queue, error) {
+	var lastErr error
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		q, err := backend.LoadQueue(ctx, env)
+		if err != nil {
+			return Queue{}, err
+		}
+		live := pruneQueue(q.Entries, time.Now())
+		entries, ok := mutate(append([]QueueEntry(nil), live...))
+		if !ok && len(live) == len(q.Entries) {
+			q.Entries = live
+			return q, nil
+		}
+		if !ok {
+			entries = live
+		}
+		sortQueue(entries)
+		next := Queue{Entries: entries, ResourceVersion: q.ResourceVersion}
+		err = backend.StoreQueue(ctx, env, next)
+		if err == nil {
+			return next, nil
+		}
+		if !errors.Is(err, ErrConflict) {
+			return Queue{}, err
+		}
+		lastErr = err
+	}
+	return Queue{}, fmt.Errorf("update %s slot queue after %d attempts: %w", env, maxUpdateAttempts, lastErr)
+}
+
+// Enqueue adds entry to the slot queue of env, or refreshes its heartbeat (and priority) when an entry
+// with the same ID is already queued, keeping its place.
+func Enqueue(ctx context.Context, backend StateBackend, env string, entry QueueEntry) (Queue, error) {
+	now := time.Now().UTC().Truncate(time.Second)
+	return UpdateQueue(ctx, backend, env, func(entries []QueueEntry) ([]QueueEntry, bool) {
+		for i := range entries {
+			if entries[i].ID == entry.ID {
+				entries[i].HeartbeatAt = now
+				entries[i].Priority = entry.Priority
+				return entries, true
+			}
+		}
+		entry.EnqueuedAt = now
+		entry.HeartbeatAt = now
+		return append(entries, entry), true
+	})
+}
+
+// Dequeue removes the entry with id from the slot queue of env; a missing entry is ignored.
+func Dequeue(ctx context.Context, backend StateBackend, env, id string) error {
+	_, err := UpdateQueue(ctx, backend, env, func(entries []QueueEntry) ([]QueueEntry, bool) {
+		for i := range entries {
+			if entries[i].ID == id {
+				return append(entries[:i], entries[i+1:]...), true
+			}
+		}
+		return entries, false
+	})
+	return err
+}
+
+// pruneQueue returns the entries whose heartbeat is not older than QueueEntryTTL at now.
+func pruneQueue(entries []QueueEntry, now time.Time) []QueueEntry {
+	live := make([]QueueEntry, 0, len(entries))
+	for _, e := range entries {
+		if now.Sub(e.HeartbeatAt) <= QueueEntryTTL {
+			live = append(live, e)
+		}
+	}
+	return live
+}
+
+// sortQueue orders entries for serving: higher priority first, then by arrival, then by ID.
+func sortQueue(entries []QueueEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		if !a.EnqueuedAt.Equal(b.EnqueuedAt) {
+			return a.EnqueuedAt.Before(b.EnqueuedAt)
+		}
+		return a.ID < b.ID
+	})
+}
@@ -0,0 +1,115 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/codex-k8s/codexctl/internal/kube"
+)
+
+// ErrSnapshotExists reports that a snapshot with the same name is already recorded for the environment.
+var ErrSnapshotExists = errors.New("snapshot already exists")
+
+// Snapshot is the metadata of a set of VolumeSnapshots taken from an environment namespace.
+type Snapshot struct {
+	// Name is the snapshot name, unique per environment.
+	Name string `json:"name" yaml:"name"`
+	// Env is the environment the snapshot was taken from.
+	Env string `json:"env" yaml:"env"`
+	// Slot is the slot the snapshot was taken from (0 for environments without slots).
+	Slot int `json:"slot,omitempty" yaml:"slot,omitempty"`
+	// Namespace holds the VolumeSnapshots.
+	Namespace string `json:"namespace" yaml:"namespace"`
+	// CreatedAt is the time the snapshot was taken.
+	CreatedAt time.Time `json:"createdAt" yaml:"createdAt"`
+	// Volumes are the captured claims.
+	Volumes []kube.SnapshotVolume `json:"volumes" yaml:"volumes"`
+}
+
+// Snapshots is the stored snapshot catalog of an environment.
+type Snapshots struct {
+	// Items are the snapshots sorted by name.
+	Items []Snapshot
+	// ResourceVersion identifies the stored revision for compare-and-swap updates; empty when the catalog
+	// was never stored.
+	ResourceVersion string
+}
+
+// Find returns the snapshot called name.
+func (s Snapshots) Find(name string) (Snapshot, bool) {
+	for _, snap := range s.Items {
+		if snap.Name == name {
+			return snap, true
+		}
+	}
+	return Snapshot{}, false
+}
+
+// UpdateSnapshots reads the snapshot catalog of env, lets mutate change it and stores it with
+// compare-and-swap, re-reading and retrying when a concurrent change wins. mutate returning false skips
+// the update; a mutate error aborts it. The resulting catalog is returned.
+func UpdateSnapshots(ctx context.Context, backend StateBackend, env string, mutate func([]Snapshot) ([]Snapshot, bool, error)) (Snapshots, error) {
+	var lastErr error
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		snaps, err := backend.LoadSnapshots(ctx, env)
+		if err != nil {
+			return Snapshots{}, err
+		}
+		items, ok, err := mutate(append([]Snapshot(nil), snaps.Items...))
+		if err != nil {
+			return Snapshots{}, err
+		}
+		if !ok {
+			return snaps, nil
+		}
+		sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+		next := Snapshots{Items: items, ResourceVersion: snaps.ResourceVersion}
+		err = backend.StoreSnapshots(ctx, env, next)
+		if err == nil {
+			return next, nil
+		}
+		if !errors.Is(err, ErrConflict) {
+			return Snapshots{}, err
+		}
+		lastErr = err
+	}
+	return Snapshots{}, fmt.Errorf("update %s snapshots after %d attempts: %w", env, maxUpdateAttempts, lastErr)
+}
+
+// CheckSnapshotName fails with ErrSnapshotExists when env already has a snapshot called name.
+func CheckSnapshotName(ctx context.Context, backend StateBackend, env, name string) error {
+	snaps, err := backend.LoadSnapshots(ctx, env)
+	if err != nil {
+		return err
+	}
+	if _, ok := snaps.Find(name); ok {
+		return fmt.Errorf("%s snapshot %q: %w", env, name, ErrSnapshotExists)
+	}
+	return nil
+}
+
+// RecordSnapshot adds snap to the catalog of snap.Env and fails with ErrSnapshotExists when the name is taken.
+func RecordSnapshot(ctx context.Context, backend StateBackend, snap Snapshot) error {
+	_, err := UpdateSnapshots(ctx, backend, snap.Env, func(items []Snapshot) ([]Snapshot, bool, error) {
+		for _, item := range items {
+			if item.Name == snap.Name {
+				return nil, false, fmt.Errorf("%s snapshot %q: %w", snap.Env, snap.Name, ErrSnapshotExists)
+			}
+		}
+		return append(items, snap), true, nil
+	})
+	return err
+}
+
+// FindSnapshot returns the snapshot of env called name, or false when it is not recorded.
+func FindSnapshot(ctx context.Context, backend StateBackend, env, name string) (Snapshot, bool, error) {
+	snaps, err := backend.LoadSnapshots(ctx, env)
+	if err != nil {
+		return Snapshot{}, false, err
+	}
+	snap, ok := snaps.Find(name)
+	return snap, ok, nil
+}
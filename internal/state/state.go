@@ -1,12 +1,13 @@
-// Package state defines the backend used to persist environment and slot state.
+// Package state defines the backends used to persist environment and slot state.
 package state
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -15,12 +16,71 @@ import (
 	"github.com/codex-k8s/codexctl/internal/kube"
 )
 
-// Store manages environment and slot records using a chosen backend.
-type Store struct {
-	client    *kube.Client
-	logger    *slog.Logger
-	namespace string
-	prefix    string
+// Supported values of state.backend.
+const (
+	// BackendConfigMap stores one ConfigMap per slot (the default).
+	BackendConfigMap = "configmap"
+	// BackendCRD stores one CodexSlot custom resource per slot.
+	BackendCRD = "crd"
+	// BackendLocal stores all slots in a local JSON file (for dev and tests).
+	BackendLocal = "local"
+)
+
+// defaultRecordPrefix is the record name prefix used when state.configmapPrefix is empty.
+const defaultRecordPrefix = "codex-env-"
+
+// Lifecycle phases of a slot record.
+const (
+	// PhaseAllocating marks a slot that was reserved but whose environment is not deployed yet.
+	PhaseAllocating = "allocating"
+	// PhaseWarming marks a warm pool slot whose environment is being provisioned.
+	PhaseWarming = "warming"
+	// PhaseWarm marks a provisioned warm pool slot that is not assigned to an issue or PR yet.
+	PhaseWarm = "warm"
+	// PhaseReady marks a deployed slot that is waiting for work.
+	PhaseReady = "ready"
+	// PhaseRunning marks a slot in which an agent run holds the lease.
+	PhaseRunning = "running"
+	// PhaseIdle marks a slot whose last agent run finished.
+	PhaseIdle = "idle"
+	// PhaseDestroying marks a slot whose environment is being torn down.
+	PhaseDestroying = "destroying"
+	// PhaseHibernated marks an idle slot whose workloads were scaled to zero; it is woken on the next use.
+	PhaseHibernated = "hibernated"
+)
+
+const (
+	// gcLeaseDuration bounds how long GC holds the lease of a slot it destroys.
+	gcLeaseDuration = 30 * time.Minute
+	// hibernateLeaseDuration bounds how long hibernation holds the lease of a slot it scales down.
+	hibernateLeaseDuration = 10 * time.Minute
+)
+
+// StateBackend persists environment slot records.
+type StateBackend interface {
+	// List returns all stored environment records sorted by slot.
+	List(ctx context.Context) ([]EnvRecord, error)
+	// Allocate reserves the first free slot of the request's search order and returns its record.
+	// It fails with *NoFreeSlotError when every candidate slot is taken.
+	Allocate(ctx context.Context, req AllocateRequest) (EnvRecord, error)
+	// Update changes the fields of the slot record that are set in upd. When upd.ResourceVersion is set,
+	// the update is a compare-and-swap and fails with ErrConflict if the record changed since it was read.
+	Update(ctx context.Context, slot int, upd RecordUpdate) error
+	// Release deletes the record of slot; missing records are ignored.
+	Release(ctx context.Context, slot int) error
+	// GC releases the records expired according to req whose lease is not active and returns them
+	// (in dry-run mode, the records it would release).
+	GC(ctx context.Context, req GCRequest) ([]EnvRecord, error)
+	// LoadQueue returns the stored slot queue of env; a queue that was never stored is empty.
+	LoadQueue(ctx context.Context, env string) (Queue, error)
+	// StoreQueue replaces the slot queue of env with a compare-and-swap against q.ResourceVersion and
+	// fails with ErrConflict when the queue changed since it was loaded.
+	StoreQueue(ctx context.Context, env string, q Queue) error
+	// LoadSnapshots returns the stored snapshot catalog of env; a catalog that was never stored is empty.
+	LoadSnapshots(ctx context.Context, env string) (Snapshots, error)
+	// StoreSnapshots replaces the snapshot catalog of env with a compare-and-swap against
+	// snaps.ResourceVersion and fails with ErrConflict when the catalog changed since it was loaded.
+	StoreSnapshots(ctx context.Context, env string, snaps Snapshots) error
 }
 
 // EnvRecord represents a single allocated environment slot.
@@ -37,8 +97,159 @@ type EnvRecord struct {
 	PR int
 	// CreatedAt is the timestamp when the slot was allocated.
 	CreatedAt time.Time
-	// ConfigName is the backing ConfigMap name used for state.
-	ConfigName string
+	// Name is the name of the backing record (ConfigMap, CodexSlot or local file entry).
+	Name string
+	// ResourceVersion identifies the stored revision of the record for compare-and-swap updates.
+	ResourceVersion string
+	// Lease is held by the runner currently working in the slot.
+	Lease Lease
+	// LastActivityAt is the last time a command worked in the slot (zero for records written before it
+	// was tracked).
+	LastActivityAt time.Time
+	// Owner is the GitHub Actions run id (or "manual") that allocated the slot or claimed it from the warm
+	// pool.
+	Owner string
+	// Branch is the git branch the agent works on.
+	Branch string
+	// HeadSHA is the last known head commit of Branch.
+	HeadSHA string
+	// PromptKind is the builtin prompt kind of the last agent run (e.g. dev_issue).
+	PromptKind string
+	// Model is the model of the last agent run.
+	Model string
+	// Phase is the lifecycle phase (one of the Phase* constants).
+	Phase string
+}
+
+// IdleSince returns the start of the current idle period: the last activity, or the allocation time
+// when no activity was recorded.
+func (r EnvRecord) IdleSince() time.Time {
+	if r.LastActivityAt.After(r.CreatedAt) {
+		return r.LastActivityAt
+	}
+	return r.CreatedAt
+}
+
+// Lease marks the runner working in a slot. A lease that is not renewed within Duration expires, so
+// the slot of a crashed runner can be taken over.
+type Lease struct {
+	// Holder identifies the runner (empty when the slot is not held).
+	Holder string
+	// RenewedAt is the time of the last heartbeat.
+	RenewedAt time.Time
+	// Duration is how long the lease stays valid after RenewedAt.
+	Duration time.Duration
+}
+
+// Active reports whether the lease is held and not expired at now.
+func (l Lease) Active(now time.Time) bool {
+	return l.Holder != "" && now.Before(l.RenewedAt.Add(l.Duration))
+}
+
+// ExpiresAt returns the time the lease expires unless renewed.
+func (l Lease) ExpiresAt() time.Time {
+	return l.RenewedAt.Add(l.Duration)
+}
+
+// AllocateRequest describes a slot allocation.
+type AllocateRequest struct {
+	// StackConfig is used to resolve the namespace of every candidate slot.
+	StackConfig *config.StackConfig
+	// BaseContext is the template context for namespace resolution; GITHUB_RUN_ID from its EnvMap is
+	// recorded as the slot owner.
+	BaseContext config.TemplateContext
+	// Env is the environment name.
+	Env string
+	// MaxSlots limits the slot range; 0 means unlimited.
+	MaxSlots int
+	// Prefer is tried first when > 0.
+	Prefer int
+	// Issue is the associated GitHub issue number, if any.
+	Issue int
+	// PR is the associated GitHub pull request number, if any.
+	PR int
+	// Phase is the initial lifecycle phase; PhaseAllocating when empty.
+	Phase string
+}
+
+// RecordUpdate lists record fields to change; zero values leave the stored value untouched.
+type RecordUpdate struct {
+	// ResourceVersion makes the update a compare-and-swap against this record revision when set.
+	ResourceVersion string
+	// Namespace replaces the slot namespace.
+	Namespace string
+	// Issue replaces the associated issue number.
+	Issue int
+	// PR replaces the associated pull request number.
+	PR int
+	// ClearLinks removes the associated issue and pull request (Issue and PR are ignored).
+	ClearLinks bool
+	// Owner replaces the owning run.
+	Owner string
+	// CreatedAt replaces the allocation time when non-zero (a claimed warm slot counts as allocated then).
+	CreatedAt time.Time
+	// Lease replaces the lease when set; a lease with an empty Holder clears it.
+	Lease *Lease
+	// LastActivityAt replaces the last activity time when non-zero.
+	LastActivityAt time.Time
+	// Branch replaces the working branch.
+	Branch string
+	// HeadSHA replaces the head commit.
+	HeadSHA string
+	// PromptKind replaces the prompt kind of the last run.
+	PromptKind string
+	// Model replaces the model of the last run.
+	Model string
+	// Phase replaces the lifecycle phase.
+	Phase string
+}
+
+// empty reports whether the update changes nothing.
+func (u RecordUpdate) empty() bool {
+	return len(updateFields(u)) == 0
+}
+
+// GCRequest describes a garbage collection run. A record expires when it is older than TTL or has been
+// idle for longer than Idle; a zero threshold is not checked, and TTL defaults to 24h when both are zero.
+type GCRequest struct {
+	// Env limits the collection to records of this environment when non-empty.
+	Env string
+	// TTL is the maximum age of a record since allocation.
+	TTL time.Duration
+	// Idle is the maximum time since the last activity in the slot.
+	Idle time.Duration
+	// DryRun reports the expired records without touching them.
+	DryRun bool
+	// Holder is the lease holder GC takes on a record while it is destroyed; "codexctl-gc" when empty.
+	Holder string
+	// Keep is consulted for every expired record; a non-empty reason keeps the record. An error keeps
+	// the record as well and is logged.
+	Keep func(ctx context.Context, rec EnvRecord) (string, error)
+	// Destroy tears down the environment of an expired record before the record is released; the record
+	// is kept when it fails.
+	Destroy func(ctx context.Context, rec EnvRecord) error
+}
+
+// expiry returns why rec is expired at now, or "" when it is not.
+func (req GCRequest) expiry(rec EnvRecord, now time.Time) string {
+	ttl := req.TTL
+	if ttl <= 0 && req.Idle <= 0 {
+		ttl = 24 * time.Hour
+	}
+	if rec.CreatedAt.IsZero() {
+		return ""
+	}
+	if age := now.Sub(rec.CreatedAt); ttl > 0 && age >= ttl {
+		return fmt.Sprintf("age %s exceeds ttl %s", age.Truncate(time.Minute), ttl)
+	}
+	// Warm pool slots wait for work by design; only their age counts.
+	if rec.Phase == PhaseWarm || rec.Phase == PhaseWarming {
+		return ""
+	}
+	if idle := now.Sub(rec.IdleSince()); req.Idle > 0 && idle >= req.Idle {
+		return fmt.Sprintf("idle for %s (limit %s)", idle.Truncate(time.Minute), req.Idle)
+	}
+	return ""
 }
 
 // NoFreeSlotError indicates that there are no free slots available.
@@ -63,314 +274,383 @@ func IsNoFreeSlotError(err error) bool {
 	return errors.As(err, &target)
 }
 
-// NewStore constructs a new Store instance for the given stack state configuration.
-// Currently only a ConfigMap-based backend is supported.
-func NewStore(stackCfg *config.StackConfig, client *kube.Client, logger *slog.Logger) (*Store, error) {
+// ErrConflict reports that a compare-and-swap update lost against a concurrent change of the record.
+var ErrConflict = errors.New("state record was modified concurrently")
+
+// errSlotTaken is returned by backend create functions when the candidate slot already has a record.
+var errSlotTaken = errors.New("slot is already taken")
+
+// NewStore constructs the state backend selected by state.backend. The configmap and crd backends
+// require a Kubernetes client; the local backend resolves state.path against projectRoot.
+func NewStore(stackCfg *config.StackConfig, client kube.ObjectClient, projectRoot string, logger *slog.Logger) (StateBackend, error) {
 	if stackCfg == nil {
 		return nil, fmt.Errorf("stack config is nil")
 	}
-
-	stateCfg := stackCfg.State
-	if stateCfg.Backend != "" && stateCfg.Backend != "configmap" {
-		return nil, fmt.Errorf("unsupported state backend %q", stateCfg.Backend)
-	}
-	if strings.TrimSpace(stateCfg.ConfigMapNamespace) == "" {
-		return nil, fmt.Errorf("state.configmapNamespace must be set for configmap backend")
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
 	}
 
+	stateCfg := stackCfg.State
 	prefix := stateCfg.ConfigMapPrefix
 	if strings.TrimSpace(prefix) == "" {
-		prefix = "codex-env-"
-	}
-
-	if client == nil {
-		return nil, fmt.Errorf("state store requires a Kubernetes client")
-	}
-
-	if logger == nil {
-		logger = slog.New(slog.NewTextHandler(nil, nil))
-	}
-
-	return &Store{
-		client:    client,
-		logger:    logger,
-		namespace: stateCfg.ConfigMapNamespace,
-		prefix:    prefix,
-	}, nil
-}
-
-// List returns all stored environment records.
-func (s *Store) List(ctx context.Context) ([]EnvRecord, error) {
-	if err := s.ensureNamespace(ctx); err != nil {
-		return nil, err
-	}
-	args := []string{"-n", s.namespace, "get", "configmap", "-o", "json"}
-	out, err := s.client.RunAndCapture(ctx, nil, args...)
-	if err != nil {
-		return nil, fmt.Errorf("list configmaps for state: %w", err)
-	}
-
-	var raw cmList
-	if err := json.Unmarshal(out, &raw); err != nil {
-		return nil, fmt.Errorf("decode configmap list: %w", err)
+		prefix = defaultRecordPrefix
 	}
 
-	var res []EnvRecord
-	for _, item := range raw.Items {
-		if item.Metadata.Name == "" || !strings.HasPrefix(item.Metadata.Name, s.prefix) {
-			continue
-		}
-		rec := EnvRecord{
-			ConfigName: item.Metadata.Name,
-			Env:        strings.TrimSpace(item.Data["env"]),
-			Namespace:  strings.TrimSpace(item.Data["namespace"]),
+	backend := strings.TrimSpace(stateCfg.Backend)
+	switch backend {
+	case "", BackendConfigMap, BackendCRD:
+		if strings.TrimSpace(stateCfg.ConfigMapNamespace) == "" {
+			return nil, fmt.Errorf("state.configmapNamespace must be set for %s backend", backendName(backend))
 		}
-		if slotStr := strings.TrimSpace(item.Data["slot"]); slotStr != "" {
-			rec.Slot, _ = strconv.Atoi(slotStr)
+		if client == nil {
+			return nil, fmt.Errorf("state store requires a Kubernetes client")
 		}
-		if issueStr := strings.TrimSpace(item.Data["issue"]); issueStr != "" {
-			rec.Issue, _ = strconv.Atoi(issueStr)
+		if backend == BackendCRD {
+			return newCRDBackend(client, logger, stateCfg.ConfigMapNamespace, prefix), nil
 		}
-		if prStr := strings.TrimSpace(item.Data["pr"]); prStr != "" {
-			rec.PR, _ = strconv.Atoi(prStr)
-		}
-		if ts := strings.TrimSpace(item.Data["createdAt"]); ts != "" {
-			if t, err := time.Parse(time.RFC3339, ts); err == nil {
-				rec.CreatedAt = t
-			}
-		}
-		res = append(res, rec)
+		return newConfigMapBackend(client, logger, stateCfg.ConfigMapNamespace, prefix), nil
+	case BackendLocal:
+		return newLocalBackend(logger, resolveStatePath(projectRoot, stateCfg.Path), prefix), nil
+	default:
+		return nil, fmt.Errorf("unsupported state backend %q (expected %s, %s or %s)", stateCfg.Backend, BackendConfigMap, BackendCRD, BackendLocal)
 	}
-	return res, nil
 }
 
-// UpdateAttributes updates issue/pr fields for a stored slot.
-func (s *Store) UpdateAttributes(ctx context.Context, slot int, issue int, pr int) error {
-	if err := s.ensureNamespace(ctx); err != nil {
-		return err
-	}
-	name := fmt.Sprintf("%s%d", s.prefix, slot)
-	patchData := map[string]string{}
-	if issue > 0 {
-		patchData["issue"] = strconv.Itoa(issue)
-	}
-	if pr > 0 {
-		patchData["pr"] = strconv.Itoa(pr)
+// backendName returns the effective backend name for messages.
+func backendName(backend string) string {
+	if backend == "" {
+		return BackendConfigMap
 	}
-	if len(patchData) == 0 {
-		return nil
-	}
-	patch := map[string]any{"data": patchData}
-	patchBytes, _ := json.Marshal(patch)
+	return backend
+}
 
-	args := []string{"-n", s.namespace, "patch", "configmap", name, "--type", "merge", "-p", string(patchBytes)}
-	if _, err := s.client.RunAndCapture(ctx, nil, args...); err != nil {
-		return fmt.Errorf("patch configmap %s: %w", name, err)
-	}
-	return nil
+// recordName returns the record name of slot.
+func recordName(prefix string, slot int) string {
+	return fmt.Sprintf("%s%d", prefix, slot)
 }
 
-// UpdateNamespace updates the namespace field for a stored slot.
-func (s *Store) UpdateNamespace(ctx context.Context, slot int, namespace string) error {
-	if err := s.ensureNamespace(ctx); err != nil {
-		return err
-	}
-	if slot <= 0 {
-		return nil
-	}
-	ns := strings.TrimSpace(namespace)
-	if ns == "" {
-		return nil
-	}
+// queueName returns the name of the slot queue object of env.
+func queueName(prefix, env string) string {
+	return prefix + "queue-" + env
+}
 
-	name := fmt.Sprintf("%s%d", s.prefix, slot)
-	patch := map[string]any{"data": map[string]string{"namespace": ns}}
-	patchBytes, _ := json.Marshal(patch)
-	args := []string{"-n", s.namespace, "patch", "configmap", name, "--type", "merge", "-p", string(patchBytes)}
-	if _, err := s.client.RunAndCapture(ctx, nil, args...); err != nil {
-		return fmt.Errorf("patch configmap %s: %w", name, err)
+// snapshotsName returns the name of the snapshot catalog object of env.
+func snapshotsName(prefix, env string) string {
+	return prefix + "snapshots-" + env
+}
+
+// slotFromName returns the slot of the record name, or false when name is not a slot record of prefix
+// (e.g. a queue or snapshot catalog object).
+func slotFromName(prefix, name string) (int, bool) {
+	rest, ok := strings.CutPrefix(name, prefix)
+	if !ok {
+		return 0, false
 	}
-	return nil
+	slot, err := strconv.Atoi(rest)
+	if err != nil || slot <= 0 {
+		return 0, false
+	}
+	return slot, true
 }
 
-// AllocateSlot reserves a new slot and returns its metadata.
-// max == 0 means unlimited slots; prefer >0 is attempted first.
-func (s *Store) AllocateSlot(
+// allocateSlot walks the slot search order of req and calls create with the record of every candidate
+// until one succeeds. create reports an existing record with errSlotTaken.
+func allocateSlot(
 	ctx context.Context,
-	stackCfg *config.StackConfig,
-	baseCtx config.TemplateContext,
-	envName string,
-	max int,
-	prefer int,
-	issue int,
-	pr int,
+	logger *slog.Logger,
+	prefix string,
+	req AllocateRequest,
+	create func(ctx context.Context, rec EnvRecord) error,
 ) (EnvRecord, error) {
 	var zero EnvRecord
 
-	if max < 0 {
-		max = 0
+	maxSlots := req.MaxSlots
+	if maxSlots < 0 {
+		maxSlots = 0
 	}
-
-	if err := s.ensureNamespace(ctx); err != nil {
-		return zero, err
+	owner := slotOwner(req)
+	phase := req.Phase
+	if phase == "" {
+		phase = PhaseAllocating
 	}
+	now := time.Now().UTC().Truncate(time.Second)
 
-	owner := strings.TrimSpace(baseCtx.EnvMap["GITHUB_RUN_ID"])
-	if owner == "" {
-		owner = "manual"
-	}
-
-	order := buildSlotOrder(max, prefer)
-	now := time.Now().UTC()
-
-	for _, slot := range order {
-		ctxSlot := baseCtx
+	for _, slot := range buildSlotOrder(maxSlots, req.Prefer) {
+		ctxSlot := req.BaseContext
 		ctxSlot.Slot = slot
 		ctxSlot.Namespace = ""
 
-		ns, err := config.ResolveNamespace(stackCfg, ctxSlot, envName)
+		ns, err := config.ResolveNamespace(req.StackConfig, ctxSlot, req.Env)
 		if err != nil {
 			return zero, err
 		}
 
-		s.logger.Info("attempting to allocate slot", "slot", slot, "env", envName, "namespace", ns)
-
-		name := fmt.Sprintf("%s%d", s.prefix, slot)
+		logger.Info("attempting to allocate slot", "slot", slot, "env", req.Env, "namespace", ns)
 
-		args := []string{
-			"-n", s.namespace,
-			"create", "configmap", name,
-			"--from-literal=slot=" + strconv.Itoa(slot),
-			"--from-literal=env=" + envName,
-			"--from-literal=namespace=" + ns,
-			"--from-literal=owner=" + owner,
-			"--from-literal=issue=" + strconv.Itoa(issue),
-			"--from-literal=pr=" + strconv.Itoa(pr),
-			"--from-literal=createdAt=" + now.Format(time.RFC3339),
+		rec := EnvRecord{
+			Slot:      slot,
+			Env:       req.Env,
+			Namespace: ns,
+			Issue:     req.Issue,
+			PR:        req.PR,
+			CreatedAt: now,
+			Name:      recordName(prefix, slot),
+
+			LastActivityAt: now,
+			Owner:          owner,
+			Phase:          phase,
 		}
-
-		_, err = s.client.RunAndCapture(ctx, nil, args...)
+		err = create(ctx, rec)
 		if err == nil {
-			return EnvRecord{
-				Slot:       slot,
-				Env:        envName,
-				Namespace:  ns,
-				Issue:      issue,
-				PR:         pr,
-				CreatedAt:  now,
-				ConfigName: name,
-			}, nil
+			return rec, nil
 		}
-
-		// Any error is treated as "slot not available"; proceed to the next candidate.
-		s.logger.Debug("slot allocation attempt failed", "slot", slot, "error", err)
+		if !errors.Is(err, errSlotTaken) {
+			return zero, fmt.Errorf("allocate slot %d: %w", slot, err)
+		}
+		logger.Debug("slot is already taken", "slot", slot)
 	}
 
-	if max > 0 {
-		return zero, &NoFreeSlotError{Max: max}
-	}
-	return zero, &NoFreeSlotError{Max: 0}
+	return zero, &NoFreeSlotError{Max: maxSlots}
 }
 
-// GarbageCollect removes stale environment records based on TTL and returns the list of removed slots.
-// When envName is non-empty, only records for that environment are considered.
-func (s *Store) GarbageCollect(ctx context.Context, envName string, ttl time.Duration) ([]EnvRecord, error) {
-	if ttl <= 0 {
-		ttl = 24 * time.Hour
-	}
-
-	if err := s.ensureNamespace(ctx); err != nil {
-		return nil, err
+// slotOwner returns the owner recorded for slots allocated or claimed by req: the GitHub Actions run id, or
+// "manual" outside of Actions.
+func slotOwner(req AllocateRequest) string {
+	if owner := strings.TrimSpace(req.BaseContext.EnvMap["GITHUB_RUN_ID"]); owner != "" {
+		return owner
 	}
+	return "manual"
+}
 
-	now := time.Now().UTC()
-
-	list, err := s.listConfigMaps(ctx)
+// collectGarbage destroys and releases the records of backend that are expired according to req. While a
+// record is destroyed, GC holds its lease so that no runner picks the slot up in the meantime.
+func collectGarbage(ctx context.Context, logger *slog.Logger, backend StateBackend, req GCRequest) ([]EnvRecord, error) {
+	records, err := backend.List(ctx)
 	if err != nil {
 		return nil, err
 	}
+	holder := req.Holder
+	if holder == "" {
+		holder = "codexctl-gc"
+	}
 
-	var removed []EnvRecord
-	for _, item := range list.Items {
-		if !strings.HasPrefix(item.Metadata.Name, s.prefix) {
+	now := time.Now().UTC()
+	var (
+		removed []EnvRecord
+		errs    []error
+	)
+	for _, rec := range records {
+		if rec.Slot <= 0 || (req.Env != "" && rec.Env != req.Env) {
 			continue
 		}
-
-		slot, err := strconv.Atoi(item.Data["slot"])
-		if err != nil || slot <= 0 {
+		reason := req.expiry(rec, now)
+		if reason == "" {
 			continue
 		}
-		envVal := item.Data["env"]
-		if envName != "" && envVal != envName {
+		if rec.Lease.Active(now) {
+			logger.Info("skipping slot with an active lease", "slot", rec.Slot, "holder", rec.Lease.Holder, "expiresAt", rec.Lease.ExpiresAt().Format(time.RFC3339))
 			continue
 		}
-
-		ns := item.Data["namespace"]
-		createdStr := item.Data["createdAt"]
-		createdAt, err := time.Parse(time.RFC3339, createdStr)
-		if err != nil {
-			createdAt = now
+		if req.Keep != nil {
+			keep, err := req.Keep(ctx, rec)
+			if err != nil {
+				logger.Warn("keeping expired slot: keep check failed", "slot", rec.Slot, "error", err)
+				continue
+			}
+			if keep != "" {
+				logger.Info("keeping expired slot", "slot", rec.Slot, "reason", keep)
+				continue
+			}
 		}
-		if now.Sub(createdAt) < ttl {
+		if req.DryRun {
+			logger.Info("would garbage-collect slot", "slot", rec.Slot, "env", rec.Env, "namespace", rec.Namespace, "reason", reason)
+			removed = append(removed, rec)
 			continue
 		}
 
-		issueVal := 0
-		if v := item.Data["issue"]; v != "" {
-			if n, err := strconv.Atoi(v); err == nil {
-				issueVal = n
+		logger.Info("garbage-collecting slot", "slot", rec.Slot, "env", rec.Env, "namespace", rec.Namespace, "record", rec.Name, "reason", reason)
+		if err := acquireGCLease(ctx, backend, req, rec, holder); err != nil {
+			var held *LeaseHeldError
+			switch {
+			case errors.As(err, &held):
+				logger.Info("skipping slot picked up by a runner", "slot", rec.Slot, "holder", held.Lease.Holder)
+				continue
+			case errors.Is(err, errGCSlotChanged), errors.Is(err, ErrRecordNotFound):
+				logger.Info("skipping slot changed since it was listed", "slot", rec.Slot, "error", err)
+				continue
 			}
+			errs = append(errs, fmt.Errorf("lease slot %d: %w", rec.Slot, err))
+			continue
 		}
-		prVal := 0
-		if v := item.Data["pr"]; v != "" {
-			if n, err := strconv.Atoi(v); err == nil {
-				prVal = n
+		if req.Destroy != nil {
+			destroyCtx, stop := renewLeaseWhile(ctx, logger, backend, rec.Slot, holder, gcLeaseDuration)
+			err := req.Destroy(destroyCtx, rec)
+			stop()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("destroy slot %d: %w", rec.Slot, err))
+				if err := ReleaseLease(context.WithoutCancel(ctx), backend, rec.Slot, holder, RecordUpdate{}); err != nil {
+					logger.Warn("failed to release gc lease", "slot", rec.Slot, "error", err)
+				}
+				continue
 			}
 		}
-
-		record := EnvRecord{
-			Slot:       slot,
-			Env:        envVal,
-			Namespace:  ns,
-			Issue:      issueVal,
-			PR:         prVal,
-			CreatedAt:  createdAt,
-			ConfigName: item.Metadata.Name,
+		// A fresh lease held by GC keeps runners away until the record is gone; a lease lost during the destroy
+		// keeps the record for its new holder.
+		if err := confirmLease(ctx, backend, rec.Slot, holder, gcLeaseDuration); err != nil {
+			errs = append(errs, fmt.Errorf("release state record %s: %w", rec.Name, err))
+			continue
 		}
-
-		s.logger.Info("garbage-collecting slot", "slot", slot, "env", envVal, "namespace", ns, "configmap", item.Metadata.Name)
-
-		delArgs := []string{"delete", "configmap", item.Metadata.Name, "-n", s.namespace, "--ignore-not-found"}
-		if err := s.client.RunRaw(ctx, nil, delArgs...); err != nil {
-			s.logger.Error("failed to delete state configmap during gc", "name", item.Metadata.Name, "error", err)
+		if err := backend.Release(ctx, rec.Slot); err != nil {
+			errs = append(errs, fmt.Errorf("release state record %s: %w", rec.Name, err))
 			continue
 		}
+		removed = append(removed, rec)
+	}
+	return removed, errors.Join(errs...)
+}
+
+// errGCSlotChanged reports that a slot selected by GC was used, claimed or moved to another phase after it was
+// listed, so that it is no longer garbage.
+var errGCSlotChanged = errors.New("slot changed since it was listed")
+
+// acquireGCLease takes the lease of the slot of listed for holder and moves it to the destroying phase. The
+// expiry is checked again on the current record in the same compare-and-swap, so that activity recorded
+// without a lease (e.g. by ensure-ready or apply), a warm pool claim or a phase change after listing keeps the
+// slot; it fails with errGCSlotChanged then and with *LeaseHeldError when a runner holds the lease.
+func acquireGCLease(ctx context.Context, backend StateBackend, req GCRequest, listed EnvRecord, holder string) error {
+	_, err := UpdateRecord(ctx, backend, listed.Slot, func(cur EnvRecord) (RecordUpdate, bool, error) {
+		now := time.Now().UTC()
+		if cur.Lease.Holder != holder && cur.Lease.Active(now) {
+			return RecordUpdate{}, false, &LeaseHeldError{Slot: cur.Slot, Lease: cur.Lease}
+		}
+		switch {
+		case !cur.CreatedAt.Equal(listed.CreatedAt):
+			return RecordUpdate{}, false, fmt.Errorf("%w: slot was reallocated", errGCSlotChanged)
+		case cur.Owner != listed.Owner:
+			return RecordUpdate{}, false, fmt.Errorf("%w: owner changed to %q", errGCSlotChanged, cur.Owner)
+		case cur.Phase != listed.Phase:
+			return RecordUpdate{}, false, fmt.Errorf("%w: phase changed to %q", errGCSlotChanged, cur.Phase)
+		case req.expiry(cur, now) == "":
+			return RecordUpdate{}, false, fmt.Errorf("%w: no longer expired", errGCSlotChanged)
+		}
+		return RecordUpdate{
+			Phase: PhaseDestroying,
+			Lease: &Lease{Holder: holder, RenewedAt: now, Duration: gcLeaseDuration},
+		}, true, nil
+	})
+	return err
+}
 
-		removed = append(removed, record)
+// patchError wraps a failed record patch, classifying optimistic concurrency failures as ErrConflict.
+func patchError(what string, err error) error {
+	if errors.Is(err, kube.ErrConflict) {
+		return fmt.Errorf("patch %s: %w: %w", what, ErrConflict, err)
 	}
+	return fmt.Errorf("patch %s: %w", what, err)
+}
 
-	return removed, nil
+// casMetadata returns the metadata patch that makes a merge patch conditional on resourceVersion.
+func casMetadata(patch map[string]any, resourceVersion string) map[string]any {
+	if resourceVersion != "" {
+		patch["metadata"] = map[string]any{"resourceVersion": resourceVersion}
+	}
+	return patch
 }
 
-// ensureNamespace verifies the state namespace exists, creating it when missing.
-func (s *Store) ensureNamespace(ctx context.Context) error {
-	if s == nil || s.client == nil {
-		return fmt.Errorf("state store is not initialized")
+// recordFields encodes a newly allocated rec as the string map stored by the configmap and local backends.
+func recordFields(rec EnvRecord) map[string]string {
+	return map[string]string{
+		"slot":      strconv.Itoa(rec.Slot),
+		"env":       rec.Env,
+		"namespace": rec.Namespace,
+		"owner":     rec.Owner,
+		"issue":     strconv.Itoa(rec.Issue),
+		"pr":        strconv.Itoa(rec.PR),
+		"createdAt": rec.CreatedAt.UTC().Format(time.RFC3339),
+		"phase":     rec.Phase,
+
+		"lastActivityAt": rec.LastActivityAt.UTC().Format(time.RFC3339),
 	}
-	if strings.TrimSpace(s.namespace) == "" {
-		return fmt.Errorf("state namespace is empty")
+}
+
+// updateFields encodes the fields set in upd like recordFields.
+func updateFields(upd RecordUpdate) map[string]string {
+	fields := map[string]string{}
+	if ns := strings.TrimSpace(upd.Namespace); ns != "" {
+		fields["namespace"] = ns
+	}
+	if upd.Issue > 0 {
+		fields["issue"] = strconv.Itoa(upd.Issue)
+	}
+	if upd.PR > 0 {
+		fields["pr"] = strconv.Itoa(upd.PR)
 	}
-	if _, err := s.client.RunAndCapture(ctx, nil, "get", "ns", s.namespace); err == nil {
-		return nil
+	if upd.ClearLinks {
+		fields["issue"], fields["pr"] = "0", "0"
 	}
-	if _, err := s.client.RunAndCapture(ctx, nil, "create", "ns", s.namespace); err != nil {
-		msg := strings.ToLower(err.Error())
-		if strings.Contains(msg, "alreadyexists") || strings.Contains(msg, "already exists") {
-			return nil
+	if !upd.CreatedAt.IsZero() {
+		fields["createdAt"] = upd.CreatedAt.UTC().Format(time.RFC3339)
+	}
+	if l := upd.Lease; l != nil {
+		fields["holder"], fields["leaseRenewedAt"], fields["leaseSeconds"] = "", "", ""
+		if l.Holder != "" {
+			fields["holder"] = l.Holder
+			fields["leaseRenewedAt"] = l.RenewedAt.UTC().Format(time.RFC3339)
+			fields["leaseSeconds"] = strconv.Itoa(int(l.Duration / time.Second))
 		}
-		return fmt.Errorf("ensure state namespace %q: %w", s.namespace, err)
 	}
-	return nil
+	if !upd.LastActivityAt.IsZero() {
+		fields["lastActivityAt"] = upd.LastActivityAt.UTC().Format(time.RFC3339)
+	}
+	for key, value := range map[string]string{
+		"owner":      upd.Owner,
+		"branch":     upd.Branch,
+		"headSha":    upd.HeadSHA,
+		"promptKind": upd.PromptKind,
+		"model":      upd.Model,
+		"phase":      upd.Phase,
+	} {
+		if v := strings.TrimSpace(value); v != "" {
+			fields[key] = v
+		}
+	}
+	return fields
+}
+
+// recordFromFields decodes a record written by recordFields; malformed numbers and timestamps stay zero.
+func recordFromFields(name string, fields map[string]string) EnvRecord {
+	rec := EnvRecord{
+		Name:       name,
+		Env:        strings.TrimSpace(fields["env"]),
+		Namespace:  strings.TrimSpace(fields["namespace"]),
+		Owner:      strings.TrimSpace(fields["owner"]),
+		Branch:     strings.TrimSpace(fields["branch"]),
+		HeadSHA:    strings.TrimSpace(fields["headSha"]),
+		PromptKind: strings.TrimSpace(fields["promptKind"]),
+		Model:      strings.TrimSpace(fields["model"]),
+		Phase:      strings.TrimSpace(fields["phase"]),
+	}
+	rec.Slot, _ = strconv.Atoi(strings.TrimSpace(fields["slot"]))
+	rec.Issue, _ = strconv.Atoi(strings.TrimSpace(fields["issue"]))
+	rec.PR, _ = strconv.Atoi(strings.TrimSpace(fields["pr"]))
+	if ts := strings.TrimSpace(fields["createdAt"]); ts != "" {
+		if t, err := time.Parse(time.RFC3339, ts); err == nil {
+			rec.CreatedAt = t
+		}
+	}
+	rec.LastActivityAt, _ = time.Parse(time.RFC3339, strings.TrimSpace(fields["lastActivityAt"]))
+	if holder := strings.TrimSpace(fields["holder"]); holder != "" {
+		rec.Lease.Holder = holder
+		rec.Lease.RenewedAt, _ = time.Parse(time.RFC3339, strings.TrimSpace(fields["leaseRenewedAt"]))
+		seconds, _ := strconv.Atoi(strings.TrimSpace(fields["leaseSeconds"]))
+		rec.Lease.Duration = time.Duration(seconds) * time.Second
+	}
+	return rec
+}
+
+// sortRecords orders records by slot.
+func sortRecords(records []EnvRecord) {
+	sort.Slice(records, func(i, j int) bool { return records[i].Slot < records[j].Slot })
 }
 
 // buildSlotOrder builds the allocation search order given limits and preference.
@@ -408,29 +688,16 @@ func buildSlotOrder(max int, prefer int) []int {
 	return order
 }
 
-type cmList struct {
-	Items []cmItem `json:"items"`
-}
-
-type cmItem struct {
-	Metadata struct {
-		Name              string `json:"name"`
-		CreationTimestamp string `json:"creationTimestamp"`
-	} `json:"metadata"`
-	Data map[string]string `json:"data"`
-}
-
-// listConfigMaps returns the raw ConfigMap list used for state storage.
-func (s *Store) listConfigMaps(ctx context.Context) (*cmList, error) {
-	args := []string{"-n", s.namespace, "get", "configmap", "-o", "json"}
-	out, err := s.client.RunAndCapture(ctx, nil, args...)
-	if err != nil {
-		return nil, fmt.Errorf("list state configmaps: %w", err)
+// ensureNamespace verifies the state namespace exists, creating it when missing.
+func ensureNamespace(ctx context.Context, client kube.ObjectClient, namespace string) error {
+	if client == nil {
+		return fmt.Errorf("state store is not initialized")
 	}
-
-	var list cmList
-	if err := json.Unmarshal(out, &list); err != nil {
-		return nil, fmt.Errorf("parse state configmaps: %w", err)
+	if strings.TrimSpace(namespace) == "" {
+		return fmt.Errorf("state namespace is empty")
 	}
-	return &list, nil
+	if _, err := client.EnsureNamespace(ctx, namespace); err != nil {
+		return fmt.Errorf("ensure state namespace %q: %w", namespace, err)
+	}
+	return nil
 }
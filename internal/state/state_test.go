@@ -0,0 +1,178 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCollectGarbage(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	activeLease := Lease{Holder: "runner-b", RenewedAt: now, Duration: time.Hour}
+	tests := []struct {
+		name string
+		// rec is stored as slot 1 before GC lists the records.
+		rec EnvRecord
+		req GCRequest
+		// race changes the record between listing and the first patch of GC.
+		race func(c *fakeCluster)
+		// destroy runs as GCRequest.Destroy.
+		destroy       func(c *fakeCluster) error
+		wantDestroyed bool
+		wantRemoved   bool
+		wantErr       bool
+		// wantHolder and wantPhase are checked on the kept record.
+		wantHolder string
+		wantPhase  string
+	}{
+		{
+			name:      "not expired",
+			rec:       testRecord(1, time.Hour),
+			req:       GCRequest{TTL: 24 * time.Hour},
+			wantPhase: PhaseIdle,
+		},
+		{
+			name:          "expired by ttl",
+			rec:           testRecord(1, 48*time.Hour),
+			req:           GCRequest{TTL: 24 * time.Hour},
+			wantDestroyed: true,
+			wantRemoved:   true,
+		},
+		{
+			name: "expired by idle time",
+			rec: func() EnvRecord {
+				rec := testRecord(1, 3*time.Hour)
+				rec.LastActivityAt = now.Add(-2 * time.Hour)
+				return rec
+			}(),
+			req:           GCRequest{Idle: time.Hour},
+			wantDestroyed: true,
+			wantRemoved:   true,
+		},
+		{
+			name:        "dry run",
+			rec:         testRecord(1, 48*time.Hour),
+			req:         GCRequest{TTL: 24 * time.Hour, DryRun: true},
+			wantRemoved: true,
+			wantPhase:   PhaseIdle,
+		},
+		{
+			name: "active lease is skipped",
+			rec: func() EnvRecord {
+				rec := testRecord(1, 48*time.Hour)
+				rec.Lease = activeLease
+				return rec
+			}(),
+			req:        GCRequest{TTL: 24 * time.Hour},
+			wantHolder: "runner-b",
+			wantPhase:  PhaseIdle,
+		},
+		{
+			name: "activity recorded after listing",
+			rec:  testRecord(1, 3*time.Hour),
+			req:  GCRequest{Idle: time.Hour},
+			race: func(c *fakeCluster) {
+				c.store(1, RecordUpdate{LastActivityAt: now})
+			},
+			wantPhase: PhaseIdle,
+		},
+		{
+			name: "claimed from the warm pool after listing",
+			rec: func() EnvRecord {
+				rec := testRecord(1, 48*time.Hour)
+				rec.Phase = PhaseWarm
+				return rec
+			}(),
+			req: GCRequest{TTL: 24 * time.Hour},
+			race: func(c *fakeCluster) {
+				c.store(1, RecordUpdate{Owner: "5678", CreatedAt: now, Phase: PhaseRunning})
+			},
+			wantPhase: PhaseRunning,
+		},
+		{
+			name: "lease taken by a runner after listing",
+			rec:  testRecord(1, 48*time.Hour),
+			req:  GCRequest{TTL: 24 * time.Hour},
+			race: func(c *fakeCluster) {
+				c.store(1, RecordUpdate{Lease: &activeLease})
+			},
+			wantHolder: "runner-b",
+			wantPhase:  PhaseIdle,
+		},
+		{
+			name: "lease lost during destroy",
+			rec:  testRecord(1, 48*time.Hour),
+			req:  GCRequest{TTL: 24 * time.Hour},
+			destroy: func(c *fakeCluster) error {
+				c.store(1, RecordUpdate{Lease: &activeLease, Phase: PhaseRunning})
+				return nil
+			},
+			wantDestroyed: true,
+			wantErr:       true,
+			wantHolder:    "runner-b",
+			wantPhase:     PhaseRunning,
+		},
+		{
+			name: "destroy fails",
+			rec:  testRecord(1, 48*time.Hour),
+			req:  GCRequest{TTL: 24 * time.Hour},
+			destroy: func(*fakeCluster) error {
+				return errors.New("namespace stuck")
+			},
+			wantDestroyed: true,
+			wantErr:       true,
+			wantPhase:     PhaseDestroying,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newFakeCluster(t)
+			c.seed(tt.rec)
+			if tt.race != nil {
+				c.beforePatch = func(n int) {
+					if n == 1 {
+						tt.race(c)
+					}
+				}
+			}
+			destroyed := false
+			req := tt.req
+			req.Destroy = func(ctx context.Context, rec EnvRecord) error {
+				destroyed = true
+				if held, _ := c.record(rec.Slot); held.Lease.Holder != "codexctl-gc" || held.Phase != PhaseDestroying {
+					t.Errorf("destroying with holder %q and phase %q, want the gc lease", held.Lease.Holder, held.Phase)
+				}
+				if tt.destroy != nil {
+					return tt.destroy(c)
+				}
+				return nil
+			}
+
+			removed, err := collectGarbage(context.Background(), testLogger(), c.backend, req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("collectGarbage error = %v, want error %v", err, tt.wantErr)
+			}
+			if destroyed != tt.wantDestroyed {
+				t.Errorf("destroyed = %v, want %v", destroyed, tt.wantDestroyed)
+			}
+			if got := len(removed) == 1 && removed[0].Slot == 1; got != tt.wantRemoved {
+				t.Errorf("removed = %+v, want slot 1 removed %v", removed, tt.wantRemoved)
+			}
+
+			stored, exists := c.record(1)
+			if wantGone := tt.wantRemoved && !req.DryRun; exists == wantGone {
+				t.Fatalf("record exists = %v, want %v", exists, !wantGone)
+			}
+			if !exists {
+				return
+			}
+			if stored.Lease.Holder != tt.wantHolder {
+				t.Errorf("stored holder = %q, want %q", stored.Lease.Holder, tt.wantHolder)
+			}
+			if stored.Phase != tt.wantPhase {
+				t.Errorf("stored phase = %q, want %q", stored.Phase, tt.wantPhase)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// IsWarm reports whether the record is a provisioned warm pool slot that can be claimed at now.
+func (r EnvRecord) IsWarm(now time.Time) bool {
+	return r.Phase == PhaseWarm && r.Issue <= 0 && r.PR <= 0 && !r.Lease.Active(now)
+}
+
+// ClaimWarm assigns the first warm pool slot of req.Env (within req.MaxSlots) to req.Issue and req.PR and
+// moves it to PhaseReady; the claiming run becomes its owner and the claim time its allocation time. It
+// reports false when no warm slot is available.
+func ClaimWarm(ctx context.Context, backend StateBackend, req AllocateRequest) (EnvRecord, bool, error) {
+	records, err := backend.List(ctx)
+	if err != nil {
+		return EnvRecord{}, false, err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, rec := range records {
+		if rec.Env != req.Env || !rec.IsWarm(now) || (req.MaxSlots > 0 && rec.Slot > req.MaxSlots) {
+			continue
+		}
+		claimed := false
+		_, err := UpdateRecord(ctx, backend, rec.Slot, func(cur EnvRecord) (RecordUpdate, bool, error) {
+			claimed = cur.Env == req.Env && cur.IsWarm(time.Now())
+			return RecordUpdate{
+				Issue:          req.Issue,
+				PR:             req.PR,
+				Owner:          slotOwner(req),
+				CreatedAt:      now,
+				LastActivityAt: now,
+				Phase:          PhaseReady,
+			}, claimed, nil
+		})
+		if errors.Is(err, ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return EnvRecord{}, false, err
+		}
+		if !claimed {
+			continue
+		}
+		rec, err = FindRecord(ctx, backend, rec.Slot)
+		if err != nil {
+			return EnvRecord{}, false, err
+		}
+		return rec, true, nil
+	}
+	return EnvRecord{}, false, nil
+}